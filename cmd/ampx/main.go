@@ -12,9 +12,12 @@ func main() {
 	cli.AddCommand(commands.NewStartCommand())
 	cli.AddCommand(commands.NewListCommand())
 	cli.AddCommand(commands.NewLogsCommand())
+	cli.AddCommand(commands.NewDiffCommand())
 	cli.AddCommand(commands.NewContinueCommand())
 	cli.AddCommand(commands.NewAbortCommand())
 	cli.AddCommand(commands.NewMergeCommand())
+	cli.AddCommand(commands.NewScheduleCommand())
+	cli.AddCommand(commands.NewCampaignCommand())
 
 	if err := cli.Execute(); err != nil {
 		os.Exit(1)
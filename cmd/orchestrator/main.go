@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/brettsmith212/ci-test-2/internal/api"
 	"github.com/brettsmith212/ci-test-2/internal/config"
 	"github.com/brettsmith212/ci-test-2/internal/database"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
+	"github.com/brettsmith212/ci-test-2/internal/scheduler"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+	"github.com/brettsmith212/ci-test-2/internal/validation"
 )
 
 func main() {
@@ -14,9 +20,27 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Accept repositories on the configured self-hosted hosts as well as the
+	// well-known ones, and local repositories only when REPO_HOSTS lists local
+	hosts, err := repourl.ParseHosts(cfg.Repository.Hosts)
+	if err != nil {
+		log.Fatalf("Invalid REPO_HOSTS: %v", err)
+	}
+	if err := hosts.AddInstance(cfg.GitLab.URL, repourl.ProviderGitLab); err != nil {
+		log.Fatalf("Invalid GITLAB_URL: %v", err)
+	}
+	if err := hosts.AddInstance(cfg.GitHub.APIURL, repourl.ProviderGitHub); err != nil {
+		log.Fatalf("Invalid GITHUB_API_URL: %v", err)
+	}
+	validation.SetRepositoryHosts(hosts)
+
 	log.Printf("Starting CI-Driven Background Agent Orchestrator...")
+	log.Printf("Repository hosts: %s", hosts)
 	log.Printf("Server will listen on %s", cfg.Server.Address)
 	log.Printf("Database path: %s", cfg.Database.Path)
+	if cfg.Server.WorkerToken == "" {
+		log.Printf("WORKER_TOKEN not set; remote workers cannot connect")
+	}
 
 	// Initialize database connection
 	if err := database.Connect(cfg.Database.Path); err != nil {
@@ -36,6 +60,12 @@ func main() {
 
 	log.Println("Database connected and migrations completed successfully")
 
+	// Enqueue tasks for recurring schedules in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interval := time.Duration(cfg.Server.ScheduleInterval) * time.Second
+	go scheduler.New(services.NewScheduleServiceDefault(), interval).Run(ctx)
+
 	// Initialize Gin server with routes
 	server := api.NewServer(cfg)
 	
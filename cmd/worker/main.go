@@ -1,14 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/brettsmith212/ci-test-2/internal/config"
 	"github.com/brettsmith212/ci-test-2/internal/database"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 	"github.com/brettsmith212/ci-test-2/internal/services"
 	"github.com/brettsmith212/ci-test-2/internal/worker"
 	"github.com/spf13/cobra"
@@ -18,9 +22,51 @@ var (
 	dbPath         string
 	workDir        string
 	ampPath        string
+	agentName      string
+	agentCommand   string
+	scriptPatches  []string
 	githubToken    string
+	githubAPIURL   string
+	githubAppID    string
+	githubKeyPath  string
+	gitlabToken    string
+	gitlabURL      string
+	bbUsername     string
+	bbToken        string
+	repoHosts      string
+	commitAuthor   string
+	committer      string
+	commitSigning  string
+	signingKey     string
+	commitTemplate string
+	coAuthors      []string
+	squashCommits  bool
 	pollInterval   time.Duration
 	maxConcurrency int
+	maxRetries     int
+	ciProvider     string
+	hooksFile      string
+	ciCommands     []string
+	ciPollInterval time.Duration
+	ciTimeout      time.Duration
+	ciStartTimeout time.Duration
+	workerID       string
+	leaseDuration  time.Duration
+	abortInterval  time.Duration
+	maxOutput      int
+	mirrorSize     int64
+	agentTimeout   time.Duration
+	cpuLimit       time.Duration
+	memoryLimit    int64
+	outputLimit    int64
+	cgroupRoot     string
+	orchestrator   string
+	workerToken    string
+	retryDelay     time.Duration
+	retryBackoff   string
+	maxRetryDelay  time.Duration
+	retryJitter    float64
+	repoLimit      int
 )
 
 func main() {
@@ -31,13 +77,61 @@ func main() {
 		Run:   runWorker,
 	}
 
+	// Environment configuration provides the defaults for the limit flags
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Define flags
-	rootCmd.Flags().StringVar(&dbPath, "db", "./orchestrator.db", "Path to the SQLite database")
+	rootCmd.Flags().StringVar(&dbPath, "db", "./orchestrator.db", "Path to the SQLite database, used when no orchestrator URL is set")
+	rootCmd.Flags().StringVar(&orchestrator, "orchestrator-url", "", "Orchestrator to take tasks from over HTTP, e.g. http://orchestrator:8080 (can also use ORCHESTRATOR_URL env var)")
+	rootCmd.Flags().StringVar(&workerToken, "worker-token", "", "Shared token for the orchestrator's worker API (can also use WORKER_TOKEN env var)")
 	rootCmd.Flags().StringVar(&workDir, "work-dir", "./work", "Working directory for repository operations")
 	rootCmd.Flags().StringVar(&ampPath, "amp-path", "", "Path to Amp CLI binary (default: search in PATH)")
+	rootCmd.Flags().StringVar(&agentName, "agent", "amp", fmt.Sprintf("Agent for tasks that do not name one (%s)", strings.Join(worker.AgentNames(), ", ")))
+	rootCmd.Flags().StringVar(&agentCommand, "agent-command", "", "Command run by the command agent; the prompt is in $AGENT_PROMPT and the file $AGENT_PROMPT_FILE ({prompt_file} in arguments)")
+	rootCmd.Flags().StringSliceVar(&scriptPatches, "scripted-patch", nil, "Patch applied by the scripted agent, one per run (repeatable)")
 	rootCmd.Flags().StringVar(&githubToken, "github-token", "", "GitHub token for API access (can also use GITHUB_TOKEN env var)")
+	rootCmd.Flags().StringVar(&githubAPIURL, "github-api-url", "", "GitHub API base URL, e.g. for GitHub Enterprise (can also use GITHUB_API_URL env var)")
+	rootCmd.Flags().StringVar(&githubAppID, "github-app-id", "", "GitHub App ID for installation token auth (can also use GITHUB_APP_ID env var)")
+	rootCmd.Flags().StringVar(&githubKeyPath, "github-private-key-path", "", "Path to the GitHub App private key (can also use GITHUB_PRIVATE_KEY_PATH env var)")
+	rootCmd.Flags().StringVar(&gitlabToken, "gitlab-token", cfg.GitLab.Token, "GitLab token for API and git access to GitLab repositories (can also use GITLAB_TOKEN env var)")
+	rootCmd.Flags().StringVar(&gitlabURL, "gitlab-url", cfg.GitLab.URL, "Instance URL of self-managed GitLab, e.g. https://gitlab.example.com; gitlab.com needs none (can also use GITLAB_URL env var)")
+	rootCmd.Flags().StringVar(&bbUsername, "bitbucket-username", cfg.Bitbucket.Username, "Bitbucket user owning the app password; leave empty when --bitbucket-token is an access token (can also use BITBUCKET_USERNAME env var)")
+	rootCmd.Flags().StringVar(&bbToken, "bitbucket-token", cfg.Bitbucket.Token, "Bitbucket Cloud app password or access token for API and git access (can also use BITBUCKET_TOKEN env var)")
+	rootCmd.Flags().StringVar(&repoHosts, "repo-hosts", cfg.Repository.Hosts, "Self-hosted repository hosts as host=provider pairs, e.g. git.example.com=gitlab,ghe.example.com=github, and local to allow paths and file:// URLs; the GitLab and GitHub API URL hosts are added automatically (can also use REPO_HOSTS env var)")
+	rootCmd.Flags().StringVar(&commitAuthor, "commit-author", cfg.Commit.Author, fmt.Sprintf("Author of the worker's commits as 'Name <email>' (default %q; can also use COMMIT_AUTHOR env var)", worker.DefaultCommitAuthor))
+	rootCmd.Flags().StringVar(&committer, "commit-committer", cfg.Commit.Committer, "Committer of the worker's commits as 'Name <email>', if not the author (can also use COMMIT_COMMITTER env var)")
+	rootCmd.Flags().StringVar(&commitSigning, "commit-signing", cfg.Commit.Signing, "Sign commits with ssh or gpg; empty leaves them unsigned (can also use COMMIT_SIGNING env var)")
+	rootCmd.Flags().StringVar(&signingKey, "commit-signing-key", cfg.Commit.SigningKey, "Path of the SSH private key, or ID of the GPG key in the worker's keyring, that signs commits (can also use COMMIT_SIGNING_KEY env var)")
+	rootCmd.Flags().StringVar(&commitTemplate, "commit-template", cfg.Commit.Template, fmt.Sprintf("Go template of commit messages with .TaskID, .Attempt, .Subject, .Prompt, .Summary, .Repo and .Branch; Task-ID and Co-authored-by trailers are appended (default %q; can also use COMMIT_TEMPLATE env var)", worker.DefaultCommitTemplate))
+	rootCmd.Flags().StringSliceVar(&coAuthors, "co-author", splitList(cfg.Commit.CoAuthors), "Co-author credited in a Co-authored-by trailer as 'Name <email>' (repeatable; can also use COMMIT_CO_AUTHORS env var, comma-separated)")
+	rootCmd.Flags().BoolVar(&squashCommits, "squash", cfg.Commit.Squash, "Squash a task's commits into one before opening its pull request (can also use COMMIT_SQUASH env var)")
 	rootCmd.Flags().DurationVar(&pollInterval, "poll-interval", 10*time.Second, "Interval for polling new tasks")
 	rootCmd.Flags().IntVar(&maxConcurrency, "max-concurrency", 3, "Maximum number of concurrent tasks")
+	rootCmd.Flags().IntVar(&repoLimit, "repo-concurrency", cfg.Worker.RepoConcurrency, "Maximum number of tasks on the same repository running at once across all workers, 0 for no limit; set on the orchestrator when using --orchestrator-url (can also use WORKER_REPO_CONCURRENCY env var)")
+	rootCmd.Flags().IntVar(&maxRetries, "max-retries", cfg.Worker.MaxRetries, "Maximum number of Amp attempts before a task needs review, for tasks that do not set their own (can also use WORKER_MAX_RETRIES env var)")
+	rootCmd.Flags().DurationVar(&retryDelay, "retry-delay", time.Duration(cfg.Worker.RetryDelay)*time.Second, "Delay before retrying a task whose CI failed, 0 to retry at once (can also use WORKER_RETRY_DELAY env var, in seconds)")
+	rootCmd.Flags().StringVar(&retryBackoff, "retry-backoff", cfg.Worker.RetryBackoff, "How the retry delay grows with each attempt: fixed or exponential (can also use WORKER_RETRY_BACKOFF env var)")
+	rootCmd.Flags().DurationVar(&maxRetryDelay, "max-retry-delay", time.Duration(cfg.Worker.MaxRetryDelay)*time.Second, "Upper bound of the retry delay (can also use WORKER_MAX_RETRY_DELAY env var, in seconds)")
+	rootCmd.Flags().Float64Var(&retryJitter, "retry-jitter", cfg.Worker.RetryJitter, "Fraction by which retry delays are randomly spread, e.g. 0.2 for ±20% (can also use WORKER_RETRY_JITTER env var)")
+	rootCmd.Flags().StringVar(&ciProvider, "ci-provider", cfg.Worker.CIProvider, fmt.Sprintf("CI provider that verifies pushed commits (%s, %s, %s, %s, %s; default: the CI of the task's code host when access to it is configured) (can also use WORKER_CI_PROVIDER env var)", worker.CIProviderGitHubActions, worker.CIProviderGitLabCI, worker.CIProviderBitbucketPipelines, worker.CIProviderLocal, worker.CIProviderNone))
+	rootCmd.Flags().StringArrayVar(&ciCommands, "ci-command", nil, "Command run through sh -c in the task workspace by the local CI provider, e.g. \"go test ./...\" (repeatable)")
+	rootCmd.Flags().StringVar(&hooksFile, "hooks-file", cfg.Worker.HooksFile, "JSON file of per-repository setup and verification commands, for repositories without their own .ampx.json (can also use WORKER_HOOKS_FILE env var)")
+	rootCmd.Flags().DurationVar(&ciPollInterval, "ci-poll-interval", 15*time.Second, "Interval for polling CI status")
+	rootCmd.Flags().DurationVar(&ciTimeout, "ci-timeout", 30*time.Minute, "Maximum time to wait for CI on a pushed commit")
+	rootCmd.Flags().DurationVar(&ciStartTimeout, "ci-start-timeout", 5*time.Minute, "How long a pushed commit may go without CI runs on the code host before the repository is treated as having no CI")
+	rootCmd.Flags().StringVar(&workerID, "worker-id", "", "Identifier used when leasing tasks (default: hostname-pid)")
+	rootCmd.Flags().DurationVar(&leaseDuration, "lease-duration", 2*time.Minute, "How long a claimed task stays leased without a heartbeat")
+	rootCmd.Flags().IntVar(&maxOutput, "max-stored-output", 1<<20, "Maximum bytes of Amp output stored in task logs per attempt")
+	rootCmd.Flags().Int64Var(&mirrorSize, "mirror-cache-size", 10<<30, "Maximum bytes of repository mirrors kept in the work directory before the least recently used are evicted")
+	rootCmd.Flags().DurationVar(&abortInterval, "abort-check-interval", 5*time.Second, "How often running tasks are checked for an abort")
+	rootCmd.Flags().DurationVar(&agentTimeout, "agent-timeout", time.Duration(cfg.Amp.Timeout)*time.Second, "Maximum wall-clock time of one agent run (can also use AMP_TIMEOUT env var, in seconds)")
+	rootCmd.Flags().DurationVar(&cpuLimit, "cpu-limit", time.Duration(cfg.Worker.CPULimit)*time.Second, "Maximum CPU time of one agent run, 0 for no limit (can also use WORKER_CPU_LIMIT env var, in seconds)")
+	rootCmd.Flags().Int64Var(&memoryLimit, "memory-limit", int64(cfg.Worker.MemoryLimit), "Maximum memory of one agent run in bytes, 0 for no limit (can also use WORKER_MEMORY_LIMIT env var)")
+	rootCmd.Flags().Int64Var(&outputLimit, "output-limit", int64(cfg.Worker.OutputLimit), "Maximum bytes of output of one agent run, 0 for no limit (can also use WORKER_OUTPUT_LIMIT env var)")
+	rootCmd.Flags().StringVar(&cgroupRoot, "cgroup-root", cfg.Worker.CgroupRoot, "Writable cgroup v2 directory for per-run cgroups; without it CPU and memory limits use rlimits (can also use WORKER_CGROUP_ROOT env var)")
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
@@ -51,6 +145,15 @@ func runWorker(cmd *cobra.Command, args []string) {
 	if githubToken == "" {
 		githubToken = os.Getenv("GITHUB_TOKEN")
 	}
+	if githubAPIURL == "" {
+		githubAPIURL = os.Getenv("GITHUB_API_URL")
+	}
+	if githubAppID == "" {
+		githubAppID = os.Getenv("GITHUB_APP_ID")
+	}
+	if githubKeyPath == "" {
+		githubKeyPath = os.Getenv("GITHUB_PRIVATE_KEY_PATH")
+	}
 
 	// Create absolute path for work directory
 	workDirAbs, err := filepath.Abs(workDir)
@@ -58,14 +161,30 @@ func runWorker(cmd *cobra.Command, args []string) {
 		log.Fatalf("Failed to resolve work directory: %v", err)
 	}
 
-	// Initialize database connection
-	log.Printf("Connecting to database: %s", dbPath)
-	if err := database.Connect(dbPath); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	if orchestrator == "" {
+		orchestrator = os.Getenv("ORCHESTRATOR_URL")
+	}
+	if workerToken == "" {
+		workerToken = os.Getenv("WORKER_TOKEN")
 	}
 
-	// Initialize task service
-	taskSvc := services.NewTaskServiceDefault()
+	// Take tasks from the orchestrator over HTTP, or straight from its database
+	var taskSvc worker.TaskService
+	if orchestrator != "" {
+		if workerToken == "" {
+			log.Fatalf("A worker token is required with --orchestrator-url")
+		}
+		log.Printf("Connecting to orchestrator: %s", orchestrator)
+		taskSvc = worker.NewHTTPTaskService(orchestrator, workerToken)
+	} else {
+		log.Printf("Connecting to database: %s", dbPath)
+		if err := database.Connect(dbPath); err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		dbTaskSvc := services.NewTaskServiceDefault()
+		dbTaskSvc.SetRepoConcurrency(repoLimit)
+		taskSvc = dbTaskSvc
+	}
 
 	// Create worker configuration
 	config := &worker.Config{
@@ -73,8 +192,67 @@ func runWorker(cmd *cobra.Command, args []string) {
 		MaxConcurrency: maxConcurrency,
 		WorkDir:        workDirAbs,
 		AmpPath:        ampPath,
+		Agent:          agentName,
+		AgentCommand:   agentCommand,
 		GitHubToken:    githubToken,
+		GitHubAPIURL:   githubAPIURL,
 		DatabasePath:   dbPath,
+		MaxRetries:     maxRetries,
+		RetryDelay:     retryDelay,
+		RetryBackoff:   retryBackoff,
+		MaxRetryDelay:  maxRetryDelay,
+		RetryJitter:    retryJitter,
+		CIProvider:     ciProvider,
+		CICommands:     ciCommands,
+		CIPollInterval: ciPollInterval,
+		CITimeout:      ciTimeout,
+		CIStartTimeout: ciStartTimeout,
+		WorkerID:       workerID,
+		LeaseDuration:  leaseDuration,
+
+		AbortCheckInterval: abortInterval,
+		MaxStoredOutput:    maxOutput,
+		MirrorCacheSize:    mirrorSize,
+		ScriptedPatches:    scriptPatches,
+
+		AgentTimeout: agentTimeout,
+		CPULimit:     cpuLimit,
+		MemoryLimit:  memoryLimit,
+		OutputLimit:  outputLimit,
+		CgroupRoot:   cgroupRoot,
+
+		GitHubAppID:          githubAppID,
+		GitHubPrivateKeyPath: githubKeyPath,
+		GitLabToken:          gitlabToken,
+		GitLabURL:            gitlabURL,
+		BitbucketUsername:    bbUsername,
+		BitbucketToken:       bbToken,
+
+		Commit: worker.CommitSettings{
+			Author:     commitAuthor,
+			Committer:  committer,
+			Signing:    commitSigning,
+			SigningKey: signingKey,
+			Template:   commitTemplate,
+			CoAuthors:  coAuthors,
+			Squash:     &squashCommits,
+		},
+	}
+
+	// Allow repositories on self-hosted hosts
+	hosts, err := repourl.ParseHosts(repoHosts)
+	if err != nil {
+		log.Fatalf("Invalid repository hosts: %v", err)
+	}
+	config.RepoHosts = hosts
+
+	// Load the setup and verification commands of each repository
+	if hooksFile != "" {
+		hooks, err := worker.LoadRepoHooks(hooksFile)
+		if err != nil {
+			log.Fatalf("Failed to load hooks: %v", err)
+		}
+		config.RepoHooks = hooks
 	}
 
 	// Validate configuration
@@ -100,11 +278,51 @@ func runWorker(cmd *cobra.Command, args []string) {
 
 	// Start worker
 	log.Printf("Worker configuration:")
+	log.Printf("  Worker ID: %s", config.WorkerID)
+	log.Printf("  Lease duration: %v", config.LeaseDuration)
 	log.Printf("  Poll interval: %v", config.PollInterval)
 	log.Printf("  Max concurrency: %d", config.MaxConcurrency)
 	log.Printf("  Work directory: %s", config.WorkDir)
+	log.Printf("  Mirror cache size: %d bytes", config.MirrorCacheSize)
+	log.Printf("  Agent: %s", config.Agent)
 	log.Printf("  Amp path: %s", config.AmpPath)
+	log.Printf("  Max retries: %d", config.MaxRetries)
+	log.Printf("  Retry backoff: %s from %v (max %v, jitter %.0f%%)", config.RetryBackoff, config.RetryDelay, config.MaxRetryDelay, config.RetryJitter*100)
+	log.Printf("  Agent timeout: %v", config.AgentTimeout)
+	if config.CPULimit > 0 || config.MemoryLimit > 0 || config.OutputLimit > 0 {
+		log.Printf("  Limits: cpu=%v memory=%d output=%d (cgroup root: %q)", config.CPULimit, config.MemoryLimit, config.OutputLimit, config.CgroupRoot)
+	}
+	if config.CIProvider != "" {
+		log.Printf("  CI provider: %s", config.CIProvider)
+	}
+	if hooksFile != "" {
+		log.Printf("  Hooks file: %s (%d repositories)", hooksFile, len(config.RepoHooks))
+	}
 	log.Printf("  GitHub token: %s", maskToken(config.GitHubToken))
+	if config.GitHubAppID != "" {
+		log.Printf("  GitHub App ID: %s", config.GitHubAppID)
+	}
+	if config.GitLabToken != "" {
+		log.Printf("  GitLab token: %s", maskToken(config.GitLabToken))
+	}
+	if config.GitLabURL != "" {
+		log.Printf("  GitLab URL: %s", config.GitLabURL)
+	}
+	if repoHosts != "" {
+		log.Printf("  Repository hosts: %s", repoHosts)
+	}
+	if config.Commit.Author != "" || config.Commit.Committer != "" {
+		log.Printf("  Commit author: %q (committer: %q)", config.Commit.Author, config.Commit.Committer)
+	}
+	if config.Commit.Signing != "" {
+		log.Printf("  Commit signing: %s (key: %s)", config.Commit.Signing, config.Commit.SigningKey)
+	}
+	if squashCommits {
+		log.Printf("  Squashing commits before pull requests")
+	}
+	if config.BitbucketToken != "" {
+		log.Printf("  Bitbucket token: %s (user: %q)", maskToken(config.BitbucketToken), config.BitbucketUsername)
+	}
 
 	if err := w.Start(); err != nil {
 		log.Fatalf("Worker failed: %v", err)
@@ -114,13 +332,57 @@ func runWorker(cmd *cobra.Command, args []string) {
 }
 
 func validateConfig(config *worker.Config) error {
-	// Check if Amp is available
-	ampOps := worker.NewAmpOperations(config.AmpPath)
-	if err := ampOps.CheckInstallation(); err != nil {
-		log.Printf("Warning: Amp CLI check failed: %v", err)
+	// Check that the default agent is configured and available
+	agent, err := worker.NewAgent(config.Agent, config)
+	if err != nil {
+		return err
+	}
+	if err := agent.CheckInstallation(); err != nil {
+		log.Printf("Warning: %s agent check failed: %v", config.Agent, err)
 		log.Println("Worker will continue but may fail when processing tasks")
 	} else {
-		log.Println("Amp CLI installation verified")
+		log.Printf("%s agent installation verified", config.Agent)
+	}
+
+	if config.RetryBackoff != worker.BackoffFixed && config.RetryBackoff != worker.BackoffExponential {
+		return fmt.Errorf("retry-backoff must be %q or %q, got %q", worker.BackoffFixed, worker.BackoffExponential, config.RetryBackoff)
+	}
+	if config.RetryJitter < 0 || config.RetryJitter > 1 {
+		return fmt.Errorf("retry-jitter must be between 0 and 1, got %v", config.RetryJitter)
+	}
+
+	// Check commit settings up front rather than on every task's first commit
+	if err := config.Commit.Validate(); err != nil {
+		return err
+	}
+	if config.Commit.Signing == worker.CommitSigningSSH {
+		if _, err := os.Stat(config.Commit.SigningKey); err != nil {
+			return fmt.Errorf("commit signing key: %w", err)
+		}
+	}
+
+	// A GitHub App needs its private key to mint installation tokens
+	if config.GitHubAppID != "" && config.GitHubPrivateKeyPath == "" {
+		return fmt.Errorf("github-private-key-path is required when github-app-id is set")
+	}
+
+	// Check the CI provider, with access to the code host it watches standing
+	// in for the real client
+	var github worker.GitHubOperations
+	switch {
+	case config.CIProvider == worker.CIProviderGitLabCI:
+		if config.GitLabToken != "" {
+			github = worker.NewGitLabOperations(config.GitLabToken, config.GitLabURL)
+		}
+	case config.CIProvider == worker.CIProviderBitbucketPipelines:
+		if config.BitbucketToken != "" {
+			github = worker.NewBitbucketOperations(config.BitbucketUsername, config.BitbucketToken)
+		}
+	case config.GitHubToken != "" || config.GitHubAppID != "":
+		github = worker.NewGitHubOperationsWithBaseURL(config.GitHubToken, config.GitHubAPIURL)
+	}
+	if _, err := worker.NewCIProvider(config.CIProvider, config, github); err != nil {
+		return err
 	}
 
 	// Validate work directory
@@ -141,3 +403,14 @@ func maskToken(token string) string {
 	}
 	return token[:4] + "***" + token[len(token)-4:]
 }
+
+// splitList splits a comma-separated environment variable, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
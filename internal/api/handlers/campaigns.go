@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+	"github.com/brettsmith212/ci-test-2/internal/validation"
+)
+
+// CampaignHandler handles requests for campaigns, which run one prompt
+// across many repositories
+type CampaignHandler struct {
+	campaignService *services.CampaignService
+}
+
+// NewCampaignHandler creates a new CampaignHandler instance
+func NewCampaignHandler() *CampaignHandler {
+	return &CampaignHandler{
+		campaignService: services.NewCampaignServiceDefault(),
+	}
+}
+
+// SetMaxRetries sets the attempt budget of campaign tasks that do not set their own
+func (h *CampaignHandler) SetMaxRetries(maxRetries int) {
+	h.campaignService.SetMaxRetries(maxRetries)
+}
+
+// CreateCampaign handles POST /campaigns
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req CreateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		validationErrs := validation.TranslateValidationErrors(err)
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Request validation failed",
+			Fields:    map[string]string{"validation": validationErrs.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	// Every task of the campaign is held to the rules of a task created directly
+	fields := map[string]string{}
+	if len(req.Repos) == 0 && req.Pattern == "" {
+		fields["repos"] = "a list of repositories or a pattern is required"
+	}
+	for i, repo := range req.Repos {
+		if err := validation.ValidateRepositoryURL(repo); err != nil {
+			fields[fmt.Sprintf("repos[%d]", i)] = err.Error()
+		}
+	}
+	if err := validation.ValidatePromptContent(req.Prompt); err != nil {
+		fields["prompt"] = err.Error()
+	}
+	if req.Agent != "" {
+		if err := validation.ValidateAgentName(req.Agent); err != nil {
+			fields["agent"] = err.Error()
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Request validation failed",
+			Fields:    fields,
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	campaign, tasks, err := h.campaignService.CreateCampaign(req.Prompt, req.Repos, services.CampaignOptions{
+		Name:    req.Name,
+		Pattern: req.Pattern,
+		Task: services.CreateTaskOptions{
+			Agent:      req.Agent,
+			MaxRetries: req.MaxRetries,
+			Priority:   req.Priority,
+		},
+	})
+	if errors.Is(err, services.ErrInvalidCampaign) {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid campaign",
+			Fields:    map[string]string{"repos": err.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "creation_error",
+			Message:   "Failed to create campaign",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	progress := services.CampaignProgress{Total: len(tasks), Counts: map[models.TaskStatus]int{}}
+	for _, task := range tasks {
+		progress.Counts[task.Status]++
+	}
+
+	c.JSON(http.StatusCreated, ToCampaignResponse(campaign, progress, tasks))
+}
+
+// ListCampaigns handles GET /campaigns
+func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
+	campaigns, err := h.campaignService.ListCampaigns()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve campaigns",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	responses := make([]CampaignResponse, 0, len(campaigns))
+	for i := range campaigns {
+		progress, err := h.campaignService.GetCampaignProgress(campaigns[i].ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:     "retrieval_error",
+				Message:   "Failed to retrieve campaign progress",
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+		responses = append(responses, ToCampaignResponse(&campaigns[i], progress, nil))
+	}
+
+	c.JSON(http.StatusOK, CampaignListResponse{
+		Campaigns: responses,
+		Total:     len(responses),
+	})
+}
+
+// GetCampaign handles GET /campaigns/{id}, including the campaign's progress and tasks
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	id := c.Param("id")
+	campaign, err := h.campaignService.GetCampaign(id)
+	if err != nil {
+		h.campaignError(c, err, "retrieval_error", "Failed to retrieve campaign")
+		return
+	}
+
+	progress, err := h.campaignService.GetCampaignProgress(id)
+	if err != nil {
+		h.campaignError(c, err, "retrieval_error", "Failed to retrieve campaign progress")
+		return
+	}
+	tasks, err := h.campaignService.GetCampaignTasks(id)
+	if err != nil {
+		h.campaignError(c, err, "retrieval_error", "Failed to retrieve campaign tasks")
+		return
+	}
+
+	c.JSON(http.StatusOK, ToCampaignResponse(campaign, progress, tasks))
+}
+
+// UpdateCampaign handles PATCH /campaigns/{id}, continuing or aborting the
+// campaign's tasks in bulk
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	var req UpdateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid request payload",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	if req.Action == "continue" && req.Prompt != "" {
+		if err := validation.ValidatePromptContent(req.Prompt); err != nil {
+			c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+				Error:     "validation_error",
+				Message:   "Invalid prompt",
+				Fields:    map[string]string{"prompt": err.Error()},
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+	}
+
+	updated, skipped, failed, err := h.campaignService.UpdateCampaignTasks(c.Param("id"), req.Action, req.Prompt)
+	if err != nil {
+		h.campaignError(c, err, "update_error", "Failed to update campaign tasks")
+		return
+	}
+
+	if updated == nil {
+		updated = []string{}
+	}
+	if skipped == nil {
+		skipped = []string{}
+	}
+	response := CampaignActionResponse{
+		Action:  req.Action,
+		Updated: updated,
+		Skipped: skipped,
+	}
+	if len(failed) > 0 {
+		response.Failed = make(map[string]string, len(failed))
+		for taskID, err := range failed {
+			response.Failed[taskID] = err.Error()
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// campaignError responds with not_found for a missing campaign, and with
+// code and message otherwise
+func (h *CampaignHandler) campaignError(c *gin.Context, err error, code, message string) {
+	if err.Error() == "campaign not found" {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:     "not_found",
+			Message:   "Campaign not found",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error:     code,
+		Message:   message,
+		RequestID: c.GetString("request_id"),
+	})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCampaignTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	campaignHandler := NewCampaignHandler()
+
+	router.Use(func(c *gin.Context) {
+		c.Set("request_id", "test-request-123")
+		c.Next()
+	})
+
+	v1 := router.Group("/api/v1")
+	{
+		v1.POST("/campaigns", campaignHandler.CreateCampaign)
+		v1.GET("/campaigns", campaignHandler.ListCampaigns)
+		v1.GET("/campaigns/:id", campaignHandler.GetCampaign)
+		v1.PATCH("/campaigns/:id", campaignHandler.UpdateCampaign)
+	}
+
+	return router
+}
+
+func TestCreateCampaign(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupCampaignTestServer()
+
+	tests := []struct {
+		name           string
+		payload        interface{}
+		expectedStatus int
+		expectedField  string
+	}{
+		{
+			name: "valid campaign",
+			payload: CreateCampaignRequest{
+				Name:     "go-bump",
+				Prompt:   "Bump the Go toolchain to 1.22",
+				Repos:    []string{"https://github.com/acme/api.git", "https://github.com/acme/web.git"},
+				Priority: 2,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "invalid repository",
+			payload: CreateCampaignRequest{
+				Prompt: "Bump the Go toolchain to 1.22",
+				Repos:  []string{"https://github.com/acme/api.git", "not-a-repo"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "repos[1]",
+		},
+		{
+			name: "no repositories",
+			payload: CreateCampaignRequest{
+				Prompt: "Bump the Go toolchain to 1.22",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "repos",
+		},
+		{
+			name: "pattern matching nothing",
+			payload: CreateCampaignRequest{
+				Prompt:  "Bump the Go toolchain to 1.22",
+				Pattern: "https://gitlab.com/nobody/*",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "repos",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doWorkerRequest(router, "POST", "/api/v1/campaigns", tt.payload)
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedStatus == http.StatusCreated {
+				var campaign CampaignResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &campaign))
+				assert.NotEmpty(t, campaign.ID)
+				assert.Len(t, campaign.Tasks, 2)
+				assert.Equal(t, 2, campaign.Progress.Total)
+				assert.Equal(t, 2, campaign.Progress.Queued)
+				for _, task := range campaign.Tasks {
+					assert.Equal(t, campaign.ID, task.CampaignID)
+				}
+				return
+			}
+
+			var response ValidationErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Contains(t, response.Fields, tt.expectedField)
+		})
+	}
+}
+
+func TestCampaignLifecycle(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupCampaignTestServer()
+
+	w := doWorkerRequest(router, "POST", "/api/v1/campaigns", CreateCampaignRequest{
+		Prompt: "Replace the deprecated logger",
+		Repos:  []string{"https://github.com/acme/api.git", "https://github.com/acme/web.git"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created CampaignResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = doWorkerRequest(router, "GET", "/api/v1/campaigns", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list CampaignListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Total)
+	assert.Equal(t, 2, list.Campaigns[0].Progress.Total)
+
+	// Nothing has failed yet, so there is nothing to continue
+	w = doWorkerRequest(router, "PATCH", "/api/v1/campaigns/"+created.ID, UpdateCampaignRequest{Action: "continue"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var result CampaignActionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Empty(t, result.Updated)
+	assert.Len(t, result.Skipped, 2)
+
+	w = doWorkerRequest(router, "PATCH", "/api/v1/campaigns/"+created.ID, UpdateCampaignRequest{Action: "abort"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Len(t, result.Updated, 2)
+
+	w = doWorkerRequest(router, "GET", "/api/v1/campaigns/"+created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var campaign CampaignResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &campaign))
+	assert.Equal(t, 2, campaign.Progress.Finished)
+	assert.Equal(t, 2, campaign.Progress.Aborted)
+	assert.Len(t, campaign.Tasks, 2)
+
+	w = doWorkerRequest(router, "PATCH", "/api/v1/campaigns/"+created.ID, map[string]interface{}{"action": "merge"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doWorkerRequest(router, "GET", "/api/v1/campaigns/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doWorkerRequest(router, "PATCH", "/api/v1/campaigns/missing", UpdateCampaignRequest{Action: "abort"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/brettsmith212/ci-test-2/internal/services"
+	"github.com/brettsmith212/ci-test-2/internal/validation"
+)
+
+// ScheduleHandler handles requests for recurring tasks
+type ScheduleHandler struct {
+	scheduleService *services.ScheduleService
+}
+
+// NewScheduleHandler creates a new ScheduleHandler instance
+func NewScheduleHandler() *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: services.NewScheduleServiceDefault(),
+	}
+}
+
+// CreateSchedule handles POST /schedules
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req CreateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		validationErrs := validation.TranslateValidationErrors(err)
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Request validation failed",
+			Fields:    map[string]string{"validation": validationErrs.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	// Scheduled tasks are held to the same rules as tasks created directly
+	fields := map[string]string{}
+	if err := validation.ValidateRepositoryURL(req.Repo); err != nil {
+		fields["repo"] = err.Error()
+	}
+	if err := validation.ValidatePromptContent(req.Prompt); err != nil {
+		fields["prompt"] = err.Error()
+	}
+	if req.Agent != "" {
+		if err := validation.ValidateAgentName(req.Agent); err != nil {
+			fields["agent"] = err.Error()
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Request validation failed",
+			Fields:    fields,
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	schedule, err := h.scheduleService.CreateSchedule(req.Cron, req.Repo, req.Prompt, services.ScheduleOptions{
+		Name:     req.Name,
+		Timezone: req.Timezone,
+		Task: services.CreateTaskOptions{
+			Agent:      req.Agent,
+			MaxRetries: req.MaxRetries,
+			Priority:   req.Priority,
+		},
+	})
+	if errors.Is(err, services.ErrInvalidSchedule) {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid schedule",
+			Fields:    map[string]string{"cron": err.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "creation_error",
+			Message:   "Failed to create schedule",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules handles GET /schedules
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	schedules, err := h.scheduleService.ListSchedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve schedules",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScheduleListResponse{
+		Schedules: schedules,
+		Total:     len(schedules),
+	})
+}
+
+// GetSchedule handles GET /schedules/{id}
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.scheduleService.GetSchedule(c.Param("id"))
+	if err != nil {
+		h.scheduleError(c, err, "retrieval_error", "Failed to retrieve schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule handles PATCH /schedules/{id}, pausing or resuming the schedule
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	var req UpdateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid request payload",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	schedule, err := h.scheduleService.SetPaused(c.Param("id"), *req.Paused)
+	if err != nil {
+		h.scheduleError(c, err, "update_error", "Failed to update schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule handles DELETE /schedules/{id}
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	if err := h.scheduleService.DeleteSchedule(c.Param("id")); err != nil {
+		h.scheduleError(c, err, "delete_error", "Failed to delete schedule")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// scheduleError responds with not_found for a missing schedule, and with
+// code and message otherwise
+func (h *ScheduleHandler) scheduleError(c *gin.Context, err error, code, message string) {
+	if err.Error() == "schedule not found" {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:     "not_found",
+			Message:   "Schedule not found",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error:     code,
+		Message:   message,
+		RequestID: c.GetString("request_id"),
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func setupScheduleTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	scheduleHandler := NewScheduleHandler()
+
+	router.Use(func(c *gin.Context) {
+		c.Set("request_id", "test-request-123")
+		c.Next()
+	})
+
+	v1 := router.Group("/api/v1")
+	{
+		v1.POST("/schedules", scheduleHandler.CreateSchedule)
+		v1.GET("/schedules", scheduleHandler.ListSchedules)
+		v1.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		v1.PATCH("/schedules/:id", scheduleHandler.UpdateSchedule)
+		v1.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+	}
+
+	return router
+}
+
+func TestCreateSchedule(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupScheduleTestServer()
+
+	tests := []struct {
+		name           string
+		payload        interface{}
+		expectedStatus int
+		expectedField  string
+	}{
+		{
+			name: "valid schedule",
+			payload: CreateScheduleRequest{
+				Name:     "deps",
+				Cron:     "0 3 * * mon-fri",
+				Timezone: "Europe/Berlin",
+				Repo:     "https://github.com/acme/api.git",
+				Prompt:   "Bump minor dependencies and fix the build",
+				Priority: 3,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "invalid cron",
+			payload: CreateScheduleRequest{
+				Cron:   "every night",
+				Repo:   "https://github.com/acme/api.git",
+				Prompt: "Bump minor dependencies",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "cron",
+		},
+		{
+			name: "unknown time zone",
+			payload: CreateScheduleRequest{
+				Cron:     "@daily",
+				Timezone: "Nowhere/Special",
+				Repo:     "https://github.com/acme/api.git",
+				Prompt:   "Bump minor dependencies",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "cron",
+		},
+		{
+			name: "invalid repository",
+			payload: CreateScheduleRequest{
+				Cron:   "@daily",
+				Repo:   "not-a-repo",
+				Prompt: "Bump minor dependencies",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "repo",
+		},
+		{
+			name:           "missing cron",
+			payload:        map[string]interface{}{"repo": "https://github.com/acme/api.git", "prompt": "Bump minor dependencies"},
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "validation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doWorkerRequest(router, "POST", "/api/v1/schedules", tt.payload)
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedStatus == http.StatusCreated {
+				var schedule models.Schedule
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+				assert.NotEmpty(t, schedule.ID)
+				assert.Equal(t, "Europe/Berlin", schedule.Timezone)
+				assert.Equal(t, 3, schedule.Priority)
+				assert.NotNil(t, schedule.NextRunAt)
+				return
+			}
+
+			var response ValidationErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Contains(t, response.Fields, tt.expectedField)
+		})
+	}
+}
+
+func TestScheduleLifecycle(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupScheduleTestServer()
+
+	w := doWorkerRequest(router, "POST", "/api/v1/schedules", CreateScheduleRequest{
+		Cron:   "@hourly",
+		Repo:   "https://github.com/acme/api.git",
+		Prompt: "Regenerate mocks",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created models.Schedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = doWorkerRequest(router, "GET", "/api/v1/schedules", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list ScheduleListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.Total)
+
+	// Pausing needs an explicit paused value
+	w = doWorkerRequest(router, "PATCH", "/api/v1/schedules/"+created.ID, map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doWorkerRequest(router, "PATCH", "/api/v1/schedules/"+created.ID, map[string]interface{}{"paused": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	var paused models.Schedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &paused))
+	assert.True(t, paused.Paused)
+
+	w = doWorkerRequest(router, "DELETE", "/api/v1/schedules/"+created.ID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doWorkerRequest(router, "GET", "/api/v1/schedules/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doWorkerRequest(router, "PATCH", "/api/v1/schedules/"+created.ID, map[string]interface{}{"paused": false})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -24,6 +25,11 @@ func NewTaskHandler() *TaskHandler {
 	}
 }
 
+// SetMaxRetries sets the attempt budget of tasks that do not set their own
+func (h *TaskHandler) SetMaxRetries(maxRetries int) {
+	h.taskService.SetMaxRetries(maxRetries)
+}
+
 // CreateTask handles POST /tasks
 func (h *TaskHandler) CreateTask(c *gin.Context) {
 	var req CreateTaskRequest
@@ -60,8 +66,36 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
+	if req.Agent != "" {
+		if err := validation.ValidateAgentName(req.Agent); err != nil {
+			c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+				Error:     "validation_error",
+				Message:   "Invalid agent",
+				Fields:    map[string]string{"agent": err.Error()},
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+	}
+
 	// Create the task
-	task, err := h.taskService.CreateTask(req.Repo, req.Prompt)
+	task, err := h.taskService.CreateTaskWithOptions(req.Repo, req.Prompt, services.CreateTaskOptions{
+		Agent:      req.Agent,
+		MaxRetries: req.MaxRetries,
+		Priority:   req.Priority,
+
+		DependsOn:     req.DependsOn,
+		StackOnParent: req.StackOnParent,
+	})
+	if errors.Is(err, services.ErrInvalidDependency) {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid dependency",
+			Fields:    map[string]string{"depends_on": err.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:     "creation_error",
@@ -73,8 +107,10 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 
 	// Return success response
 	response := CreateTaskResponse{
-		ID:     task.ID,
-		Branch: task.Branch,
+		ID:         task.ID,
+		Branch:     task.Branch,
+		BaseBranch: task.BaseBranch,
+		Status:     task.Status,
 	}
 
 	c.JSON(http.StatusCreated, response)
@@ -111,10 +147,151 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		return
 	}
 
+	dependencies, dependents, err := h.taskService.GetTaskDependencies(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve task dependencies",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
 	response := ToTaskResponse(task)
+	response.Dependencies = ToTaskDependencyResponses(dependencies)
+	response.Dependents = ToTaskDependencyResponses(dependents)
 	c.JSON(http.StatusOK, response)
 }
 
+// GetTaskLogs handles GET /tasks/{id}/logs
+func (h *TaskHandler) GetTaskLogs(c *gin.Context) {
+	id := c.Param("id")
+
+	// Parse query parameters
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid after parameter",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	tail, err := strconv.Atoi(c.DefaultQuery("tail", "0"))
+	if err != nil || tail < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid tail parameter",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	if _, err := h.taskService.GetTask(id); err != nil {
+		if err.Error() == "task not found" {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:     "not_found",
+				Message:   "Task not found",
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve task",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	logs, err := h.taskService.GetTaskLogs(id, uint(after), tail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve task logs",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ToTaskLogListResponse(logs))
+}
+
+// GetTaskDiff handles GET /tasks/{id}/diff, returning the files an attempt
+// changed as JSON, or its unified diff with format=patch. Without an attempt
+// the latest attempt's diff is returned.
+func (h *TaskHandler) GetTaskDiff(c *gin.Context) {
+	id := c.Param("id")
+
+	attempt, err := strconv.Atoi(c.DefaultQuery("attempt", "0"))
+	if err != nil || attempt < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid attempt parameter",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "patch" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid format parameter (json, patch)",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	if _, err := h.taskService.GetTask(id); err != nil {
+		if err.Error() == "task not found" {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:     "not_found",
+				Message:   "Task not found",
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve task",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	diff, err := h.taskService.GetTaskDiff(id, attempt)
+	if err != nil {
+		if err.Error() == "diff not found" {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:     "not_found",
+				Message:   "No diff recorded for this task",
+				RequestID: c.GetString("request_id"),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:     "retrieval_error",
+			Message:   "Failed to retrieve task diff",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	if format == "patch" {
+		c.Header("X-Diff-Attempt", strconv.Itoa(diff.Attempt))
+		c.Header("X-Diff-Truncated", strconv.FormatBool(diff.Truncated))
+		c.Data(http.StatusOK, "text/x-diff; charset=utf-8", []byte(diff.Patch))
+		return
+	}
+
+	c.JSON(http.StatusOK, ToTaskDiffResponse(diff))
+}
+
 // ListTasks handles GET /tasks
 func (h *TaskHandler) ListTasks(c *gin.Context) {
 	// Parse query parameters
@@ -192,6 +369,15 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
+	if req.Action == "" && req.Priority == nil {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "An action or a priority is required",
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
 	// Validate prompt if action is continue and prompt is provided
 	if req.Action == "continue" && req.Prompt != "" {
 		if err := h.taskService.ValidatePrompt(req.Prompt); err != nil {
@@ -204,8 +390,10 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		}
 	}
 
-	// Update the task
-	err := h.taskService.UpdateTask(id, req.Action, req.Prompt)
+	// Reprioritize the task and apply the action together
+	err := h.taskService.UpdateTaskWithOptions(id, req.Action, req.Prompt, services.UpdateTaskOptions{
+		Priority: req.Priority,
+	})
 	if err != nil {
 		if err.Error() == "task not found" {
 			c.JSON(http.StatusNotFound, ErrorResponse{
@@ -217,8 +405,9 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		}
 
 		// Check for business logic errors
-		if err.Error() == "task cannot be continued: status=success, attempts=3" ||
-		   err.Error() == "failed to update task status: invalid value" {
+		if errors.Is(err, services.ErrTaskNotContinuable) ||
+		   err.Error() == "failed to update task status: invalid value" ||
+		   errors.Is(err, services.ErrDependencyFailed) {
 			c.JSON(http.StatusConflict, ErrorResponse{
 				Error:     "conflict",
 				Message:   err.Error(),
@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +18,7 @@ import (
 
 	"github.com/brettsmith212/ci-test-2/internal/database"
 	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
 )
 
 func setupTestDB(t *testing.T) func() {
@@ -30,7 +33,7 @@ func setupTestDB(t *testing.T) func() {
 	require.NoError(t, err)
 	
 	// Run migrations
-	err = database.GetDB().AutoMigrate(&models.Task{})
+	err = database.GetDB().AutoMigrate(&models.Task{}, &models.TaskLog{}, &models.TaskDiff{}, &models.Schedule{}, &models.TaskDependency{}, &models.Campaign{})
 	require.NoError(t, err)
 	
 	// Return cleanup function
@@ -58,6 +61,8 @@ func setupTestServer() *gin.Engine {
 		v1.GET("/tasks", taskHandler.ListTasks)
 		v1.GET("/tasks/:id", taskHandler.GetTask)
 		v1.PATCH("/tasks/:id", taskHandler.UpdateTask)
+		v1.GET("/tasks/:id/logs", taskHandler.GetTaskLogs)
+		v1.GET("/tasks/:id/diff", taskHandler.GetTaskDiff)
 		v1.GET("/tasks/active", taskHandler.GetActiveTasks)
 	}
 	
@@ -129,6 +134,44 @@ func TestCreateTask(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "validation_error",
 		},
+		{
+			name: "task_with_agent",
+			payload: CreateTaskRequest{
+				Repo:   "https://github.com/test/repo.git",
+				Prompt: "Fix the bug in the authentication system",
+				Agent:  "command",
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "invalid_agent",
+			payload: CreateTaskRequest{
+				Repo:   "https://github.com/test/repo.git",
+				Prompt: "Fix the bug in the authentication system",
+				Agent:  "amp; rm",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "validation_error",
+		},
+		{
+			name: "task_with_max_retries",
+			payload: CreateTaskRequest{
+				Repo:       "https://github.com/test/repo.git",
+				Prompt:     "Fix the bug in the authentication system",
+				MaxRetries: 5,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "max_retries_too_high",
+			payload: CreateTaskRequest{
+				Repo:       "https://github.com/test/repo.git",
+				Prompt:     "Fix the bug in the authentication system",
+				MaxRetries: 50,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "validation_error",
+		},
 		{
 			name:           "invalid_json",
 			payload:        `{"invalid": json}`,
@@ -253,6 +296,149 @@ func TestGetTask(t *testing.T) {
 	}
 }
 
+func TestGetTaskLogs(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	
+	router := setupTestServer()
+	
+	// Create a task with a mix of worker messages and Amp output
+	svc := services.NewTaskServiceDefault()
+	task, err := svc.CreateTask("https://github.com/test/repo.git", "Fix the flaky test")
+	require.NoError(t, err)
+	
+	ctx := context.Background()
+	require.NoError(t, svc.AddTaskLog(ctx, task.ID, "info", "Task processing started"))
+	for i, line := range []string{"reading files", "editing auth.go", "done"} {
+		require.NoError(t, svc.AddTaskLogEntry(ctx, &models.TaskLog{
+			TaskID:   task.ID,
+			Level:    "info",
+			Message:  line,
+			Stream:   models.LogStreamStdout,
+			Attempt:  1,
+			Sequence: i + 1,
+		}))
+	}
+	
+	getLogs := func(query string) (int, TaskLogListResponse) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/tasks/%s/logs%s", task.ID, query), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		
+		var logsResp TaskLogListResponse
+		json.Unmarshal(resp.Body.Bytes(), &logsResp)
+		return resp.Code, logsResp
+	}
+	
+	t.Run("all_logs", func(t *testing.T) {
+		code, logsResp := getLogs("")
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, logsResp.Logs, 4)
+		assert.Equal(t, "Task processing started", logsResp.Logs[0].Message)
+		assert.Equal(t, "", logsResp.Logs[0].Stream)
+		assert.Equal(t, "stdout", logsResp.Logs[1].Stream)
+		assert.Equal(t, 1, logsResp.Logs[1].Sequence)
+	})
+	
+	t.Run("tail", func(t *testing.T) {
+		code, logsResp := getLogs("?tail=2")
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, logsResp.Logs, 2)
+		assert.Equal(t, "editing auth.go", logsResp.Logs[0].Message)
+		assert.Equal(t, "done", logsResp.Logs[1].Message)
+	})
+	
+	t.Run("after_cursor", func(t *testing.T) {
+		_, all := getLogs("")
+		code, logsResp := getLogs(fmt.Sprintf("?after=%d", all.Logs[2].ID))
+		assert.Equal(t, http.StatusOK, code)
+		require.Len(t, logsResp.Logs, 1)
+		assert.Equal(t, "done", logsResp.Logs[0].Message)
+	})
+	
+	t.Run("invalid_tail", func(t *testing.T) {
+		code, _ := getLogs("?tail=-1")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	
+	t.Run("unknown_task", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v1/tasks/non-existent-id/logs", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+func TestGetTaskDiff(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupTestServer()
+
+	svc := services.NewTaskServiceDefault()
+	task, err := svc.CreateTask("https://github.com/test/repo.git", "Fix the flaky test")
+	require.NoError(t, err)
+
+	getDiff := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("no_diff_yet", func(t *testing.T) {
+		resp := getDiff("/api/v1/tasks/" + task.ID + "/diff")
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), "No diff recorded")
+	})
+
+	ctx := context.Background()
+	for attempt, patch := range []string{"diff --git a/auth.go b/auth.go\n+first\n", "diff --git a/auth.go b/auth.go\n+second\n"} {
+		require.NoError(t, svc.SaveTaskDiff(ctx, &models.TaskDiff{
+			TaskID:  task.ID,
+			Attempt: attempt + 1,
+			BaseRef: "origin/main",
+			Files: []models.DiffFile{
+				{Path: "auth.go", Status: models.DiffFileModified, Additions: 1},
+				{Path: "logo.png", Status: models.DiffFileAdded, Binary: true},
+			},
+			Additions: 1,
+			Patch:     patch,
+		}))
+	}
+
+	t.Run("latest_stats", func(t *testing.T) {
+		resp := getDiff("/api/v1/tasks/" + task.ID + "/diff")
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var diffResp TaskDiffResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &diffResp))
+		assert.Equal(t, 2, diffResp.Attempt)
+		assert.Equal(t, 2, diffResp.FilesChanged)
+		assert.Equal(t, "origin/main", diffResp.BaseRef)
+		assert.True(t, diffResp.Files[1].Binary)
+		assert.NotContains(t, resp.Body.String(), "patch")
+	})
+
+	t.Run("attempt_patch", func(t *testing.T) {
+		resp := getDiff("/api/v1/tasks/" + task.ID + "/diff?attempt=1&format=patch")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Header().Get("Content-Type"), "text/x-diff")
+		assert.Equal(t, "1", resp.Header().Get("X-Diff-Attempt"))
+		assert.Equal(t, "diff --git a/auth.go b/auth.go\n+first\n", resp.Body.String())
+	})
+
+	t.Run("invalid_parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, getDiff("/api/v1/tasks/"+task.ID+"/diff?attempt=-1").Code)
+		assert.Equal(t, http.StatusBadRequest, getDiff("/api/v1/tasks/"+task.ID+"/diff?format=html").Code)
+	})
+
+	t.Run("unknown_attempt_or_task", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, getDiff("/api/v1/tasks/"+task.ID+"/diff?attempt=3").Code)
+		assert.Equal(t, http.StatusNotFound, getDiff("/api/v1/tasks/non-existent-id/diff").Code)
+	})
+}
+
 func TestListTasks(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
@@ -449,8 +635,8 @@ func TestUpdateTask(t *testing.T) {
 				Action: "continue",
 				Prompt: "Run this: <script>alert('xss')</script>",
 			},
-			expectedStatus: http.StatusInternalServerError, // Business logic error - queued task can't be continued 
-			expectedError:  "update_error",
+			expectedStatus: http.StatusConflict, // Business logic error - aborted task can't be continued
+			expectedError:  "conflict",
 		},
 		{
 			name:           "invalid_json",
@@ -500,6 +686,126 @@ func TestUpdateTask(t *testing.T) {
 	}
 }
 
+func TestUpdateTaskPriority(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupTestServer()
+
+	createPayload := CreateTaskRequest{
+		Repo:     "https://github.com/test/repo.git",
+		Prompt:   "Fix the authentication bug in the system",
+		Priority: 3,
+	}
+	body, _ := json.Marshal(createPayload)
+
+	createReq, _ := http.NewRequest("POST", "/api/v1/tasks", bytes.NewBuffer(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	createResp := httptest.NewRecorder()
+	router.ServeHTTP(createResp, createReq)
+
+	require.Equal(t, http.StatusCreated, createResp.Code)
+
+	var createTaskResp CreateTaskResponse
+	err := json.Unmarshal(createResp.Body.Bytes(), &createTaskResp)
+	require.NoError(t, err)
+
+	patch := func(payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/api/v1/tasks/"+createTaskResp.ID, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"priority": 0}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(`{"priority": 11}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(`{}`).Code)
+	require.Equal(t, http.StatusNoContent, patch(`{"priority": 9}`).Code)
+
+	getReq, _ := http.NewRequest("GET", "/api/v1/tasks/"+createTaskResp.ID, nil)
+	getResp := httptest.NewRecorder()
+	router.ServeHTTP(getResp, getReq)
+
+	var taskResp TaskResponse
+	err = json.Unmarshal(getResp.Body.Bytes(), &taskResp)
+	require.NoError(t, err)
+	assert.Equal(t, 9, taskResp.Priority)
+	assert.Equal(t, models.TaskStatusQueued, taskResp.Status)
+}
+
+func TestTaskDependencies(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupTestServer()
+
+	create := func(payload CreateTaskRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/api/v1/tasks", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	get := func(id string) TaskResponse {
+		req, _ := http.NewRequest("GET", "/api/v1/tasks/"+id, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var task TaskResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &task))
+		return task
+	}
+
+	parentResp := create(CreateTaskRequest{
+		Repo:   "https://github.com/test/repo.git",
+		Prompt: "Extract the storage interface",
+	})
+	require.Equal(t, http.StatusCreated, parentResp.Code)
+	var parent CreateTaskResponse
+	require.NoError(t, json.Unmarshal(parentResp.Body.Bytes(), &parent))
+	assert.Equal(t, models.TaskStatusQueued, parent.Status)
+
+	childResp := create(CreateTaskRequest{
+		Repo:          "https://github.com/test/repo.git",
+		Prompt:        "Move the callers to the storage interface",
+		DependsOn:     []string{parent.ID},
+		StackOnParent: true,
+	})
+	require.Equal(t, http.StatusCreated, childResp.Code)
+	var child CreateTaskResponse
+	require.NoError(t, json.Unmarshal(childResp.Body.Bytes(), &child))
+	assert.Equal(t, models.TaskStatusBlocked, child.Status)
+	assert.Equal(t, parent.Branch, child.BaseBranch)
+
+	// The graph is visible from both ends
+	parentTask := get(parent.ID)
+	require.Len(t, parentTask.Dependents, 1)
+	assert.Equal(t, child.ID, parentTask.Dependents[0].ID)
+	assert.Equal(t, models.TaskStatusBlocked, parentTask.Dependents[0].Status)
+	assert.Empty(t, parentTask.Dependencies)
+
+	childTask := get(child.ID)
+	require.Len(t, childTask.Dependencies, 1)
+	assert.Equal(t, parent.ID, childTask.Dependencies[0].ID)
+	assert.Equal(t, parent.Branch, childTask.BaseBranch)
+
+	// Unknown dependencies and stacking without one are rejected
+	for _, payload := range []CreateTaskRequest{
+		{Repo: "https://github.com/test/repo.git", Prompt: "Follow-up refactor step", DependsOn: []string{"missing"}},
+		{Repo: "https://github.com/test/repo.git", Prompt: "Follow-up refactor step", StackOnParent: true},
+	} {
+		resp := create(payload)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var errResp ValidationErrorResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &errResp))
+		assert.Contains(t, errResp.Fields, "depends_on")
+	}
+}
+
 func TestGetActiveTasks(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
@@ -613,7 +919,7 @@ func TestTaskResponseStructure(t *testing.T) {
 	assert.Equal(t, 0, taskResp.Attempts)
 	assert.NotZero(t, taskResp.CreatedAt)
 	assert.NotZero(t, taskResp.UpdatedAt)
-	assert.NotEmpty(t, taskResp.ThreadID) // Should have a thread ID
+	assert.Empty(t, taskResp.ThreadID) // Thread is created by the worker
 	assert.Nil(t, taskResp.CIRunID)   // Should be nil initially
 	assert.Empty(t, taskResp.Summary) // Should be empty initially
 }
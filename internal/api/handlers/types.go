@@ -4,39 +4,67 @@ import (
 	"time"
 
 	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
 )
 
 // CreateTaskRequest represents the request payload for creating a new task
 type CreateTaskRequest struct {
-	Repo   string `json:"repo" binding:"required"`
-	Prompt string `json:"prompt" binding:"required"`
+	Repo          string   `json:"repo" binding:"required"`
+	Prompt        string   `json:"prompt" binding:"required"`
+	Agent         string   `json:"agent,omitempty"`
+	MaxRetries    int      `json:"max_retries,omitempty" binding:"omitempty,min=1,max=20"`
+	Priority      int      `json:"priority,omitempty" binding:"omitempty,min=1,max=10"`
+	DependsOn     []string `json:"depends_on,omitempty" binding:"omitempty,max=20,dive,required"`
+	StackOnParent bool     `json:"stack_on_parent,omitempty"`
 }
 
 // CreateTaskResponse represents the response after creating a task
 type CreateTaskResponse struct {
-	ID     string `json:"id"`
-	Branch string `json:"branch"`
+	ID         string            `json:"id"`
+	Branch     string            `json:"branch"`
+	BaseBranch string            `json:"base_branch,omitempty"`
+	Status     models.TaskStatus `json:"status"`
 }
 
 // UpdateTaskRequest represents the request payload for updating a task
+// with an action, a new priority, or both
 type UpdateTaskRequest struct {
-	Action string `json:"action" binding:"required,oneof=continue abort"`
-	Prompt string `json:"prompt,omitempty"`
+	Action   string `json:"action,omitempty" binding:"omitempty,oneof=continue abort"`
+	Prompt   string `json:"prompt,omitempty"`
+	Priority *int   `json:"priority,omitempty" binding:"omitempty,min=1,max=10"`
 }
 
 // TaskResponse represents a task in API responses
 type TaskResponse struct {
-	ID        string                `json:"id"`
-	Repo      string                `json:"repo"`
-	Branch    string                `json:"branch,omitempty"`
-	ThreadID  string                `json:"thread_id,omitempty"`
-	Prompt    string                `json:"prompt"`
-	Status    models.TaskStatus     `json:"status"`
-	CIRunID   *int64                `json:"ci_run_id,omitempty"`
-	Attempts  int                   `json:"attempts"`
-	Summary   string                `json:"summary,omitempty"`
-	CreatedAt time.Time             `json:"created_at"`
-	UpdatedAt time.Time             `json:"updated_at"`
+	ID           string                   `json:"id"`
+	Repo         string                   `json:"repo"`
+	Branch       string                   `json:"branch,omitempty"`
+	BaseBranch   string                   `json:"base_branch,omitempty"`
+	ThreadID     string                   `json:"thread_id,omitempty"`
+	Agent        string                   `json:"agent,omitempty"`
+	Prompt       string                   `json:"prompt"`
+	Status       models.TaskStatus        `json:"status"`
+	Priority     int                      `json:"priority"`
+	CIRunID      *int64                   `json:"ci_run_id,omitempty"`
+	Attempts     int                      `json:"attempts"`
+	MaxRetries   int                      `json:"max_retries,omitempty"`
+	NextRunAt    *time.Time               `json:"next_run_at,omitempty"`
+	ScheduleID   string                   `json:"schedule_id,omitempty"`
+	CampaignID   string                   `json:"campaign_id,omitempty"`
+	Summary      string                   `json:"summary,omitempty"`
+	Dependencies []TaskDependencyResponse `json:"dependencies,omitempty"`
+	Dependents   []TaskDependencyResponse `json:"dependents,omitempty"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+// TaskDependencyResponse represents a task's neighbour in the dependency graph
+type TaskDependencyResponse struct {
+	ID         string            `json:"id"`
+	Status     models.TaskStatus `json:"status"`
+	Branch     string            `json:"branch,omitempty"`
+	BaseBranch string            `json:"base_branch,omitempty"`
+	PRURL      string            `json:"pr_url,omitempty"`
 }
 
 // TaskListResponse represents the response for listing tasks
@@ -45,6 +73,161 @@ type TaskListResponse struct {
 	Total int            `json:"total"`
 }
 
+// TaskLogResponse represents a task log entry in API responses
+type TaskLogResponse struct {
+	ID        uint      `json:"id"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Stream    string    `json:"stream,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Sequence  int       `json:"sequence,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TaskLogListResponse represents the response for listing task logs
+type TaskLogListResponse struct {
+	Logs  []TaskLogResponse `json:"logs"`
+	Total int               `json:"total"`
+}
+
+// TaskDiffResponse represents the files an attempt of a task changed, with
+// their line counts
+type TaskDiffResponse struct {
+	TaskID       string            `json:"task_id"`
+	Attempt      int               `json:"attempt"`
+	BaseRef      string            `json:"base_ref"`
+	BaseSHA      string            `json:"base_sha"`
+	HeadSHA      string            `json:"head_sha"`
+	Files        []models.DiffFile `json:"files"`
+	FilesChanged int               `json:"files_changed"`
+	Additions    int               `json:"additions"`
+	Deletions    int               `json:"deletions"`
+	Truncated    bool              `json:"truncated,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// CreateScheduleRequest represents the request payload for creating a recurring task
+type CreateScheduleRequest struct {
+	Name       string `json:"name,omitempty" binding:"omitempty,max=100"`
+	Cron       string `json:"cron" binding:"required"`
+	Timezone   string `json:"timezone,omitempty"`
+	Repo       string `json:"repo" binding:"required"`
+	Prompt     string `json:"prompt" binding:"required"`
+	Agent      string `json:"agent,omitempty"`
+	MaxRetries int    `json:"max_retries,omitempty" binding:"omitempty,min=1,max=20"`
+	Priority   int    `json:"priority,omitempty" binding:"omitempty,min=1,max=10"`
+}
+
+// UpdateScheduleRequest represents the request payload for pausing or resuming a schedule
+type UpdateScheduleRequest struct {
+	Paused *bool `json:"paused" binding:"required"`
+}
+
+// ScheduleListResponse represents the response for listing schedules
+type ScheduleListResponse struct {
+	Schedules []models.Schedule `json:"schedules"`
+	Total     int               `json:"total"`
+}
+
+// CreateCampaignRequest represents the request payload for running one
+// prompt across many repositories
+type CreateCampaignRequest struct {
+	Name       string   `json:"name,omitempty" binding:"omitempty,max=100"`
+	Prompt     string   `json:"prompt" binding:"required"`
+	Repos      []string `json:"repos,omitempty" binding:"omitempty,max=200,dive,required"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Agent      string   `json:"agent,omitempty"`
+	MaxRetries int      `json:"max_retries,omitempty" binding:"omitempty,min=1,max=20"`
+	Priority   int      `json:"priority,omitempty" binding:"omitempty,min=1,max=10"`
+}
+
+// UpdateCampaignRequest represents the request payload for continuing or
+// aborting a campaign's tasks in bulk
+type UpdateCampaignRequest struct {
+	Action string `json:"action" binding:"required,oneof=continue abort"`
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// CampaignProgressResponse counts a campaign's tasks by status
+type CampaignProgressResponse struct {
+	Total       int `json:"total"`
+	Finished    int `json:"finished"`
+	Queued      int `json:"queued"`
+	Blocked     int `json:"blocked"`
+	Running     int `json:"running"`
+	Retrying    int `json:"retrying"`
+	NeedsReview int `json:"needs_review"`
+	Success     int `json:"success"`
+	Error       int `json:"error"`
+	Aborted     int `json:"aborted"`
+}
+
+// CampaignResponse represents a campaign in API responses
+type CampaignResponse struct {
+	ID         string                   `json:"id"`
+	Name       string                   `json:"name,omitempty"`
+	Prompt     string                   `json:"prompt"`
+	Pattern    string                   `json:"pattern,omitempty"`
+	Agent      string                   `json:"agent,omitempty"`
+	MaxRetries int                      `json:"max_retries,omitempty"`
+	Priority   int                      `json:"priority,omitempty"`
+	Progress   CampaignProgressResponse `json:"progress"`
+	Tasks      []TaskResponse           `json:"tasks,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+}
+
+// CampaignListResponse represents the response for listing campaigns
+type CampaignListResponse struct {
+	Campaigns []CampaignResponse `json:"campaigns"`
+	Total     int                `json:"total"`
+}
+
+// CampaignActionResponse represents the outcome of a bulk action on a campaign's tasks
+type CampaignActionResponse struct {
+	Action  string            `json:"action"`
+	Updated []string          `json:"updated"`
+	Skipped []string          `json:"skipped"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// ClaimTaskRequest represents a worker's request to lease the next queued task
+type ClaimTaskRequest struct {
+	WorkerID     string `json:"worker_id" binding:"required"`
+	LeaseSeconds int    `json:"lease_seconds" binding:"required,min=1"`
+}
+
+// LeaseRequest represents a worker renewing or releasing its lease on a task
+type LeaseRequest struct {
+	WorkerID     string `json:"worker_id" binding:"required"`
+	LeaseSeconds int    `json:"lease_seconds,omitempty"`
+}
+
+// ReportTaskRequest represents a worker saving its copy of a task it holds the lease on
+type ReportTaskRequest struct {
+	WorkerID string      `json:"worker_id" binding:"required"`
+	Task     models.Task `json:"task"`
+}
+
+// ReapTasksRequest represents a request to recover tasks with expired leases
+type ReapTasksRequest struct {
+	MaxAttempts int `json:"max_attempts" binding:"required,min=1"`
+}
+
+// ReapTasksResponse represents the number of tasks recovered by a reap
+type ReapTasksResponse struct {
+	Reaped int `json:"reaped"`
+}
+
+// TaskStatusRequest represents a task status read or written by a worker
+type TaskStatusRequest struct {
+	Status models.TaskStatus `json:"status" binding:"required"`
+}
+
+// AppendLogsRequest represents log entries appended to a task by a worker
+type AppendLogsRequest struct {
+	Logs []models.TaskLog `json:"logs" binding:"required"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error     string `json:"error"`
@@ -63,18 +246,76 @@ type ValidationErrorResponse struct {
 // ToTaskResponse converts a models.Task to TaskResponse
 func ToTaskResponse(task *models.Task) TaskResponse {
 	return TaskResponse{
-		ID:        task.ID,
-		Repo:      task.Repo,
-		Branch:    task.Branch,
-		ThreadID:  task.ThreadID,
-		Prompt:    task.Prompt,
-		Status:    task.Status,
-		CIRunID:   task.CIRunID,
-		Attempts:  task.Attempts,
-		Summary:   task.Summary,
-		CreatedAt: task.CreatedAt,
-		UpdatedAt: task.UpdatedAt,
+		ID:         task.ID,
+		Repo:       task.Repo,
+		Branch:     task.Branch,
+		BaseBranch: task.BaseBranch,
+		ThreadID:   task.ThreadID,
+		Agent:      task.Agent,
+		Prompt:     task.Prompt,
+		Status:     task.Status,
+		Priority:   task.Priority,
+		CIRunID:    task.CIRunID,
+		Attempts:   task.Attempts,
+		MaxRetries: task.MaxRetries,
+		NextRunAt:  task.NextRunAt,
+		ScheduleID: task.ScheduleID,
+		CampaignID: task.CampaignID,
+		Summary:    task.Summary,
+		CreatedAt:  task.CreatedAt,
+		UpdatedAt:  task.UpdatedAt,
+	}
+}
+
+// ToTaskDependencyResponses converts the tasks around a task in the
+// dependency graph to their API representation
+func ToTaskDependencyResponses(tasks []models.Task) []TaskDependencyResponse {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	responses := make([]TaskDependencyResponse, len(tasks))
+	for i, task := range tasks {
+		responses[i] = TaskDependencyResponse{
+			ID:         task.ID,
+			Status:     task.Status,
+			Branch:     task.Branch,
+			BaseBranch: task.BaseBranch,
+			PRURL:      task.PRURL,
+		}
+	}
+	return responses
+}
+
+// ToCampaignResponse converts a campaign, its progress and optionally its
+// tasks to their API representation
+func ToCampaignResponse(campaign *models.Campaign, progress services.CampaignProgress, tasks []models.Task) CampaignResponse {
+	response := CampaignResponse{
+		ID:         campaign.ID,
+		Name:       campaign.Name,
+		Prompt:     campaign.Prompt,
+		Pattern:    campaign.Pattern,
+		Agent:      campaign.Agent,
+		MaxRetries: campaign.MaxRetries,
+		Priority:   campaign.Priority,
+		Progress: CampaignProgressResponse{
+			Total:       progress.Total,
+			Finished:    progress.Finished(),
+			Queued:      progress.Counts[models.TaskStatusQueued],
+			Blocked:     progress.Counts[models.TaskStatusBlocked],
+			Running:     progress.Counts[models.TaskStatusRunning],
+			Retrying:    progress.Counts[models.TaskStatusRetrying],
+			NeedsReview: progress.Counts[models.TaskStatusNeedsReview],
+			Success:     progress.Counts[models.TaskStatusSuccess],
+			Error:       progress.Counts[models.TaskStatusError],
+			Aborted:     progress.Counts[models.TaskStatusAborted],
+		},
+		CreatedAt: campaign.CreatedAt,
+	}
+	for i := range tasks {
+		response.Tasks = append(response.Tasks, ToTaskResponse(&tasks[i]))
 	}
+	return response
 }
 
 // ToTaskListResponse converts a slice of models.Task to TaskListResponse
@@ -89,3 +330,47 @@ func ToTaskListResponse(tasks []models.Task) TaskListResponse {
 		Total: len(tasks),
 	}
 }
+
+// ToTaskLogListResponse converts a slice of models.TaskLog to TaskLogListResponse
+func ToTaskLogListResponse(logs []models.TaskLog) TaskLogListResponse {
+	logResponses := make([]TaskLogResponse, len(logs))
+	for i, entry := range logs {
+		logResponses[i] = TaskLogResponse{
+			ID:        entry.ID,
+			Level:     entry.Level,
+			Message:   entry.Message,
+			Stream:    entry.Stream,
+			Attempt:   entry.Attempt,
+			Sequence:  entry.Sequence,
+			Timestamp: entry.Timestamp,
+		}
+	}
+
+	return TaskLogListResponse{
+		Logs:  logResponses,
+		Total: len(logs),
+	}
+}
+
+// ToTaskDiffResponse converts a models.TaskDiff to TaskDiffResponse, leaving
+// out the patch
+func ToTaskDiffResponse(diff *models.TaskDiff) TaskDiffResponse {
+	files := diff.Files
+	if files == nil {
+		files = []models.DiffFile{}
+	}
+
+	return TaskDiffResponse{
+		TaskID:       diff.TaskID,
+		Attempt:      diff.Attempt,
+		BaseRef:      diff.BaseRef,
+		BaseSHA:      diff.BaseSHA,
+		HeadSHA:      diff.HeadSHA,
+		Files:        files,
+		FilesChanged: len(files),
+		Additions:    diff.Additions,
+		Deletions:    diff.Deletions,
+		Truncated:    diff.Truncated,
+		CreatedAt:    diff.CreatedAt,
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+// WorkerHandler handles requests from workers that run tasks remotely
+type WorkerHandler struct {
+	taskService *services.TaskService
+}
+
+// NewWorkerHandler creates a new WorkerHandler instance
+func NewWorkerHandler() *WorkerHandler {
+	return &WorkerHandler{
+		taskService: services.NewTaskServiceDefault(),
+	}
+}
+
+// SetRepoConcurrency caps how many tasks on the same repository workers may run at once
+func (h *WorkerHandler) SetRepoConcurrency(maxTasks int) {
+	h.taskService.SetRepoConcurrency(maxTasks)
+}
+
+// ClaimTask handles POST /worker/claim
+func (h *WorkerHandler) ClaimTask(c *gin.Context) {
+	var req ClaimTaskRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+
+	task, err := h.taskService.ClaimNextTask(c.Request.Context(), req.WorkerID, leaseDuration(req.LeaseSeconds))
+	if err != nil {
+		workerError(c, http.StatusInternalServerError, "claim_error", "Failed to claim task")
+		return
+	}
+
+	// Nothing is queued
+	if task == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// Heartbeat handles POST /worker/tasks/{id}/heartbeat
+func (h *WorkerHandler) Heartbeat(c *gin.Context) {
+	var req LeaseRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+	if req.LeaseSeconds < 1 {
+		workerError(c, http.StatusBadRequest, "validation_error", "lease_seconds must be at least 1")
+		return
+	}
+
+	err := h.taskService.RenewLease(c.Request.Context(), c.Param("id"), req.WorkerID, leaseDuration(req.LeaseSeconds))
+	if errors.Is(err, services.ErrLeaseLost) {
+		workerError(c, http.StatusConflict, "lease_lost", err.Error())
+		return
+	}
+	if err != nil {
+		workerError(c, http.StatusInternalServerError, "lease_error", "Failed to renew lease")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReleaseTask handles POST /worker/tasks/{id}/release
+func (h *WorkerHandler) ReleaseTask(c *gin.Context) {
+	var req LeaseRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+
+	if err := h.taskService.ReleaseTask(c.Request.Context(), c.Param("id"), req.WorkerID); err != nil {
+		workerError(c, http.StatusInternalServerError, "lease_error", "Failed to release task")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReapTasks handles POST /worker/reap
+func (h *WorkerHandler) ReapTasks(c *gin.Context) {
+	var req ReapTasksRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+
+	reaped, err := h.taskService.ReapExpiredTasks(c.Request.Context(), req.MaxAttempts)
+	if err != nil {
+		workerError(c, http.StatusInternalServerError, "reap_error", "Failed to reap expired tasks")
+		return
+	}
+
+	c.JSON(http.StatusOK, ReapTasksResponse{Reaped: reaped})
+}
+
+// GetTaskStatus handles GET /worker/tasks/{id}/status
+func (h *WorkerHandler) GetTaskStatus(c *gin.Context) {
+	status, err := h.taskService.GetTaskStatus(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err.Error() == "task not found" {
+			workerError(c, http.StatusNotFound, "not_found", "Task not found")
+			return
+		}
+		workerError(c, http.StatusInternalServerError, "retrieval_error", "Failed to retrieve task status")
+		return
+	}
+
+	c.JSON(http.StatusOK, TaskStatusRequest{Status: status})
+}
+
+// UpdateTaskStatus handles PUT /worker/tasks/{id}/status
+func (h *WorkerHandler) UpdateTaskStatus(c *gin.Context) {
+	var req TaskStatusRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+
+	if !req.Status.IsValid() {
+		workerError(c, http.StatusBadRequest, "validation_error", "Invalid status: "+string(req.Status))
+		return
+	}
+
+	if err := h.taskService.UpdateTaskStatus(c.Request.Context(), c.Param("id"), string(req.Status)); err != nil {
+		workerError(c, http.StatusInternalServerError, "update_error", "Failed to update task status")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReportTask handles PUT /worker/tasks/{id}, saving the worker's copy of the
+// task after an attempt. Only the worker holding the lease may report; the
+// lease columns are owned by the lease endpoints and are ignored.
+func (h *WorkerHandler) ReportTask(c *gin.Context) {
+	var req ReportTaskRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+	req.Task.ID = c.Param("id")
+
+	err := h.taskService.ReportTask(c.Request.Context(), &req.Task, req.WorkerID)
+	if errors.Is(err, services.ErrTaskAborted) {
+		workerError(c, http.StatusConflict, "task_aborted", err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrLeaseLost) {
+		workerError(c, http.StatusConflict, "lease_lost", err.Error())
+		return
+	}
+	if err != nil {
+		workerError(c, http.StatusInternalServerError, "update_error", "Failed to update task")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AppendLogs handles POST /worker/tasks/{id}/logs
+func (h *WorkerHandler) AppendLogs(c *gin.Context) {
+	var req AppendLogsRequest
+	if !bindWorkerRequest(c, &req) {
+		return
+	}
+
+	entries := make([]*models.TaskLog, len(req.Logs))
+	for i := range req.Logs {
+		entry := &req.Logs[i]
+		// IDs are assigned here so entries stay in the order they arrive
+		entry.ID = 0
+		entries[i] = entry
+	}
+	if err := h.taskService.AddTaskLogEntries(c.Request.Context(), c.Param("id"), entries); err != nil {
+		workerError(c, http.StatusInternalServerError, "log_error", "Failed to append task logs")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SaveDiff handles POST /worker/tasks/{id}/diffs, recording what an attempt
+// changed. A diff sent again for the same attempt replaces the first.
+func (h *WorkerHandler) SaveDiff(c *gin.Context) {
+	var diff models.TaskDiff
+	if !bindWorkerRequest(c, &diff) {
+		return
+	}
+	diff.TaskID = c.Param("id")
+
+	if diff.Attempt < 1 {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid request payload",
+			Fields:    map[string]string{"attempt": "must be at least 1"},
+			RequestID: c.GetString("request_id"),
+		})
+		return
+	}
+
+	if err := h.taskService.SaveTaskDiff(c.Request.Context(), &diff); err != nil {
+		workerError(c, http.StatusInternalServerError, "diff_error", "Failed to save task diff")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindWorkerRequest binds the JSON body into req, responding with a
+// validation error and returning false if it is malformed
+func bindWorkerRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Error:     "validation_error",
+			Message:   "Invalid request payload",
+			Fields:    map[string]string{"validation": err.Error()},
+			RequestID: c.GetString("request_id"),
+		})
+		return false
+	}
+	return true
+}
+
+// workerError responds with an ErrorResponse
+func workerError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, ErrorResponse{
+		Error:     code,
+		Message:   message,
+		RequestID: c.GetString("request_id"),
+	})
+}
+
+// leaseDuration converts a requested lease length in seconds to a duration
+func leaseDuration(seconds int) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+func setupWorkerTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	workerHandler := NewWorkerHandler()
+
+	router.Use(func(c *gin.Context) {
+		c.Set("request_id", "test-request-123")
+		c.Next()
+	})
+
+	workers := router.Group("/api/v1/worker")
+	{
+		workers.POST("/claim", workerHandler.ClaimTask)
+		workers.POST("/reap", workerHandler.ReapTasks)
+		workers.PUT("/tasks/:id", workerHandler.ReportTask)
+		workers.POST("/tasks/:id/heartbeat", workerHandler.Heartbeat)
+		workers.POST("/tasks/:id/release", workerHandler.ReleaseTask)
+		workers.GET("/tasks/:id/status", workerHandler.GetTaskStatus)
+		workers.PUT("/tasks/:id/status", workerHandler.UpdateTaskStatus)
+		workers.POST("/tasks/:id/logs", workerHandler.AppendLogs)
+		workers.POST("/tasks/:id/diffs", workerHandler.SaveDiff)
+	}
+
+	return router
+}
+
+func doWorkerRequest(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWorkerClaimAndHeartbeat(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+
+	// Nothing to claim yet
+	w := doWorkerRequest(router, "POST", "/api/v1/worker/claim", ClaimTaskRequest{WorkerID: "worker-a", LeaseSeconds: 60})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	taskService := services.NewTaskServiceDefault()
+	created, err := taskService.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	require.NoError(t, err)
+
+	w = doWorkerRequest(router, "POST", "/api/v1/worker/claim", ClaimTaskRequest{WorkerID: "worker-a", LeaseSeconds: 60})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var claimed models.Task
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claimed))
+	assert.Equal(t, created.ID, claimed.ID)
+	assert.Equal(t, models.TaskStatusRunning, claimed.Status)
+	assert.Equal(t, "worker-a", claimed.ClaimedBy)
+
+	// Only the lease holder can renew the lease
+	w = doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+created.ID+"/heartbeat", LeaseRequest{WorkerID: "worker-a", LeaseSeconds: 60})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+created.ID+"/heartbeat", LeaseRequest{WorkerID: "worker-b", LeaseSeconds: 60})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "lease_lost")
+
+	w = doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+created.ID+"/heartbeat", LeaseRequest{WorkerID: "worker-a"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWorkerClaim_Validation(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+
+	tests := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"missing worker ID", map[string]interface{}{"lease_seconds": 60}},
+		{"missing lease", map[string]interface{}{"worker_id": "worker-a"}},
+		{"zero lease", map[string]interface{}{"worker_id": "worker-a", "lease_seconds": 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doWorkerRequest(router, "POST", "/api/v1/worker/claim", tt.payload)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestWorkerReportTaskAndLogs(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+	taskService := services.NewTaskServiceDefault()
+	task, err := taskService.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	require.NoError(t, err)
+
+	// Log entries keep the order they were sent in
+	w := doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+task.ID+"/logs", AppendLogsRequest{Logs: []models.TaskLog{
+		{Level: "info", Message: "Cloning repository..."},
+		{Level: "info", Message: "go test ./...", Stream: models.LogStreamStdout, Attempt: 1, Sequence: 1},
+	}})
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	logs, err := taskService.GetTaskLogs(task.ID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "Cloning repository...", logs[0].Message)
+	assert.Equal(t, models.LogStreamStdout, logs[1].Stream)
+	assert.Equal(t, task.ID, logs[1].TaskID)
+
+	claimed, err := taskService.ClaimNextTask(context.Background(), "worker-1", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, task.ID, claimed.ID)
+
+	task.Status = models.TaskStatusSuccess
+	task.Attempts = 1
+	task.Summary = "CI passed after 1 attempt(s)"
+
+	// Only the worker holding the lease may report
+	w = doWorkerRequest(router, "PUT", "/api/v1/worker/tasks/"+task.ID, ReportTaskRequest{Task: *task})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doWorkerRequest(router, "PUT", "/api/v1/worker/tasks/"+task.ID, ReportTaskRequest{WorkerID: "worker-2", Task: *task})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "lease_lost")
+
+	w = doWorkerRequest(router, "PUT", "/api/v1/worker/tasks/"+task.ID, ReportTaskRequest{WorkerID: "worker-1", Task: *task})
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doWorkerRequest(router, "GET", "/api/v1/worker/tasks/"+task.ID+"/status", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"success"`)
+
+	// A report never overwrites an abort made in the meantime
+	require.NoError(t, taskService.UpdateTaskStatus(context.Background(), task.ID, string(models.TaskStatusAborted)))
+	task.Status = models.TaskStatusError
+	w = doWorkerRequest(router, "PUT", "/api/v1/worker/tasks/"+task.ID, ReportTaskRequest{WorkerID: "worker-1", Task: *task})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "task_aborted")
+}
+
+func TestWorkerSaveDiff(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+	taskService := services.NewTaskServiceDefault()
+	task, err := taskService.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	require.NoError(t, err)
+
+	w := doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+task.ID+"/diffs", models.TaskDiff{
+		Attempt:   1,
+		Files:     []models.DiffFile{{Path: "auth.go", Status: models.DiffFileModified, Additions: 2, Deletions: 1}},
+		Additions: 2,
+		Deletions: 1,
+		Patch:     "diff --git a/auth.go b/auth.go\n",
+	})
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	diff, err := taskService.GetTaskDiff(task.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, task.ID, diff.TaskID)
+	require.Len(t, diff.Files, 1)
+	assert.Equal(t, "auth.go", diff.Files[0].Path)
+
+	w = doWorkerRequest(router, "POST", "/api/v1/worker/tasks/"+task.ID+"/diffs", models.TaskDiff{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWorkerGetTaskStatus_NotFound(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+
+	w := doWorkerRequest(router, "GET", "/api/v1/worker/tasks/missing/status", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doWorkerRequest(router, "PUT", "/api/v1/worker/tasks/missing/status", TaskStatusRequest{Status: "bogus"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWorkerReapTasks(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	router := setupWorkerTestServer()
+	taskService := services.NewTaskServiceDefault()
+	_, err := taskService.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	require.NoError(t, err)
+	_, err = taskService.ClaimNextTask(context.Background(), "worker-a", -time.Minute)
+	require.NoError(t, err)
+
+	w := doWorkerRequest(router, "POST", "/api/v1/worker/reap", ReapTasksRequest{MaxAttempts: 3})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"reaped":1}`, w.Body.String())
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
@@ -189,6 +190,30 @@ func HeaderValidationMiddleware(requiredHeaders map[string]string) gin.HandlerFu
 	}
 }
 
+// WorkerAuthMiddleware only lets through requests carrying the shared worker
+// token as a bearer token. With no token configured every request is rejected,
+// so the worker API is never left open by accident.
+func WorkerAuthMiddleware(token string) gin.HandlerFunc {
+	errorHandler := GetErrorHandler()
+
+	return func(c *gin.Context) {
+		if token == "" {
+			errorHandler.HandleUnauthorizedError(c, "Worker API is disabled; set WORKER_TOKEN on the orchestrator")
+			c.Abort()
+			return
+		}
+
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			errorHandler.HandleUnauthorizedError(c, "Invalid or missing worker token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // SecurityMiddleware adds basic security headers
 func SecurityMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
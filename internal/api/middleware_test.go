@@ -364,6 +364,45 @@ func TestCORSMiddleware(t *testing.T) {
 	}
 }
 
+func TestWorkerAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		{"valid token", "s3cret", "Bearer s3cret", 200},
+		{"wrong token", "s3cret", "Bearer guess", 401},
+		{"missing header", "s3cret", "", 401},
+		{"not a bearer token", "s3cret", "s3cret", 401},
+		{"no token configured", "", "Bearer ", 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+
+			r.Use(WorkerAuthMiddleware(tt.token))
+			r.GET("/test", func(c *gin.Context) {
+				c.JSON(200, gin.H{"message": "ok"})
+			})
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
 func TestSecurityMiddleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
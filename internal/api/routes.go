@@ -8,20 +8,69 @@ import (
 	"github.com/brettsmith212/ci-test-2/internal/api/handlers"
 )
 
-// SetupTaskRoutes configures task-related routes
-func SetupTaskRoutes(router *gin.RouterGroup) {
+// SetupTaskRoutes configures task-related routes. maxRetries is the attempt
+// budget of tasks that do not set their own; zero uses the default.
+func SetupTaskRoutes(router *gin.RouterGroup, maxRetries int) {
 	taskHandler := handlers.NewTaskHandler()
+	taskHandler.SetMaxRetries(maxRetries)
 
 	// Task CRUD routes
 	router.POST("/tasks", taskHandler.CreateTask)
 	router.GET("/tasks", taskHandler.ListTasks)
 	router.GET("/tasks/:id", taskHandler.GetTask)
 	router.PATCH("/tasks/:id", taskHandler.UpdateTask)
+	router.GET("/tasks/:id/logs", taskHandler.GetTaskLogs)
+	router.GET("/tasks/:id/diff", taskHandler.GetTaskDiff)
 
 	// Additional task routes
 	router.GET("/tasks/active", taskHandler.GetActiveTasks)
 }
 
+// SetupScheduleRoutes configures the routes for recurring tasks
+func SetupScheduleRoutes(router *gin.RouterGroup) {
+	scheduleHandler := handlers.NewScheduleHandler()
+
+	router.POST("/schedules", scheduleHandler.CreateSchedule)
+	router.GET("/schedules", scheduleHandler.ListSchedules)
+	router.GET("/schedules/:id", scheduleHandler.GetSchedule)
+	router.PATCH("/schedules/:id", scheduleHandler.UpdateSchedule)
+	router.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+}
+
+// SetupCampaignRoutes configures the routes for campaigns, which run one
+// prompt across many repositories. maxRetries is the attempt budget of
+// campaign tasks that do not set their own; zero uses the default.
+func SetupCampaignRoutes(router *gin.RouterGroup, maxRetries int) {
+	campaignHandler := handlers.NewCampaignHandler()
+	campaignHandler.SetMaxRetries(maxRetries)
+
+	router.POST("/campaigns", campaignHandler.CreateCampaign)
+	router.GET("/campaigns", campaignHandler.ListCampaigns)
+	router.GET("/campaigns/:id", campaignHandler.GetCampaign)
+	router.PATCH("/campaigns/:id", campaignHandler.UpdateCampaign)
+}
+
+// SetupWorkerRoutes configures the routes remote workers use to lease and run
+// tasks. Every route requires the shared worker token. repoConcurrency caps
+// the tasks running on one repository at once; zero leaves it unlimited.
+func SetupWorkerRoutes(router *gin.RouterGroup, token string, repoConcurrency int) {
+	workerHandler := handlers.NewWorkerHandler()
+	workerHandler.SetRepoConcurrency(repoConcurrency)
+
+	workers := router.Group("/worker", WorkerAuthMiddleware(token))
+	{
+		workers.POST("/claim", workerHandler.ClaimTask)
+		workers.POST("/reap", workerHandler.ReapTasks)
+		workers.PUT("/tasks/:id", workerHandler.ReportTask)
+		workers.POST("/tasks/:id/heartbeat", workerHandler.Heartbeat)
+		workers.POST("/tasks/:id/release", workerHandler.ReleaseTask)
+		workers.GET("/tasks/:id/status", workerHandler.GetTaskStatus)
+		workers.PUT("/tasks/:id/status", workerHandler.UpdateTaskStatus)
+		workers.POST("/tasks/:id/logs", workerHandler.AppendLogs)
+		workers.POST("/tasks/:id/diffs", workerHandler.SaveDiff)
+	}
+}
+
 // SetupHealthRoutes configures health check routes
 func SetupHealthRoutes(router *gin.Engine) {
 	router.GET("/health", HealthCheckHandler)
@@ -46,6 +95,12 @@ func SetupAPIRoutes(router *gin.Engine) {
 		})
 
 		// Task routes
-		SetupTaskRoutes(v1)
+		SetupTaskRoutes(v1, 0)
+
+		// Schedule routes
+		SetupScheduleRoutes(v1)
+
+		// Campaign routes
+		SetupCampaignRoutes(v1, 0)
 	}
 }
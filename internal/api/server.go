@@ -93,7 +93,16 @@ func (s *Server) setupRoutes() {
 		})
 
 		// Task routes
-		SetupTaskRoutes(v1)
+		SetupTaskRoutes(v1, s.config.Worker.MaxRetries)
+
+		// Schedule routes
+		SetupScheduleRoutes(v1)
+
+		// Campaign routes
+		SetupCampaignRoutes(v1, s.config.Worker.MaxRetries)
+
+		// Worker protocol routes
+		SetupWorkerRoutes(v1, s.config.Server.WorkerToken, s.config.Worker.RepoConcurrency)
 	}
 }
 
@@ -32,7 +32,7 @@ func setupTestDBForServer(t *testing.T) func() {
 	require.NoError(t, err)
 	
 	// Run migrations
-	err = database.GetDB().AutoMigrate(&models.Task{})
+	err = database.GetDB().AutoMigrate(&models.Task{}, &models.TaskDependency{})
 	require.NoError(t, err)
 	
 	// Return cleanup function
@@ -108,7 +108,7 @@ Examples:
 
 // validateAbortable checks if a task can be aborted
 func validateAbortable(task *TaskResponse) error {
-	abortableStates := []string{"queued", "running", "retrying", "needs_review"}
+	abortableStates := []string{"queued", "blocked", "running", "retrying", "needs_review"}
 	
 	for _, state := range abortableStates {
 		if task.Status == state {
@@ -150,6 +150,8 @@ func outputAbortTable(taskID string, originalTask *TaskResponse) error {
 		}
 	case "queued":
 		fmt.Println("The task has been removed from the queue.")
+	case "blocked":
+		fmt.Println("The task will no longer wait for its dependencies.")
 	case "retrying":
 		fmt.Println("The retry attempt has been cancelled.")
 	case "needs_review":
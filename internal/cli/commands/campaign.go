@@ -0,0 +1,455 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/cli/output"
+)
+
+// CreateCampaignRequest represents a campaign creation request
+type CreateCampaignRequest struct {
+	Name       string   `json:"name,omitempty"`
+	Prompt     string   `json:"prompt"`
+	Repos      []string `json:"repos,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Agent      string   `json:"agent,omitempty"`
+	MaxRetries int      `json:"max_retries,omitempty"`
+	Priority   int      `json:"priority,omitempty"`
+}
+
+// CampaignProgress counts a campaign's tasks by status
+type CampaignProgress struct {
+	Total       int `json:"total"`
+	Finished    int `json:"finished"`
+	Queued      int `json:"queued"`
+	Blocked     int `json:"blocked"`
+	Running     int `json:"running"`
+	Retrying    int `json:"retrying"`
+	NeedsReview int `json:"needs_review"`
+	Success     int `json:"success"`
+	Error       int `json:"error"`
+	Aborted     int `json:"aborted"`
+}
+
+// CampaignResponse represents a campaign in API responses
+type CampaignResponse struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name,omitempty"`
+	Prompt     string           `json:"prompt"`
+	Pattern    string           `json:"pattern,omitempty"`
+	Agent      string           `json:"agent,omitempty"`
+	MaxRetries int              `json:"max_retries,omitempty"`
+	Priority   int              `json:"priority,omitempty"`
+	Progress   CampaignProgress `json:"progress"`
+	Tasks      []TaskResponse   `json:"tasks,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// CampaignListResponse represents the response for listing campaigns
+type CampaignListResponse struct {
+	Campaigns []CampaignResponse `json:"campaigns"`
+	Total     int                `json:"total"`
+}
+
+// CampaignActionResponse represents the outcome of a bulk action on a campaign's tasks
+type CampaignActionResponse struct {
+	Action  string            `json:"action"`
+	Updated []string          `json:"updated"`
+	Skipped []string          `json:"skipped"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// NewCampaignCommand creates the campaign command and its subcommands
+func NewCampaignCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "campaign",
+		Short: "Run one prompt across many repositories",
+		Long: `Manage campaigns, which start the same task on many repositories and track
+them together.
+
+Examples:
+  ampx campaign start "Bump the Go toolchain to 1.22" https://github.com/acme/api.git https://github.com/acme/web.git
+  ampx campaign start --pattern "https://github.com/acme/*-service" "Replace the deprecated logger"
+  ampx campaign status <campaign-id> --watch
+  ampx campaign continue <campaign-id> "Also update the Dockerfile"
+  ampx campaign abort <campaign-id>`,
+	}
+
+	cmd.AddCommand(newCampaignStartCommand())
+	cmd.AddCommand(newCampaignListCommand())
+	cmd.AddCommand(newCampaignStatusCommand())
+	cmd.AddCommand(newCampaignActionCommand("continue"))
+	cmd.AddCommand(newCampaignActionCommand("abort"))
+
+	return cmd
+}
+
+// newCampaignStartCommand creates the campaign start command
+func newCampaignStartCommand() *cobra.Command {
+	var request CreateCampaignRequest
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "start <prompt> [repository...]",
+		Short: "Start a campaign",
+		Long: `Start a task running the prompt on each repository given, and on each
+repository the orchestrator already knows that matches --pattern.
+
+The pattern is a glob in which * matches within one path segment. Only
+repositories that earlier tasks or schedules have used can match it.
+
+Examples:
+  ampx campaign start "Bump the Go toolchain to 1.22" https://github.com/acme/api.git https://github.com/acme/web.git
+  ampx campaign start --pattern "https://github.com/acme/*" --name go-1.22 "Bump the Go toolchain to 1.22"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request.Prompt = args[0]
+			request.Repos = args[1:]
+
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			// Validate inputs
+			if len(request.Repos) == 0 && request.Pattern == "" {
+				return fmt.Errorf("give at least one repository or a pattern (--pattern)")
+			}
+			if err := validatePrompt(request.Prompt); err != nil {
+				return fmt.Errorf("invalid prompt: %w", err)
+			}
+			hosts, err := config.RepositoryHosts()
+			if err != nil {
+				return err
+			}
+			for _, repo := range request.Repos {
+				if err := validateStartInputs(hosts, repo, request.Prompt); err != nil {
+					return fmt.Errorf("%s: %w", repo, err)
+				}
+			}
+
+			// Make API request
+			resp, err := client.Post("/api/v1/campaigns", request)
+			if err != nil {
+				return fmt.Errorf("failed to start campaign: %w", err)
+			}
+
+			var campaign CampaignResponse
+			if err := client.HandleResponse(resp, &campaign); err != nil {
+				return fmt.Errorf("failed to start campaign: %w", err)
+			}
+
+			switch outputFormat {
+			case "json":
+				return outputJSON(campaign)
+			case "table", "":
+				fmt.Fprintln(cli.GetOutput(), output.Success(fmt.Sprintf("✓ Campaign started with %d tasks", len(campaign.Tasks))))
+				fmt.Fprintln(cli.GetOutput())
+				outputCampaignStatus(cli.GetOutput(), campaign)
+				fmt.Fprintf(cli.GetOutput(), "\nUse 'ampx campaign status %s --watch' to follow its progress\n", campaign.ID)
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format: %s", outputFormat)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&request.Pattern, "pattern", "", "Also run on the known repositories matching this glob")
+	cmd.Flags().StringVar(&request.Name, "name", "", "Name shown in campaign listings")
+	cmd.Flags().StringVar(&request.Agent, "agent", "", "Coding agent to run the tasks with (default: the worker's agent)")
+	cmd.Flags().IntVar(&request.MaxRetries, "max-retries", 0, "Maximum number of attempts for each task (default: the orchestrator's setting)")
+	cmd.Flags().IntVar(&request.Priority, "priority", 0, "Scheduling priority of each task (default: normal)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newCampaignListCommand creates the campaign list command
+func newCampaignListCommand() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List campaigns",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			resp, err := client.Get("/api/v1/campaigns")
+			if err != nil {
+				return fmt.Errorf("failed to list campaigns: %w", err)
+			}
+
+			var listResp CampaignListResponse
+			if err := client.HandleResponse(resp, &listResp); err != nil {
+				return fmt.Errorf("failed to list campaigns: %w", err)
+			}
+
+			switch outputFormat {
+			case "json":
+				return outputJSON(listResp)
+			case "table", "":
+				return outputCampaignTable(listResp.Campaigns)
+			default:
+				return fmt.Errorf("unsupported output format: %s", outputFormat)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newCampaignStatusCommand creates the campaign status command
+func newCampaignStatusCommand() *cobra.Command {
+	var outputFormat string
+	var watchMode bool
+
+	cmd := &cobra.Command{
+		Use:   "status <campaign-id>",
+		Short: "Show a campaign's progress and tasks",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			for {
+				campaign, err := getCampaign(client, args[0])
+				if err != nil {
+					return err
+				}
+
+				switch outputFormat {
+				case "json":
+					if err := outputJSON(campaign); err != nil {
+						return err
+					}
+				case "table", "":
+					outputCampaignStatus(cli.GetOutput(), *campaign)
+				default:
+					return fmt.Errorf("unsupported output format: %s", outputFormat)
+				}
+
+				if !watchMode || campaign.Progress.Finished == campaign.Progress.Total {
+					return nil
+				}
+
+				if outputFormat != "json" {
+					fmt.Fprintln(cli.GetOutput(), "\n"+strings.Repeat("-", 80))
+					fmt.Fprintf(cli.GetOutput(), "Updated at: %s\n", time.Now().Format("15:04:05"))
+					fmt.Fprintln(cli.GetOutput(), strings.Repeat("-", 80))
+				}
+				time.Sleep(5 * time.Second)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Refresh every 5 seconds until every task has finished")
+
+	return cmd
+}
+
+// newCampaignActionCommand creates the campaign continue or abort command
+func newCampaignActionCommand(action string) *cobra.Command {
+	use, short, done := "abort <campaign-id>", "Abort every unfinished task of a campaign", "Aborted"
+	args := cobra.ExactArgs(1)
+	if action == "continue" {
+		use, short, done = "continue <campaign-id> [new-prompt]", "Continue every retryable task of a campaign", "Continued"
+		args = cobra.RangeArgs(1, 2)
+	}
+
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := UpdateTaskRequest{Action: action}
+			if len(args) > 1 {
+				request.Prompt = args[1]
+				if err := validatePrompt(request.Prompt); err != nil {
+					return fmt.Errorf("invalid prompt: %w", err)
+				}
+			}
+
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			resp, err := client.Patch(fmt.Sprintf("/api/v1/campaigns/%s", args[0]), request)
+			if err != nil {
+				return fmt.Errorf("failed to %s campaign: %w", action, err)
+			}
+
+			var result CampaignActionResponse
+			if err := client.HandleResponse(resp, &result); err != nil {
+				return fmt.Errorf("failed to %s campaign: %w", action, err)
+			}
+
+			fmt.Fprintln(cli.GetOutput(), output.Success(fmt.Sprintf("✓ %s %d tasks", done, len(result.Updated))))
+			if len(result.Skipped) > 0 {
+				fmt.Fprintln(cli.GetOutput(), output.Muted(fmt.Sprintf("Skipped %d tasks it does not apply to", len(result.Skipped))))
+			}
+			if len(result.Failed) > 0 {
+				ids := make([]string, 0, len(result.Failed))
+				for id := range result.Failed {
+					ids = append(ids, id)
+				}
+				sort.Strings(ids)
+				fmt.Fprintln(cli.GetOutput(), output.Warning(fmt.Sprintf("Failed to %s %d tasks:", action, len(ids))))
+				for _, id := range ids {
+					fmt.Fprintf(cli.GetOutput(), "  %s: %s\n", id, result.Failed[id])
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// getCampaign fetches a campaign with its progress and tasks
+func getCampaign(client *cli.Client, campaignID string) (*CampaignResponse, error) {
+	resp, err := client.Get(fmt.Sprintf("/api/v1/campaigns/%s", campaignID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	var campaign CampaignResponse
+	if err := client.HandleResponse(resp, &campaign); err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	return &campaign, nil
+}
+
+// outputCampaignTable displays campaigns in table format
+func outputCampaignTable(campaigns []CampaignResponse) error {
+	if len(campaigns) == 0 {
+		fmt.Fprintln(cli.GetOutput(), output.Muted("No campaigns found"))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cli.GetOutput(), 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "ID\tNAME\tPROMPT\tTASKS\tFINISHED\tFAILED\tCREATED")
+	for _, campaign := range campaigns {
+		name := campaign.Name
+		if name == "" {
+			name = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			campaign.ID,
+			name,
+			output.TruncateString(campaign.Prompt, 40),
+			campaign.Progress.Total,
+			campaign.Progress.Finished,
+			campaign.Progress.Error+campaign.Progress.Aborted,
+			campaign.CreatedAt.Local().Format("2006-01-02 15:04"),
+		)
+	}
+
+	return nil
+}
+
+// outputCampaignStatus displays a campaign's progress bar, its counts by
+// status and its tasks
+func outputCampaignStatus(out io.Writer, campaign CampaignResponse) {
+	title := campaign.ID
+	if campaign.Name != "" {
+		title = campaign.Name + " (" + campaign.ID + ")"
+	}
+	fmt.Fprintf(out, "Campaign:    %s\n", title)
+	fmt.Fprintf(out, "Prompt:      %s\n", campaign.Prompt)
+	if campaign.Pattern != "" {
+		fmt.Fprintf(out, "Pattern:     %s\n", campaign.Pattern)
+	}
+	fmt.Fprintln(out)
+
+	progress := campaign.Progress
+	bar := output.NewProgressBar(int64(progress.Total), "Progress:")
+	bar.SetWriter(out)
+	bar.SetShowRate(false)
+	bar.Update(int64(progress.Finished))
+	fmt.Fprintln(out)
+
+	// Only the statuses some task is in are worth a mention
+	counts := []struct {
+		status string
+		count  int
+	}{
+		{"queued", progress.Queued},
+		{"blocked", progress.Blocked},
+		{"running", progress.Running},
+		{"retrying", progress.Retrying},
+		{"needs_review", progress.NeedsReview},
+		{"success", progress.Success},
+		{"error", progress.Error},
+		{"aborted", progress.Aborted},
+	}
+	var parts []string
+	for _, c := range counts {
+		if c.count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", output.Status(c.status), c.count))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintln(out, strings.Join(parts, "  "))
+	}
+
+	if len(campaign.Tasks) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "TASK\tREPOSITORY\tSTATUS\tATTEMPTS\tSUMMARY")
+	for _, task := range campaign.Tasks {
+		summary := task.Summary
+		if summary == "" {
+			summary = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			task.ID,
+			task.Repo,
+			output.Status(task.Status),
+			task.Attempts,
+			output.TruncateString(summary, 50),
+		)
+	}
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutputCampaignStatus(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	campaign := CampaignResponse{
+		ID:     "campaign-1",
+		Name:   "go-bump",
+		Prompt: "Bump the Go toolchain",
+		Progress: CampaignProgress{
+			Total:    4,
+			Finished: 2,
+			Running:  2,
+			Success:  1,
+			Error:    1,
+		},
+		Tasks: []TaskResponse{
+			{ID: "task-1", Repo: "https://github.com/acme/api", Status: "success", Attempts: 1},
+			{ID: "task-2", Repo: "https://github.com/acme/web", Status: "error", Attempts: 3, Summary: "Tests still fail"},
+		},
+	}
+
+	var buf bytes.Buffer
+	outputCampaignStatus(&buf, campaign)
+	out := buf.String()
+
+	for _, want := range []string{"go-bump (campaign-1)", "50.0% (2/4)", "running 2", "error 1", "task-2", "Tests still fail"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "remaining") {
+		t.Errorf("output estimates the time remaining:\n%s", out)
+	}
+	if strings.Contains(out, "queued") {
+		t.Errorf("output mentions a status no task is in:\n%s", out)
+	}
+
+	// A campaign without tasks renders an empty bar
+	buf.Reset()
+	outputCampaignStatus(&buf, CampaignResponse{ID: "campaign-2"})
+	if !strings.Contains(buf.String(), "0.0% (0/0)") {
+		t.Errorf("output = %q, want an empty progress bar", buf.String())
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 func TestNewContinueCommand(t *testing.T) {
@@ -565,7 +566,7 @@ func TestPromptValidation(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// We'll use the validation logic from start command since continue uses similar validation
-			err := validateStartInputs("https://github.com/user/repo.git", tt.prompt)
+			err := validateStartInputs(repourl.DefaultHosts(), "https://github.com/user/repo.git", tt.prompt)
 
 			if tt.wantErr {
 				if err == nil {
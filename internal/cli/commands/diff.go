@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/cli/output"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// diffStatBarWidth is the widest a --stat bar of added and removed lines gets
+const diffStatBarWidth = 40
+
+// TaskDiffResponse represents the files an attempt of a task changed, from the API
+type TaskDiffResponse struct {
+	TaskID       string            `json:"task_id"`
+	Attempt      int               `json:"attempt"`
+	BaseRef      string            `json:"base_ref"`
+	BaseSHA      string            `json:"base_sha"`
+	HeadSHA      string            `json:"head_sha"`
+	Files        []models.DiffFile `json:"files"`
+	FilesChanged int               `json:"files_changed"`
+	Additions    int               `json:"additions"`
+	Deletions    int               `json:"deletions"`
+	Truncated    bool              `json:"truncated,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// NewDiffCommand creates the diff command
+func NewDiffCommand() *cobra.Command {
+	var attempt int
+	var statFlag bool
+	var nameOnlyFlag bool
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "diff <task-id>",
+		Short: "Show the changes a task made",
+		Long: `Show what a task's branch changes against the branch it started from.
+
+The worker records the diff after every attempt; the latest attempt is shown
+unless --attempt picks an earlier one. Very large diffs are stored cut short,
+but --stat and --name-only always list every changed file.
+
+Examples:
+  ampx diff abc123                    # Show the latest attempt's diff
+  ampx diff abc123 --attempt 1        # Show the first attempt's diff
+  ampx diff abc123 --stat             # Show the changed files with line counts
+  ampx diff abc123 --name-only        # List the changed files
+  ampx diff abc123 -o json            # Output the file stats as JSON`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			taskID := args[0]
+
+			if attempt < 0 {
+				return fmt.Errorf("attempt cannot be negative")
+			}
+			if statFlag && nameOnlyFlag {
+				return fmt.Errorf("--stat and --name-only cannot be used together")
+			}
+			if outputFormat != "text" && outputFormat != "" && outputFormat != "json" {
+				return fmt.Errorf("unsupported output format: %s", outputFormat)
+			}
+
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			if outputFormat != "json" && !statFlag && !nameOnlyFlag {
+				return showTaskPatch(client, taskID, attempt)
+			}
+
+			diff, err := fetchTaskDiff(client, taskID, attempt)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case outputFormat == "json":
+				return outputJSON(diff)
+			case nameOnlyFlag:
+				outputDiffNames(cli.GetOutput(), diff)
+			default:
+				outputDiffStat(cli.GetOutput(), diff)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&attempt, "attempt", 0, "Attempt to show (default: the latest)")
+	cmd.Flags().BoolVar(&statFlag, "stat", false, "Show the changed files with their added and removed lines")
+	cmd.Flags().BoolVar(&nameOnlyFlag, "name-only", false, "Show only the names of the changed files")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format (text, json)")
+
+	return cmd
+}
+
+// taskDiffPath returns the API path of an attempt's diff in the given format;
+// attempt zero asks for the latest attempt
+func taskDiffPath(taskID string, attempt int, format string) string {
+	path := fmt.Sprintf("/api/v1/tasks/%s/diff?format=%s", taskID, format)
+	if attempt > 0 {
+		path += fmt.Sprintf("&attempt=%d", attempt)
+	}
+	return path
+}
+
+// fetchTaskDiff retrieves the files an attempt of a task changed
+func fetchTaskDiff(client *cli.Client, taskID string, attempt int) (*TaskDiffResponse, error) {
+	resp, err := client.Get(taskDiffPath(taskID, attempt, "json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task diff: %w", err)
+	}
+
+	var diff TaskDiffResponse
+	if err := client.HandleResponse(resp, &diff); err != nil {
+		return nil, fmt.Errorf("failed to get task diff: %w", err)
+	}
+
+	return &diff, nil
+}
+
+// showTaskPatch prints the unified diff of an attempt, colored when the
+// terminal supports it
+func showTaskPatch(client *cli.Client, taskID string, attempt int) error {
+	resp, err := client.Get(taskDiffPath(taskID, attempt, "patch"))
+	if err != nil {
+		return fmt.Errorf("failed to get task diff: %w", err)
+	}
+	if err := client.ParseError(resp); err != nil {
+		return fmt.Errorf("failed to get task diff: %w", err)
+	}
+
+	out := cli.GetOutput()
+	if len(resp.Body) == 0 {
+		fmt.Fprintln(out, output.Muted("No changes"))
+		return nil
+	}
+
+	fmt.Fprint(out, output.Diff(string(resp.Body)))
+	if resp.Headers.Get("X-Diff-Truncated") == "true" {
+		fmt.Fprintf(out, "%s %s\n", output.Warning("Diff truncated; use"), output.Code("ampx diff "+taskID+" --stat")+" to see every changed file")
+	}
+	return nil
+}
+
+// outputDiffNames prints the paths of the changed files, one per line
+func outputDiffNames(out io.Writer, diff *TaskDiffResponse) {
+	for _, file := range diff.Files {
+		fmt.Fprintln(out, file.Path)
+	}
+}
+
+// outputDiffStat prints each changed file with a bar of its added and
+// removed lines, like git diff --stat
+func outputDiffStat(out io.Writer, diff *TaskDiffResponse) {
+	if len(diff.Files) == 0 {
+		fmt.Fprintln(out, output.Muted("No changes"))
+		return
+	}
+
+	names := make([]string, len(diff.Files))
+	nameWidth, maxChanges := 0, 0
+	for i, file := range diff.Files {
+		names[i] = file.Path
+		if file.OldPath != "" {
+			names[i] = file.OldPath + " => " + file.Path
+		}
+		if len(names[i]) > nameWidth {
+			nameWidth = len(names[i])
+		}
+		if changes := file.Additions + file.Deletions; changes > maxChanges {
+			maxChanges = changes
+		}
+	}
+	countWidth := len(fmt.Sprint(maxChanges))
+
+	for i, file := range diff.Files {
+		if file.Binary {
+			fmt.Fprintf(out, " %-*s | %s\n", nameWidth, names[i], output.Muted("Bin"))
+			continue
+		}
+
+		plus, minus := diffStatBar(file.Additions, file.Deletions, maxChanges)
+		fmt.Fprintf(out, " %-*s | %*d%s\n", nameWidth, names[i], countWidth, file.Additions+file.Deletions, colorBar(plus, minus))
+	}
+
+	fmt.Fprintf(out, " %s, %s, %s\n",
+		pluralize(len(diff.Files), "file changed", "files changed"),
+		output.Success(pluralize(diff.Additions, "insertion(+)", "insertions(+)")),
+		output.Error(pluralize(diff.Deletions, "deletion(-)", "deletions(-)")))
+	if diff.BaseRef != "" {
+		fmt.Fprintf(out, " %s\n", output.Muted(fmt.Sprintf("attempt %d against %s", diff.Attempt, diff.BaseRef)))
+	}
+}
+
+// diffStatBar returns how many + and - characters show a file's added and
+// removed lines, scaled down when the largest change is wider than the bar
+func diffStatBar(additions, deletions, maxChanges int) (plus, minus int) {
+	if maxChanges <= diffStatBarWidth {
+		return additions, deletions
+	}
+
+	scale := func(n int) int {
+		scaled := n * diffStatBarWidth / maxChanges
+		// Never hide a change entirely
+		if scaled == 0 && n > 0 {
+			scaled = 1
+		}
+		return scaled
+	}
+	return scale(additions), scale(deletions)
+}
+
+// colorBar renders a --stat bar of plus and minus characters, with the
+// space that separates it from the count
+func colorBar(plus, minus int) string {
+	if plus == 0 && minus == 0 {
+		return ""
+	}
+
+	bar := " "
+	if plus > 0 {
+		bar += output.Success(strings.Repeat("+", plus))
+	}
+	if minus > 0 {
+		bar += output.Error(strings.Repeat("-", minus))
+	}
+	return bar
+}
+
+// pluralize formats a count with the singular or plural form of a noun
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
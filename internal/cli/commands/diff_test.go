@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestNewDiffCommand(t *testing.T) {
+	cmd := NewDiffCommand()
+
+	if cmd.Use != "diff <task-id>" {
+		t.Errorf("Expected use to be 'diff <task-id>', got %s", cmd.Use)
+	}
+
+	for _, flag := range []string{"attempt", "stat", "name-only", "output"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("Expected --%s flag to exist", flag)
+		}
+	}
+}
+
+// newDiffServer serves a task's diff the way the orchestrator does
+func newDiffServer(t *testing.T, diff TaskDiffResponse, patch string, truncated bool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tasks/task-123/diff" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not_found", "message": "Task not found"}`))
+			return
+		}
+		if got := r.URL.Query().Get("attempt"); got != "" && got != "2" {
+			t.Errorf("Expected attempt 2 or none, got %s", got)
+		}
+
+		if r.URL.Query().Get("format") == "patch" {
+			w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+			if truncated {
+				w.Header().Set("X-Diff-Truncated", "true")
+			}
+			w.Write([]byte(patch))
+			return
+		}
+		json.NewEncoder(w).Encode(diff)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestShowTaskPatch(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	patch := "diff --git a/auth.go b/auth.go\n--- a/auth.go\n+++ b/auth.go\n@@ -1 +1 @@\n-old\n+new\n"
+
+	tests := []struct {
+		name      string
+		taskID    string
+		patch     string
+		truncated bool
+		wantErr   string
+		expected  []string
+	}{
+		{name: "whole patch", taskID: "task-123", patch: patch, expected: []string{patch}},
+		{name: "truncated patch", taskID: "task-123", patch: patch, truncated: true, expected: []string{patch, "Diff truncated", "ampx diff task-123 --stat"}},
+		{name: "no changes", taskID: "task-123", expected: []string{"No changes"}},
+		{name: "unknown task", taskID: "nonexistent", wantErr: "failed to get task diff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newDiffServer(t, TaskDiffResponse{}, tt.patch, tt.truncated)
+			client := cli.NewClient(&cli.Config{APIUrl: server.URL})
+
+			var buf bytes.Buffer
+			oldOutput := cli.GetOutput()
+			cli.SetOutput(&buf)
+			defer cli.SetOutput(oldOutput)
+
+			err := showTaskPatch(client, tt.taskID, 2)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing '%s', got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("showTaskPatch failed: %v", err)
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(buf.String(), expected) {
+					t.Errorf("Expected output to contain %q, got:\n%s", expected, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestOutputDiffStat(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	diff := &TaskDiffResponse{
+		Attempt: 2,
+		BaseRef: "origin/main",
+		Files: []models.DiffFile{
+			{Path: "auth.go", Status: models.DiffFileModified, Additions: 3, Deletions: 1},
+			{Path: "docs/notes.md", OldPath: "notes.md", Status: models.DiffFileRenamed},
+			{Path: "logo.png", Status: models.DiffFileAdded, Binary: true},
+			{Path: "generated.go", Status: models.DiffFileAdded, Additions: 400},
+		},
+		Additions: 403,
+		Deletions: 1,
+	}
+
+	var buf bytes.Buffer
+	outputDiffStat(&buf, diff)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+
+	expected := []string{
+		" auth.go                   |   4 +-",
+		" notes.md => docs/notes.md |   0",
+		" logo.png                  | Bin",
+		" generated.go              | 400 " + strings.Repeat("+", diffStatBarWidth),
+		" 4 files changed, 403 insertions(+), 1 deletion(-)",
+		" attempt 2 against origin/main",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(expected), len(lines), buf.String())
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("Line %d: expected %q, got %q", i, want, lines[i])
+		}
+	}
+
+	buf.Reset()
+	outputDiffNames(&buf, diff)
+	if got := buf.String(); got != "auth.go\ndocs/notes.md\nlogo.png\ngenerated.go\n" {
+		t.Errorf("Expected one path per line, got:\n%s", got)
+	}
+}
+
+func TestDiffStatBar(t *testing.T) {
+	tests := []struct {
+		additions, deletions, maxChanges int
+		wantPlus, wantMinus              int
+	}{
+		{3, 1, 4, 3, 1},
+		{400, 0, 400, 40, 0},
+		{200, 200, 400, 20, 20},
+		// A small change next to a large one still shows
+		{1, 0, 400, 1, 0},
+	}
+
+	for _, tt := range tests {
+		plus, minus := diffStatBar(tt.additions, tt.deletions, tt.maxChanges)
+		if plus != tt.wantPlus || minus != tt.wantMinus {
+			t.Errorf("diffStatBar(%d, %d, %d) = %d, %d, want %d, %d",
+				tt.additions, tt.deletions, tt.maxChanges, plus, minus, tt.wantPlus, tt.wantMinus)
+		}
+	}
+}
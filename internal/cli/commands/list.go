@@ -16,17 +16,33 @@ import (
 
 // TaskResponse represents a task in API responses
 type TaskResponse struct {
-	ID        string    `json:"id"`
-	Repo      string    `json:"repo"`
-	Branch    string    `json:"branch,omitempty"`
-	ThreadID  string    `json:"thread_id,omitempty"`
-	Prompt    string    `json:"prompt"`
-	Status    string    `json:"status"`
-	CIRunID   *int64    `json:"ci_run_id,omitempty"`
-	Attempts  int       `json:"attempts"`
-	Summary   string    `json:"summary,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string           `json:"id"`
+	Repo         string           `json:"repo"`
+	Branch       string           `json:"branch,omitempty"`
+	BaseBranch   string           `json:"base_branch,omitempty"`
+	ThreadID     string           `json:"thread_id,omitempty"`
+	Agent        string           `json:"agent,omitempty"`
+	Prompt       string           `json:"prompt"`
+	Status       string           `json:"status"`
+	Priority     int              `json:"priority"`
+	CIRunID      *int64           `json:"ci_run_id,omitempty"`
+	Attempts     int              `json:"attempts"`
+	MaxRetries   int              `json:"max_retries,omitempty"`
+	NextRunAt    *time.Time       `json:"next_run_at,omitempty"`
+	Summary      string           `json:"summary,omitempty"`
+	Dependencies []TaskDependency `json:"dependencies,omitempty"`
+	Dependents   []TaskDependency `json:"dependents,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// TaskDependency represents a task's neighbour in the dependency graph
+type TaskDependency struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Branch     string `json:"branch,omitempty"`
+	BaseBranch string `json:"base_branch,omitempty"`
+	PRURL      string `json:"pr_url,omitempty"`
 }
 
 // TaskListResponse represents the response for listing tasks
@@ -74,7 +90,7 @@ Examples:
 		},
 	}
 
-	cmd.Flags().StringVarP(&statusFilter, "status", "s", "", "Filter by status (queued, running, retrying, needs_review, success, failed, aborted)")
+	cmd.Flags().StringVarP(&statusFilter, "status", "s", "", "Filter by status (queued, blocked, running, retrying, needs_review, success, failed, aborted)")
 	cmd.Flags().IntVarP(&limit, "limit", "l", 50, "Maximum number of tasks to return")
 	cmd.Flags().IntVar(&offset, "offset", 0, "Number of tasks to skip")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
@@ -205,6 +221,7 @@ func outputTaskTableWide(resp TaskListResponse) error {
 			Branch:    t.Branch,
 			Prompt:    t.Prompt,
 			Status:    models.TaskStatus(t.Status),
+			Priority:  t.Priority,
 			CreatedAt: t.CreatedAt,
 			UpdatedAt: t.UpdatedAt,
 		}
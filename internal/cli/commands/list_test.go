@@ -428,7 +428,7 @@ func TestOutputTaskTableWide(t *testing.T) {
 	output := buf.String()
 	
 	// Check for wide format specific columns
-	expectedColumns := []string{"ID", "STATUS", "REPOSITORY", "BRANCH", "PROMPT", "CREATED", "UPDATED"}
+	expectedColumns := []string{"ID", "STATUS", "PRIORITY", "REPOSITORY", "BRANCH", "PROMPT", "CREATED", "UPDATED"}
 	for _, col := range expectedColumns {
 		if !strings.Contains(output, col) {
 			t.Errorf("Expected column '%s' in wide format output", col)
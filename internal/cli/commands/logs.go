@@ -45,7 +45,7 @@ Examples:
 			client := cli.NewClient(config)
 
 			if followFlag {
-				return followTaskLogs(client, taskID, outputFormat)
+				return followTaskLogs(client, taskID, tailLines, outputFormat)
 			}
 
 			return showTaskLogs(client, taskID, tailLines, outputFormat)
@@ -59,6 +59,23 @@ Examples:
 	return cmd
 }
 
+// TaskLogEntry represents a task log entry from the API
+type TaskLogEntry struct {
+	ID        uint      `json:"id"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Stream    string    `json:"stream,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Sequence  int       `json:"sequence,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TaskLogListResponse represents the response for listing task logs
+type TaskLogListResponse struct {
+	Logs  []TaskLogEntry `json:"logs"`
+	Total int            `json:"total"`
+}
+
 // showTaskLogs displays logs for a task
 func showTaskLogs(client *cli.Client, taskID string, tailLines int, format string) error {
 	// Get task details
@@ -74,17 +91,22 @@ func showTaskLogs(client *cli.Client, taskID string, tailLines int, format strin
 
 	// Convert to models.Task for formatter
 	modelTask := models.Task{
-		ID:        task.ID,
-		Repo:      task.Repo,
-		Branch:    task.Branch,
-		ThreadID:  task.ThreadID,
-		Prompt:    task.Prompt,
-		Status:    models.TaskStatus(task.Status),
-		CIRunID:   task.CIRunID,
-		Attempts:  task.Attempts,
-		Summary:   task.Summary,
-		CreatedAt: task.CreatedAt,
-		UpdatedAt: task.UpdatedAt,
+		ID:         task.ID,
+		Repo:       task.Repo,
+		Branch:     task.Branch,
+		BaseBranch: task.BaseBranch,
+		ThreadID:   task.ThreadID,
+		Agent:      task.Agent,
+		Prompt:     task.Prompt,
+		Status:     models.TaskStatus(task.Status),
+		Priority:   task.Priority,
+		CIRunID:    task.CIRunID,
+		Attempts:   task.Attempts,
+		MaxRetries: task.MaxRetries,
+		NextRunAt:  task.NextRunAt,
+		Summary:    task.Summary,
+		CreatedAt:  task.CreatedAt,
+		UpdatedAt:  task.UpdatedAt,
 	}
 
 	// Display based on format
@@ -94,19 +116,108 @@ func showTaskLogs(client *cli.Client, taskID string, tailLines int, format strin
 		return formatter.FormatTask(modelTask)
 	case "table", "":
 		formatter := output.NewFormatter(cli.GetOutput(), output.FormatTable)
-		return formatter.FormatTask(modelTask)
+		if err := formatter.FormatTask(modelTask); err != nil {
+			return err
+		}
+		outputDependencyGraph(task)
 	default:
 		return fmt.Errorf("unsupported output format: %s", format)
 	}
+
+	logs, err := fetchTaskLogs(client, taskID, 0, tailLines)
+	if err != nil {
+		return err
+	}
+	if len(logs) > 0 {
+		fmt.Fprintln(cli.GetOutput())
+		fmt.Fprintln(cli.GetOutput(), "Logs:")
+		fmt.Fprintln(cli.GetOutput(), strings.Repeat("-", 50))
+		for _, entry := range logs {
+			outputLogEntry(entry)
+		}
+	}
+
+	return nil
+}
+
+// outputDependencyGraph prints the tasks a task depends on and the tasks
+// waiting on it, marking the branches its pull request stacks with
+func outputDependencyGraph(task TaskResponse) {
+	out := cli.GetOutput()
+	if len(task.Dependencies) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Depends on:")
+		fmt.Fprintln(out, strings.Repeat("-", 50))
+		for _, dep := range task.Dependencies {
+			stacked := ""
+			if task.BaseBranch != "" && dep.Branch == task.BaseBranch {
+				stacked = output.Muted(" (stacked on)")
+			}
+			fmt.Fprintf(out, "  ↑ %s  %s  %s%s\n", output.ID(dep.ID), output.Status(dep.Status), output.Branch(dep.Branch), stacked)
+		}
+	}
+
+	if len(task.Dependents) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Required by:")
+		fmt.Fprintln(out, strings.Repeat("-", 50))
+		for _, dep := range task.Dependents {
+			stacked := ""
+			if dep.BaseBranch != "" && dep.BaseBranch == task.Branch {
+				stacked = output.Muted(" (stacked)")
+			}
+			fmt.Fprintf(out, "  ↓ %s  %s  %s%s\n", output.ID(dep.ID), output.Status(dep.Status), output.Branch(dep.Branch), stacked)
+		}
+	}
+}
+
+// fetchTaskLogs retrieves log entries after the given ID, or the last tail entries when tail is positive
+func fetchTaskLogs(client *cli.Client, taskID string, afterID uint, tail int) ([]TaskLogEntry, error) {
+	path := fmt.Sprintf("/api/v1/tasks/%s/logs?after=%d", taskID, afterID)
+	if tail > 0 {
+		path += fmt.Sprintf("&tail=%d", tail)
+	}
+
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task logs: %w", err)
+	}
+
+	var logs TaskLogListResponse
+	if err := client.HandleResponse(resp, &logs); err != nil {
+		return nil, fmt.Errorf("failed to get task logs: %w", err)
+	}
+
+	return logs.Logs, nil
+}
+
+// outputLogEntry prints a single log entry, tagging agent output with its stream
+func outputLogEntry(entry TaskLogEntry) {
+	timestamp := output.Timestamp(entry.Timestamp.Format("15:04:05"))
+
+	switch {
+	case entry.Stream == "stderr":
+		fmt.Fprintf(cli.GetOutput(), "%s %s %s\n", timestamp, output.Warning(fmt.Sprintf("amp#%d stderr |", entry.Attempt)), entry.Message)
+	case entry.Stream != "":
+		fmt.Fprintf(cli.GetOutput(), "%s %s %s\n", timestamp, output.Muted(fmt.Sprintf("amp#%d %s |", entry.Attempt, entry.Stream)), entry.Message)
+	case entry.Level == "error":
+		fmt.Fprintf(cli.GetOutput(), "%s %s\n", timestamp, output.Error(entry.Message))
+	case entry.Level == "warn":
+		fmt.Fprintf(cli.GetOutput(), "%s %s\n", timestamp, output.Warning(entry.Message))
+	default:
+		fmt.Fprintf(cli.GetOutput(), "%s %s\n", timestamp, entry.Message)
+	}
 }
 
 // followTaskLogs follows task logs in real-time
-func followTaskLogs(client *cli.Client, taskID string, format string) error {
+func followTaskLogs(client *cli.Client, taskID string, tailLines int, format string) error {
 	fmt.Printf("Following logs for task %s... (Press Ctrl+C to exit)\n", taskID)
 	fmt.Println()
 
 	var lastStatus string
 	var lastUpdate time.Time
+	var lastLogID uint
+	tail := tailLines
 
 	for {
 		// Get current task status
@@ -135,6 +246,23 @@ func followTaskLogs(client *cli.Client, taskID string, format string) error {
 			lastUpdate = task.UpdatedAt
 		}
 
+		// Print log lines written since the last poll; the first poll starts from the tail
+		logs, err := fetchTaskLogs(client, taskID, lastLogID, tail)
+		if err != nil {
+			fmt.Printf("Error fetching logs: %v\n", err)
+		}
+		for _, entry := range logs {
+			if format == "json" {
+				cli.PrintJSON(entry)
+			} else {
+				outputLogEntry(entry)
+			}
+			lastLogID = entry.ID
+		}
+		if err == nil {
+			tail = 0
+		}
+
 		// If task is in terminal state, stop following
 		if isTerminalStatus(task.Status) {
 			fmt.Printf("\n✓ Task completed with status: %s\n", output.Status(task.Status))
@@ -159,6 +287,9 @@ func outputTaskLogs(task TaskResponse) error {
 	if task.ThreadID != "" {
 		fmt.Printf("Thread ID:   %s\n", task.ThreadID)
 	}
+	if task.Agent != "" {
+		fmt.Printf("Agent:       %s\n", task.Agent)
+	}
 	fmt.Printf("Attempts:    %d\n", task.Attempts)
 	fmt.Printf("Created:     %s\n", task.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Updated:     %s\n", task.UpdatedAt.Format("2006-01-02 15:04:05"))
@@ -187,6 +318,8 @@ func outputTaskLogs(task TaskResponse) error {
 	switch task.Status {
 	case "queued":
 		fmt.Println("Task is waiting to be processed by a worker.")
+	case "blocked":
+		fmt.Println("Task is waiting for its dependencies to succeed.")
 	case "running":
 		fmt.Println("Task is currently being processed by Amp.")
 		if task.CIRunID != nil {
@@ -194,6 +327,9 @@ func outputTaskLogs(task TaskResponse) error {
 		}
 	case "retrying":
 		fmt.Printf("Task failed and is being retried (attempt %d).\n", task.Attempts)
+		if task.NextRunAt != nil {
+			fmt.Printf("Next attempt %s.\n", output.FormatTimeUntil(*task.NextRunAt))
+		}
 	case "needs_review":
 		fmt.Println("Task requires manual review before proceeding.")
 		fmt.Println("Use 'ampx continue " + task.ID + "' to resume with modifications.")
@@ -244,6 +380,10 @@ func outputTaskUpdate(task TaskResponse, lastStatus string) {
 	if task.CIRunID != nil {
 		fmt.Printf("          CI Run: %d\n", *task.CIRunID)
 	}
+
+	if task.Status == "retrying" && task.NextRunAt != nil {
+		fmt.Printf("          Next attempt %s\n", output.FormatTimeUntil(*task.NextRunAt))
+	}
 	
 	fmt.Println()
 }
@@ -272,7 +412,7 @@ func canContinue(status string) bool {
 
 // canAbort checks if a task can be aborted
 func canAbort(status string) bool {
-	abortableStates := []string{"queued", "running", "retrying", "needs_review"}
+	abortableStates := []string{"queued", "blocked", "running", "retrying", "needs_review"}
 	for _, abortable := range abortableStates {
 		if status == abortable {
 			return true
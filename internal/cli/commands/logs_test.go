@@ -91,8 +91,8 @@ func TestLogsCommandExecution(t *testing.T) {
 				if r.Method != "GET" {
 					t.Errorf("Expected GET request, got %s", r.Method)
 				}
-				if r.URL.Path != "/api/v1/tasks/task-123" {
-					t.Errorf("Expected /api/v1/tasks/task-123 path, got %s", r.URL.Path)
+				if r.URL.Path != "/api/v1/tasks/task-123" && r.URL.Path != "/api/v1/tasks/task-123/logs" {
+					t.Errorf("Expected /api/v1/tasks/task-123 or its logs path, got %s", r.URL.Path)
 				}
 			},
 		},
@@ -394,6 +394,56 @@ func TestOutputTaskLogs(t *testing.T) {
 	}
 }
 
+func TestOutputDependencyGraph(t *testing.T) {
+	task := TaskResponse{
+		ID:         "task-2",
+		Branch:     "amp/task-2",
+		BaseBranch: "amp/task-1",
+		Status:     "blocked",
+		Dependencies: []TaskDependency{
+			{ID: "task-1", Status: "running", Branch: "amp/task-1"},
+		},
+		Dependents: []TaskDependency{
+			{ID: "task-3", Status: "blocked", Branch: "amp/task-3", BaseBranch: "amp/task-2"},
+			{ID: "task-4", Status: "blocked", Branch: "amp/task-4"},
+		},
+	}
+
+	var buf bytes.Buffer
+	oldOutput := cli.GetOutput()
+	cli.SetOutput(&buf)
+	defer cli.SetOutput(oldOutput)
+
+	outputDependencyGraph(task)
+
+	lines := strings.Split(buf.String(), "\n")
+	expected := map[string]string{
+		"task-1": "(stacked on)",
+		"task-3": "(stacked)",
+	}
+	for _, id := range []string{"task-1", "task-3", "task-4"} {
+		found := false
+		for _, line := range lines {
+			if !strings.Contains(line, id) {
+				continue
+			}
+			found = true
+			if marker := expected[id]; marker != "" && !strings.Contains(line, marker) {
+				t.Errorf("line for %s = %q, want it marked %s", id, line, marker)
+			}
+			if id == "task-4" && strings.Contains(line, "stacked") {
+				t.Errorf("line for %s = %q, want it unmarked", id, line)
+			}
+		}
+		if !found {
+			t.Errorf("Expected output to list %s, got:\n%s", id, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "Depends on:") || !strings.Contains(buf.String(), "Required by:") {
+		t.Errorf("Expected both sections, got:\n%s", buf.String())
+	}
+}
+
 // Test status-specific information display
 func TestStatusSpecificInfo(t *testing.T) {
 	now := time.Now()
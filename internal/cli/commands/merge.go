@@ -8,6 +8,7 @@ import (
 
 	"github.com/brettsmith212/ci-test-2/internal/cli"
 	"github.com/brettsmith212/ci-test-2/internal/cli/output"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 // NewMergeCommand creates the merge command
@@ -63,11 +64,15 @@ Examples:
 			}
 
 			// Display merge information
+			hosts, err := config.RepositoryHosts()
+			if err != nil {
+				return err
+			}
 			switch outputFormat {
 			case "json":
-				return outputMergeJSON(task)
+				return outputMergeJSON(task, hosts)
 			case "table", "":
-				return outputMergeTable(task)
+				return outputMergeTable(task, hosts)
 			default:
 				return fmt.Errorf("unsupported output format: %s", outputFormat)
 			}
@@ -95,7 +100,7 @@ func validateMergeable(task *TaskResponse) error {
 }
 
 // outputMergeTable displays merge information in table format
-func outputMergeTable(task *TaskResponse) error {
+func outputMergeTable(task *TaskResponse, hosts repourl.Hosts) error {
 	fmt.Println("✓ Task ready for merge!")
 	fmt.Println()
 	fmt.Printf("Task ID:     %s\n", task.ID)
@@ -122,38 +127,24 @@ func outputMergeTable(task *TaskResponse) error {
 	fmt.Println(strings.Repeat("=", 50))
 
 	// Extract repository information
-	repoURL := task.Repo
-	
-	// Remove .git suffix if present for web URLs
-	if strings.HasSuffix(repoURL, ".git") {
-		repoURL = strings.TrimSuffix(repoURL, ".git")
-	}
-	
-	// Convert SSH URLs to HTTPS for web viewing
-	if strings.HasPrefix(repoURL, "git@") {
-		// Convert git@github.com:user/repo to https://github.com/user/repo
-		parts := strings.Split(repoURL, ":")
-		if len(parts) == 2 {
-			domain := strings.TrimPrefix(parts[0], "git@")
-			repoURL = fmt.Sprintf("https://%s/%s", domain, parts[1])
-		}
-	}
+	repoURL, provider := repoWebURL(hosts, task.Repo)
 
 	fmt.Println("1. Review the changes:")
 	fmt.Printf("   Branch: %s\n", task.Branch)
-	if strings.Contains(repoURL, "github.com") {
+	if provider == repourl.ProviderGitHub {
 		fmt.Printf("   Compare: %s/compare/%s\n", repoURL, task.Branch)
 	}
 
 	fmt.Println()
 	fmt.Println("2. Create a Pull Request (if not already created):")
-	if strings.Contains(repoURL, "github.com") {
+	switch provider {
+	case repourl.ProviderGitHub:
 		fmt.Printf("   GitHub: %s/compare/%s\n", repoURL, task.Branch)
-	} else if strings.Contains(repoURL, "gitlab.com") {
+	case repourl.ProviderGitLab:
 		fmt.Printf("   GitLab: %s/-/merge_requests/new?merge_request[source_branch]=%s\n", repoURL, task.Branch)
-	} else if strings.Contains(repoURL, "bitbucket.org") {
+	case repourl.ProviderBitbucket:
 		fmt.Printf("   Bitbucket: %s/pull-requests/new?source=%s\n", repoURL, task.Branch)
-	} else {
+	default:
 		fmt.Printf("   Create PR from branch: %s\n", task.Branch)
 	}
 
@@ -180,20 +171,8 @@ func outputMergeTable(task *TaskResponse) error {
 }
 
 // outputMergeJSON displays merge information in JSON format
-func outputMergeJSON(task *TaskResponse) error {
-	repoURL := task.Repo
-	if strings.HasSuffix(repoURL, ".git") {
-		repoURL = strings.TrimSuffix(repoURL, ".git")
-	}
-	
-	// Convert SSH URLs to HTTPS
-	if strings.HasPrefix(repoURL, "git@") {
-		parts := strings.Split(repoURL, ":")
-		if len(parts) == 2 {
-			domain := strings.TrimPrefix(parts[0], "git@")
-			repoURL = fmt.Sprintf("https://%s/%s", domain, parts[1])
-		}
-	}
+func outputMergeJSON(task *TaskResponse, hosts repourl.Hosts) error {
+	repoURL, provider := repoWebURL(hosts, task.Repo)
 
 	mergeInfo := map[string]interface{}{
 		"task_id":    task.ID,
@@ -214,18 +193,32 @@ func outputMergeJSON(task *TaskResponse) error {
 	}
 
 	// Add platform-specific URLs
-	if strings.Contains(repoURL, "github.com") {
+	switch provider {
+	case repourl.ProviderGitHub:
 		mergeInfo["merge_info"].(map[string]interface{})["compare_url"] = fmt.Sprintf("%s/compare/%s", repoURL, task.Branch)
 		mergeInfo["merge_info"].(map[string]interface{})["pr_url"] = fmt.Sprintf("%s/compare/%s", repoURL, task.Branch)
-	} else if strings.Contains(repoURL, "gitlab.com") {
+	case repourl.ProviderGitLab:
 		mergeInfo["merge_info"].(map[string]interface{})["mr_url"] = fmt.Sprintf("%s/-/merge_requests/new?merge_request[source_branch]=%s", repoURL, task.Branch)
-	} else if strings.Contains(repoURL, "bitbucket.org") {
+	case repourl.ProviderBitbucket:
 		mergeInfo["merge_info"].(map[string]interface{})["pr_url"] = fmt.Sprintf("%s/pull-requests/new?source=%s", repoURL, task.Branch)
 	}
 
 	return cli.PrintJSON(mergeInfo)
 }
 
+// repoWebURL returns the web page of the repository and the provider hosting
+// it, which is empty when the host is not one of hosts
+func repoWebURL(hosts repourl.Hosts, repo string) (webURL, provider string) {
+	ref, err := repourl.Parse(repo)
+	if err != nil {
+		return strings.TrimSuffix(repo, ".git"), ""
+	}
+	if ref.IsLocal() {
+		return ref.WebURL(), ref.Provider
+	}
+	return ref.WebURL(), hosts[ref.Host]
+}
+
 // extractRepoName extracts repository name from URL
 func extractRepoName(repoURL string) string {
 	// Remove .git suffix
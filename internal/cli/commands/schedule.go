@@ -0,0 +1,340 @@
+package commands
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/cli/output"
+)
+
+// CreateScheduleRequest represents a schedule creation request
+type CreateScheduleRequest struct {
+	Name       string `json:"name,omitempty"`
+	Cron       string `json:"cron"`
+	Timezone   string `json:"timezone,omitempty"`
+	Repo       string `json:"repo"`
+	Prompt     string `json:"prompt"`
+	Agent      string `json:"agent,omitempty"`
+	MaxRetries int    `json:"max_retries,omitempty"`
+	Priority   int    `json:"priority,omitempty"`
+}
+
+// UpdateScheduleRequest represents a request to pause or resume a schedule
+type UpdateScheduleRequest struct {
+	Paused bool `json:"paused"`
+}
+
+// ScheduleResponse represents a schedule in API responses
+type ScheduleResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	Cron       string     `json:"cron"`
+	Timezone   string     `json:"timezone,omitempty"`
+	Repo       string     `json:"repo"`
+	Prompt     string     `json:"prompt"`
+	Agent      string     `json:"agent,omitempty"`
+	MaxRetries int        `json:"max_retries,omitempty"`
+	Priority   int        `json:"priority,omitempty"`
+	Paused     bool       `json:"paused"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastTaskID string     `json:"last_task_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScheduleListResponse represents the response for listing schedules
+type ScheduleListResponse struct {
+	Schedules []ScheduleResponse `json:"schedules"`
+	Total     int                `json:"total"`
+}
+
+// NewScheduleCommand creates the schedule command and its subcommands
+func NewScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Manage recurring tasks",
+		Long: `Manage schedules that start a task on a cron expression.
+
+A schedule skips a run while the task it started last is still queued,
+running or waiting to retry; a task waiting for review does not hold it up.
+
+Examples:
+  ampx schedule create --cron "0 3 * * *" https://github.com/user/repo.git "Bump minor deps and fix the build"
+  ampx schedule list
+  ampx schedule pause <schedule-id>
+  ampx schedule resume <schedule-id>
+  ampx schedule delete <schedule-id>`,
+	}
+
+	cmd.AddCommand(newScheduleCreateCommand())
+	cmd.AddCommand(newScheduleListCommand())
+	cmd.AddCommand(newSchedulePauseCommand(true))
+	cmd.AddCommand(newSchedulePauseCommand(false))
+	cmd.AddCommand(newScheduleDeleteCommand())
+
+	return cmd
+}
+
+// newScheduleCreateCommand creates the schedule create command
+func newScheduleCreateCommand() *cobra.Command {
+	var request CreateScheduleRequest
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "create <repository> <prompt>",
+		Short: "Create a recurring task",
+		Long: `Create a schedule that starts a task for the repository and prompt whenever
+its cron expression fires.
+
+The expression has five fields (minute hour day-of-month month day-of-week),
+or is one of @hourly, @daily, @weekly, @monthly and @yearly. It is read in
+UTC unless --timezone is given.
+
+Examples:
+  ampx schedule create --cron "0 3 * * *" https://github.com/user/repo.git "Bump minor deps and fix the build"
+  ampx schedule create --cron "@weekly" --name mocks https://github.com/user/repo.git "Regenerate mocks"
+  ampx schedule create --cron "30 1 * * mon-fri" --timezone Europe/Berlin https://github.com/user/repo.git "Update snapshots"`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request.Repo = args[0]
+			request.Prompt = args[1]
+
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			// Validate inputs
+			hosts, err := config.RepositoryHosts()
+			if err != nil {
+				return err
+			}
+			if err := validateStartInputs(hosts, request.Repo, request.Prompt); err != nil {
+				return err
+			}
+			if request.Cron == "" {
+				return fmt.Errorf("a cron expression is required (--cron)")
+			}
+
+			// Make API request
+			resp, err := client.Post("/api/v1/schedules", request)
+			if err != nil {
+				return fmt.Errorf("failed to create schedule: %w", err)
+			}
+
+			var schedule ScheduleResponse
+			if err := client.HandleResponse(resp, &schedule); err != nil {
+				return fmt.Errorf("failed to create schedule: %w", err)
+			}
+
+			switch outputFormat {
+			case "json":
+				return outputJSON(schedule)
+			case "table", "":
+				fmt.Fprintln(cli.GetOutput(), output.Success("✓ Schedule created"))
+				fmt.Fprintln(cli.GetOutput())
+				return outputScheduleDetails(schedule)
+			default:
+				return fmt.Errorf("unsupported output format: %s", outputFormat)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&request.Cron, "cron", "", "Cron expression, e.g. \"0 3 * * *\" or @daily")
+	cmd.Flags().StringVar(&request.Timezone, "timezone", "", "IANA time zone the cron expression is read in (default: UTC)")
+	cmd.Flags().StringVar(&request.Name, "name", "", "Name shown in schedule listings")
+	cmd.Flags().StringVar(&request.Agent, "agent", "", "Coding agent to run the tasks with (default: the worker's agent)")
+	cmd.Flags().IntVar(&request.MaxRetries, "max-retries", 0, "Maximum number of attempts for each task (default: the orchestrator's setting)")
+	cmd.Flags().IntVar(&request.Priority, "priority", 0, "Scheduling priority of each task (default: normal)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newScheduleListCommand creates the schedule list command
+func newScheduleListCommand() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List recurring tasks",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			resp, err := client.Get("/api/v1/schedules")
+			if err != nil {
+				return fmt.Errorf("failed to list schedules: %w", err)
+			}
+
+			var listResp ScheduleListResponse
+			if err := client.HandleResponse(resp, &listResp); err != nil {
+				return fmt.Errorf("failed to list schedules: %w", err)
+			}
+
+			switch outputFormat {
+			case "json":
+				return outputJSON(listResp)
+			case "table", "":
+				return outputScheduleTable(listResp.Schedules)
+			default:
+				return fmt.Errorf("unsupported output format: %s", outputFormat)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newSchedulePauseCommand creates the schedule pause command, or the resume
+// command when pause is false
+func newSchedulePauseCommand(pause bool) *cobra.Command {
+	use, short, done := "resume", "Resume a paused schedule", "resumed"
+	if pause {
+		use, short, done = "pause", "Pause a schedule", "paused"
+	}
+
+	return &cobra.Command{
+		Use:   use + " <schedule-id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			resp, err := client.Patch(fmt.Sprintf("/api/v1/schedules/%s", args[0]), UpdateScheduleRequest{Paused: pause})
+			if err != nil {
+				return fmt.Errorf("failed to %s schedule: %w", use, err)
+			}
+
+			var schedule ScheduleResponse
+			if err := client.HandleResponse(resp, &schedule); err != nil {
+				return fmt.Errorf("failed to %s schedule: %w", use, err)
+			}
+
+			fmt.Fprintln(cli.GetOutput(), output.Success(fmt.Sprintf("✓ Schedule %s %s", schedule.ID, done)))
+			if !schedule.Paused && schedule.NextRunAt != nil {
+				fmt.Fprintf(cli.GetOutput(), "Next run: %s\n", formatNextRun(schedule))
+			}
+			return nil
+		},
+	}
+}
+
+// newScheduleDeleteCommand creates the schedule delete command
+func newScheduleDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <schedule-id>",
+		Short: "Delete a schedule; tasks it already started are kept",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load configuration
+			config, err := cli.LoadConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			// Create client
+			client := cli.NewClient(config)
+
+			resp, err := client.Delete(fmt.Sprintf("/api/v1/schedules/%s", args[0]))
+			if err != nil {
+				return fmt.Errorf("failed to delete schedule: %w", err)
+			}
+			if err := client.HandleResponse(resp, nil); err != nil {
+				return fmt.Errorf("failed to delete schedule: %w", err)
+			}
+
+			fmt.Fprintln(cli.GetOutput(), output.Success(fmt.Sprintf("✓ Schedule %s deleted", args[0])))
+			return nil
+		},
+	}
+}
+
+// outputScheduleTable displays schedules in table format
+func outputScheduleTable(schedules []ScheduleResponse) error {
+	if len(schedules) == 0 {
+		fmt.Fprintln(cli.GetOutput(), output.Muted("No schedules found"))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cli.GetOutput(), 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "ID\tNAME\tCRON\tREPOSITORY\tPROMPT\tNEXT RUN\tLAST TASK")
+	for _, schedule := range schedules {
+		name := schedule.Name
+		if name == "" {
+			name = "-"
+		}
+		lastTask := schedule.LastTaskID
+		if lastTask == "" {
+			lastTask = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			schedule.ID,
+			name,
+			schedule.Cron,
+			schedule.Repo,
+			output.TruncateString(schedule.Prompt, 40),
+			formatNextRun(schedule),
+			lastTask,
+		)
+	}
+
+	return nil
+}
+
+// outputScheduleDetails displays a single schedule
+func outputScheduleDetails(schedule ScheduleResponse) error {
+	out := cli.GetOutput()
+	fmt.Fprintf(out, "Schedule ID: %s\n", schedule.ID)
+	if schedule.Name != "" {
+		fmt.Fprintf(out, "Name:        %s\n", schedule.Name)
+	}
+	cronText := schedule.Cron
+	if schedule.Timezone != "" {
+		cronText += " (" + schedule.Timezone + ")"
+	}
+	fmt.Fprintf(out, "Cron:        %s\n", cronText)
+	fmt.Fprintf(out, "Repository:  %s\n", schedule.Repo)
+	fmt.Fprintf(out, "Prompt:      %s\n", schedule.Prompt)
+	fmt.Fprintf(out, "Next run:    %s\n", formatNextRun(schedule))
+	return nil
+}
+
+// formatNextRun describes when a schedule runs next
+func formatNextRun(schedule ScheduleResponse) string {
+	if schedule.Paused {
+		return output.Warning("paused")
+	}
+	if schedule.NextRunAt == nil {
+		return "-"
+	}
+	return schedule.NextRunAt.Local().Format("2006-01-02 15:04") + " (" + output.FormatTimeUntil(*schedule.NextRunAt) + ")"
+}
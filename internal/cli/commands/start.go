@@ -8,37 +8,60 @@ import (
 
 	"github.com/brettsmith212/ci-test-2/internal/cli"
 	"github.com/brettsmith212/ci-test-2/internal/cli/output"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 // CreateTaskRequest represents a task creation request
 type CreateTaskRequest struct {
-	Repo   string `json:"repo"`
-	Prompt string `json:"prompt"`
+	Repo          string   `json:"repo"`
+	Prompt        string   `json:"prompt"`
+	Agent         string   `json:"agent,omitempty"`
+	MaxRetries    int      `json:"max_retries,omitempty"`
+	Priority      int      `json:"priority,omitempty"`
+	DependsOn     []string `json:"depends_on,omitempty"`
+	StackOnParent bool     `json:"stack_on_parent,omitempty"`
 }
 
 // CreateTaskResponse represents a task creation response
 type CreateTaskResponse struct {
-	ID     string `json:"id"`
-	Branch string `json:"branch"`
+	ID         string `json:"id"`
+	Branch     string `json:"branch"`
+	BaseBranch string `json:"base_branch,omitempty"`
+	Status     string `json:"status,omitempty"`
 }
 
 // NewStartCommand creates the start command
 func NewStartCommand() *cobra.Command {
 	var waitFlag bool
 	var outputFormat string
+	var agent string
+	var maxRetries int
+	var priority int
+	var dependsOn []string
+	var stack bool
 
 	cmd := &cobra.Command{
 		Use:   "start <repository> <prompt>",
 		Short: "Start a new CI-driven Amp task",
 		Long: `Start a new CI-driven Amp task for the specified repository with the given prompt.
 
-The repository should be a valid Git URL (GitHub, GitLab, Bitbucket supported).
+The repository may be an https, ssh:// or scp-like (git@host:owner/repo.git)
+URL on GitHub, GitLab or Bitbucket, or owner/repo shorthand for GitHub.
+Self-hosted hosts are allowed by listing them in repo_hosts (AMPX_REPO_HOSTS),
+e.g. git.example.com=gitlab; listing local also allows a file:// URL or path
+of a local repository, when the orchestrator allows them too.
 The prompt should describe what you want Amp to do.
 
 Examples:
   ampx start https://github.com/user/repo.git "Fix the authentication bug"
   ampx start git@github.com:user/repo.git "Add unit tests for user service"
-  ampx start --wait https://github.com/user/repo.git "Optimize database queries"`,
+  ampx start ssh://git@gitlab.com/group/subgroup/repo.git "Fix the linter warnings"
+  ampx start --wait https://github.com/user/repo.git "Optimize database queries"
+  ampx start --agent command https://github.com/user/repo.git "Bump the Go version"
+  ampx start --max-retries 5 https://github.com/user/repo.git "Fix the flaky tests"
+  ampx start --priority 8 https://github.com/user/repo.git "Fix the production outage"
+  ampx start --depends-on <task-id> --stack https://github.com/user/repo.git "Migrate the callers to the new API"`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			repo := args[0]
@@ -54,14 +77,33 @@ Examples:
 			client := cli.NewClient(config)
 
 			// Validate inputs
-			if err := validateStartInputs(repo, prompt); err != nil {
+			hosts, err := config.RepositoryHosts()
+			if err != nil {
+				return err
+			}
+			if err := validateStartInputs(hosts, repo, prompt); err != nil {
 				return err
 			}
+			if maxRetries < 0 {
+				return fmt.Errorf("max retries cannot be negative")
+			}
+			if cmd.Flags().Changed("priority") && (priority < models.MinTaskPriority || priority > models.MaxTaskPriority) {
+				return fmt.Errorf("priority must be between %d and %d", models.MinTaskPriority, models.MaxTaskPriority)
+			}
+			if stack && len(dependsOn) != 1 {
+				return fmt.Errorf("--stack needs exactly one --depends-on task")
+			}
 
 			// Create task request
 			request := CreateTaskRequest{
-				Repo:   repo,
-				Prompt: prompt,
+				Repo:       repo,
+				Prompt:     prompt,
+				Agent:      agent,
+				MaxRetries: maxRetries,
+				Priority:   priority,
+
+				DependsOn:     dependsOn,
+				StackOnParent: stack,
 			}
 
 			if config.Verbose {
@@ -86,7 +128,7 @@ Examples:
 			case "json":
 				return outputJSON(createResp)
 			case "table", "":
-				return outputStartTable(createResp, repo, prompt)
+				return outputStartTable(createResp, repo, prompt, agent)
 			default:
 				return fmt.Errorf("unsupported output format: %s", outputFormat)
 			}
@@ -95,37 +137,23 @@ Examples:
 
 	cmd.Flags().BoolVarP(&waitFlag, "wait", "w", false, "Wait for task completion before returning")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format (table, json)")
+	cmd.Flags().StringVar(&agent, "agent", "", "Coding agent to run the task with (default: the worker's agent)")
+	cmd.Flags().IntVar(&maxRetries, "max-retries", 0, "Maximum number of attempts for this task (default: the orchestrator's setting)")
+	cmd.Flags().StringSliceVar(&dependsOn, "depends-on", nil, "Task IDs that must succeed before this task starts (repeatable or comma-separated)")
+	cmd.Flags().BoolVar(&stack, "stack", false, "Start the task's branch from its dependency's branch, stacking the pull requests")
+	cmd.Flags().IntVar(&priority, "priority", 0, fmt.Sprintf("Scheduling priority from %d to %d; higher priorities get a larger share of the workers (default %d)", models.MinTaskPriority, models.MaxTaskPriority, models.DefaultTaskPriority))
 
 	return cmd
 }
 
 // validateStartInputs validates the repository URL and prompt
-func validateStartInputs(repo, prompt string) error {
+func validateStartInputs(hosts repourl.Hosts, repo, prompt string) error {
 	// Validate repository URL
 	if repo == "" {
 		return fmt.Errorf("repository URL cannot be empty")
 	}
-
-	// Basic URL validation
-	validPrefixes := []string{
-		"https://github.com/",
-		"https://gitlab.com/",
-		"https://bitbucket.org/",
-		"git@github.com:",
-		"git@gitlab.com:",
-		"git@bitbucket.org:",
-	}
-
-	valid := false
-	for _, prefix := range validPrefixes {
-		if strings.HasPrefix(repo, prefix) {
-			valid = true
-			break
-		}
-	}
-
-	if !valid {
-		return fmt.Errorf("repository URL must be a valid Git URL (GitHub, GitLab, or Bitbucket)")
+	if _, err := hosts.Parse(repo); err != nil {
+		return fmt.Errorf("invalid repository URL: %w", err)
 	}
 
 	// Validate prompt
@@ -162,14 +190,23 @@ func validateStartInputs(repo, prompt string) error {
 }
 
 // outputStartTable displays the result in table format
-func outputStartTable(resp CreateTaskResponse, repo, prompt string) error {
+func outputStartTable(resp CreateTaskResponse, repo, prompt, agent string) error {
 	output.PrintSuccess("Task created successfully!")
 	fmt.Println()
 	
 	fmt.Printf("%-12s %s\n", output.Primary("Task ID:"), output.ID(resp.ID))
 	fmt.Printf("%-12s %s\n", output.Primary("Branch:"), output.Branch(resp.Branch))
+	if resp.BaseBranch != "" {
+		fmt.Printf("%-12s %s\n", output.Primary("Stacked on:"), output.Branch(resp.BaseBranch))
+	}
 	fmt.Printf("%-12s %s\n", output.Primary("Repository:"), output.Repository(repo))
 	fmt.Printf("%-12s %s\n", output.Primary("Prompt:"), prompt)
+	if agent != "" {
+		fmt.Printf("%-12s %s\n", output.Primary("Agent:"), agent)
+	}
+	if resp.Status == string(models.TaskStatusBlocked) {
+		fmt.Printf("%-12s %s\n", output.Primary("Status:"), output.Status(resp.Status)+" until its dependencies succeed")
+	}
 	
 	fmt.Println()
 	fmt.Printf("%s %s\n", output.Info("Use"), output.Code("ampx logs "+resp.ID)+" to monitor progress")
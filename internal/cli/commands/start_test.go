@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/brettsmith212/ci-test-2/internal/cli"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 func TestNewStartCommand(t *testing.T) {
@@ -56,6 +57,25 @@ func TestValidateStartInputs(t *testing.T) {
 			prompt:  "Fix tests",
 			wantErr: false,
 		},
+		{
+			name:    "valid ssh gitlab repo in nested groups",
+			repo:    "ssh://git@gitlab.com/group/subgroup/repo.git",
+			prompt:  "Fix the linter warnings",
+			wantErr: false,
+		},
+		{
+			name:    "valid local repo",
+			repo:    "file:///srv/git/repo.git",
+			prompt:  "Fix the linter warnings",
+			wantErr: false,
+		},
+		{
+			name:    "unlisted self-hosted repo",
+			repo:    "git@git.example.com:user/repo.git",
+			prompt:  "Fix the bug",
+			wantErr: true,
+			errMsg:  "unsupported repository host: git.example.com",
+		},
 		{
 			name:    "empty repo",
 			repo:    "",
@@ -109,7 +129,7 @@ func TestValidateStartInputs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateStartInputs(tt.repo, tt.prompt)
+			err := validateStartInputs(repourl.DefaultHosts(), tt.repo, tt.prompt)
 
 			if tt.wantErr {
 				if err == nil {
@@ -327,7 +347,7 @@ func TestOutputStartTable(t *testing.T) {
 			cli.SetOutput(&buf)
 			defer cli.SetOutput(oldOutput)
 
-			err := outputStartTable(tt.response, tt.repo, tt.prompt)
+			err := outputStartTable(tt.response, tt.repo, tt.prompt, "")
 			if err != nil {
 				t.Fatalf("outputStartTable failed: %v", err)
 			}
@@ -383,7 +403,7 @@ func BenchmarkValidateStartInputs(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		validateStartInputs(repo, prompt)
+		validateStartInputs(repourl.DefaultHosts(), repo, prompt)
 	}
 }
 
@@ -403,6 +423,6 @@ func BenchmarkOutputStartTable(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		buf.Reset()
-		outputStartTable(response, repo, prompt)
+		outputStartTable(response, repo, prompt, "")
 	}
 }
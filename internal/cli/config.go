@@ -8,12 +8,17 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 // Config represents the CLI configuration
 type Config struct {
 	APIUrl  string `json:"api_url" mapstructure:"api_url"`
 	Verbose bool   `json:"verbose" mapstructure:"verbose"`
+	// Self-hosted repository hosts as host=provider pairs, e.g.
+	// git.example.com=gitlab
+	RepoHosts string `json:"repo_hosts,omitempty" mapstructure:"repo_hosts"`
 }
 
 // DefaultConfig returns a configuration with default values
@@ -42,6 +47,10 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 	// Environment variable support
 	viper.SetEnvPrefix("AMPX")
 	viper.AutomaticEnv()
+	// Unmarshal only sees environment variables of keys viper knows about
+	if err := viper.BindEnv("repo_hosts"); err != nil {
+		return nil, fmt.Errorf("failed to bind repo_hosts: %w", err)
+	}
 
 	// Try to read config file
 	if err := viper.ReadInConfig(); err != nil {
@@ -150,6 +159,16 @@ func (c *Config) String() string {
 	return fmt.Sprintf("APIUrl: %s, Verbose: %v", c.APIUrl, c.Verbose)
 }
 
+// RepositoryHosts returns the hosts repositories may live on: github.com,
+// gitlab.com, bitbucket.org and the configured self-hosted hosts
+func (c *Config) RepositoryHosts() (repourl.Hosts, error) {
+	hosts, err := repourl.ParseHosts(c.RepoHosts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo_hosts: %w", err)
+	}
+	return hosts, nil
+}
+
 // GetAPIUrl returns the API URL with proper formatting
 func (c *Config) GetAPIUrl() string {
 	url := c.APIUrl
@@ -75,6 +75,7 @@ var (
 	// Status-specific colors
 	StatusColors = map[string]Color{
 		"queued":     Yellow,
+		"blocked":    Magenta,
 		"running":    Blue,
 		"completed":  BrightGreen,
 		"failed":     Red,
@@ -242,3 +243,40 @@ func Branch(text string) string {
 func Repository(text string) string {
 	return Colorize(text, BrightCyan)
 }
+
+// Diff colors a unified diff the way git does: file headers in bold, hunk
+// headers in the secondary color, added lines as success and removed lines
+// as errors
+func Diff(patch string) string {
+	if !IsColorEnabled() {
+		return patch
+	}
+
+	var b strings.Builder
+	inHeader := false
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		newline := line[len(text):]
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "diff "):
+			inHeader = true
+			text = BoldText(text)
+		case strings.HasPrefix(text, "@@"):
+			inHeader = false
+			text = Secondary(text)
+		case inHeader:
+			// index, mode, rename and ---/+++ lines up to the first hunk
+			text = BoldText(text)
+		case strings.HasPrefix(text, "+"):
+			text = Success(text)
+		case strings.HasPrefix(text, "-"):
+			text = Error(text)
+		case strings.HasPrefix(text, "\\"):
+			text = Muted(text)
+		}
+		b.WriteString(text)
+		b.WriteString(newline)
+	}
+	return b.String()
+}
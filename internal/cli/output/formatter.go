@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -100,9 +101,9 @@ func (f *Formatter) formatTasksWide(tasks []models.Task) error {
 	defer w.Flush()
 
 	// Header
-	header := "ID\tSTATUS\tREPOSITORY\tBRANCH\tPROMPT\tCREATED\tUPDATED"
+	header := "ID\tSTATUS\tPRIORITY\tREPOSITORY\tBRANCH\tPROMPT\tCREATED\tUPDATED"
 	if f.colors {
-		header = Header("ID") + "\t" + Header("STATUS") + "\t" + Header("REPOSITORY") + "\t" + Header("BRANCH") + "\t" + Header("PROMPT") + "\t" + Header("CREATED") + "\t" + Header("UPDATED")
+		header = Header("ID") + "\t" + Header("STATUS") + "\t" + Header("PRIORITY") + "\t" + Header("REPOSITORY") + "\t" + Header("BRANCH") + "\t" + Header("PROMPT") + "\t" + Header("CREATED") + "\t" + Header("UPDATED")
 	}
 	fmt.Fprintln(w, header)
 
@@ -110,13 +111,14 @@ func (f *Formatter) formatTasksWide(tasks []models.Task) error {
 	for _, task := range tasks {
 		id := f.formatID(task.ID)
 		status := f.formatStatus(task.Status)
+		priority := f.formatPriority(task.Priority)
 		repo := f.formatRepository(task.Repo)
 		branch := f.formatBranch(task.Branch)
 		prompt := f.formatPrompt(task.Prompt, 60)
 		created := f.formatTime(task.CreatedAt)
 		updated := f.formatTime(task.UpdatedAt)
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", id, status, repo, branch, prompt, created, updated)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", id, status, priority, repo, branch, prompt, created, updated)
 	}
 
 	return nil
@@ -138,13 +140,29 @@ func (f *Formatter) formatTaskDetailed(task models.Task) error {
 	if task.Branch != "" {
 		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Branch:"), f.formatBranch(task.Branch))
 	}
+	if task.BaseBranch != "" {
+		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Stacked on:"), f.formatBranch(task.BaseBranch))
+	}
 	if task.ThreadID != "" {
 		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Thread ID:"), task.ThreadID)
 	}
+	if task.Agent != "" {
+		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Agent:"), task.Agent)
+	}
+	if task.Priority > 0 {
+		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Priority:"), f.formatPriority(task.Priority))
+	}
 	if task.CIRunID != nil {
 		fmt.Fprintf(f.writer, "%-12s %d\n", Primary("CI Run ID:"), *task.CIRunID)
 	}
-	fmt.Fprintf(f.writer, "%-12s %d\n", Primary("Attempts:"), task.Attempts)
+	if task.MaxRetries > 0 {
+		fmt.Fprintf(f.writer, "%-12s %d/%d\n", Primary("Attempts:"), task.Attempts, task.MaxRetries)
+	} else {
+		fmt.Fprintf(f.writer, "%-12s %d\n", Primary("Attempts:"), task.Attempts)
+	}
+	if task.Status == models.TaskStatusRetrying && task.NextRunAt != nil {
+		fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Next run:"), Warning("next attempt "+FormatTimeUntil(*task.NextRunAt)))
+	}
 	fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Created:"), f.formatTime(task.CreatedAt))
 	fmt.Fprintf(f.writer, "%-12s %s\n", Primary("Updated:"), f.formatTime(task.UpdatedAt))
 
@@ -187,6 +205,22 @@ func (f *Formatter) formatStatus(status models.TaskStatus) string {
 	return statusStr
 }
 
+func (f *Formatter) formatPriority(priority int) string {
+	if priority == 0 {
+		return Muted("-")
+	}
+
+	text := strconv.Itoa(priority)
+	switch {
+	case priority > models.DefaultTaskPriority:
+		return Warning(text)
+	case priority < models.DefaultTaskPriority:
+		return Muted(text)
+	default:
+		return text
+	}
+}
+
 func (f *Formatter) formatRepository(repo string) string {
 	// Extract just the repo name from URL for display
 	parts := strings.Split(repo, "/")
@@ -271,6 +305,29 @@ func (f *Formatter) formatLongText(text string) string {
 
 // Utility functions for common formatting patterns
 
+// FormatTimeUntil describes how long until t, e.g. "in 4m" or "in 1h30m",
+// or "due now" once it has passed
+func FormatTimeUntil(t time.Time) string {
+	d := time.Until(t).Round(time.Second)
+	if d <= 0 {
+		return "due now"
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("in %ds", int(d.Seconds()))
+	}
+
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("in %dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("in %dh", hours)
+	default:
+		return fmt.Sprintf("in %dh%dm", hours, minutes)
+	}
+}
+
 func FormatTasksTable(tasks []models.Task, writer io.Writer) error {
 	formatter := NewFormatter(writer, FormatTable)
 	return formatter.FormatTasks(tasks)
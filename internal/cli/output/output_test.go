@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestIsColorEnabled(t *testing.T) {
@@ -108,6 +109,40 @@ func TestColorize(t *testing.T) {
 	}
 }
 
+func TestDiff(t *testing.T) {
+	t.Setenv("AMPX_COLOR", "1")
+	t.Setenv("NO_COLOR", "")
+
+	patch := "diff --git a/auth.go b/auth.go\n--- a/auth.go\n+++ b/auth.go\n@@ -1,2 +1,2 @@\n-old line\n+new line\n--- a removed line that looks like a header\n context\n"
+	lines := strings.Split(Diff(patch), "\n")
+
+	expected := []string{
+		BoldText("diff --git a/auth.go b/auth.go"),
+		BoldText("--- a/auth.go"),
+		BoldText("+++ b/auth.go"),
+		Secondary("@@ -1,2 +1,2 @@"),
+		Error("-old line"),
+		Success("+new line"),
+		Error("--- a removed line that looks like a header"),
+		" context",
+		"",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(expected), len(lines), lines)
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("Line %d: expected %q, got %q", i, want, lines[i])
+		}
+	}
+
+	// Without colors the patch is returned untouched, so it can be applied
+	t.Setenv("NO_COLOR", "1")
+	if result := Diff(patch); result != patch {
+		t.Errorf("Expected the plain patch with colors disabled, got %q", result)
+	}
+}
+
 func TestStatus(t *testing.T) {
 	tests := []struct {
 		status   string
@@ -189,6 +224,44 @@ func TestTruncateString(t *testing.T) {
 	}
 }
 
+func TestFormatTimeUntil(t *testing.T) {
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		expected string
+	}{
+		{
+			name:     "past",
+			offset:   -time.Minute,
+			expected: "due now",
+		},
+		{
+			name:     "seconds",
+			offset:   45*time.Second + 200*time.Millisecond,
+			expected: "in 45s",
+		},
+		{
+			name:     "minutes",
+			offset:   4*time.Minute + 10*time.Second,
+			expected: "in 4m",
+		},
+		{
+			name:     "hours and minutes",
+			offset:   90*time.Minute + 10*time.Second,
+			expected: "in 1h30m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FormatTimeUntil(time.Now().Add(tt.offset))
+			if result != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestSemanticFormatters(t *testing.T) {
 	// Test that semantic formatters return non-empty strings
 	testText := "test message"
@@ -189,6 +189,13 @@ func (pb *ProgressBar) SetWriter(w io.Writer) {
 	pb.writer = w
 }
 
+// SetShowRate sets whether the progress bar estimates the time remaining
+func (pb *ProgressBar) SetShowRate(show bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.showRate = show
+}
+
 // Update updates the progress bar with the current value
 func (pb *ProgressBar) Update(current int64) {
 	pb.mu.Lock()
@@ -214,8 +221,12 @@ func (pb *ProgressBar) Finish() {
 }
 
 func (pb *ProgressBar) render() {
-	percentage := float64(pb.current) / float64(pb.total) * 100
-	filled := int(float64(pb.width) * float64(pb.current) / float64(pb.total))
+	// An empty bar has nothing to divide by
+	percentage, filled := 0.0, 0
+	if pb.total > 0 {
+		percentage = float64(pb.current) / float64(pb.total) * 100
+		filled = int(float64(pb.width) * float64(pb.current) / float64(pb.total))
+	}
 	
 	bar := strings.Repeat("█", filled) + strings.Repeat("░", pb.width-filled)
 	
@@ -7,17 +7,23 @@ import (
 
 // Config holds the application configuration
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	GitHub   GitHubConfig
-	Amp      AmpConfig
-	Worker   WorkerConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	GitHub     GitHubConfig
+	GitLab     GitLabConfig
+	Bitbucket  BitbucketConfig
+	Repository RepositoryConfig
+	Commit     CommitConfig
+	Amp        AmpConfig
+	Worker     WorkerConfig
 }
 
 // ServerConfig holds server-specific configuration
 type ServerConfig struct {
-	Address string
-	Port    int
+	Address          string
+	Port             int
+	WorkerToken      string // shared secret remote workers authenticate with
+	ScheduleInterval int    // seconds between checks for due schedules
 }
 
 // DatabaseConfig holds database configuration
@@ -30,20 +36,59 @@ type GitHubConfig struct {
 	AppID          string
 	PrivateKeyPath string
 	Token          string
+	APIURL         string
+}
+
+// GitLabConfig holds GitLab integration configuration
+type GitLabConfig struct {
+	Token string
+	URL   string // instance URL of self-managed GitLab; empty for gitlab.com
+}
+
+// BitbucketConfig holds Bitbucket Cloud integration configuration
+type BitbucketConfig struct {
+	Username string // owner of the app password; empty when Token is an access token
+	Token    string // app password or access token
+}
+
+// RepositoryConfig holds the hosts task repositories may live on
+type RepositoryConfig struct {
+	Hosts string // self-hosted hosts as host=provider pairs, e.g. git.example.com=gitlab; "local" allows local repositories
+}
+
+// CommitConfig holds the identity, signing and messages of worker commits
+type CommitConfig struct {
+	Author     string // "Name <email>"
+	Committer  string // "Name <email>"; empty commits as the author
+	Signing    string // ssh, gpg, or empty for unsigned commits
+	SigningKey string // SSH private key path or GPG key ID
+	Template   string // Go text/template of commit messages
+	CoAuthors  string // comma-separated "Name <email>" co-authors
+	Squash     bool   // squash a task's commits before its pull request
 }
 
 // AmpConfig holds Amp CLI configuration
 type AmpConfig struct {
 	Command string
-	Timeout int // seconds
+	Timeout int // seconds; wall-clock limit of one agent run
 }
 
 // WorkerConfig holds worker-specific configuration
 type WorkerConfig struct {
 	MaxRetries      int
-	RetryDelay      int // seconds
+	RetryDelay      int    // seconds; base delay between CI-failure retries
+	RetryBackoff    string // fixed or exponential
+	MaxRetryDelay   int    // seconds
+	RetryJitter     float64
 	PollInterval    int // seconds
 	ConcurrentTasks int
+	RepoConcurrency int // tasks per repository running at once, 0 for no limit
+	CPULimit        int // seconds of CPU time per agent run, 0 for no limit
+	MemoryLimit     int // bytes per agent run, 0 for no limit
+	OutputLimit     int // bytes of output per agent run, 0 for no limit
+	CgroupRoot      string
+	CIProvider      string // github-actions, gitlab-ci, bitbucket-pipelines, local or none; empty picks the code host's CI when it is configured
+	HooksFile       string // JSON file of per-repository setup and verification commands
 }
 
 // Load loads configuration from environment variables with defaults
@@ -52,6 +97,9 @@ func Load() (*Config, error) {
 		Server: ServerConfig{
 			Address: getEnv("SERVER_ADDRESS", "localhost:8080"),
 			Port:    getEnvAsInt("SERVER_PORT", 8080),
+
+			WorkerToken:      getEnv("WORKER_TOKEN", ""),
+			ScheduleInterval: getEnvAsInt("SCHEDULE_INTERVAL", 30),
 		},
 		Database: DatabaseConfig{
 			Path: getEnv("DATABASE_PATH", "orchestrator.db"),
@@ -60,16 +108,47 @@ func Load() (*Config, error) {
 			AppID:          getEnv("GITHUB_APP_ID", ""),
 			PrivateKeyPath: getEnv("GITHUB_PRIVATE_KEY_PATH", ""),
 			Token:          getEnv("GITHUB_TOKEN", ""),
+			APIURL:         getEnv("GITHUB_API_URL", "https://api.github.com"),
+		},
+		GitLab: GitLabConfig{
+			Token: getEnv("GITLAB_TOKEN", ""),
+			URL:   getEnv("GITLAB_URL", ""),
+		},
+		Bitbucket: BitbucketConfig{
+			Username: getEnv("BITBUCKET_USERNAME", ""),
+			Token:    getEnv("BITBUCKET_TOKEN", ""),
+		},
+		Repository: RepositoryConfig{
+			Hosts: getEnv("REPO_HOSTS", ""),
+		},
+		Commit: CommitConfig{
+			Author:     getEnv("COMMIT_AUTHOR", ""),
+			Committer:  getEnv("COMMIT_COMMITTER", ""),
+			Signing:    getEnv("COMMIT_SIGNING", ""),
+			SigningKey: getEnv("COMMIT_SIGNING_KEY", ""),
+			Template:   getEnv("COMMIT_TEMPLATE", ""),
+			CoAuthors:  getEnv("COMMIT_CO_AUTHORS", ""),
+			Squash:     getEnvAsBool("COMMIT_SQUASH", false),
 		},
 		Amp: AmpConfig{
 			Command: getEnv("AMP_COMMAND", "amp"),
-			Timeout: getEnvAsInt("AMP_TIMEOUT", 300), // 5 minutes
+			Timeout: getEnvAsInt("AMP_TIMEOUT", 1800), // 30 minutes
 		},
 		Worker: WorkerConfig{
 			MaxRetries:      getEnvAsInt("WORKER_MAX_RETRIES", 3),
 			RetryDelay:      getEnvAsInt("WORKER_RETRY_DELAY", 60),
+			RetryBackoff:    getEnv("WORKER_RETRY_BACKOFF", "exponential"),
+			MaxRetryDelay:   getEnvAsInt("WORKER_MAX_RETRY_DELAY", 1800), // 30 minutes
+			RetryJitter:     getEnvAsFloat("WORKER_RETRY_JITTER", 0.2),
 			PollInterval:    getEnvAsInt("WORKER_POLL_INTERVAL", 30),
 			ConcurrentTasks: getEnvAsInt("WORKER_CONCURRENT_TASKS", 1),
+			RepoConcurrency: getEnvAsInt("WORKER_REPO_CONCURRENCY", 0),
+			CPULimit:        getEnvAsInt("WORKER_CPU_LIMIT", 0),
+			MemoryLimit:     getEnvAsInt("WORKER_MEMORY_LIMIT", 0),
+			OutputLimit:     getEnvAsInt("WORKER_OUTPUT_LIMIT", 0),
+			CgroupRoot:      getEnv("WORKER_CGROUP_ROOT", ""),
+			CIProvider:      getEnv("WORKER_CI_PROVIDER", ""),
+			HooksFile:       getEnv("WORKER_HOOKS_FILE", ""),
 		},
 	}
 
@@ -93,3 +172,23 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsBool gets an environment variable as a boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
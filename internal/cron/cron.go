@@ -0,0 +1,207 @@
+// Package cron parses standard five-field cron expressions and computes when
+// they next fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch bounds how far ahead Next looks for a matching time
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// descriptors are the supported shorthands for common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// field describes one position of a cron expression
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	// 7 is accepted as another spelling of Sunday
+	{name: "day of week", min: 0, max: 7, names: dayNames},
+}
+
+// Schedule is a parsed cron expression. Each field is a bit set of the
+// values it matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Whether the day fields are unrestricted; when both are restricted, a
+	// day matching either one fires, as in cron(8)
+	domAny, dowAny bool
+}
+
+// Parse parses a cron expression of the form "minute hour day-of-month month
+// day-of-week", or one of @yearly, @monthly, @weekly, @daily and @hourly.
+// Fields accept *, values, ranges (1-5), lists (1,15) and steps (*/15, 0-30/10);
+// months and days of the week may be given by their three-letter names.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		expanded, ok := descriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron descriptor %q", expr)
+		}
+		expr = expanded
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields, got %d", expr, len(fields), len(parts))
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	// Fold 7 into 0 so Sunday is a single bit
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*" || strings.HasPrefix(parts[2], "*/"),
+		dowAny: parts[4] == "*" || strings.HasPrefix(parts[4], "*/"),
+	}, nil
+}
+
+// parseField parses one comma-separated field into a bit set
+func parseField(text string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, item)
+			}
+			rangeText, step = item[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangeText == "*":
+		case strings.Contains(rangeText, "-"):
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s field %q", f.name, item)
+			}
+		default:
+			var err error
+			if lo, err = parseValue(rangeText, f); err != nil {
+				return 0, err
+			}
+			// A single value with a step runs to the end of the field, e.g. 5/15
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// parseValue parses a number or name within the bounds of field f
+func parseValue(text string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(text)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %s field %q", f.name, text)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that the schedule fires, in t's
+// location. It returns the zero time if the schedule never fires, e.g. for
+// "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(maxSearch)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay reports whether t's day matches the day of month and day of week fields
+func (s *Schedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	}
+
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, time.January, 15, 10, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, time.January, 16, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2025, time.January, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2025, time.January, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.January, 19, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2025, time.February, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 jul *", time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2025, time.January, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day matches when both are restricted: the 20th, or a Friday
+		{"0 0 20 * fri", time.Date(2025, time.January, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_NextInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	schedule, _ := Parse("0 2 * * *")
+	from := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	got := schedule.Next(from.In(loc))
+	want := time.Date(2025, time.January, 16, 2, 0, 0, 0, loc)
+	if !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
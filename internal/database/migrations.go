@@ -21,6 +21,10 @@ func Migrate() error {
 	if err := DB.AutoMigrate(
 		&models.Task{},
 		&models.TaskLog{},
+		&models.TaskDiff{},
+		&models.Schedule{},
+		&models.TaskDependency{},
+		&models.Campaign{},
 	); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
@@ -56,6 +60,25 @@ func runCustomMigrations(db *gorm.DB) error {
 		// Index on updated_at for finding recently updated tasks
 		`CREATE INDEX IF NOT EXISTS idx_tasks_updated_at ON tasks(updated_at)`,
 		
+		// Index on lease expiry for reaping tasks held by dead workers
+		`CREATE INDEX IF NOT EXISTS idx_tasks_lease_expires_at ON tasks(lease_expires_at)`,
+		
+		// Index on next run time for claiming tasks whose retry backoff has passed
+		`CREATE INDEX IF NOT EXISTS idx_tasks_next_run_at ON tasks(next_run_at)`,
+		
+		// Index on schedule_id for finding the tasks a schedule created
+		`CREATE INDEX IF NOT EXISTS idx_tasks_schedule_id ON tasks(schedule_id)`,
+		
+		// Index on campaign_id for tracking a campaign's tasks
+		`CREATE INDEX IF NOT EXISTS idx_tasks_campaign_id ON tasks(campaign_id)`,
+		
+		// Index on due schedules for the scheduler
+		`CREATE INDEX IF NOT EXISTS idx_schedules_next_run_at ON schedules(paused, next_run_at)`,
+		
+		// Indexes on repository, owner and claim time for weighing their recent share of workers
+		`CREATE INDEX IF NOT EXISTS idx_tasks_repo_key_claimed_at ON tasks(repo_key, claimed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_repo_owner_claimed_at ON tasks(repo_owner, claimed_at)`,
+		
 		// Composite index for active tasks (non-terminal statuses)
 		`CREATE INDEX IF NOT EXISTS idx_tasks_active ON tasks(status, updated_at) 
 		 WHERE status IN ('queued', 'running', 'retrying', 'needs_review')`,
@@ -67,6 +90,28 @@ func runCustomMigrations(db *gorm.DB) error {
 		}
 	}
 
+	return backfillRepoKeys(db)
+}
+
+// backfillRepoKeys keys the repositories of tasks created before tasks were
+// shared out by normalized repository and owner
+func backfillRepoKeys(db *gorm.DB) error {
+	var tasks []models.Task
+	if err := db.Select("id, repo").Where("repo_key IS NULL OR repo_key = ''").Find(&tasks).Error; err != nil {
+		return fmt.Errorf("failed to find tasks without repository keys: %w", err)
+	}
+
+	for _, task := range tasks {
+		key, owner := models.RepoKeys(task.Repo)
+		err := db.Model(&models.Task{}).Where("id = ?", task.ID).UpdateColumns(map[string]interface{}{
+			"repo_key":   key,
+			"repo_owner": owner,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to key repository of task %s: %w", task.ID, err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Campaign fans one prompt out across many repositories, with one task per
+// repository
+type Campaign struct {
+	ID         string    `gorm:"primaryKey;type:text" json:"id"`
+	Name       string    `gorm:"type:text" json:"name,omitempty"`
+	Prompt     string    `gorm:"not null;type:text" json:"prompt"`
+	Pattern    string    `gorm:"type:text" json:"pattern,omitempty"`
+	Agent      string    `gorm:"type:text" json:"agent,omitempty"`
+	MaxRetries int       `gorm:"type:integer;default:0" json:"max_retries,omitempty"`
+	Priority   int       `gorm:"type:integer;default:0" json:"priority,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
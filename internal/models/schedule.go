@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Schedule enqueues a task from the same repository and prompt whenever its
+// cron expression fires
+type Schedule struct {
+	ID         string     `gorm:"primaryKey;type:text" json:"id"`
+	Name       string     `gorm:"type:text" json:"name,omitempty"`
+	Cron       string     `gorm:"not null;type:text" json:"cron"`
+	Timezone   string     `gorm:"type:text" json:"timezone,omitempty"`
+	Repo       string     `gorm:"not null;type:text" json:"repo"`
+	Prompt     string     `gorm:"not null;type:text" json:"prompt"`
+	Agent      string     `gorm:"type:text" json:"agent,omitempty"`
+	MaxRetries int        `gorm:"type:integer;default:0" json:"max_retries,omitempty"`
+	Priority   int        `gorm:"type:integer;default:0" json:"priority,omitempty"`
+	Paused     bool       `gorm:"not null;default:false" json:"paused"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastTaskID string     `gorm:"type:text" json:"last_task_id,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Location returns the time zone the schedule's cron expression is read in,
+// UTC unless the schedule names one
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 // TaskStatus represents the possible states of a task
@@ -11,6 +13,7 @@ type TaskStatus string
 
 const (
 	TaskStatusQueued      TaskStatus = "queued"
+	TaskStatusBlocked     TaskStatus = "blocked"
 	TaskStatusRunning     TaskStatus = "running"
 	TaskStatusRetrying    TaskStatus = "retrying"
 	TaskStatusNeedsReview TaskStatus = "needs_review"
@@ -19,10 +22,18 @@ const (
 	TaskStatusError       TaskStatus = "error"
 )
 
+// Task priorities; a task's priority weighs its share of the workers
+// against other tasks on other repositories
+const (
+	MinTaskPriority     = 1
+	DefaultTaskPriority = 5
+	MaxTaskPriority     = 10
+)
+
 // IsValid checks if the task status is valid
 func (ts TaskStatus) IsValid() bool {
 	switch ts {
-	case TaskStatusQueued, TaskStatusRunning, TaskStatusRetrying,
+	case TaskStatusQueued, TaskStatusBlocked, TaskStatusRunning, TaskStatusRetrying,
 		 TaskStatusNeedsReview, TaskStatusSuccess, TaskStatusAborted, TaskStatusError:
 		return true
 	default:
@@ -42,23 +53,50 @@ func (ts TaskStatus) IsTerminal() bool {
 
 // Task represents a CI-driven Amp task
 type Task struct {
-	ID         string     `gorm:"primaryKey;type:text" json:"id"`
-	Repo       string     `gorm:"not null;type:text" json:"repo"`
-	Branch     string     `gorm:"type:text" json:"branch"`
-	ThreadID   string     `gorm:"type:text" json:"thread_id"`
-	Prompt     string     `gorm:"type:text" json:"prompt"`
-	Status     TaskStatus `gorm:"type:text;not null;default:'queued'" json:"status"`
-	CIRunID    *int64     `gorm:"type:integer" json:"ci_run_id,omitempty"`
-	Attempts   int        `gorm:"type:integer;default:0" json:"attempts"`
-	Summary    string     `gorm:"type:text" json:"summary,omitempty"`
-	BranchURL  string     `gorm:"type:text" json:"branch_url,omitempty"`
-	PRURL      string     `gorm:"type:text" json:"pr_url,omitempty"`
-	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	ID             string     `gorm:"primaryKey;type:text" json:"id"`
+	Repo           string     `gorm:"not null;type:text" json:"repo"`
+	RepoKey        string     `gorm:"type:text" json:"-"`
+	RepoOwner      string     `gorm:"type:text" json:"-"`
+	Branch         string     `gorm:"type:text" json:"branch"`
+	BaseBranch     string     `gorm:"type:text" json:"base_branch,omitempty"`
+	ThreadID       string     `gorm:"type:text" json:"thread_id"`
+	Agent          string     `gorm:"type:text" json:"agent,omitempty"`
+	Prompt         string     `gorm:"type:text" json:"prompt"`
+	Status         TaskStatus `gorm:"type:text;not null;default:'queued'" json:"status"`
+	CIRunID        *int64     `gorm:"type:integer" json:"ci_run_id,omitempty"`
+	Attempts       int        `gorm:"type:integer;default:0" json:"attempts"`
+	MaxRetries     int        `gorm:"type:integer;default:0" json:"max_retries,omitempty"`
+	Priority       int        `gorm:"type:integer;not null;default:5" json:"priority"`
+	ScheduleID     string     `gorm:"type:text" json:"schedule_id,omitempty"`
+	CampaignID     string     `gorm:"type:text" json:"campaign_id,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	NextPrompt     string     `gorm:"type:text" json:"next_prompt,omitempty"`
+	Summary        string     `gorm:"type:text" json:"summary,omitempty"`
+	BranchURL      string     `gorm:"type:text" json:"branch_url,omitempty"`
+	PRURL          string     `gorm:"type:text" json:"pr_url,omitempty"`
+	ClaimedBy      string     `gorm:"type:text" json:"claimed_by,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RepoKeys returns the keys workers are shared by: the repository however it
+// was referenced, and the owner holding it. A reference that cannot be parsed
+// is its own repository and owner.
+func RepoKeys(repo string) (key, owner string) {
+	ref, err := repourl.Parse(repo)
+	if err != nil {
+		return repo, repo
+	}
+	return ref.Key(), ref.OwnerKey()
 }
 
 // BeforeCreate is a GORM hook that runs before creating a task
 func (t *Task) BeforeCreate(tx *gorm.DB) error {
+	// Key the repository for sharing out the workers
+	t.RepoKey, t.RepoOwner = RepoKeys(t.Repo)
+
 	// Validate status
 	if !t.Status.IsValid() {
 		t.Status = TaskStatusQueued
@@ -79,9 +117,11 @@ func (t *Task) BeforeUpdate(tx *gorm.DB) error {
 
 // CanTransitionTo checks if the task can transition to the given status
 func (t *Task) CanTransitionTo(newStatus TaskStatus) bool {
-	// If task is already in a terminal state, only allow transition to aborted
+	// If task is already in a terminal state, only allow transition to aborted,
+	// or back to queued (or blocked on its dependencies) when a failed task is continued
 	if t.Status.IsTerminal() {
-		return newStatus == TaskStatusAborted
+		return newStatus == TaskStatusAborted ||
+			(t.Status == TaskStatusError && (newStatus == TaskStatusQueued || newStatus == TaskStatusBlocked))
 	}
 
 	// Define valid transitions
@@ -90,6 +130,11 @@ func (t *Task) CanTransitionTo(newStatus TaskStatus) bool {
 			TaskStatusRunning,
 			TaskStatusAborted,
 		},
+		TaskStatusBlocked: {
+			TaskStatusQueued,
+			TaskStatusError,
+			TaskStatusAborted,
+		},
 		TaskStatusRunning: {
 			TaskStatusRetrying,
 			TaskStatusNeedsReview,
@@ -98,12 +143,14 @@ func (t *Task) CanTransitionTo(newStatus TaskStatus) bool {
 			TaskStatusAborted,
 		},
 		TaskStatusRetrying: {
+			TaskStatusQueued,
 			TaskStatusRunning,
 			TaskStatusNeedsReview,
 			TaskStatusError,
 			TaskStatusAborted,
 		},
 		TaskStatusNeedsReview: {
+			TaskStatusQueued,
 			TaskStatusRunning,
 			TaskStatusAborted,
 		},
@@ -143,13 +190,72 @@ func (t *Task) IsRetryable(maxRetries int) bool {
 		   (t.Status == TaskStatusError || t.Status == TaskStatusRetrying || t.Status == TaskStatusNeedsReview)
 }
 
+// CanContinue returns true if a follow-up may be started on the task: it
+// failed, is waiting to retry, or is waiting for review. Continuing grants a
+// fresh attempt budget, so the attempts already used do not matter.
+func (t *Task) CanContinue() bool {
+	return t.Status == TaskStatusError || t.Status == TaskStatusRetrying || t.Status == TaskStatusNeedsReview
+}
+
+// TaskDependency records that a task waits for another task to succeed
+// before it is queued
+type TaskDependency struct {
+	TaskID      string    `gorm:"primaryKey;type:text" json:"task_id"`
+	DependsOnID string    `gorm:"primaryKey;type:text;index" json:"depends_on_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Log streams for TaskLog entries captured from agent output
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
 // TaskLog represents a log entry for a task
 type TaskLog struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	TaskID    string    `gorm:"not null;index;type:text" json:"task_id"`
 	Level     string    `gorm:"not null" json:"level"` // info, warn, error
 	Message   string    `gorm:"not null" json:"message"`
+	Stream    string    `gorm:"type:text" json:"stream,omitempty"` // stdout, stderr; empty for worker messages
+	Attempt   int       `gorm:"type:integer;default:0" json:"attempt,omitempty"`
+	Sequence  int       `gorm:"type:integer;default:0" json:"sequence,omitempty"`
 	Timestamp time.Time `gorm:"not null" json:"timestamp"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// Statuses of the files in a TaskDiff
+const (
+	DiffFileAdded    = "added"
+	DiffFileModified = "modified"
+	DiffFileDeleted  = "deleted"
+	DiffFileRenamed  = "renamed"
+)
+
+// DiffFile is the change a TaskDiff makes to one file
+type DiffFile struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"old_path,omitempty"` // set for renamed files
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// TaskDiff records what the task's branch changed as of one attempt,
+// against the branch it started from
+type TaskDiff struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TaskID    string     `gorm:"not null;type:text;uniqueIndex:idx_task_diffs_attempt" json:"task_id"`
+	Attempt   int        `gorm:"not null;type:integer;uniqueIndex:idx_task_diffs_attempt" json:"attempt"`
+	BaseRef   string     `gorm:"type:text" json:"base_ref"`
+	BaseSHA   string     `gorm:"type:text" json:"base_sha"`
+	HeadSHA   string     `gorm:"type:text" json:"head_sha"`
+	Files     []DiffFile `gorm:"serializer:json" json:"files"`
+	Additions int        `gorm:"type:integer;default:0" json:"additions"`
+	Deletions int        `gorm:"type:integer;default:0" json:"deletions"`
+	Patch     string     `gorm:"type:text" json:"patch"`
+	Truncated bool       `gorm:"default:false" json:"truncated,omitempty"` // the patch was cut short; Files is complete
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -13,6 +13,7 @@ func TestTaskStatus_IsValid(t *testing.T) {
 		valid  bool
 	}{
 		{TaskStatusQueued, true},
+		{TaskStatusBlocked, true},
 		{TaskStatusRunning, true},
 		{TaskStatusRetrying, true},
 		{TaskStatusNeedsReview, true},
@@ -38,6 +39,7 @@ func TestTaskStatus_IsTerminal(t *testing.T) {
 		terminal bool
 	}{
 		{TaskStatusQueued, false},
+		{TaskStatusBlocked, false},
 		{TaskStatusRunning, false},
 		{TaskStatusRetrying, false},
 		{TaskStatusNeedsReview, false},
@@ -67,6 +69,12 @@ func TestTask_CanTransitionTo(t *testing.T) {
 		{"queued to aborted", TaskStatusQueued, TaskStatusAborted, true},
 		{"queued to success", TaskStatusQueued, TaskStatusSuccess, false},
 		
+		// From blocked
+		{"blocked to queued", TaskStatusBlocked, TaskStatusQueued, true},
+		{"blocked to error", TaskStatusBlocked, TaskStatusError, true},
+		{"blocked to aborted", TaskStatusBlocked, TaskStatusAborted, true},
+		{"blocked to running", TaskStatusBlocked, TaskStatusRunning, false},
+		
 		// From running
 		{"running to retrying", TaskStatusRunning, TaskStatusRetrying, true},
 		{"running to needs_review", TaskStatusRunning, TaskStatusNeedsReview, true},
@@ -76,6 +84,7 @@ func TestTask_CanTransitionTo(t *testing.T) {
 		{"running to queued", TaskStatusRunning, TaskStatusQueued, false},
 		
 		// From retrying
+		{"retrying to queued", TaskStatusRetrying, TaskStatusQueued, true},
 		{"retrying to running", TaskStatusRetrying, TaskStatusRunning, true},
 		{"retrying to needs_review", TaskStatusRetrying, TaskStatusNeedsReview, true},
 		{"retrying to error", TaskStatusRetrying, TaskStatusError, true},
@@ -85,6 +94,7 @@ func TestTask_CanTransitionTo(t *testing.T) {
 		// From needs_review
 		{"needs_review to running", TaskStatusNeedsReview, TaskStatusRunning, true},
 		{"needs_review to aborted", TaskStatusNeedsReview, TaskStatusAborted, true},
+		{"needs_review to queued", TaskStatusNeedsReview, TaskStatusQueued, true},
 		{"needs_review to success", TaskStatusNeedsReview, TaskStatusSuccess, false},
 		
 		// From terminal states
@@ -92,6 +102,11 @@ func TestTask_CanTransitionTo(t *testing.T) {
 		{"success to running", TaskStatusSuccess, TaskStatusRunning, false},
 		{"error to aborted", TaskStatusError, TaskStatusAborted, true},
 		{"error to running", TaskStatusError, TaskStatusRunning, false},
+		{"error to queued", TaskStatusError, TaskStatusQueued, true},
+		{"error to blocked", TaskStatusError, TaskStatusBlocked, true},
+		{"success to blocked", TaskStatusSuccess, TaskStatusBlocked, false},
+		{"success to queued", TaskStatusSuccess, TaskStatusQueued, false},
+		{"aborted to queued", TaskStatusAborted, TaskStatusQueued, false},
 		{"aborted to running", TaskStatusAborted, TaskStatusRunning, false},
 	}
 
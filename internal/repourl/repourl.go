@@ -0,0 +1,387 @@
+// Package repourl parses the repository references accepted by the API, the
+// worker and the CLI: https and ssh:// URLs, scp-like git@host:owner/repo.git
+// references, file:// URLs, local paths and owner/repo shorthand for GitHub.
+// Local repositories are only accepted when the hosts allow them.
+package repourl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Providers of the hosts repositories live on
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+	// ProviderLocal is the provider of repositories on the local filesystem
+	ProviderLocal = "local"
+)
+
+// shorthandPartPattern matches the owner and name of owner/repo shorthand
+var shorthandPartPattern = regexp.MustCompile(`^[a-zA-Z0-9\-_\.]+$`)
+
+// Ref is a parsed repository reference
+type Ref struct {
+	// Reference as given
+	Raw string
+	// How the repository is reached: https, http, ssh, git or file. Scp-like
+	// references are ssh, local paths file and shorthand https.
+	Scheme string
+	// User in the reference, e.g. git in git@github.com:acme/api.git
+	User string
+	// Lower-cased host name without port; empty for local repositories
+	Host string
+	// Port in the reference, if any
+	Port string
+	// Path of the repository on its host without the .git suffix, e.g.
+	// acme/api or group/subgroup/api; the filesystem path of a local
+	// repository
+	Path string
+	// Provider of the host: github, gitlab, bitbucket, local, or empty when
+	// the host is unknown
+	Provider string
+}
+
+// Parse parses a remote repository reference. The provider of well-known
+// hosts is recognised; use Hosts.Parse to also recognise self-hosted hosts,
+// allow local repositories and reject hosts that are not allowed.
+func Parse(raw string) (Ref, error) {
+	return DefaultHosts().parse(raw)
+}
+
+// IsLocal reports whether the repository is on the local filesystem
+func (r Ref) IsLocal() bool {
+	return r.Scheme == "file"
+}
+
+// Owner returns the namespace holding the repository: its owner, workspace or
+// group, including any parent groups
+func (r Ref) Owner() string {
+	if r.IsLocal() {
+		return ""
+	}
+	owner, _ := path.Split(r.Path)
+	return strings.TrimSuffix(owner, "/")
+}
+
+// Name returns the name of the repository
+func (r Ref) Name() string {
+	return path.Base(r.Path)
+}
+
+// Key identifies the repository however it was referenced: the lower-cased
+// host and path, e.g. github.com/acme/api, or the path of a local repository
+func (r Ref) Key() string {
+	if r.IsLocal() {
+		return r.Path
+	}
+	return strings.ToLower(r.Host + "/" + r.Path)
+}
+
+// OwnerKey identifies the namespace holding the repository on its host, e.g.
+// github.com/acme. A local repository is its own namespace.
+func (r Ref) OwnerKey() string {
+	if r.IsLocal() {
+		return r.Key()
+	}
+	return strings.ToLower(r.Host + "/" + r.Owner())
+}
+
+// Segments returns the number of elements in the repository path on its host
+func (r Ref) Segments() int {
+	return strings.Count(r.Path, "/") + 1
+}
+
+// WebURL returns the repository's web page, e.g. https://gitlab.com/group/api,
+// or its path for a local repository
+func (r Ref) WebURL() string {
+	if r.IsLocal() {
+		return r.Path
+	}
+	return "https://" + r.Host + "/" + r.Path
+}
+
+// CloneURL returns a URL git can clone the repository from: the reference
+// itself, or the https URL of owner/repo shorthand
+func (r Ref) CloneURL() string {
+	// Shorthand is the only remote reference without a colon
+	if !r.IsLocal() && !strings.Contains(r.Raw, ":") {
+		return r.WebURL() + ".git"
+	}
+	return r.Raw
+}
+
+// String returns the reference as given
+func (r Ref) String() string {
+	return r.Raw
+}
+
+// Hosts maps allowed host names to the provider running them. The local entry
+// allows repositories on the local filesystem.
+type Hosts map[string]string
+
+// localEntry is the entry of Hosts, and of the spec ParseHosts reads, that
+// allows local repositories
+const localEntry = ProviderLocal
+
+// DefaultHosts returns the well-known hosted providers
+func DefaultHosts() Hosts {
+	return Hosts{
+		"github.com":    ProviderGitHub,
+		"gitlab.com":    ProviderGitLab,
+		"bitbucket.org": ProviderBitbucket,
+	}
+}
+
+// ParseHosts returns the default hosts together with the self-hosted hosts in
+// spec, a comma-separated list of host=provider pairs such as
+// "git.example.com=gitlab,ghe.example.com=github". The entry "local" allows
+// local repositories.
+func ParseHosts(spec string) (Hosts, error) {
+	hosts := DefaultHosts()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == localEntry {
+			hosts.AllowLocal()
+			continue
+		}
+
+		host, provider, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid repository host %q: must be host=provider", entry)
+		}
+		if err := hosts.Add(strings.TrimSpace(host), strings.TrimSpace(provider)); err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+// Add allows host, run by provider
+func (h Hosts) Add(host, provider string) error {
+	switch provider {
+	case ProviderGitHub, ProviderGitLab, ProviderBitbucket:
+	default:
+		return fmt.Errorf("unknown provider %q for repository host %s (available: %s, %s, %s)", provider, host, ProviderGitHub, ProviderGitLab, ProviderBitbucket)
+	}
+	if host == "" || strings.ContainsAny(host, "/:@ ") {
+		return fmt.Errorf("invalid repository host %q", host)
+	}
+
+	h[strings.ToLower(host)] = provider
+	return nil
+}
+
+// AllowLocal allows repositories on the local filesystem: paths and file://
+// URLs. Only enable it where the users submitting tasks may read the
+// filesystem of the workers.
+func (h Hosts) AllowLocal() {
+	h[localEntry] = ProviderLocal
+}
+
+// AllowsLocal reports whether repositories on the local filesystem are allowed
+func (h Hosts) AllowsLocal() bool {
+	return h[localEntry] == ProviderLocal
+}
+
+// AddInstance allows the host of a self-managed instance, given by its web or
+// API URL such as https://gitlab.example.com, run by provider. An empty URL
+// and the API host of github.com are ignored.
+func (h Hosts) AddInstance(instanceURL, provider string) error {
+	if instanceURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(instanceURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid %s instance URL %q", provider, instanceURL)
+	}
+	if strings.EqualFold(u.Hostname(), "api.github.com") {
+		return nil
+	}
+	return h.Add(u.Hostname(), provider)
+}
+
+// String lists the hosts as host=provider pairs, in the format ParseHosts reads
+func (h Hosts) String() string {
+	entries := make([]string, 0, len(h))
+	for host, provider := range h {
+		if host == localEntry && provider == ProviderLocal {
+			entries = append(entries, localEntry)
+			continue
+		}
+		entries = append(entries, host+"="+provider)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// Parse parses a repository reference, which must be on one of the hosts, or
+// local when they allow it
+func (h Hosts) Parse(raw string) (Ref, error) {
+	ref, err := h.parse(raw)
+	if err != nil {
+		return Ref{}, err
+	}
+	if ref.Provider == "" {
+		return Ref{}, fmt.Errorf("unsupported repository host: %s", ref.Host)
+	}
+	return ref, nil
+}
+
+// parse parses a repository reference, taking the provider of its host from h
+func (h Hosts) parse(raw string) (Ref, error) {
+	if raw == "" {
+		return Ref{}, errors.New("repository URL cannot be empty")
+	}
+
+	var ref Ref
+	var err error
+	switch {
+	case strings.Contains(raw, "://"):
+		ref, err = parseURL(raw, h.AllowsLocal())
+	case h.AllowsLocal() && isLocalPath(raw):
+		ref = Ref{Raw: raw, Scheme: "file", Path: raw}
+	case isSCPLike(raw):
+		ref, err = parseSCPLike(raw)
+	default:
+		ref, err = parseShorthand(raw)
+	}
+	if err != nil {
+		return Ref{}, err
+	}
+
+	if ref.IsLocal() {
+		ref.Provider = ProviderLocal
+	} else {
+		ref.Provider = h[ref.Host]
+	}
+	return ref, nil
+}
+
+// parseURL parses a reference with a scheme; file:// URLs only when local
+// repositories are allowed
+func parseURL(raw string, allowLocal bool) (Ref, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Ref{}, errors.New("invalid repository URL format")
+	}
+
+	switch {
+	case u.Scheme == "file" && allowLocal:
+		if u.Path == "" || (u.Host != "" && u.Host != "localhost") {
+			return Ref{}, errors.New("invalid repository URL format")
+		}
+		return Ref{Raw: raw, Scheme: "file", Path: u.Path}, nil
+	case u.Scheme == "https", u.Scheme == "http", u.Scheme == "ssh", u.Scheme == "git":
+	default:
+		return Ref{}, fmt.Errorf("unsupported repository URL scheme: %s", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return Ref{}, errors.New("invalid repository URL format")
+	}
+	repoPath, err := cleanRepoPath(u.Path)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	return Ref{
+		Raw:    raw,
+		Scheme: u.Scheme,
+		User:   u.User.Username(),
+		Host:   strings.ToLower(u.Hostname()),
+		Port:   u.Port(),
+		Path:   repoPath,
+	}, nil
+}
+
+// isLocalPath reports whether raw is a filesystem path: absolute, or
+// explicitly relative so that it cannot be mistaken for owner/repo shorthand
+func isLocalPath(raw string) bool {
+	return raw == "." || raw == ".." ||
+		strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "./") || strings.HasPrefix(raw, "../")
+}
+
+// isSCPLike reports whether raw is a [user@]host:path reference, which git
+// tells apart from a local path by a colon before any slash
+func isSCPLike(raw string) bool {
+	colon := strings.Index(raw, ":")
+	return colon > 0 && !strings.Contains(raw[:colon], "/")
+}
+
+// parseSCPLike parses a [user@]host:path reference
+func parseSCPLike(raw string) (Ref, error) {
+	hostPart, pathPart, _ := strings.Cut(raw, ":")
+
+	user, host, ok := strings.Cut(hostPart, "@")
+	if !ok {
+		user, host = "", hostPart
+	}
+	if host == "" {
+		return Ref{}, errors.New("invalid repository URL format")
+	}
+
+	repoPath, err := cleanRepoPath(pathPart)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	return Ref{
+		Raw:    raw,
+		Scheme: "ssh",
+		User:   user,
+		Host:   strings.ToLower(host),
+		Path:   repoPath,
+	}, nil
+}
+
+// parseShorthand parses owner/repo shorthand for a GitHub repository
+func parseShorthand(raw string) (Ref, error) {
+	if !strings.Contains(raw, "/") {
+		return Ref{}, errors.New("repository must be in format 'owner/repo' or full Git URL")
+	}
+
+	parts := strings.Split(raw, "/")
+	if len(parts) != 2 {
+		return Ref{}, errors.New("invalid repository format: must be 'owner/repo'")
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Ref{}, errors.New("repository owner and name cannot be empty")
+		}
+		if !shorthandPartPattern.MatchString(part) {
+			return Ref{}, errors.New("repository owner and name can only contain letters, numbers, hyphens, underscores, and dots")
+		}
+	}
+
+	return Ref{Raw: raw, Scheme: "https", Host: "github.com", Path: raw}, nil
+}
+
+// cleanRepoPath trims the slashes and .git suffix off the path of a remote
+// repository and checks that it names a repository within a namespace
+func cleanRepoPath(p string) (string, error) {
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+
+	parts := strings.Split(p, "/")
+	if len(parts) < 2 {
+		return "", errors.New("invalid repository path: must be in format 'owner/repo'")
+	}
+	for _, part := range parts {
+		// "-" starts the non-repository routes of GitLab, e.g. /-/merge_requests
+		if part == "" || part == "." || part == ".." || part == "-" {
+			return "", fmt.Errorf("invalid repository path: %s", p)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,172 @@
+package repourl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw      string
+		scheme   string
+		host     string
+		path     string
+		provider string
+		owner    string
+		web      string
+	}{
+		{"https://github.com/acme/api.git", "https", "github.com", "acme/api", ProviderGitHub, "acme", "https://github.com/acme/api"},
+		{"http://GitLab.com/acme/api/", "http", "gitlab.com", "acme/api", ProviderGitLab, "acme", "https://gitlab.com/acme/api"},
+		{"https://amp-bot@bitbucket.org/acme/api.git", "https", "bitbucket.org", "acme/api", ProviderBitbucket, "acme", "https://bitbucket.org/acme/api"},
+		{"ssh://git@gitlab.com:2222/group/sub/api.git", "ssh", "gitlab.com", "group/sub/api", ProviderGitLab, "group/sub", "https://gitlab.com/group/sub/api"},
+		{"git@github.com:acme/api.git", "ssh", "github.com", "acme/api", ProviderGitHub, "acme", "https://github.com/acme/api"},
+		{"git.example.com:platform/billing", "ssh", "git.example.com", "platform/billing", "", "platform", "https://git.example.com/platform/billing"},
+		{"acme/api", "https", "github.com", "acme/api", ProviderGitHub, "acme", "https://github.com/acme/api"},
+		{"file:///srv/git/api.git", "file", "", "/srv/git/api.git", ProviderLocal, "", "/srv/git/api.git"},
+		{"/srv/git/api", "file", "", "/srv/git/api", ProviderLocal, "", "/srv/git/api"},
+		{"./fixtures/repo", "file", "", "./fixtures/repo", ProviderLocal, "", "./fixtures/repo"},
+	}
+
+	hosts := DefaultHosts()
+	hosts.AllowLocal()
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			ref, err := hosts.parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if ref.Scheme != tt.scheme || ref.Host != tt.host || ref.Path != tt.path || ref.Provider != tt.provider {
+				t.Errorf("Parse() = %+v, want %s://%s/%s (%s)", ref, tt.scheme, tt.host, tt.path, tt.provider)
+			}
+			if ref.Owner() != tt.owner {
+				t.Errorf("Owner() = %q, want %q", ref.Owner(), tt.owner)
+			}
+			if ref.WebURL() != tt.web {
+				t.Errorf("WebURL() = %q, want %q", ref.WebURL(), tt.web)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"":                                 "cannot be empty",
+		"invalid":                          "format 'owner/repo' or full Git URL",
+		"acme/api/extra":                   "must be 'owner/repo'",
+		"acme$/api":                        "can only contain",
+		"https://github.com/acme":          "must be in format 'owner/repo'",
+		"https://gitlab.com/acme/api/-/mr": "invalid repository path",
+		"ftp://github.com/acme/api":        "unsupported repository URL scheme",
+		"https:///acme/api":                "invalid repository URL format",
+		"git@github.com:api.git":           "must be in format 'owner/repo'",
+	}
+
+	for raw, want := range tests {
+		_, err := Parse(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want it to mention %q", raw, err, want)
+		}
+	}
+}
+
+func TestParse_LocalNotAllowed(t *testing.T) {
+	// Without the local entry, paths are read as shorthand and file:// is refused
+	tests := map[string]string{
+		"/repo":                   "owner and name cannot be empty",
+		"/srv/git/api":            "must be 'owner/repo'",
+		"./fixtures/repo":         "must be 'owner/repo'",
+		"file:///srv/git/api.git": "unsupported repository URL scheme: file",
+	}
+
+	for raw, want := range tests {
+		_, err := DefaultHosts().Parse(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Hosts.Parse(%q) error = %v, want it to mention %q", raw, err, want)
+		}
+	}
+}
+
+func TestRefCloneURL(t *testing.T) {
+	tests := map[string]string{
+		"acme/api":                    "https://github.com/acme/api.git",
+		"git@github.com:acme/api.git": "git@github.com:acme/api.git",
+		"/srv/git/api":                "/srv/git/api",
+	}
+
+	hosts := DefaultHosts()
+	hosts.AllowLocal()
+	for raw, want := range tests {
+		ref, err := hosts.Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", raw, err)
+		}
+		if got := ref.CloneURL(); got != want {
+			t.Errorf("CloneURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestRefKey(t *testing.T) {
+	// Every way of referencing the same repository has the same keys
+	for _, raw := range []string{"acme/api", "https://github.com/Acme/API.git", "git@github.com:acme/api.git", "ssh://git@github.com:22/acme/api"} {
+		ref, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", raw, err)
+		}
+		if ref.Key() != "github.com/acme/api" || ref.OwnerKey() != "github.com/acme" {
+			t.Errorf("Parse(%q) keys = %q, %q, want github.com/acme/api and github.com/acme", raw, ref.Key(), ref.OwnerKey())
+		}
+	}
+
+	ref, _ := Parse("https://gitlab.com/group/sub/api")
+	if ref.Key() != "gitlab.com/group/sub/api" || ref.OwnerKey() != "gitlab.com/group/sub" {
+		t.Errorf("nested group keys = %q, %q", ref.Key(), ref.OwnerKey())
+	}
+}
+
+func TestHosts(t *testing.T) {
+	hosts, err := ParseHosts("git.example.com=gitlab, GHE.example.com=github, local")
+	if err != nil {
+		t.Fatalf("ParseHosts() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"git@git.example.com:group/sub/api.git": ProviderGitLab,
+		"https://ghe.example.com/acme/api":      ProviderGitHub,
+		"https://bitbucket.org/acme/api":        ProviderBitbucket,
+		"/srv/git/api":                          ProviderLocal,
+	}
+	for raw, want := range tests {
+		ref, err := hosts.Parse(raw)
+		if err != nil {
+			t.Fatalf("Hosts.Parse(%q) error = %v", raw, err)
+		}
+		if ref.Provider != want {
+			t.Errorf("Hosts.Parse(%q).Provider = %q, want %q", raw, ref.Provider, want)
+		}
+	}
+
+	if _, err := hosts.Parse("https://example.com/acme/api"); err == nil || err.Error() != "unsupported repository host: example.com" {
+		t.Errorf("Hosts.Parse(unknown host) error = %v, want unsupported host", err)
+	}
+
+	if err := hosts.AddInstance("https://GHE.corp.example.com/api/v3", ProviderGitHub); err != nil {
+		t.Fatalf("AddInstance() error = %v", err)
+	}
+	if err := hosts.AddInstance("https://api.github.com", ProviderGitHub); err != nil {
+		t.Fatalf("AddInstance(api.github.com) error = %v", err)
+	}
+	if hosts["ghe.corp.example.com"] != ProviderGitHub || hosts["api.github.com"] != "" {
+		t.Errorf("hosts = %v, want the GitHub Enterprise host only", hosts)
+	}
+
+	if again, err := ParseHosts(hosts.String()); err != nil || !again.AllowsLocal() {
+		t.Errorf("ParseHosts(%q) = %v, %v, want the hosts back with local repositories", hosts.String(), again, err)
+	}
+
+	for _, spec := range []string{"git.example.com", "git.example.com=gitea", "https://git.example.com=gitlab"} {
+		if _, err := ParseHosts(spec); err == nil {
+			t.Errorf("ParseHosts(%q) error = nil, want an error", spec)
+		}
+	}
+}
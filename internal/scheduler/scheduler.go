@@ -0,0 +1,57 @@
+// Package scheduler runs the orchestrator loop that turns due schedules into tasks.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+// DefaultInterval is how often due schedules are checked when none is configured
+const DefaultInterval = 30 * time.Second
+
+// Scheduler periodically enqueues tasks for due schedules
+type Scheduler struct {
+	schedules *services.ScheduleService
+	interval  time.Duration
+}
+
+// New creates a Scheduler that checks schedules every interval
+func New(schedules *services.ScheduleService, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Scheduler{
+		schedules: schedules,
+		interval:  interval,
+	}
+}
+
+// Run checks for due schedules until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick enqueues the tasks of every schedule that is due now
+func (s *Scheduler) tick(ctx context.Context) {
+	enqueued, err := s.schedules.EnqueueDueSchedules(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to run schedules: %v", err)
+	}
+	if enqueued > 0 {
+		log.Printf("Enqueued %d scheduled task(s)", enqueued)
+	}
+}
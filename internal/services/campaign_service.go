@@ -0,0 +1,272 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/database"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// ErrInvalidCampaign is returned for a campaign that names no repositories
+// or has a malformed pattern
+var ErrInvalidCampaign = errors.New("invalid campaign")
+
+// MaxCampaignRepos bounds how many repositories one campaign fans out to
+const MaxCampaignRepos = 200
+
+// CampaignService provides business logic for campaigns, which run one
+// prompt across many repositories
+type CampaignService struct {
+	db    *gorm.DB
+	tasks *TaskService
+}
+
+// NewCampaignService creates a new CampaignService that manages its tasks through tasks
+func NewCampaignService(db *gorm.DB, tasks *TaskService) *CampaignService {
+	if db == nil {
+		panic("database connection is nil")
+	}
+	return &CampaignService{
+		db:    db,
+		tasks: tasks,
+	}
+}
+
+// NewCampaignServiceDefault creates a new CampaignService using the default database
+func NewCampaignServiceDefault() *CampaignService {
+	db := database.GetDB()
+	if db == nil {
+		panic("database not initialized - call database.Connect() first")
+	}
+	return NewCampaignService(db, NewTaskService(db))
+}
+
+// SetMaxRetries sets the attempt budget of campaign tasks that do not override it
+func (s *CampaignService) SetMaxRetries(maxRetries int) {
+	s.tasks.SetMaxRetries(maxRetries)
+}
+
+// CampaignOptions holds optional settings for a new campaign
+type CampaignOptions struct {
+	// Name shown in listings
+	Name string
+	// Glob matched against the repositories the orchestrator already knows
+	// from tasks and schedules, e.g. https://github.com/acme/*-service
+	Pattern string
+	// Settings of every task the campaign creates
+	Task CreateTaskOptions
+}
+
+// CampaignProgress counts a campaign's tasks by status
+type CampaignProgress struct {
+	Total  int
+	Counts map[models.TaskStatus]int
+}
+
+// Finished returns how many of the campaign's tasks need nothing more from
+// the workers: those that succeeded, failed, were aborted or wait for review
+func (p CampaignProgress) Finished() int {
+	return p.Counts[models.TaskStatusSuccess] + p.Counts[models.TaskStatusNeedsReview] +
+		p.Counts[models.TaskStatusError] + p.Counts[models.TaskStatusAborted]
+}
+
+// CreateCampaign creates a campaign and one task running prompt on each of
+// repos and of the known repositories matching opts.Pattern
+func (s *CampaignService) CreateCampaign(prompt string, repos []string, opts CampaignOptions) (*models.Campaign, []models.Task, error) {
+	if opts.Pattern != "" {
+		matched, err := s.matchRepos(opts.Pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		repos = append(repos, matched...)
+	}
+
+	// The same repository named twice still gets a single task
+	seen := make(map[string]bool, len(repos))
+	unique := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if !seen[repo] {
+			seen[repo] = true
+			unique = append(unique, repo)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, nil, fmt.Errorf("%w: no repositories given or matched", ErrInvalidCampaign)
+	}
+	if len(unique) > MaxCampaignRepos {
+		return nil, nil, fmt.Errorf("%w: %d repositories exceed the limit of %d", ErrInvalidCampaign, len(unique), MaxCampaignRepos)
+	}
+
+	campaign := &models.Campaign{
+		ID:         ulid.Make().String(),
+		Name:       opts.Name,
+		Prompt:     prompt,
+		Pattern:    opts.Pattern,
+		Agent:      opts.Task.Agent,
+		MaxRetries: opts.Task.MaxRetries,
+		Priority:   opts.Task.Priority,
+	}
+
+	tasks := make([]models.Task, 0, len(unique))
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(campaign).Error; err != nil {
+			return fmt.Errorf("failed to create campaign: %w", err)
+		}
+
+		taskOpts := opts.Task
+		taskOpts.CampaignID = campaign.ID
+		txTasks := NewTaskService(tx)
+		for _, repo := range unique {
+			task, err := txTasks.CreateTaskWithOptions(repo, prompt, taskOpts)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, *task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return campaign, tasks, nil
+}
+
+// matchRepos returns the known repositories matching pattern, sorted. A
+// repository matches with or without its .git suffix.
+func (s *CampaignService) matchRepos(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: malformed pattern %q", ErrInvalidCampaign, pattern)
+	}
+
+	var taskRepos, scheduleRepos []string
+	if err := s.db.Model(&models.Task{}).Distinct().Pluck("repo", &taskRepos).Error; err != nil {
+		return nil, fmt.Errorf("failed to list known repositories: %w", err)
+	}
+	if err := s.db.Model(&models.Schedule{}).Distinct().Pluck("repo", &scheduleRepos).Error; err != nil {
+		return nil, fmt.Errorf("failed to list known repositories: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var matched []string
+	for _, repo := range append(taskRepos, scheduleRepos...) {
+		if seen[repo] {
+			continue
+		}
+		seen[repo] = true
+
+		ok, _ := path.Match(pattern, repo)
+		if !ok {
+			ok, _ = path.Match(pattern, strings.TrimSuffix(repo, ".git"))
+		}
+		if ok {
+			matched = append(matched, repo)
+		}
+	}
+
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// GetCampaign retrieves a campaign by ID
+func (s *CampaignService) GetCampaign(id string) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := s.db.First(&campaign, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("campaign not found")
+		}
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	return &campaign, nil
+}
+
+// ListCampaigns retrieves every campaign, newest first
+func (s *CampaignService) ListCampaigns() ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	if err := s.db.Order("created_at DESC").Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// GetCampaignTasks retrieves a campaign's tasks, ordered by repository
+func (s *CampaignService) GetCampaignTasks(id string) ([]models.Task, error) {
+	var tasks []models.Task
+	if err := s.db.Where("campaign_id = ?", id).Order("repo ASC").Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get campaign tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetCampaignProgress counts a campaign's tasks by status
+func (s *CampaignService) GetCampaignProgress(id string) (CampaignProgress, error) {
+	var rows []struct {
+		Status models.TaskStatus
+		Count  int
+	}
+	err := s.db.Model(&models.Task{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", id).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return CampaignProgress{}, fmt.Errorf("failed to get campaign progress: %w", err)
+	}
+
+	progress := CampaignProgress{Counts: make(map[models.TaskStatus]int, len(rows))}
+	for _, row := range rows {
+		progress.Counts[row.Status] = row.Count
+		progress.Total += row.Count
+	}
+	return progress, nil
+}
+
+// UpdateCampaignTasks applies action ("continue" or "abort") to every task
+// of a campaign it applies to: continue to the tasks that failed or wait for
+// review, abort to those that have not finished. A task that cannot be
+// updated does not stop the others. It returns the IDs of the tasks it
+// updated and of those it left alone, and why each failed task failed.
+func (s *CampaignService) UpdateCampaignTasks(id, action, prompt string) (updated, skipped []string, failed map[string]error, err error) {
+	if action != "continue" && action != "abort" {
+		return nil, nil, nil, fmt.Errorf("invalid action: %s", action)
+	}
+	if _, err := s.GetCampaign(id); err != nil {
+		return nil, nil, nil, err
+	}
+
+	tasks, err := s.GetCampaignTasks(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	failed = make(map[string]error)
+	for i := range tasks {
+		task := &tasks[i]
+		applies := !task.Status.IsTerminal()
+		if action == "continue" {
+			applies = task.CanContinue()
+		}
+		if !applies {
+			skipped = append(skipped, task.ID)
+			continue
+		}
+
+		if err := s.tasks.UpdateTask(task.ID, action, prompt); err != nil {
+			failed[task.ID] = fmt.Errorf("failed to %s task %s: %w", action, task.ID, err)
+			continue
+		}
+		updated = append(updated, task.ID)
+	}
+
+	return updated, skipped, failed, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestCreateCampaign(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewCampaignService(tasks.db, tasks)
+
+	// Repositories the orchestrator already knows, for the pattern to match
+	for _, repo := range []string{"https://github.com/acme/api-service.git", "https://github.com/acme/web-service", "https://github.com/other/api-service"} {
+		if _, err := tasks.CreateTask(repo, "earlier task"); err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+	}
+
+	campaign, created, err := svc.CreateCampaign("Bump the Go toolchain", []string{"https://github.com/acme/cli", "https://github.com/acme/web-service"}, CampaignOptions{
+		Name:    "go-bump",
+		Pattern: "https://github.com/acme/*-service",
+		Task:    CreateTaskOptions{Priority: 4},
+	})
+	if err != nil {
+		t.Fatalf("CreateCampaign() error = %v", err)
+	}
+
+	want := []string{"https://github.com/acme/cli", "https://github.com/acme/web-service", "https://github.com/acme/api-service.git"}
+	if len(created) != len(want) {
+		t.Fatalf("created %d tasks, want %d", len(created), len(want))
+	}
+	for i, task := range created {
+		if task.Repo != want[i] {
+			t.Errorf("task %d repo = %s, want %s", i, task.Repo, want[i])
+		}
+		if task.CampaignID != campaign.ID || task.Priority != 4 || task.Prompt != "Bump the Go toolchain" {
+			t.Errorf("task %d = %+v, want the campaign's settings", i, task)
+		}
+	}
+
+	progress, err := svc.GetCampaignProgress(campaign.ID)
+	if err != nil {
+		t.Fatalf("GetCampaignProgress() error = %v", err)
+	}
+	if progress.Total != 3 || progress.Counts[models.TaskStatusQueued] != 3 || progress.Finished() != 0 {
+		t.Errorf("progress = %+v, want 3 queued tasks", progress)
+	}
+
+	invalid := []struct {
+		name    string
+		repos   []string
+		pattern string
+	}{
+		{"nothing", nil, ""},
+		{"no match", nil, "https://gitlab.com/*"},
+		{"malformed pattern", nil, "https://github.com/[acme"},
+	}
+	for _, tt := range invalid {
+		if _, _, err := svc.CreateCampaign("prompt", tt.repos, CampaignOptions{Pattern: tt.pattern}); !errors.Is(err, ErrInvalidCampaign) {
+			t.Errorf("%s: CreateCampaign() error = %v, want ErrInvalidCampaign", tt.name, err)
+		}
+	}
+}
+
+func TestUpdateCampaignTasks(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewCampaignService(tasks.db, tasks)
+	ctx := context.Background()
+
+	campaign, created, err := svc.CreateCampaign("Replace the logger", []string{
+		"https://github.com/acme/a", "https://github.com/acme/b", "https://github.com/acme/c", "https://github.com/acme/d",
+	}, CampaignOptions{})
+	if err != nil {
+		t.Fatalf("CreateCampaign() error = %v", err)
+	}
+
+	// a succeeds, b fails, c used its whole budget and waits for review, and
+	// d fails after a task it depends on was aborted
+	if err := tasks.UpdateTaskStatus(ctx, created[0].ID, string(models.TaskStatusSuccess)); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+	if err := tasks.UpdateTaskStatus(ctx, created[1].ID, string(models.TaskStatusError)); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+	tasks.db.Model(&models.Task{}).Where("id = ?", created[2].ID).UpdateColumns(map[string]interface{}{
+		"status":   models.TaskStatusNeedsReview,
+		"attempts": DefaultMaxRetries,
+	})
+	aborted, _ := tasks.CreateTask("https://github.com/acme/d", "prompt")
+	tasks.db.Model(&models.Task{}).Where("id = ?", aborted.ID).UpdateColumn("status", models.TaskStatusAborted)
+	tasks.db.Create(&models.TaskDependency{TaskID: created[3].ID, DependsOnID: aborted.ID})
+	tasks.db.Model(&models.Task{}).Where("id = ?", created[3].ID).UpdateColumn("status", models.TaskStatusError)
+
+	updated, skipped, failed, err := svc.UpdateCampaignTasks(campaign.ID, "continue", "Replace the logger and its config")
+	if err != nil {
+		t.Fatalf("UpdateCampaignTasks(continue) error = %v", err)
+	}
+	if len(updated) != 2 || updated[0] != created[1].ID || updated[1] != created[2].ID || len(skipped) != 1 {
+		t.Fatalf("continue updated %v, skipped %v, want the failed task and the one in review", updated, skipped)
+	}
+	if len(failed) != 1 || !errors.Is(failed[created[3].ID], ErrDependencyFailed) {
+		t.Fatalf("continue failed %v, want the task whose dependency was aborted", failed)
+	}
+	for _, id := range updated {
+		retried, _ := tasks.GetTask(id)
+		if retried.Status != models.TaskStatusQueued || retried.Prompt != "Replace the logger and its config" {
+			t.Errorf("continued task = %s %q, want queued with the new prompt", retried.Status, retried.Prompt)
+		}
+	}
+
+	updated, skipped, failed, err = svc.UpdateCampaignTasks(campaign.ID, "abort", "")
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("UpdateCampaignTasks(abort) error = %v, failed %v", err, failed)
+	}
+	if len(updated) != 2 || len(skipped) != 2 {
+		t.Fatalf("abort updated %v, skipped %v, want the two queued tasks", updated, skipped)
+	}
+
+	progress, _ := svc.GetCampaignProgress(campaign.ID)
+	if progress.Finished() != 4 || progress.Counts[models.TaskStatusAborted] != 2 {
+		t.Errorf("progress = %+v, want every task finished", progress)
+	}
+
+	if _, _, _, err := svc.UpdateCampaignTasks("missing", "abort", ""); err == nil || err.Error() != "campaign not found" {
+		t.Errorf("UpdateCampaignTasks(missing) error = %v, want campaign not found", err)
+	}
+}
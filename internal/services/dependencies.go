@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// ErrInvalidDependency is returned when a new task cannot depend on the tasks it names
+var ErrInvalidDependency = errors.New("invalid dependency")
+
+// ErrDependencyFailed is returned when continuing a task one of whose dependencies has failed
+var ErrDependencyFailed = errors.New("a dependency has failed")
+
+// MaxTaskDependencies bounds how many tasks a single task may depend on
+const MaxTaskDependencies = 20
+
+// dependencyParents loads the tasks a new task depends on, checking that
+// every one exists and has not already failed
+func dependencyParents(tx *gorm.DB, ids []string) ([]models.Task, error) {
+	if len(ids) > MaxTaskDependencies {
+		return nil, fmt.Errorf("%w: a task may depend on at most %d tasks", ErrInvalidDependency, MaxTaskDependencies)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	parents := make([]models.Task, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var parent models.Task
+		if err := tx.First(&parent, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("%w: task %s not found", ErrInvalidDependency, id)
+			}
+			return nil, fmt.Errorf("failed to load dependency %s: %w", id, err)
+		}
+		if parent.Status == models.TaskStatusError || parent.Status == models.TaskStatusAborted {
+			return nil, fmt.Errorf("%w: task %s has already finished with status %s", ErrInvalidDependency, id, parent.Status)
+		}
+		parents = append(parents, parent)
+	}
+
+	return parents, nil
+}
+
+// dependencyStatus works out where a task stands with its dependencies. It
+// returns queued once every dependency has succeeded (or when there are
+// none), blocked while any is still pending, and error or aborted along with
+// the responsible dependency once one has failed.
+func dependencyStatus(db *gorm.DB, taskID string) (models.TaskStatus, *models.Task, error) {
+	var parents []models.Task
+	err := db.Joins("JOIN task_dependencies ON task_dependencies.depends_on_id = tasks.id").
+		Where("task_dependencies.task_id = ?", taskID).
+		Order("tasks.created_at ASC").
+		Find(&parents).Error
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load dependencies of task %s: %w", taskID, err)
+	}
+
+	status := models.TaskStatusQueued
+	for i := range parents {
+		switch parents[i].Status {
+		case models.TaskStatusSuccess:
+		case models.TaskStatusError, models.TaskStatusAborted:
+			return parents[i].Status, &parents[i], nil
+		default:
+			status = models.TaskStatusBlocked
+		}
+	}
+
+	return status, nil, nil
+}
+
+// resolveBlockedTask moves a blocked task on once its dependencies allow it:
+// to queued when they have all succeeded, or to the status of a dependency
+// that failed. It returns the task's new status, or blocked if it is still
+// waiting or was not blocked to begin with.
+func (s *TaskService) resolveBlockedTask(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	db := s.db.WithContext(ctx)
+
+	status, failed, err := dependencyStatus(db, taskID)
+	if err != nil {
+		return "", err
+	}
+	if status == models.TaskStatusBlocked {
+		return status, nil
+	}
+
+	updates := map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	level, message := "info", "All dependencies succeeded; task queued"
+	if failed != nil {
+		updates["summary"] = fmt.Sprintf("Dependency %s finished with status %s", failed.ID, failed.Status)
+		level, message = "warn", fmt.Sprintf("Dependency %s finished with status %s; task marked as %s", failed.ID, failed.Status, status)
+	}
+
+	// Only a task that is still blocked moves, so concurrent resolutions agree
+	result := db.Model(&models.Task{}).
+		Where("id = ? AND status = ?", taskID, models.TaskStatusBlocked).
+		UpdateColumns(updates)
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to resolve blocked task %s: %w", taskID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.TaskStatusBlocked, nil
+	}
+
+	if err := s.AddTaskLog(ctx, taskID, level, message); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// settleDependents resolves the blocked tasks that depend on a task that
+// just finished. A failure cascades down the whole graph; a success queues
+// the dependents whose other dependencies have succeeded too.
+func (s *TaskService) settleDependents(ctx context.Context, taskID string, status models.TaskStatus) error {
+	if !status.IsTerminal() {
+		return nil
+	}
+
+	var dependentIDs []string
+	err := s.db.WithContext(ctx).Model(&models.TaskDependency{}).
+		Where("depends_on_id = ?", taskID).
+		Pluck("task_id", &dependentIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to find dependents of task %s: %w", taskID, err)
+	}
+
+	for _, id := range dependentIDs {
+		resolved, err := s.resolveBlockedTask(ctx, id)
+		if err != nil {
+			return err
+		}
+		if resolved.IsTerminal() {
+			if err := s.settleDependents(ctx, id, resolved); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetTaskDependencies returns the tasks a task depends on and the tasks that
+// depend on it, oldest first
+func (s *TaskService) GetTaskDependencies(id string) (dependencies, dependents []models.Task, err error) {
+	err = s.db.Joins("JOIN task_dependencies ON task_dependencies.depends_on_id = tasks.id").
+		Where("task_dependencies.task_id = ?", id).
+		Order("tasks.created_at ASC").
+		Find(&dependencies).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get task dependencies: %w", err)
+	}
+
+	err = s.db.Joins("JOIN task_dependencies ON task_dependencies.task_id = tasks.id").
+		Where("task_dependencies.depends_on_id = ?", id).
+		Order("tasks.created_at ASC").
+		Find(&dependents).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get task dependents: %w", err)
+	}
+
+	return dependencies, dependents, nil
+}
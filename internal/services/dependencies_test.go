@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// mustCreateTask creates a task or fails the test
+func mustCreateTask(t *testing.T, svc *TaskService, repo string, opts CreateTaskOptions) *models.Task {
+	t.Helper()
+	task, err := svc.CreateTaskWithOptions(repo, "Refactor step", opts)
+	if err != nil {
+		t.Fatalf("CreateTaskWithOptions() error = %v", err)
+	}
+	return task
+}
+
+// assertStatus checks a task's stored status
+func assertStatus(t *testing.T, svc *TaskService, id string, want models.TaskStatus) {
+	t.Helper()
+	task, err := svc.GetTask(id)
+	if err != nil {
+		t.Fatalf("GetTask(%s) error = %v", id, err)
+	}
+	if task.Status != want {
+		t.Errorf("task %s status = %s, want %s", id, task.Status, want)
+	}
+}
+
+func TestCreateTask_BlockedUntilDependenciesSucceed(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+	repo := "https://github.com/acme/api"
+
+	first := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	second := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	last := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{first.ID, second.ID}})
+	if last.Status != models.TaskStatusBlocked {
+		t.Fatalf("Status = %s, want blocked", last.Status)
+	}
+
+	// A blocked task is never claimed
+	svc.UpdateTaskStatus(ctx, first.ID, string(models.TaskStatusRunning))
+	svc.UpdateTaskStatus(ctx, second.ID, string(models.TaskStatusRunning))
+	if task, _ := svc.ClaimNextTask(ctx, "worker-1", 0); task != nil {
+		t.Fatalf("claimed %s, want the blocked task held back", task.ID)
+	}
+
+	// One dependency is not enough
+	svc.UpdateTaskStatus(ctx, first.ID, string(models.TaskStatusSuccess))
+	assertStatus(t, svc, last.ID, models.TaskStatusBlocked)
+
+	svc.UpdateTaskModel(ctx, &models.Task{ID: second.ID, Repo: repo, Status: models.TaskStatusSuccess})
+	assertStatus(t, svc, last.ID, models.TaskStatusQueued)
+
+	logs, _ := svc.GetTaskLogs(last.ID, 0, 0)
+	if len(logs) != 1 || logs[0].Message != "All dependencies succeeded; task queued" {
+		t.Errorf("logs = %+v, want the unblocking logged", logs)
+	}
+}
+
+func TestCreateTask_DependencyAlreadySucceeded(t *testing.T) {
+	svc := newTestTaskService(t)
+	repo := "https://github.com/acme/api"
+
+	parent := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	svc.UpdateTaskStatus(context.Background(), parent.ID, string(models.TaskStatusSuccess))
+
+	child := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{parent.ID}})
+	if child.Status != models.TaskStatusQueued {
+		t.Errorf("Status = %s, want queued straight away", child.Status)
+	}
+}
+
+func TestDependencyFailureCascades(t *testing.T) {
+	tests := []struct {
+		name   string
+		status models.TaskStatus
+	}{
+		{"error", models.TaskStatusError},
+		{"aborted", models.TaskStatusAborted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestTaskService(t)
+			repo := "https://github.com/acme/api"
+
+			root := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+			child := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{root.ID}})
+			grandchild := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{child.ID}})
+			unrelated := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+
+			if tt.status == models.TaskStatusAborted {
+				if err := svc.UpdateTask(root.ID, "abort", ""); err != nil {
+					t.Fatalf("UpdateTask(abort) error = %v", err)
+				}
+			} else {
+				svc.UpdateTaskStatus(context.Background(), root.ID, string(tt.status))
+			}
+
+			assertStatus(t, svc, child.ID, tt.status)
+			assertStatus(t, svc, grandchild.ID, tt.status)
+			assertStatus(t, svc, unrelated.ID, models.TaskStatusQueued)
+
+			stored, _ := svc.GetTask(grandchild.ID)
+			if stored.Summary != "Dependency "+child.ID+" finished with status "+string(tt.status) {
+				t.Errorf("Summary = %q, want the failed dependency named", stored.Summary)
+			}
+		})
+	}
+}
+
+func TestCreateTask_StackOnParent(t *testing.T) {
+	svc := newTestTaskService(t)
+	repo := "https://github.com/acme/api"
+
+	parent := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	child := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{parent.ID}, StackOnParent: true})
+	if child.BaseBranch != parent.Branch {
+		t.Errorf("BaseBranch = %q, want the parent's branch %q", child.BaseBranch, parent.Branch)
+	}
+
+	dependencies, dependents, err := svc.GetTaskDependencies(parent.ID)
+	if err != nil {
+		t.Fatalf("GetTaskDependencies() error = %v", err)
+	}
+	if len(dependencies) != 0 || len(dependents) != 1 || dependents[0].ID != child.ID {
+		t.Errorf("GetTaskDependencies() = %v, %v, want the child as the only dependent", dependencies, dependents)
+	}
+}
+
+func TestCreateTask_InvalidDependencies(t *testing.T) {
+	svc := newTestTaskService(t)
+	repo := "https://github.com/acme/api"
+
+	parent := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	other := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	failed := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	svc.UpdateTaskStatus(context.Background(), failed.ID, string(models.TaskStatusError))
+
+	tests := []struct {
+		name string
+		repo string
+		opts CreateTaskOptions
+	}{
+		{"unknown task", repo, CreateTaskOptions{DependsOn: []string{"missing"}}},
+		{"failed task", repo, CreateTaskOptions{DependsOn: []string{failed.ID}}},
+		{"stack without dependency", repo, CreateTaskOptions{StackOnParent: true}},
+		{"stack on two tasks", repo, CreateTaskOptions{DependsOn: []string{parent.ID, other.ID}, StackOnParent: true}},
+		{"stack across repositories", "https://github.com/acme/web", CreateTaskOptions{DependsOn: []string{parent.ID}, StackOnParent: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateTaskWithOptions(tt.repo, "Refactor step", tt.opts)
+			if !errors.Is(err, ErrInvalidDependency) {
+				t.Errorf("CreateTaskWithOptions() error = %v, want ErrInvalidDependency", err)
+			}
+		})
+	}
+}
+
+func TestUpdateTask_ContinueWaitsForDependencies(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+	repo := "https://github.com/acme/api"
+
+	parent := mustCreateTask(t, svc, repo, CreateTaskOptions{})
+	child := mustCreateTask(t, svc, repo, CreateTaskOptions{DependsOn: []string{parent.ID}})
+	svc.UpdateTaskStatus(ctx, parent.ID, string(models.TaskStatusError))
+	assertStatus(t, svc, child.ID, models.TaskStatusError)
+
+	// The dependent cannot run while its dependency is still failed
+	if err := svc.UpdateTask(child.ID, "continue", ""); !errors.Is(err, ErrDependencyFailed) {
+		t.Fatalf("UpdateTask(continue) error = %v, want ErrDependencyFailed", err)
+	}
+
+	// Once the dependency is continued, the dependent waits for it again
+	if err := svc.UpdateTask(parent.ID, "continue", ""); err != nil {
+		t.Fatalf("UpdateTask(continue) parent error = %v", err)
+	}
+	if err := svc.UpdateTask(child.ID, "continue", ""); err != nil {
+		t.Fatalf("UpdateTask(continue) child error = %v", err)
+	}
+	assertStatus(t, svc, child.ID, models.TaskStatusBlocked)
+
+	svc.UpdateTaskStatus(ctx, parent.ID, string(models.TaskStatusSuccess))
+	assertStatus(t, svc, child.ID, models.TaskStatusQueued)
+}
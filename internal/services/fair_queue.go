@@ -0,0 +1,118 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// fairShareWindow is how far back a repository's claims count against its
+// share of the workers
+const fairShareWindow = time.Hour
+
+// repoUnderCap matches tasks whose repository holds fewer leases than the
+// cap. It is part of the claim update itself, so concurrent claims cannot
+// push a repository past the cap.
+const repoUnderCap = `(SELECT COUNT(*) FROM tasks AS held
+	WHERE held.repo_key = tasks.repo_key AND held.claimed_by <> '') < ?`
+
+// workerShare is a repository's or an owner's use of the workers
+type workerShare struct {
+	Key string `gorm:"column:share_key"`
+	// Held counts the tasks currently leased to a worker
+	Held int
+	// Served counts those plus the tasks claimed within fairShareWindow
+	Served int
+}
+
+// workerUsage returns the use of the workers by every repository and every
+// owner that holds a lease or had a task claimed since the given time, keyed
+// by models.RepoKeys
+func workerUsage(tx *gorm.DB, since time.Time) (repos, owners map[string]workerShare, err error) {
+	if repos, err = usageBy(tx, "repo_key", since); err != nil {
+		return nil, nil, err
+	}
+	if owners, err = usageBy(tx, "repo_owner", since); err != nil {
+		return nil, nil, err
+	}
+	return repos, owners, nil
+}
+
+// usageBy returns the use of the workers grouped by the given key column
+func usageBy(tx *gorm.DB, column string, since time.Time) (map[string]workerShare, error) {
+	var shares []workerShare
+	err := tx.Model(&models.Task{}).
+		Select(column+` AS share_key,
+			SUM(CASE WHEN claimed_by <> '' THEN 1 ELSE 0 END) AS held,
+			COUNT(*) AS served`).
+		Where("claimed_by <> '' OR claimed_at >= ?", since).
+		Group(column).
+		Scan(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]workerShare, len(shares))
+	for _, share := range shares {
+		usage[share.Key] = share
+	}
+	return usage, nil
+}
+
+// nextFairTask picks the task to claim from candidates ordered by priority
+// and age. Recent use of the workers is weighed against the priority of the
+// best waiting task, first per owner and then, among the repositories of
+// equally served owners, per repository; the smallest weighted use goes
+// next. Neither a long queue on one repository nor an owner with many
+// repositories can therefore starve the others, while a higher priority
+// earns a proportionally larger share. Repositories already holding repoCap
+// leases are skipped.
+func nextFairTask(candidates []models.Task, repos, owners map[string]workerShare, repoCap int) *models.Task {
+	var best *models.Task
+	var bestOwner, bestRepo float64
+	seen := make(map[string]bool)
+	ownerWeights := make(map[string]float64)
+
+	for i := range candidates {
+		task := &candidates[i]
+		// Candidates are ordered, so a repository's first one is its best,
+		// and likewise an owner's
+		if _, ok := ownerWeights[task.RepoOwner]; !ok {
+			ownerWeights[task.RepoOwner] = float64(priorityWeight(task.Priority))
+		}
+		if seen[task.RepoKey] {
+			continue
+		}
+		seen[task.RepoKey] = true
+
+		repo := repos[task.RepoKey]
+		if repoCap > 0 && repo.Held >= repoCap {
+			continue
+		}
+
+		// Ties keep the earlier candidate: the higher priority, then the older task
+		ownerUse := float64(owners[task.RepoOwner].Served+1) / ownerWeights[task.RepoOwner]
+		repoUse := float64(repo.Served+1) / float64(priorityWeight(task.Priority))
+		if best == nil || ownerUse < bestOwner || (ownerUse == bestOwner && repoUse < bestRepo) {
+			best, bestOwner, bestRepo = task, ownerUse, repoUse
+		}
+	}
+
+	return best
+}
+
+// priorityWeight returns the scheduling weight of a task priority
+func priorityWeight(priority int) int {
+	switch {
+	case priority == 0:
+		return models.DefaultTaskPriority
+	case priority < models.MinTaskPriority:
+		return models.MinTaskPriority
+	case priority > models.MaxTaskPriority:
+		return models.MaxTaskPriority
+	default:
+		return priority
+	}
+}
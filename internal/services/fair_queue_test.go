@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestNextFairTask(t *testing.T) {
+	api := models.Task{ID: "api-1", RepoKey: "github.com/acme/api", RepoOwner: "github.com/acme", Priority: 5}
+	apiLow := models.Task{ID: "api-2", RepoKey: "github.com/acme/api", RepoOwner: "github.com/acme", Priority: 1}
+	web := models.Task{ID: "web-1", RepoKey: "github.com/acme/web", RepoOwner: "github.com/acme", Priority: 5}
+	urgent := models.Task{ID: "web-2", RepoKey: "github.com/acme/web", RepoOwner: "github.com/acme", Priority: 10}
+	other := models.Task{ID: "other-1", RepoKey: "github.com/globex/app", RepoOwner: "github.com/globex", Priority: 5}
+
+	tests := []struct {
+		name       string
+		candidates []models.Task
+		repos      map[string]workerShare
+		owners     map[string]workerShare
+		repoCap    int
+		want       string
+	}{
+		{
+			name:       "equal use keeps queue order",
+			candidates: []models.Task{api, web},
+			want:       "api-1",
+		},
+		{
+			name:       "least used repository first",
+			candidates: []models.Task{api, apiLow, web},
+			repos:      map[string]workerShare{"github.com/acme/api": {Served: 3}},
+			owners:     map[string]workerShare{"github.com/acme": {Served: 3}},
+			want:       "web-1",
+		},
+		{
+			name:       "higher priority earns a larger share",
+			candidates: []models.Task{urgent, api},
+			repos:      map[string]workerShare{"github.com/acme/web": {Served: 1}},
+			owners:     map[string]workerShare{"github.com/acme": {Served: 1}},
+			want:       "web-2",
+		},
+		{
+			name:       "priority share runs out",
+			candidates: []models.Task{urgent, api},
+			repos:      map[string]workerShare{"github.com/acme/web": {Served: 2}},
+			owners:     map[string]workerShare{"github.com/acme": {Served: 2}},
+			want:       "api-1",
+		},
+		{
+			name:       "least used owner first, however many repositories it has",
+			candidates: []models.Task{web, other},
+			repos:      map[string]workerShare{"github.com/acme/api": {Served: 1}, "github.com/globex/app": {Served: 1}},
+			owners:     map[string]workerShare{"github.com/acme": {Served: 2}, "github.com/globex": {Served: 1}},
+			want:       "other-1",
+		},
+		{
+			name:       "repository at its cap is skipped",
+			candidates: []models.Task{api, web},
+			repos:      map[string]workerShare{"github.com/acme/api": {Held: 1, Served: 1}, "github.com/acme/web": {Held: 1, Served: 4}},
+			owners:     map[string]workerShare{"github.com/acme": {Held: 2, Served: 5}},
+			repoCap:    2,
+			want:       "api-1",
+		},
+		{
+			name:       "every repository at its cap",
+			candidates: []models.Task{api, web},
+			repos:      map[string]workerShare{"github.com/acme/api": {Held: 1, Served: 1}, "github.com/acme/web": {Held: 1, Served: 1}},
+			owners:     map[string]workerShare{"github.com/acme": {Held: 2, Served: 2}},
+			repoCap:    1,
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextFairTask(tt.candidates, tt.repos, tt.owners, tt.repoCap)
+			gotID := ""
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.want {
+				t.Errorf("nextFairTask() = %q, want %q", gotID, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimNextTask_SharesWorkersAcrossRepos(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	// One repository queues a backlog before another queues a single task
+	for i := 0; i < 5; i++ {
+		svc.CreateTask("https://github.com/acme/api", "backlog")
+		time.Sleep(time.Millisecond)
+	}
+	web, _ := svc.CreateTask("https://github.com/acme/web", "fix")
+
+	var order []string
+	for i := 0; i < 3; i++ {
+		task, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+		if err != nil || task == nil {
+			t.Fatalf("ClaimNextTask() = %v, %v, want a task", task, err)
+		}
+		order = append(order, task.Repo)
+		// Finish the task so only the claim history counts
+		svc.ReleaseTask(ctx, task.ID, "worker-1")
+		svc.UpdateTaskStatus(ctx, task.ID, string(models.TaskStatusSuccess))
+	}
+
+	if order[1] != web.Repo {
+		t.Errorf("claimed %v, want acme/web second rather than behind the backlog", order)
+	}
+}
+
+func TestClaimNextTask_PriorityFirst(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	svc.CreateTask("https://github.com/acme/api", "routine")
+	time.Sleep(time.Millisecond)
+	urgent, _ := svc.CreateTaskWithOptions("https://github.com/acme/api", "outage", CreateTaskOptions{Priority: 9})
+
+	task, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if task == nil || task.ID != urgent.ID {
+		t.Errorf("claimed %v, want the higher priority task", task)
+	}
+}
+
+func TestClaimNextTask_RepoConcurrencyCap(t *testing.T) {
+	svc := newTestTaskService(t)
+	svc.SetRepoConcurrency(1)
+	ctx := context.Background()
+
+	svc.CreateTask("https://github.com/acme/api", "first")
+	svc.CreateTask("https://github.com/acme/api", "second")
+
+	first, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil || first == nil {
+		t.Fatalf("ClaimNextTask() = %v, %v, want a task", first, err)
+	}
+	second, err := svc.ClaimNextTask(ctx, "worker-2", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if second != nil {
+		t.Fatalf("claimed %s while the repository is at its cap", second.ID)
+	}
+
+	// The same repository referenced another way shares the cap
+	svc.CreateTask("git@github.com:Acme/API.git", "third")
+	if third, err := svc.ClaimNextTask(ctx, "worker-3", time.Minute); err != nil || third != nil {
+		t.Fatalf("ClaimNextTask() = %v, %v, want the scp-like reference held to the same cap", third, err)
+	}
+
+	// Releasing the first lease frees the slot
+	svc.UpdateTaskStatus(ctx, first.ID, string(models.TaskStatusSuccess))
+	svc.ReleaseTask(ctx, first.ID, "worker-1")
+	second, err = svc.ClaimNextTask(ctx, "worker-2", time.Minute)
+	if err != nil || second == nil {
+		t.Errorf("ClaimNextTask() = %v, %v, want the second task once the slot is free", second, err)
+	}
+}
+
+func TestSetTaskPriority(t *testing.T) {
+	svc := newTestTaskService(t)
+
+	created, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	if created.Priority != models.DefaultTaskPriority {
+		t.Errorf("Priority = %d, want the default %d", created.Priority, models.DefaultTaskPriority)
+	}
+
+	if err := svc.SetTaskPriority(created.ID, 8); err != nil {
+		t.Fatalf("SetTaskPriority() error = %v", err)
+	}
+	task, _ := svc.GetTask(created.ID)
+	if task.Priority != 8 {
+		t.Errorf("Priority = %d, want 8", task.Priority)
+	}
+
+	if err := svc.SetTaskPriority(created.ID, 11); err == nil {
+		t.Error("SetTaskPriority(11) succeeded, want an out of range error")
+	}
+	if err := svc.SetTaskPriority("missing", 3); err == nil || err.Error() != "task not found" {
+		t.Errorf("SetTaskPriority(missing) error = %v, want task not found", err)
+	}
+}
+
+func TestSetTaskPriority_WhileRunning(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	svc.CreateTask("https://github.com/acme/api", "prompt")
+	running, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil || running == nil {
+		t.Fatalf("ClaimNextTask() = %v, %v", running, err)
+	}
+
+	// The worker's copy of the task must not undo a priority set meanwhile
+	if err := svc.SetTaskPriority(running.ID, 9); err != nil {
+		t.Fatalf("SetTaskPriority() error = %v", err)
+	}
+	running.Summary = "working"
+	if err := svc.ReportTask(ctx, running, "worker-1"); err != nil {
+		t.Fatalf("ReportTask() error = %v", err)
+	}
+	if task, _ := svc.GetTask(running.ID); task.Priority != 9 || task.Summary != "working" {
+		t.Errorf("task = priority %d summary %q, want the new priority and the report", task.Priority, task.Summary)
+	}
+
+	// A priority sent with an action that fails is not applied either
+	priority := 2
+	if err := svc.UpdateTaskWithOptions(running.ID, "continue", "", UpdateTaskOptions{Priority: &priority}); !errors.Is(err, ErrTaskNotContinuable) {
+		t.Fatalf("UpdateTaskWithOptions(continue) error = %v, want ErrTaskNotContinuable", err)
+	}
+	if task, _ := svc.GetTask(running.ID); task.Priority != 9 {
+		t.Errorf("Priority = %d, want 9 kept when the action fails", task.Priority)
+	}
+
+	if err := svc.UpdateTaskWithOptions(running.ID, "abort", "", UpdateTaskOptions{Priority: &priority}); err != nil {
+		t.Fatalf("UpdateTaskWithOptions(abort) error = %v", err)
+	}
+	if task, _ := svc.GetTask(running.ID); task.Priority != 2 || task.Status != models.TaskStatusAborted {
+		t.Errorf("task = priority %d status %s, want both changes applied", task.Priority, task.Status)
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/cron"
+	"github.com/brettsmith212/ci-test-2/internal/database"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// ErrInvalidSchedule is returned for a cron expression or time zone that cannot be used
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// activeTaskStatuses are the statuses of a task that is still being worked
+// on. A task waiting for review does not hold up the schedule's next run.
+var activeTaskStatuses = []string{
+	string(models.TaskStatusQueued),
+	string(models.TaskStatusRunning),
+	string(models.TaskStatusRetrying),
+}
+
+// ScheduleService provides business logic for recurring tasks
+type ScheduleService struct {
+	db    *gorm.DB
+	tasks *TaskService
+}
+
+// NewScheduleService creates a new ScheduleService that enqueues tasks through tasks
+func NewScheduleService(db *gorm.DB, tasks *TaskService) *ScheduleService {
+	if db == nil {
+		panic("database connection is nil")
+	}
+	return &ScheduleService{
+		db:    db,
+		tasks: tasks,
+	}
+}
+
+// NewScheduleServiceDefault creates a new ScheduleService using the default database
+func NewScheduleServiceDefault() *ScheduleService {
+	db := database.GetDB()
+	if db == nil {
+		panic("database not initialized - call database.Connect() first")
+	}
+	return NewScheduleService(db, NewTaskService(db))
+}
+
+// ScheduleOptions holds optional settings for a new schedule
+type ScheduleOptions struct {
+	// Name shown in listings
+	Name string
+	// IANA time zone the cron expression is read in; empty uses UTC
+	Timezone string
+	// Settings of every task the schedule enqueues
+	Task CreateTaskOptions
+}
+
+// CreateSchedule creates a schedule that enqueues a task for repo and prompt
+// whenever cronExpr fires
+func (s *ScheduleService) CreateSchedule(cronExpr, repo, prompt string, opts ScheduleOptions) (*models.Schedule, error) {
+	schedule := &models.Schedule{
+		ID:         ulid.Make().String(),
+		Name:       opts.Name,
+		Cron:       cronExpr,
+		Timezone:   opts.Timezone,
+		Repo:       repo,
+		Prompt:     prompt,
+		Agent:      opts.Task.Agent,
+		MaxRetries: opts.Task.MaxRetries,
+		Priority:   opts.Task.Priority,
+	}
+
+	nextRunAt, err := nextScheduledRun(schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	schedule.NextRunAt = &nextRunAt
+
+	if err := s.db.Create(schedule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetSchedule retrieves a schedule by ID
+func (s *ScheduleService) GetSchedule(id string) (*models.Schedule, error) {
+	var schedule models.Schedule
+	if err := s.db.First(&schedule, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("schedule not found")
+		}
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// ListSchedules retrieves every schedule, oldest first
+func (s *ScheduleService) ListSchedules() ([]models.Schedule, error) {
+	var schedules []models.Schedule
+	if err := s.db.Order("created_at ASC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// SetPaused pauses or resumes a schedule. A resumed schedule next fires at
+// its first time after now rather than catching up on the runs it missed.
+func (s *ScheduleService) SetPaused(id string, paused bool) (*models.Schedule, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"paused":     paused,
+		"updated_at": time.Now(),
+	}
+	if !paused {
+		nextRunAt, err := nextScheduledRun(schedule, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		updates["next_run_at"] = nextRunAt
+	}
+
+	if err := s.db.Model(&models.Schedule{}).Where("id = ?", id).UpdateColumns(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	return s.GetSchedule(id)
+}
+
+// DeleteSchedule deletes a schedule. Tasks it already enqueued are kept.
+func (s *ScheduleService) DeleteSchedule(id string) error {
+	result := s.db.Delete(&models.Schedule{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("schedule not found")
+	}
+
+	return nil
+}
+
+// EnqueueDueSchedules enqueues a task for every unpaused schedule whose next
+// run time has passed, and moves each schedule on to its following run. A
+// schedule whose previous task is still active is skipped for this run, so
+// a slow task never piles up behind itself. A schedule that fails to enqueue
+// keeps its run for the next tick without holding up the others. It returns
+// the number of tasks enqueued.
+func (s *ScheduleService) EnqueueDueSchedules(ctx context.Context, now time.Time) (int, error) {
+	db := s.db.WithContext(ctx)
+
+	var due []models.Schedule
+	if err := db.Where("paused = ? AND next_run_at <= ?", false, now).Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to find due schedules: %w", err)
+	}
+
+	enqueued := 0
+	for i := range due {
+		schedule := &due[i]
+
+		// Runs missed while the orchestrator was down collapse into this one
+		nextRunAt, err := nextScheduledRun(schedule, now)
+		if err != nil {
+			log.Printf("Schedule %s cannot run: %v", schedule.ID, err)
+			continue
+		}
+
+		task, active, err := s.enqueueSchedule(db, schedule, now, nextRunAt)
+		if err != nil {
+			log.Printf("Schedule %s failed to enqueue: %v", schedule.ID, err)
+			continue
+		}
+		if active != nil {
+			message := fmt.Sprintf("Scheduled run of %s skipped; this task is still %s", schedule.Cron, active.Status)
+			if err := s.tasks.AddTaskLog(ctx, active.ID, "warn", message); err != nil {
+				log.Printf("Schedule %s skipped a run but failed to log it: %v", schedule.ID, err)
+			}
+			continue
+		}
+		if task != nil {
+			enqueued++
+		}
+	}
+
+	return enqueued, nil
+}
+
+// enqueueSchedule moves a due schedule on to nextRunAt and enqueues its task,
+// in one transaction so a run is never passed over without its task. It
+// returns the task enqueued, or the active task the run was skipped for;
+// neither when a concurrent scheduler took the run.
+func (s *ScheduleService) enqueueSchedule(db *gorm.DB, schedule *models.Schedule, now, nextRunAt time.Time) (*models.Task, *models.Task, error) {
+	var task, active *models.Task
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The conditional update lets only one scheduler take this run
+		result := tx.Model(&models.Schedule{}).
+			Where("id = ? AND paused = ? AND next_run_at <= ?", schedule.ID, false, now).
+			UpdateColumns(map[string]interface{}{
+				"next_run_at": nextRunAt,
+				"last_run_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to advance schedule: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var previous models.Task
+		err := tx.Where("schedule_id = ? AND status IN ?", schedule.ID, activeTaskStatuses).
+			Order("created_at DESC").
+			First(&previous).Error
+		if err == nil {
+			active = &previous
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed to find active task: %w", err)
+		}
+
+		created, err := NewTaskService(tx).CreateTaskWithOptions(schedule.Repo, schedule.Prompt, CreateTaskOptions{
+			Agent:      schedule.Agent,
+			MaxRetries: schedule.MaxRetries,
+			Priority:   schedule.Priority,
+			ScheduleID: schedule.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue task: %w", err)
+		}
+		if err := tx.Model(&models.Schedule{}).Where("id = ?", schedule.ID).UpdateColumn("last_task_id", created.ID).Error; err != nil {
+			return fmt.Errorf("failed to update schedule: %w", err)
+		}
+		task = created
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return task, active, nil
+}
+
+// nextScheduledRun returns when schedule next fires after t
+func nextScheduledRun(schedule *models.Schedule, t time.Time) (time.Time, error) {
+	expr, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	loc, err := schedule.Location()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, schedule.Timezone)
+	}
+
+	next := expr.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: %q never fires", ErrInvalidSchedule, schedule.Cron)
+	}
+	// Stored times are compared as text, so keep them in the zone time.Now uses
+	return next.In(time.Local), nil
+}
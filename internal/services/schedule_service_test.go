@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// makeScheduleDue moves a schedule's next run into the past
+func makeScheduleDue(t *testing.T, svc *ScheduleService, id string) {
+	t.Helper()
+	err := svc.db.Model(&models.Schedule{}).Where("id = ?", id).
+		UpdateColumn("next_run_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatalf("failed to make schedule due: %v", err)
+	}
+}
+
+func TestCreateSchedule(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+
+	schedule, err := svc.CreateSchedule("0 3 * * *", "https://github.com/acme/api", "Bump minor deps", ScheduleOptions{
+		Name:     "deps",
+		Timezone: "UTC",
+		Task:     CreateTaskOptions{Priority: 3},
+	})
+	if err != nil {
+		t.Fatalf("CreateSchedule() error = %v", err)
+	}
+	if schedule.NextRunAt == nil || !schedule.NextRunAt.After(time.Now()) {
+		t.Fatalf("NextRunAt = %v, want a future run", schedule.NextRunAt)
+	}
+	if next := schedule.NextRunAt.UTC(); next.Hour() != 3 || next.Minute() != 0 {
+		t.Errorf("NextRunAt = %v, want 03:00 UTC", next)
+	}
+
+	invalid := []struct {
+		cron, timezone string
+	}{
+		{"not a cron", ""},
+		{"0 0 30 2 *", ""},
+		{"@daily", "Mars/Olympus_Mons"},
+	}
+	for _, tt := range invalid {
+		_, err := svc.CreateSchedule(tt.cron, "https://github.com/acme/api", "prompt", ScheduleOptions{Timezone: tt.timezone})
+		if !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("CreateSchedule(%q, %q) error = %v, want ErrInvalidSchedule", tt.cron, tt.timezone, err)
+		}
+	}
+}
+
+func TestEnqueueDueSchedules(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+	ctx := context.Background()
+
+	schedule, _ := svc.CreateSchedule("@hourly", "https://github.com/acme/api", "Regenerate mocks", ScheduleOptions{
+		Task: CreateTaskOptions{Agent: "command", Priority: 8},
+	})
+
+	// Nothing is due yet
+	if n, err := svc.EnqueueDueSchedules(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("EnqueueDueSchedules() = %d, %v, want nothing enqueued", n, err)
+	}
+
+	makeScheduleDue(t, svc, schedule.ID)
+	n, err := svc.EnqueueDueSchedules(ctx, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("EnqueueDueSchedules() = %d, %v, want 1 task", n, err)
+	}
+
+	stored, _ := svc.GetSchedule(schedule.ID)
+	if stored.LastTaskID == "" || stored.LastRunAt == nil {
+		t.Fatalf("schedule = %+v, want the run recorded", stored)
+	}
+	if stored.NextRunAt == nil || !stored.NextRunAt.After(time.Now()) {
+		t.Errorf("NextRunAt = %v, want the following run", stored.NextRunAt)
+	}
+
+	task, _ := tasks.GetTask(stored.LastTaskID)
+	if task.ScheduleID != schedule.ID || task.Prompt != "Regenerate mocks" || task.Agent != "command" || task.Priority != 8 {
+		t.Errorf("task = %+v, want the schedule's repo, prompt and options", task)
+	}
+}
+
+func TestEnqueueDueSchedules_KeepsRunWhenEnqueueFails(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+	ctx := context.Background()
+
+	// Creating tasks for the broken repository fails
+	tasks.db.Callback().Create().Before("gorm:create").Register("fail_broken_repo", func(db *gorm.DB) {
+		if task, ok := db.Statement.Dest.(*models.Task); ok && task.Repo == "https://github.com/acme/broken" {
+			db.AddError(errors.New("disk I/O error"))
+		}
+	})
+
+	broken, _ := svc.CreateSchedule("@hourly", "https://github.com/acme/broken", "Regenerate mocks", ScheduleOptions{})
+	healthy, _ := svc.CreateSchedule("@hourly", "https://github.com/acme/api", "Regenerate mocks", ScheduleOptions{})
+	makeScheduleDue(t, svc, broken.ID)
+	makeScheduleDue(t, svc, healthy.ID)
+
+	// The failing schedule does not hold up the other one
+	n, err := svc.EnqueueDueSchedules(ctx, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("EnqueueDueSchedules() = %d, %v, want the healthy schedule enqueued", n, err)
+	}
+	if stored, _ := svc.GetSchedule(healthy.ID); stored.LastTaskID == "" {
+		t.Errorf("healthy schedule = %+v, want its task recorded", stored)
+	}
+
+	// The failed run is still due, to be tried again on the next tick
+	stored, _ := svc.GetSchedule(broken.ID)
+	if stored.LastTaskID != "" || stored.LastRunAt != nil || stored.NextRunAt == nil || stored.NextRunAt.After(time.Now()) {
+		t.Errorf("broken schedule = %+v, want its run kept", stored)
+	}
+}
+
+func TestEnqueueDueSchedules_SkipsWhilePreviousActive(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+	ctx := context.Background()
+
+	schedule, _ := svc.CreateSchedule("@daily", "https://github.com/acme/api", "Bump minor deps", ScheduleOptions{})
+	makeScheduleDue(t, svc, schedule.ID)
+	svc.EnqueueDueSchedules(ctx, time.Now())
+	first, _ := svc.GetSchedule(schedule.ID)
+
+	// The first task is still queued when the schedule fires again
+	makeScheduleDue(t, svc, schedule.ID)
+	n, err := svc.EnqueueDueSchedules(ctx, time.Now())
+	if err != nil || n != 0 {
+		t.Fatalf("EnqueueDueSchedules() = %d, %v, want the run skipped", n, err)
+	}
+
+	stored, _ := svc.GetSchedule(schedule.ID)
+	if stored.LastTaskID != first.LastTaskID {
+		t.Errorf("LastTaskID = %s, want %s kept", stored.LastTaskID, first.LastTaskID)
+	}
+	if stored.NextRunAt == nil || !stored.NextRunAt.After(time.Now()) {
+		t.Errorf("NextRunAt = %v, want the skipped run passed over", stored.NextRunAt)
+	}
+	logs, _ := tasks.GetTaskLogs(first.LastTaskID, 0, 0)
+	if len(logs) == 0 || logs[len(logs)-1].Level != "warn" {
+		t.Errorf("logs = %+v, want the skip logged on the active task", logs)
+	}
+
+	// Once it stops to wait for review, the next run enqueues again
+	tasks.UpdateTaskStatus(ctx, first.LastTaskID, string(models.TaskStatusRunning))
+	tasks.UpdateTaskStatus(ctx, first.LastTaskID, string(models.TaskStatusNeedsReview))
+	makeScheduleDue(t, svc, schedule.ID)
+	if n, err := svc.EnqueueDueSchedules(ctx, time.Now()); err != nil || n != 1 {
+		t.Errorf("EnqueueDueSchedules() = %d, %v, want a new task", n, err)
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+	ctx := context.Background()
+
+	schedule, _ := svc.CreateSchedule("@hourly", "https://github.com/acme/api", "prompt", ScheduleOptions{})
+	if _, err := svc.SetPaused(schedule.ID, true); err != nil {
+		t.Fatalf("SetPaused(true) error = %v", err)
+	}
+
+	makeScheduleDue(t, svc, schedule.ID)
+	if n, _ := svc.EnqueueDueSchedules(ctx, time.Now()); n != 0 {
+		t.Errorf("EnqueueDueSchedules() = %d, want a paused schedule skipped", n)
+	}
+
+	// Resuming does not catch up on the missed run
+	resumed, err := svc.SetPaused(schedule.ID, false)
+	if err != nil {
+		t.Fatalf("SetPaused(false) error = %v", err)
+	}
+	if resumed.Paused || resumed.NextRunAt == nil || !resumed.NextRunAt.After(time.Now()) {
+		t.Errorf("schedule = %+v, want resumed with a future run", resumed)
+	}
+
+	if _, err := svc.SetPaused("missing", true); err == nil || err.Error() != "schedule not found" {
+		t.Errorf("SetPaused(missing) error = %v, want schedule not found", err)
+	}
+}
+
+func TestDeleteSchedule(t *testing.T) {
+	tasks := newTestTaskService(t)
+	svc := NewScheduleService(tasks.db, tasks)
+
+	schedule, _ := svc.CreateSchedule("@hourly", "https://github.com/acme/api", "prompt", ScheduleOptions{})
+	if err := svc.DeleteSchedule(schedule.ID); err != nil {
+		t.Fatalf("DeleteSchedule() error = %v", err)
+	}
+	if _, err := svc.GetSchedule(schedule.ID); err == nil {
+		t.Error("GetSchedule() found a deleted schedule")
+	}
+	if err := svc.DeleteSchedule(schedule.ID); err == nil {
+		t.Error("DeleteSchedule() succeeded twice")
+	}
+}
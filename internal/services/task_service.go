@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,9 +14,34 @@ import (
 	"github.com/brettsmith212/ci-test-2/internal/models"
 )
 
+// ErrLeaseLost is returned when a worker no longer holds the lease on a task
+var ErrLeaseLost = errors.New("task lease lost")
+
+// ErrTaskAborted is returned when saving a task that was aborted in the meantime
+var ErrTaskAborted = errors.New("task was aborted")
+
+// ErrTaskNotContinuable is returned when continuing a task that has not
+// failed or stopped for review
+var ErrTaskNotContinuable = errors.New("task cannot be continued")
+
+// leaseColumns are owned by ClaimNextTask, RenewLease and ReleaseTask and are
+// never written by whole-model saves, so a stale copy cannot undo a heartbeat
+var leaseColumns = []string{"claimed_by", "lease_expires_at", "claimed_at"}
+
+// reportOmitColumns are never written from a worker's copy of a task: the
+// lease columns, the priority, which users may change while it runs, and the
+// repository keys, which the copy does not carry
+var reportOmitColumns = append([]string{"priority", "repo_key", "repo_owner"}, leaseColumns...)
+
+// DefaultMaxRetries is the attempt budget of a task when neither the task
+// nor the service configures one
+const DefaultMaxRetries = 3
+
 // TaskService provides business logic for task operations
 type TaskService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	maxRetries  int
+	repoTaskCap int
 }
 
 // NewTaskService creates a new TaskService instance
@@ -39,31 +65,140 @@ func NewTaskServiceDefault() *TaskService {
 	}
 }
 
+// SetMaxRetries sets the attempt budget of tasks that do not override it
+func (s *TaskService) SetMaxRetries(maxRetries int) {
+	s.maxRetries = maxRetries
+}
+
+// MaxRetriesFor returns the attempt budget of a task: its own override, or
+// the service's configured default
+func (s *TaskService) MaxRetriesFor(task *models.Task) int {
+	if task.MaxRetries > 0 {
+		return task.MaxRetries
+	}
+	return s.defaultMaxRetries()
+}
+
+// defaultMaxRetries returns the attempt budget of tasks without an override
+func (s *TaskService) defaultMaxRetries() int {
+	if s.maxRetries > 0 {
+		return s.maxRetries
+	}
+	return DefaultMaxRetries
+}
+
+// grantAttempts gives a continued task a fresh attempt budget on top of the
+// attempts it has used. Attempt numbers keep counting up, so the logs and
+// diffs of earlier attempts stay distinct.
+func (s *TaskService) grantAttempts(task *models.Task) {
+	if budget := task.Attempts + s.defaultMaxRetries(); budget > s.MaxRetriesFor(task) {
+		task.MaxRetries = budget
+	}
+}
+
+// SetRepoConcurrency caps how many tasks on the same repository may hold a
+// lease at once; zero leaves it unlimited
+func (s *TaskService) SetRepoConcurrency(maxTasks int) {
+	s.repoTaskCap = maxTasks
+}
+
 // CreateTask creates a new task
 func (s *TaskService) CreateTask(repo, prompt string) (*models.Task, error) {
+	return s.CreateTaskWithOptions(repo, prompt, CreateTaskOptions{})
+}
+
+// CreateTaskOptions holds optional settings for a new task
+type CreateTaskOptions struct {
+	// Coding agent to run the task with; empty uses the worker's default
+	Agent string
+	// Attempt budget of the task; zero uses the configured default
+	MaxRetries int
+	// Scheduling priority, from models.MinTaskPriority to models.MaxTaskPriority;
+	// zero uses models.DefaultTaskPriority
+	Priority int
+	// Schedule that enqueued the task, if any
+	ScheduleID string
+	// Campaign the task belongs to, if any
+	CampaignID string
+	// Tasks that must succeed before this one is queued; until then it is blocked
+	DependsOn []string
+	// Start the task's branch from its single dependency's branch, so its
+	// pull request stacks on the dependency's
+	StackOnParent bool
+}
+
+// CreateTaskWithOptions creates a new task with the given optional settings
+func (s *TaskService) CreateTaskWithOptions(repo, prompt string, opts CreateTaskOptions) (*models.Task, error) {
 	// Generate unique ID
 	id := ulid.Make().String()
 	
 	// Generate branch name from ID
 	branch := fmt.Sprintf("amp/%s", id[:6])
 	
-	// TODO: Generate Amp thread ID
-	// For now, use a placeholder - this will be implemented in worker step
-	threadID := fmt.Sprintf("thread-%s", id[:8])
-
+	// The worker creates the Amp thread on the task's first run
 	task := &models.Task{
 		ID:       id,
 		Repo:     repo,
 		Branch:   branch,
-		ThreadID: threadID,
+		Agent:    opts.Agent,
 		Prompt:   prompt,
 		Status:   models.TaskStatusQueued,
 		Attempts: 0,
+
+		MaxRetries: opts.MaxRetries,
+		Priority:   opts.Priority,
+		ScheduleID: opts.ScheduleID,
+		CampaignID: opts.CampaignID,
+	}
+	if task.Priority == 0 {
+		task.Priority = models.DefaultTaskPriority
+	}
+
+	if len(opts.DependsOn) == 0 {
+		if opts.StackOnParent {
+			return nil, fmt.Errorf("%w: stacking needs a task to depend on", ErrInvalidDependency)
+		}
+		if err := s.db.Create(task).Error; err != nil {
+			return nil, fmt.Errorf("failed to create task: %w", err)
+		}
+		return task, nil
+	}
+
+	// A task with dependencies waits, blocked, until they have all succeeded
+	task.Status = models.TaskStatusBlocked
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		parents, err := dependencyParents(tx, opts.DependsOn)
+		if err != nil {
+			return err
+		}
+		if opts.StackOnParent {
+			if len(parents) != 1 || parents[0].Repo != repo {
+				return fmt.Errorf("%w: stacking needs exactly one dependency on the same repository", ErrInvalidDependency)
+			}
+			task.BaseBranch = parents[0].Branch
+		}
+
+		if err := tx.Create(task).Error; err != nil {
+			return fmt.Errorf("failed to create task: %w", err)
+		}
+		for _, parent := range parents {
+			dependency := &models.TaskDependency{TaskID: task.ID, DependsOnID: parent.ID}
+			if err := tx.Create(dependency).Error; err != nil {
+				return fmt.Errorf("failed to record dependency: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.db.Create(task).Error; err != nil {
-		return nil, fmt.Errorf("failed to create task: %w", err)
+	// The dependencies may have finished already, or while the task was created
+	status, err := s.resolveBlockedTask(context.Background(), task.ID)
+	if err != nil {
+		return nil, err
 	}
+	task.Status = status
 
 	return task, nil
 }
@@ -114,55 +249,121 @@ func (s *TaskService) ListTasks(status string, limit, offset int) ([]models.Task
 	return tasks, nil
 }
 
+// SetTaskPriority changes the scheduling priority of a task
+func (s *TaskService) SetTaskPriority(id string, priority int) error {
+	if priority < models.MinTaskPriority || priority > models.MaxTaskPriority {
+		return fmt.Errorf("priority must be between %d and %d", models.MinTaskPriority, models.MaxTaskPriority)
+	}
+
+	result := s.db.Model(&models.Task{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"priority":   priority,
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update task priority: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("task not found")
+	}
+
+	return nil
+}
+
+// UpdateTaskOptions holds optional changes made along with a task update
+type UpdateTaskOptions struct {
+	// New scheduling priority; nil keeps the current one
+	Priority *int
+}
+
 // UpdateTask updates a task based on action
 func (s *TaskService) UpdateTask(id, action, prompt string) error {
-	// Retrieve the task
-	task, err := s.GetTask(id)
-	if err != nil {
-		return err
-	}
+	return s.UpdateTaskWithOptions(id, action, prompt, UpdateTaskOptions{})
+}
 
-	switch action {
-	case "continue":
-		// Validate that task can be continued
-		if !task.IsRetryable(3) { // TODO: Get max retries from config
-			return fmt.Errorf("task cannot be continued: status=%s, attempts=%d", task.Status, task.Attempts)
+// UpdateTaskWithOptions applies an action to a task together with the
+// changes in opts, all or none of them. An empty action only applies opts.
+func (s *TaskService) UpdateTaskWithOptions(id, action, prompt string, opts UpdateTaskOptions) error {
+	if opts.Priority != nil && (*opts.Priority < models.MinTaskPriority || *opts.Priority > models.MaxTaskPriority) {
+		return fmt.Errorf("priority must be between %d and %d", models.MinTaskPriority, models.MaxTaskPriority)
+	}
+	if action == "" {
+		if opts.Priority == nil {
+			return nil
 		}
+		return s.SetTaskPriority(id, *opts.Priority)
+	}
 
-		// Update prompt if provided
-		if prompt != "" {
-			task.Prompt = prompt
+	var task models.Task
+	settled := true
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&task, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("task not found")
+			}
+			return fmt.Errorf("failed to get task: %w", err)
 		}
-
-		// Update status to queued for retry
-		if err := task.UpdateStatus(models.TaskStatusQueued); err != nil {
-			return fmt.Errorf("failed to update task status: %w", err)
+		if opts.Priority != nil {
+			task.Priority = *opts.Priority
 		}
 
-	case "abort":
-		// Validate that task can be aborted
-		if task.Status.IsTerminal() && task.Status != models.TaskStatusAborted {
-			// Allow aborting already completed tasks (idempotent)
+		switch action {
+		case "continue":
+			// Validate that task can be continued
+			if !task.CanContinue() {
+				return fmt.Errorf("%w: status=%s", ErrTaskNotContinuable, task.Status)
+			}
+			s.grantAttempts(&task)
+
+			// Update prompt if provided
+			if prompt != "" {
+				task.Prompt = prompt
+			}
+
+			// Run right away, from the task's prompt rather than a pending retry
+			task.NextRunAt = nil
+			task.NextPrompt = ""
+
+			// A task whose dependencies have not all succeeded waits for them again
+			status, failed, err := dependencyStatus(tx, task.ID)
+			if err != nil {
+				return err
+			}
+			if failed != nil {
+				return fmt.Errorf("task cannot be continued: dependency %s finished with status %s: %w", failed.ID, failed.Status, ErrDependencyFailed)
+			}
+
+			// Update status to queued for retry
+			if err := task.UpdateStatus(status); err != nil {
+				return fmt.Errorf("failed to update task status: %w", err)
+			}
+
+		case "abort":
+			// Aborting a task that already succeeded is a no-op (idempotent)
 			if task.Status == models.TaskStatusSuccess {
-				return nil // Already completed, nothing to abort
+				settled = false
+				break
 			}
-		}
 
-		// Update status to aborted
-		if err := task.UpdateStatus(models.TaskStatusAborted); err != nil {
-			return fmt.Errorf("failed to abort task: %w", err)
-		}
+			// Update status to aborted
+			if err := task.UpdateStatus(models.TaskStatusAborted); err != nil {
+				return fmt.Errorf("failed to abort task: %w", err)
+			}
 
-	default:
-		return fmt.Errorf("invalid action: %s", action)
-	}
+		default:
+			return fmt.Errorf("invalid action: %s", action)
+		}
 
-	// Save the updated task
-	if err := s.db.Save(task).Error; err != nil {
-		return fmt.Errorf("failed to save updated task: %w", err)
+		// Save the updated task
+		if err := tx.Omit(leaseColumns...).Save(&task).Error; err != nil {
+			return fmt.Errorf("failed to save updated task: %w", err)
+		}
+		return nil
+	})
+	if err != nil || !settled {
+		return err
 	}
 
-	return nil
+	return s.settleDependents(context.Background(), task.ID, task.Status)
 }
 
 // GetTasksByRepo retrieves tasks for a specific repository
@@ -195,6 +396,7 @@ func (s *TaskService) GetActiveTasks() ([]models.Task, error) {
 	// Get tasks that are not in terminal states
 	query := s.db.Where("status IN ?", []string{
 		string(models.TaskStatusQueued),
+		string(models.TaskStatusBlocked),
 		string(models.TaskStatusRunning),
 		string(models.TaskStatusRetrying),
 		string(models.TaskStatusNeedsReview),
@@ -239,9 +441,9 @@ func (s *TaskService) ValidatePrompt(prompt string) error {
 func (s *TaskService) GetNextTask(ctx context.Context) (*models.Task, error) {
 	var task models.Task
 	
-	// Find the oldest queued task
+	// Find the oldest queued task with the highest priority
 	err := s.db.Where("status = ?", models.TaskStatusQueued).
-		Order("created_at ASC").
+		Order("priority DESC, created_at ASC").
 		First(&task).Error
 	
 	if err != nil {
@@ -254,6 +456,167 @@ func (s *TaskService) GetNextTask(ctx context.Context) (*models.Task, error) {
 	return &task, nil
 }
 
+// claimableTasks matches tasks a worker may claim: queued tasks, and retrying
+// tasks that were released to wait out their backoff, once next_run_at has passed
+const claimableTasks = `(status = ? OR (status = ? AND (claimed_by = '' OR claimed_by IS NULL)))
+	AND (next_run_at IS NULL OR next_run_at <= ?)`
+
+// ClaimNextTask atomically moves the next runnable task to running and
+// leases it to workerID. Owners and their repositories share the workers
+// in proportion to their tasks' priorities (see nextFairTask), and a
+// repository already running the configured number of tasks is skipped. It
+// returns nil when there is nothing to claim.
+func (s *TaskService) ClaimNextTask(ctx context.Context, workerID string, leaseDuration time.Duration) (*models.Task, error) {
+	var claimed *models.Task
+	now := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidates []models.Task
+		err := tx.Where(claimableTasks, models.TaskStatusQueued, models.TaskStatusRetrying, now).
+			Order("priority DESC, created_at ASC").
+			Find(&candidates).Error
+		if err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil // No tasks available
+		}
+
+		repos, owners, err := workerUsage(tx, now.Add(-fairShareWindow))
+		if err != nil {
+			return err
+		}
+		task := nextFairTask(candidates, repos, owners, s.repoTaskCap)
+		if task == nil {
+			return nil // Every repository with work is at its cap
+		}
+
+		// Only flip the row if it is still claimable and its repository is
+		// still under the cap, so a concurrent claim wins cleanly
+		leaseExpiresAt := now.Add(leaseDuration)
+		query := tx.Model(task).
+			Where(claimableTasks, models.TaskStatusQueued, models.TaskStatusRetrying, now)
+		if s.repoTaskCap > 0 {
+			query = query.Where(repoUnderCap, s.repoTaskCap)
+		}
+		result := query.Updates(map[string]interface{}{
+			"status":           models.TaskStatusRunning,
+			"claimed_by":       workerID,
+			"lease_expires_at": leaseExpiresAt,
+			"claimed_at":       now,
+			"next_run_at":      nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Claimed by someone else
+		}
+
+		task.Status = models.TaskStatusRunning
+		task.ClaimedBy = workerID
+		task.LeaseExpiresAt = &leaseExpiresAt
+		task.ClaimedAt = &now
+		task.NextRunAt = nil
+		claimed = task
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim next task: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// RenewLease extends the lease workerID holds on a task. It returns
+// ErrLeaseLost if the task has been reaped or claimed by another worker.
+func (s *TaskService) RenewLease(ctx context.Context, taskID, workerID string, leaseDuration time.Duration) error {
+	result := s.db.WithContext(ctx).Model(&models.Task{}).
+		Where("id = ? AND claimed_by = ?", taskID, workerID).
+		UpdateColumn("lease_expires_at", time.Now().Add(leaseDuration))
+	if result.Error != nil {
+		return fmt.Errorf("failed to renew lease: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseTask gives up the lease workerID holds on a task
+func (s *TaskService) ReleaseTask(ctx context.Context, taskID, workerID string) error {
+	err := s.db.WithContext(ctx).Model(&models.Task{}).
+		Where("id = ? AND claimed_by = ?", taskID, workerID).
+		UpdateColumns(map[string]interface{}{
+			"claimed_by":       "",
+			"lease_expires_at": nil,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release task: %w", err)
+	}
+
+	return nil
+}
+
+// ReapExpiredTasks recovers tasks whose worker stopped renewing its lease.
+// Tasks with attempts left are requeued; the rest are marked as errored.
+// It returns the number of tasks reaped.
+func (s *TaskService) ReapExpiredTasks(ctx context.Context, maxAttempts int) (int, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	var expired []models.Task
+	err := db.Where("status IN ? AND lease_expires_at < ?", []string{
+		string(models.TaskStatusRunning),
+		string(models.TaskStatusRetrying),
+	}, now).Find(&expired).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired tasks: %w", err)
+	}
+
+	reaped := 0
+	for _, task := range expired {
+		updates := map[string]interface{}{
+			"status":           models.TaskStatusQueued,
+			"claimed_by":       "",
+			"lease_expires_at": nil,
+			"updated_at":       now,
+		}
+		message := fmt.Sprintf("Lease held by worker %s expired; task requeued", task.ClaimedBy)
+		attemptLimit := maxAttempts
+		if task.MaxRetries > 0 {
+			attemptLimit = task.MaxRetries
+		}
+		if task.Attempts >= attemptLimit {
+			updates["status"] = models.TaskStatusError
+			updates["summary"] = fmt.Sprintf("Worker %s stopped responding after %d attempts", task.ClaimedBy, task.Attempts)
+			message = fmt.Sprintf("Lease held by worker %s expired with no attempts left", task.ClaimedBy)
+		}
+
+		// Re-check the lease, in case the worker renewed it meanwhile
+		result := db.Model(&models.Task{}).
+			Where("id = ? AND claimed_by = ? AND lease_expires_at < ?", task.ID, task.ClaimedBy, now).
+			UpdateColumns(updates)
+		if result.Error != nil {
+			return reaped, fmt.Errorf("failed to reap task %s: %w", task.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		reaped++
+		if err := s.AddTaskLog(ctx, task.ID, "warn", message); err != nil {
+			return reaped, err
+		}
+		if err := s.settleDependents(ctx, task.ID, updates["status"].(models.TaskStatus)); err != nil {
+			return reaped, err
+		}
+	}
+
+	return reaped, nil
+}
+
 // UpdateTaskStatus updates the status of a task
 func (s *TaskService) UpdateTaskStatus(ctx context.Context, taskID string, status string) error {
 	// First get the task, then update it
@@ -265,12 +628,12 @@ func (s *TaskService) UpdateTaskStatus(ctx context.Context, taskID string, statu
 	
 	// Update the status
 	task.Status = models.TaskStatus(status)
-	err = s.db.Save(&task).Error
+	err = s.db.Omit(leaseColumns...).Save(&task).Error
 	if err != nil {
 		return fmt.Errorf("failed to update task status: %w", err)
 	}
 	
-	return nil
+	return s.settleDependents(ctx, taskID, task.Status)
 }
 
 // UpdateTaskModel updates a task model
@@ -278,11 +641,59 @@ func (s *TaskService) UpdateTaskModel(ctx context.Context, task *models.Task) er
 	// Log what we're trying to save for debugging
 	fmt.Printf("DEBUG: Updating task %s with status %s\n", task.ID, task.Status)
 	
-	err := s.db.Save(task).Error
-	if err != nil {
-		return fmt.Errorf("failed to update task: %w", err)
+	query := s.db.WithContext(ctx).Model(task).Select("*").Omit(reportOmitColumns...)
+
+	// Never overwrite an abort that happened while the worker was busy
+	if task.Status != models.TaskStatusAborted {
+		query = query.Where("status <> ?", models.TaskStatusAborted)
 	}
-	return nil
+
+	result := query.Updates(task)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update task: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskAborted
+	}
+	return s.settleDependents(ctx, task.ID, task.Status)
+}
+
+// ReportTask saves a worker's copy of a task like UpdateTaskModel, but only
+// while workerID holds the task's lease. It returns ErrLeaseLost if the lease
+// expired or passed to another worker, so a stale worker cannot overwrite
+// the task's next run.
+func (s *TaskService) ReportTask(ctx context.Context, task *models.Task, workerID string) error {
+	query := s.db.WithContext(ctx).Model(task).Select("*").Omit(reportOmitColumns...).Where("claimed_by = ?", workerID)
+	if task.Status != models.TaskStatusAborted {
+		query = query.Where("status <> ?", models.TaskStatusAborted)
+	}
+
+	result := query.Updates(task)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update task: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// Tell an abort apart from a lost lease
+		status, err := s.GetTaskStatus(ctx, task.ID)
+		if err == nil && status == models.TaskStatusAborted && task.Status != models.TaskStatusAborted {
+			return ErrTaskAborted
+		}
+		return ErrLeaseLost
+	}
+	return s.settleDependents(ctx, task.ID, task.Status)
+}
+
+// GetTaskStatus returns the current status of a task
+func (s *TaskService) GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	var task models.Task
+	if err := s.db.WithContext(ctx).Select("status").First(&task, "id = ?", taskID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", fmt.Errorf("task not found")
+		}
+		return "", fmt.Errorf("failed to get task status: %w", err)
+	}
+
+	return task.Status, nil
 }
 
 // AddTaskLog adds a log entry for a task
@@ -302,3 +713,97 @@ func (s *TaskService) AddTaskLog(ctx context.Context, taskID string, level, mess
 	
 	return nil
 }
+
+// AddTaskLogEntry stores a fully populated log entry, such as a line of agent output
+func (s *TaskService) AddTaskLogEntry(ctx context.Context, entry *models.TaskLog) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	if err := s.db.WithContext(ctx).Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to add task log: %w", err)
+	}
+
+	return nil
+}
+
+// AddTaskLogEntries stores a batch of fully populated log entries of a task
+// in order, all or none of them
+func (s *TaskService) AddTaskLogEntries(ctx context.Context, taskID string, entries []*models.TaskLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, entry := range entries {
+		entry.TaskID = taskID
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now()
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Create(entries).Error; err != nil {
+		return fmt.Errorf("failed to add task logs: %w", err)
+	}
+
+	return nil
+}
+
+// GetTaskLogs retrieves log entries for a task in the order they were written.
+// Only entries with an ID greater than afterID are returned; when tail is
+// positive, just the last tail of those entries are returned.
+func (s *TaskService) GetTaskLogs(taskID string, afterID uint, tail int) ([]models.TaskLog, error) {
+	var logs []models.TaskLog
+	query := s.db.Where("task_id = ? AND id > ?", taskID, afterID)
+
+	if tail > 0 {
+		// Take the newest entries, then restore chronological order
+		if err := query.Order("id DESC").Limit(tail).Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to get task logs: %w", err)
+		}
+		for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+			logs[i], logs[j] = logs[j], logs[i]
+		}
+		return logs, nil
+	}
+
+	if err := query.Order("id ASC").Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get task logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// SaveTaskDiff records the diff of an attempt, replacing any diff recorded
+// for the same attempt before
+func (s *TaskService) SaveTaskDiff(ctx context.Context, diff *models.TaskDiff) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id = ? AND attempt = ?", diff.TaskID, diff.Attempt).Delete(&models.TaskDiff{}).Error; err != nil {
+			return err
+		}
+		diff.ID = 0
+		return tx.Create(diff).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save task diff: %w", err)
+	}
+
+	return nil
+}
+
+// GetTaskDiff retrieves the diff recorded for an attempt of a task, or the
+// latest attempt's diff when attempt is zero
+func (s *TaskService) GetTaskDiff(taskID string, attempt int) (*models.TaskDiff, error) {
+	var diff models.TaskDiff
+	query := s.db.Where("task_id = ?", taskID)
+	if attempt > 0 {
+		query = query.Where("attempt = ?", attempt)
+	}
+
+	if err := query.Order("attempt DESC").First(&diff).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("diff not found")
+		}
+		return nil, fmt.Errorf("failed to retrieve task diff: %w", err)
+	}
+
+	return &diff, nil
+}
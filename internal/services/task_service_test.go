@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// newTestTaskService creates a TaskService backed by a fresh SQLite database
+func newTestTaskService(t *testing.T) *TaskService {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&models.Task{}, &models.TaskLog{}, &models.TaskDiff{}, &models.Schedule{}, &models.TaskDependency{}, &models.Campaign{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	return NewTaskService(db)
+}
+
+func TestClaimNextTask(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	older, err := svc.CreateTask("https://github.com/acme/api", "first")
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := svc.CreateTask("https://github.com/acme/api", "second"); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	task, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if task == nil || task.ID != older.ID {
+		t.Fatalf("claimed %v, want the oldest queued task", task)
+	}
+
+	stored, _ := svc.GetTask(older.ID)
+	if stored.Status != models.TaskStatusRunning || stored.ClaimedBy != "worker-1" || stored.LeaseExpiresAt == nil {
+		t.Errorf("stored task = %+v, want running and leased to worker-1", stored)
+	}
+}
+
+func TestClaimNextTask_Concurrent(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	const numTasks = 5
+	for i := 0; i < numTasks; i++ {
+		if _, err := svc.CreateTask("https://github.com/acme/api", "prompt"); err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	claims := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				task, err := svc.ClaimNextTask(ctx, "worker", time.Minute)
+				if err != nil {
+					t.Errorf("ClaimNextTask() error = %v", err)
+					return
+				}
+				if task == nil {
+					return
+				}
+				mu.Lock()
+				claims[task.ID]++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(claims) != numTasks {
+		t.Errorf("claimed %d distinct tasks, want %d", len(claims), numTasks)
+	}
+	for id, count := range claims {
+		if count != 1 {
+			t.Errorf("task %s claimed %d times, want once", id, count)
+		}
+	}
+}
+
+func TestRenewAndReleaseLease(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	created, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	if _, err := svc.ClaimNextTask(ctx, "worker-1", time.Second); err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+
+	if err := svc.RenewLease(ctx, created.ID, "worker-2", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("RenewLease() by another worker error = %v, want ErrLeaseLost", err)
+	}
+	if err := svc.RenewLease(ctx, created.ID, "worker-1", time.Hour); err != nil {
+		t.Fatalf("RenewLease() error = %v", err)
+	}
+
+	stored, _ := svc.GetTask(created.ID)
+	if time.Until(*stored.LeaseExpiresAt) < 30*time.Minute {
+		t.Errorf("lease expires at %v, want it extended", stored.LeaseExpiresAt)
+	}
+
+	// Saving a stale copy of the task must not roll the lease back
+	stored.Summary = "working"
+	stored.LeaseExpiresAt = nil
+	if err := svc.UpdateTaskModel(ctx, stored); err != nil {
+		t.Fatalf("UpdateTaskModel() error = %v", err)
+	}
+	if err := svc.RenewLease(ctx, created.ID, "worker-1", time.Hour); err != nil {
+		t.Errorf("RenewLease() after a model update error = %v", err)
+	}
+
+	if err := svc.ReleaseTask(ctx, created.ID, "worker-1"); err != nil {
+		t.Fatalf("ReleaseTask() error = %v", err)
+	}
+	released, _ := svc.GetTask(created.ID)
+	if released.ClaimedBy != "" || released.LeaseExpiresAt != nil {
+		t.Errorf("released task = %+v, want no lease", released)
+	}
+}
+
+func TestReapExpiredTasks(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	requeue, _ := svc.CreateTask("https://github.com/acme/api", "requeue me")
+	exhausted, _ := svc.CreateTask("https://github.com/acme/web", "out of attempts")
+	healthy, _ := svc.CreateTask("https://github.com/acme/cli", "still running")
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.ClaimNextTask(ctx, "worker-1", time.Hour); err != nil {
+			t.Fatalf("ClaimNextTask() error = %v", err)
+		}
+	}
+
+	// Expire the first two leases
+	expiredAt := time.Now().Add(-time.Minute)
+	svc.db.Model(&models.Task{}).Where("id IN ?", []string{requeue.ID, exhausted.ID}).
+		UpdateColumn("lease_expires_at", expiredAt)
+	svc.db.Model(&models.Task{}).Where("id = ?", exhausted.ID).UpdateColumn("attempts", 3)
+
+	reaped, err := svc.ReapExpiredTasks(ctx, 3)
+	if err != nil {
+		t.Fatalf("ReapExpiredTasks() error = %v", err)
+	}
+	if reaped != 2 {
+		t.Errorf("reaped = %d, want 2", reaped)
+	}
+
+	tests := []struct {
+		id         string
+		wantStatus models.TaskStatus
+		wantClaim  string
+	}{
+		{requeue.ID, models.TaskStatusQueued, ""},
+		{exhausted.ID, models.TaskStatusError, ""},
+		{healthy.ID, models.TaskStatusRunning, "worker-1"},
+	}
+	for _, tt := range tests {
+		task, _ := svc.GetTask(tt.id)
+		if task.Status != tt.wantStatus || task.ClaimedBy != tt.wantClaim {
+			t.Errorf("task %s = status %s claimed by %q, want %s claimed by %q",
+				tt.id, task.Status, task.ClaimedBy, tt.wantStatus, tt.wantClaim)
+		}
+	}
+
+	var logs []models.TaskLog
+	svc.db.Where("task_id = ?", requeue.ID).Find(&logs)
+	if len(logs) != 1 || logs[0].Level != "warn" {
+		t.Errorf("logs = %+v, want one warning about the expired lease", logs)
+	}
+}
+
+func TestUpdateTaskModel_KeepsAbort(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	svc.CreateTask("https://github.com/acme/api", "prompt")
+	task, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+
+	if err := svc.UpdateTask(task.ID, "abort", ""); err != nil {
+		t.Fatalf("UpdateTask(abort) error = %v", err)
+	}
+
+	// The worker's copy still says running
+	task.Status = models.TaskStatusRetrying
+	if err := svc.UpdateTaskModel(ctx, task); !errors.Is(err, ErrTaskAborted) {
+		t.Errorf("UpdateTaskModel() error = %v, want ErrTaskAborted", err)
+	}
+
+	status, err := svc.GetTaskStatus(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskStatus() error = %v", err)
+	}
+	if status != models.TaskStatusAborted {
+		t.Errorf("status = %s, want aborted", status)
+	}
+
+	// Recording the abort itself is allowed
+	task.Status = models.TaskStatusAborted
+	task.Attempts = 2
+	if err := svc.UpdateTaskModel(ctx, task); err != nil {
+		t.Errorf("UpdateTaskModel(aborted) error = %v", err)
+	}
+}
+
+func TestUpdateTask_ContinueKeepsBranchAndThread(t *testing.T) {
+	svc := newTestTaskService(t)
+
+	created, _ := svc.CreateTask("https://github.com/acme/api", "Migrate Mocha tests to Vitest")
+	svc.db.Model(&models.Task{}).Where("id = ?", created.ID).UpdateColumns(map[string]interface{}{
+		"status":    models.TaskStatusNeedsReview,
+		"attempts":  1,
+		"thread_id": "T-1234",
+	})
+
+	if err := svc.UpdateTask(created.ID, "continue", "restore skipped test"); err != nil {
+		t.Fatalf("UpdateTask(continue) error = %v", err)
+	}
+
+	task, _ := svc.GetTask(created.ID)
+	if task.Status != models.TaskStatusQueued {
+		t.Errorf("Status = %s, want queued", task.Status)
+	}
+	if task.Prompt != "restore skipped test" {
+		t.Errorf("Prompt = %q, want the follow-up prompt", task.Prompt)
+	}
+	if task.Branch != created.Branch || task.ThreadID != "T-1234" {
+		t.Errorf("task = branch %q thread %q, want branch %q and thread T-1234 kept", task.Branch, task.ThreadID, created.Branch)
+	}
+}
+
+func TestClaimNextTask_WaitsForNextRunAt(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	created, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	nextRunAt := time.Now().Add(time.Hour)
+	svc.db.Model(&models.Task{}).Where("id = ?", created.ID).UpdateColumns(map[string]interface{}{
+		"status":      models.TaskStatusRetrying,
+		"attempts":    1,
+		"next_run_at": nextRunAt,
+	})
+
+	task, err := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if task != nil {
+		t.Fatalf("claimed %s before its next_run_at", task.ID)
+	}
+
+	// Once the backoff has passed, any worker can pick the retry up
+	svc.db.Model(&models.Task{}).Where("id = ?", created.ID).UpdateColumn("next_run_at", time.Now().Add(-time.Second))
+	task, err = svc.ClaimNextTask(ctx, "worker-2", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if task == nil || task.ID != created.ID {
+		t.Fatalf("claimed %v, want the due retry", task)
+	}
+
+	stored, _ := svc.GetTask(created.ID)
+	if stored.Status != models.TaskStatusRunning || stored.ClaimedBy != "worker-2" || stored.NextRunAt != nil {
+		t.Errorf("stored task = %+v, want running, leased to worker-2 and next_run_at cleared", stored)
+	}
+}
+
+func TestClaimNextTask_SkipsHeldRetry(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	// A worker retrying in-process keeps its claim while the status reads retrying
+	svc.CreateTask("https://github.com/acme/api", "prompt")
+	task, _ := svc.ClaimNextTask(ctx, "worker-1", time.Minute)
+	svc.UpdateTaskStatus(ctx, task.ID, string(models.TaskStatusRetrying))
+
+	claimed, err := svc.ClaimNextTask(ctx, "worker-2", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if claimed != nil {
+		t.Errorf("claimed %s while worker-1 still holds it", claimed.ID)
+	}
+}
+
+func TestUpdateTask_ContinueGrantsFreshAttempts(t *testing.T) {
+	svc := newTestTaskService(t)
+
+	// A task that used its whole budget still goes to review and can be continued
+	created, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	svc.db.Model(&models.Task{}).Where("id = ?", created.ID).UpdateColumns(map[string]interface{}{
+		"status":      models.TaskStatusNeedsReview,
+		"attempts":    DefaultMaxRetries,
+		"next_prompt": "CI failed: ...",
+	})
+
+	if err := svc.UpdateTask(created.ID, "continue", ""); err != nil {
+		t.Fatalf("UpdateTask(continue) error = %v, want a task at its attempt budget to continue", err)
+	}
+	task, _ := svc.GetTask(created.ID)
+	if task.Status != models.TaskStatusQueued || task.NextPrompt != "" {
+		t.Errorf("task = status %s next_prompt %q, want queued with the next prompt cleared", task.Status, task.NextPrompt)
+	}
+	if task.Attempts != DefaultMaxRetries || svc.MaxRetriesFor(task) != 2*DefaultMaxRetries {
+		t.Errorf("attempts %d of %d, want %d of %d", task.Attempts, svc.MaxRetriesFor(task), DefaultMaxRetries, 2*DefaultMaxRetries)
+	}
+
+	// A larger per-task budget is kept when it still has room
+	roomy, _ := svc.CreateTaskWithOptions("https://github.com/acme/api", "prompt", CreateTaskOptions{MaxRetries: 10})
+	svc.db.Model(&models.Task{}).Where("id = ?", roomy.ID).UpdateColumns(map[string]interface{}{
+		"status":   models.TaskStatusError,
+		"attempts": 2,
+	})
+	if err := svc.UpdateTask(roomy.ID, "continue", ""); err != nil {
+		t.Fatalf("UpdateTask(continue) error = %v", err)
+	}
+	if task, _ := svc.GetTask(roomy.ID); task.MaxRetries != 10 {
+		t.Errorf("MaxRetries = %d, want the task's own budget of 10 kept", task.MaxRetries)
+	}
+
+	// Finished tasks cannot be continued
+	done, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	svc.db.Model(&models.Task{}).Where("id = ?", done.ID).UpdateColumn("status", models.TaskStatusSuccess)
+	if err := svc.UpdateTask(done.ID, "continue", ""); !errors.Is(err, ErrTaskNotContinuable) {
+		t.Errorf("UpdateTask(continue) on a successful task error = %v, want ErrTaskNotContinuable", err)
+	}
+}
+
+func TestTaskDiffs(t *testing.T) {
+	svc := newTestTaskService(t)
+	ctx := context.Background()
+
+	task, _ := svc.CreateTask("https://github.com/acme/api", "prompt")
+	if _, err := svc.GetTaskDiff(task.ID, 0); err == nil || err.Error() != "diff not found" {
+		t.Fatalf("GetTaskDiff() before any attempt error = %v, want diff not found", err)
+	}
+
+	for attempt, additions := range []int{3, 5} {
+		err := svc.SaveTaskDiff(ctx, &models.TaskDiff{
+			TaskID:    task.ID,
+			Attempt:   attempt + 1,
+			Files:     []models.DiffFile{{Path: "auth.go", Status: models.DiffFileModified, Additions: additions}},
+			Additions: additions,
+		})
+		if err != nil {
+			t.Fatalf("SaveTaskDiff(attempt %d) error = %v", attempt+1, err)
+		}
+	}
+	// A retried save of an attempt replaces its diff
+	if err := svc.SaveTaskDiff(ctx, &models.TaskDiff{TaskID: task.ID, Attempt: 1, Additions: 4}); err != nil {
+		t.Fatalf("SaveTaskDiff(attempt 1 again) error = %v", err)
+	}
+
+	latest, err := svc.GetTaskDiff(task.ID, 0)
+	if err != nil || latest.Attempt != 2 || len(latest.Files) != 1 || latest.Files[0].Additions != 5 {
+		t.Errorf("GetTaskDiff(latest) = %+v, %v, want attempt 2 with its file", latest, err)
+	}
+	first, err := svc.GetTaskDiff(task.ID, 1)
+	if err != nil || first.Additions != 4 {
+		t.Errorf("GetTaskDiff(1) = %+v, %v, want the replaced diff", first, err)
+	}
+	if _, err := svc.GetTaskDiff(task.ID, 3); err == nil {
+		t.Error("GetTaskDiff(3) error = nil, want diff not found")
+	}
+}
@@ -2,14 +2,18 @@ package validation
 
 import (
 	"fmt"
-	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
+// agentNamePattern matches valid agent names such as "amp" or "claude-code"
+var agentNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
 // ValidationError represents a field validation error
 type ValidationError struct {
 	Field   string `json:"field"`
@@ -42,30 +46,7 @@ func RegisterCustomValidators() {
 
 // validateGitRepo validates Git repository URLs and formats
 func validateGitRepo(fl validator.FieldLevel) bool {
-	repo := fl.Field().String()
-	
-	if repo == "" {
-		return false
-	}
-
-	// Check for basic patterns
-	// 1. Full Git URLs (https://github.com/user/repo.git)
-	// 2. GitHub shorthand (user/repo)
-	// 3. GitHub URLs without .git suffix (https://github.com/user/repo)
-	
-	// Pattern 1: Full Git URLs
-	gitURLPattern := regexp.MustCompile(`^https?://[a-zA-Z0-9\-\.]+/[a-zA-Z0-9\-_\.]+/[a-zA-Z0-9\-_\.]+(?:\.git)?/?$`)
-	if gitURLPattern.MatchString(repo) {
-		return true
-	}
-	
-	// Pattern 2: GitHub shorthand (user/repo)
-	shorthandPattern := regexp.MustCompile(`^[a-zA-Z0-9\-_\.]+/[a-zA-Z0-9\-_\.]+$`)
-	if shorthandPattern.MatchString(repo) {
-		return true
-	}
-	
-	return false
+	return ValidateRepositoryURL(fl.Field().String()) == nil
 }
 
 // validateTaskPrompt validates task prompt content
@@ -110,6 +91,7 @@ func validateTaskStatus(fl validator.FieldLevel) bool {
 	
 	validStatuses := []string{
 		"queued",
+		"blocked",
 		"running", 
 		"retrying",
 		"needs_review",
@@ -145,73 +127,25 @@ func validateTaskAction(fl validator.FieldLevel) bool {
 	return false
 }
 
+// repositoryHosts are the hosts repositories may live on; local repositories
+// are refused unless they allow them
+var repositoryHosts = repourl.DefaultHosts()
+
+// SetRepositoryHosts sets the hosts ValidateRepositoryURL accepts, e.g. to
+// allow self-hosted GitLab or GitHub Enterprise
+func SetRepositoryHosts(hosts repourl.Hosts) {
+	repositoryHosts = hosts
+}
+
 // ValidateRepositoryURL performs comprehensive repository URL validation
 func ValidateRepositoryURL(repo string) error {
-	if repo == "" {
-		return fmt.Errorf("repository URL cannot be empty")
-	}
-	
 	// Check length
 	if len(repo) > 500 {
 		return fmt.Errorf("repository URL too long (max 500 characters)")
 	}
-	
-	// Try to parse as URL if it looks like a full URL
-	if strings.HasPrefix(repo, "http://") || strings.HasPrefix(repo, "https://") {
-		parsedURL, err := url.Parse(repo)
-		if err != nil {
-			return fmt.Errorf("invalid repository URL format")
-		}
-		
-		// Check for supported hosts
-		supportedHosts := []string{
-			"github.com",
-			"gitlab.com", 
-			"bitbucket.org",
-		}
-		
-		isSupported := false
-		for _, host := range supportedHosts {
-			if parsedURL.Host == host {
-				isSupported = true
-				break
-			}
-		}
-		
-		if !isSupported {
-			return fmt.Errorf("unsupported repository host: %s", parsedURL.Host)
-		}
-		
-		// Validate path structure
-		pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
-		if len(pathParts) < 2 {
-			return fmt.Errorf("invalid repository path: must be in format 'owner/repo'")
-		}
-	} else {
-		// Validate shorthand format (owner/repo)
-		if !strings.Contains(repo, "/") {
-			return fmt.Errorf("repository must be in format 'owner/repo' or full Git URL")
-		}
-		
-		parts := strings.Split(repo, "/")
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid repository format: must be 'owner/repo'")
-		}
-		
-		// Validate owner and repo names
-		for _, part := range parts {
-			if part == "" {
-				return fmt.Errorf("repository owner and name cannot be empty")
-			}
-			
-			// Check for valid characters
-			if !regexp.MustCompile(`^[a-zA-Z0-9\-_\.]+$`).MatchString(part) {
-				return fmt.Errorf("repository owner and name can only contain letters, numbers, hyphens, underscores, and dots")
-			}
-		}
-	}
-	
-	return nil
+
+	_, err := repositoryHosts.Parse(repo)
+	return err
 }
 
 // ValidatePromptContent performs comprehensive prompt validation
@@ -249,6 +183,20 @@ func ValidatePromptContent(prompt string) error {
 	return nil
 }
 
+// ValidateAgentName checks that an agent name is well formed. Whether the
+// agent exists is decided by the worker that runs the task.
+func ValidateAgentName(name string) error {
+	if len(name) > 32 {
+		return fmt.Errorf("agent name too long (max 32 characters)")
+	}
+	
+	if !agentNamePattern.MatchString(name) {
+		return fmt.Errorf("agent name can only contain lowercase letters, numbers, and hyphens")
+	}
+	
+	return nil
+}
+
 // ValidatePaginationParams validates pagination parameters
 func ValidatePaginationParams(limit, offset int) error {
 	if limit < 0 {
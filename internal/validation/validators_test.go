@@ -2,6 +2,8 @@ package validation
 
 import (
 	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 func TestValidateRepositoryURL(t *testing.T) {
@@ -54,12 +56,34 @@ func TestValidateRepositoryURL(t *testing.T) {
 			wantErr:  true,
 			errorMsg: "invalid repository format: must be 'owner/repo'",
 		},
+		{
+			name:    "valid scp-like ssh url",
+			repo:    "git@github.com:user/repo.git",
+			wantErr: false,
+		},
+		{
+			name:    "valid ssh url with nested gitlab groups",
+			repo:    "ssh://git@gitlab.com/group/subgroup/repo.git",
+			wantErr: false,
+		},
+		{
+			name:     "file urls need local repositories allowed",
+			repo:     "file:///srv/git/repo.git",
+			wantErr:  true,
+			errorMsg: "unsupported repository URL scheme: file",
+		},
 		{
 			name:     "empty owner",
 			repo:     "/repo",
 			wantErr:  true,
 			errorMsg: "repository owner and name cannot be empty",
 		},
+		{
+			name:     "unsupported ssh host",
+			repo:     "git@example.com:user/repo.git",
+			wantErr:  true,
+			errorMsg: "unsupported repository host: example.com",
+		},
 		{
 			name:     "empty repo name",
 			repo:     "user/",
@@ -113,6 +137,37 @@ func TestValidateRepositoryURL(t *testing.T) {
 	}
 }
 
+func TestValidateRepositoryURL_SelfHostedHosts(t *testing.T) {
+	hosts, err := repourl.ParseHosts("git.example.com=gitlab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRepositoryHosts(hosts)
+	defer SetRepositoryHosts(repourl.DefaultHosts())
+
+	if err := ValidateRepositoryURL("git@git.example.com:platform/billing/api.git"); err != nil {
+		t.Errorf("ValidateRepositoryURL(self-hosted) unexpected error = %v", err)
+	}
+	if err := ValidateRepositoryURL("https://example.com/user/repo"); err == nil {
+		t.Error("ValidateRepositoryURL(unlisted host) expected error but got none")
+	}
+}
+
+func TestValidateRepositoryURL_LocalRepositories(t *testing.T) {
+	hosts, err := repourl.ParseHosts("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRepositoryHosts(hosts)
+	defer SetRepositoryHosts(repourl.DefaultHosts())
+
+	for _, repo := range []string{"/srv/git/repo", "file:///srv/git/repo.git"} {
+		if err := ValidateRepositoryURL(repo); err != nil {
+			t.Errorf("ValidateRepositoryURL(%q) unexpected error = %v", repo, err)
+		}
+	}
+}
+
 func TestValidatePromptContent(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -300,6 +355,62 @@ func TestValidatePaginationParams(t *testing.T) {
 	}
 }
 
+func TestValidateAgentName(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    string
+		wantErr  bool
+		errorMsg string
+	}{
+		{
+			name:    "single word",
+			agent:   "amp",
+			wantErr: false,
+		},
+		{
+			name:    "hyphenated",
+			agent:   "claude-code",
+			wantErr: false,
+		},
+		{
+			name:     "uppercase",
+			agent:    "Amp",
+			wantErr:  true,
+			errorMsg: "agent name can only contain lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:     "shell characters",
+			agent:    "amp;rm",
+			wantErr:  true,
+			errorMsg: "agent name can only contain lowercase letters, numbers, and hyphens",
+		},
+		{
+			name:     "too long",
+			agent:    "an-agent-name-that-is-far-too-long",
+			wantErr:  true,
+			errorMsg: "agent name too long (max 32 characters)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAgentName(tt.agent)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ValidateAgentName() expected error but got none")
+					return
+				}
+				if tt.errorMsg != "" && err.Error() != tt.errorMsg {
+					t.Errorf("ValidateAgentName() error = %v, want %v", err.Error(), tt.errorMsg)
+				}
+			} else if err != nil {
+				t.Errorf("ValidateAgentName() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
 func TestTranslateValidationErrors(t *testing.T) {
 	// Test with nil error
 	result := TranslateValidationErrors(nil)
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Built-in agent names
+const (
+	AgentAmp      = "amp"
+	AgentCommand  = "command"
+	AgentScripted = "scripted"
+)
+
+// AgentFactory creates a coding agent from the worker configuration
+type AgentFactory func(config *Config) (AmpOperations, error)
+
+// agentRegistry holds the agents tasks can be run with, by name
+var agentRegistry = struct {
+	sync.RWMutex
+	factories map[string]AgentFactory
+}{
+	factories: map[string]AgentFactory{
+		AgentAmp: func(config *Config) (AmpOperations, error) {
+			return NewAmpOperations(config.AmpPath), nil
+		},
+		AgentCommand: func(config *Config) (AmpOperations, error) {
+			return NewCommandAgent(config.AgentCommand)
+		},
+		AgentScripted: func(config *Config) (AmpOperations, error) {
+			return NewScriptedAgent(config.ScriptedPatches)
+		},
+	},
+}
+
+// RegisterAgent makes an agent available under name, replacing any agent
+// already registered with that name
+func RegisterAgent(name string, factory AgentFactory) {
+	agentRegistry.Lock()
+	defer agentRegistry.Unlock()
+	agentRegistry.factories[name] = factory
+}
+
+// AgentNames returns the names of the registered agents in sorted order
+func AgentNames() []string {
+	agentRegistry.RLock()
+	defer agentRegistry.RUnlock()
+
+	names := make([]string, 0, len(agentRegistry.factories))
+	for name := range agentRegistry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAgent creates the agent registered under name. An empty name selects
+// the worker's default agent.
+func NewAgent(name string, config *Config) (AmpOperations, error) {
+	if name == "" {
+		name = config.agent()
+	}
+
+	agentRegistry.RLock()
+	factory, ok := agentRegistry.factories[name]
+	agentRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown agent %q (available: %v)", name, AgentNames())
+	}
+
+	agent, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent %q: %w", name, err)
+	}
+	return agent, nil
+}
+
+// agent returns the name of the default agent
+func (c *Config) agent() string {
+	if c.Agent != "" {
+		return c.Agent
+	}
+	return AgentAmp
+}
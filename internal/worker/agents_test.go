@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestNewAgent(t *testing.T) {
+	config := &Config{AgentCommand: "my-agent --yes", ScriptedPatches: []string{"fix.patch"}}
+
+	tests := []struct {
+		name     string
+		agent    string
+		wantType string
+		wantErr  string
+	}{
+		{"default is amp", "", "*worker.ampOperations", ""},
+		{"amp", AgentAmp, "*worker.ampOperations", ""},
+		{"command", AgentCommand, "*worker.commandAgent", ""},
+		{"scripted", AgentScripted, "*worker.scriptedAgent", ""},
+		{"unknown", "cursor", "", `unknown agent "cursor"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, err := NewAgent(tt.agent, config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewAgent() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewAgent() error = %v", err)
+			}
+			if got := fmt.Sprintf("%T", agent); got != tt.wantType {
+				t.Errorf("NewAgent() = %s, want %s", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestNewAgent_Misconfigured(t *testing.T) {
+	if _, err := NewAgent(AgentCommand, &Config{}); err == nil {
+		t.Error("NewAgent(command) without a command succeeded, want an error")
+	}
+	if _, err := NewAgent(AgentScripted, &Config{}); err == nil {
+		t.Error("NewAgent(scripted) without patches succeeded, want an error")
+	}
+}
+
+func TestRegisterAgent(t *testing.T) {
+	fake := &fakeAmpOps{}
+	RegisterAgent("test-fake", func(config *Config) (AmpOperations, error) {
+		return fake, nil
+	})
+
+	agent, err := NewAgent("", &Config{Agent: "test-fake"})
+	if err != nil {
+		t.Fatalf("NewAgent() error = %v", err)
+	}
+	if agent != fake {
+		t.Errorf("NewAgent() = %v, want the registered agent", agent)
+	}
+	if names := strings.Join(AgentNames(), ","); !strings.Contains(names, "test-fake") {
+		t.Errorf("AgentNames() = %s, want test-fake listed", names)
+	}
+}
+
+func TestProcessTask_UnknownAgentFailsTask(t *testing.T) {
+	taskSvc := &fakeTaskService{}
+	w := New(&Config{MaxConcurrency: 1, WorkDir: t.TempDir(), WorkerID: "worker-1"}, taskSvc)
+	task := &models.Task{ID: "01TESTTASK", Status: models.TaskStatusRunning, Agent: "no-such-agent"}
+
+	w.semaphore <- struct{}{}
+	w.processTask(task)
+
+	if task.Status != models.TaskStatusError || !strings.Contains(task.Summary, "unknown agent") {
+		t.Errorf("task = status %s summary %q, want an unknown agent error", task.Status, task.Summary)
+	}
+	if len(taskSvc.released) != 1 {
+		t.Errorf("released %v, want the task released", taskSvc.released)
+	}
+}
@@ -2,14 +2,27 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
 )
 
+// processWaitDelay bounds how long to wait for output pipes after Amp is killed
+const processWaitDelay = 5 * time.Second
+
+// ErrThreadsUnsupported is returned by CreateThread when the Amp CLI has no threads command
+var ErrThreadsUnsupported = errors.New("amp CLI does not support threads")
+
+// threadIDPattern matches Amp thread IDs such as T-5928a90d-d53b-488f-a829-4e36442142ee
+var threadIDPattern = regexp.MustCompile(`\bT-[A-Za-z0-9-]+`)
+
 // ampOperations implements the AmpOperations interface
 type ampOperations struct {
 	ampPath string
@@ -53,8 +66,9 @@ func (a *ampOperations) CheckInstallation() error {
 	return nil
 }
 
-// ExecutePrompt runs an Amp prompt in the specified repository directory
-func (a *ampOperations) ExecutePrompt(ctx context.Context, repoDir, prompt string) (*AmpResult, error) {
+// ExecutePrompt runs an Amp prompt in the specified repository directory,
+// passing each line of output to opts.OnOutput as it is produced
+func (a *ampOperations) ExecutePrompt(ctx context.Context, repoDir, prompt string, opts PromptOptions) (*AmpResult, error) {
 	result := &AmpResult{
 		Success: false,
 	}
@@ -65,65 +79,52 @@ func (a *ampOperations) ExecutePrompt(ctx context.Context, repoDir, prompt strin
 		return result, err
 	}
 	
-	// Change to repository directory
-	originalDir, err := os.Getwd()
-	if err != nil {
-		result.Error = fmt.Errorf("failed to get current directory: %w", err)
-		return result, err
+	// Run amp with the prompt piped to stdin, continuing the thread if there is one.
+	// The limits stop a runaway run and its whole process group.
+	var args []string
+	if opts.ThreadID != "" {
+		args = []string{"threads", "continue", opts.ThreadID}
 	}
+	limited := newLimitedCommand(ctx, opts.Limits, a.ampPath, args...)
+	cmd := limited.cmd
+	cmd.Dir = repoDir
 	
-	if err := os.Chdir(repoDir); err != nil {
-		result.Error = fmt.Errorf("failed to change to repo directory: %w", err)
-		return result, err
-	}
-	
-	defer func() {
-		// Always restore original directory
-		os.Chdir(originalDir)
-	}()
-	
-	// Prepare amp command
-	// Using a context with timeout to prevent hanging
-	ampCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
-	defer cancel()
-	
-	// Run amp with the prompt piped to stdin
-	cmd := exec.CommandContext(ampCtx, a.ampPath)
-	fmt.Printf("DEBUG AMP: Running amp from directory: %s\n", repoDir)
-	fmt.Printf("DEBUG AMP: Amp path: %s\n", a.ampPath)
-	fmt.Printf("DEBUG AMP: Prompt: %s\n", prompt)
-	
-	// Set up environment for amp
-	cmd.Env = append(os.Environ(),
+	// Set up environment for amp; per-task overrides come last so they win
+	cmd.Env = childEnvironment(
 		"TERM=xterm-256color", // Ensure proper terminal support
 	)
+	cmd.Env = append(cmd.Env, opts.Env...)
 	
 	// Pipe the prompt to amp's stdin
 	cmd.Stdin = strings.NewReader(prompt)
 	
-	fmt.Printf("DEBUG AMP: Starting amp execution...\n")
-	// Capture output
-	output, err := cmd.CombinedOutput()
-	fmt.Printf("DEBUG AMP: Amp finished. Output length: %d bytes\n", len(output))
-	if err != nil {
-		fmt.Printf("DEBUG AMP: Amp error: %v\n", err)
-	}
-	result.Output = string(output)
+	// Stream output line by line while keeping the combined output for parsing
+	var combined syncBuffer
+	stdout := newLineWriter(models.LogStreamStdout, opts.OnOutput, &combined)
+	stderr := newLineWriter(models.LogStreamStderr, opts.OnOutput, &combined)
+	cmd.Stdout = limited.limitOutput(stdout)
+	cmd.Stderr = limited.limitOutput(stderr)
+	
+	err := limited.Run()
+	stdout.Flush()
+	stderr.Flush()
+	output := combined.String()
+	result.Output = output
 	
 	if err != nil {
 		result.Error = fmt.Errorf("amp command failed: %w", err)
-		result.Message = fmt.Sprintf("Amp execution failed: %s", string(output))
-		return result, err
+		result.Message = fmt.Sprintf("Amp execution failed: %s", output)
+		return result, result.Error
 	}
 	
 	// Parse the output to determine success and extract information
-	if err := a.parseAmpOutput(result, string(output)); err != nil {
+	if err := a.parseAmpOutput(result, output); err != nil {
 		result.Error = err
 		return result, err
 	}
 	
 	// Check for actual file changes
-	changedFiles, err := a.detectChangedFiles(repoDir)
+	changedFiles, err := detectChangedFiles(repoDir)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to detect changed files: %w", err)
 		return result, err
@@ -147,6 +148,51 @@ func (a *ampOperations) ExecutePrompt(ctx context.Context, repoDir, prompt strin
 	return result, nil
 }
 
+// CreateThread starts a new Amp thread with `amp threads new` and returns its ID.
+// It returns ErrThreadsUnsupported if the installed Amp CLI predates threads.
+func (a *ampOperations) CreateThread(ctx context.Context, repoDir string, env []string) (string, error) {
+	if err := a.CheckInstallation(); err != nil {
+		return "", err
+	}
+	
+	threadCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	
+	cmd := exec.CommandContext(threadCtx, a.ampPath, "threads", "new")
+	cmd.Dir = repoDir
+	setProcessGroup(cmd)
+	cmd.Env = childEnvironment(
+		"TERM=xterm-256color",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if isUnknownCommandOutput(string(output)) {
+			return "", ErrThreadsUnsupported
+		}
+		return "", fmt.Errorf("amp threads new failed: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+	
+	threadID := threadIDPattern.FindString(string(output))
+	if threadID == "" {
+		return "", fmt.Errorf("%w: no thread ID in output: %s", ErrThreadsUnsupported, truncateString(strings.TrimSpace(string(output)), 200))
+	}
+	
+	return threadID, nil
+}
+
+// isUnknownCommandOutput reports whether a CLI rejected its subcommand
+func isUnknownCommandOutput(output string) bool {
+	output = strings.ToLower(output)
+	for _, marker := range []string{"unknown command", "unknown subcommand", "unrecognized command", "invalid command", "no such command"} {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseAmpOutput analyzes Amp's output to determine success and extract information
 func (a *ampOperations) parseAmpOutput(result *AmpResult, output string) error {
 	lines := strings.Split(output, "\n")
@@ -180,7 +226,7 @@ func (a *ampOperations) parseAmpOutput(result *AmpResult, output string) error {
 }
 
 // detectChangedFiles uses git to detect what files have been modified
-func (a *ampOperations) detectChangedFiles(repoDir string) ([]string, error) {
+func detectChangedFiles(repoDir string) ([]string, error) {
 	// Use git status to detect changed files
 	cmd := exec.Command("git", "status", "--porcelain")
 	cmd.Dir = repoDir
@@ -215,7 +261,7 @@ func (a *ampOperations) runAmpWithArgs(ctx context.Context, repoDir string, args
 	cmd.Dir = repoDir
 	
 	// Set up environment
-	cmd.Env = append(os.Environ(),
+	cmd.Env = childEnvironment(
 		"TERM=xterm-256color",
 	)
 	
@@ -0,0 +1,209 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// writeFakeAmp writes an executable shell script standing in for the Amp CLI
+func writeFakeAmp(t *testing.T, dir, body string) string {
+	t.Helper()
+
+	ampPath := filepath.Join(dir, "amp")
+	script := "#!/bin/sh\nif [ \"$1\" = \"--version\" ]; then echo \"amp 0.0.0\"; exit 0; fi\n" + body
+	if err := os.WriteFile(ampPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake amp: %v", err)
+	}
+	return ampPath
+}
+
+// initGitRepo creates an empty git repository in dir
+func initGitRepo(t *testing.T, dir string) {
+	t.Helper()
+
+	if err := exec.Command("git", "init", "-q", dir).Run(); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+}
+
+func TestExecutePrompt_StreamsOutput(t *testing.T) {
+	binDir := t.TempDir()
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	ampPath := writeFakeAmp(t, binDir, `read prompt
+echo "working on: $prompt"
+echo "deprecated flag" >&2
+echo "changes" > file.txt
+echo "Task completed"
+`)
+
+	var mu sync.Mutex
+	var lines []string
+	result, err := NewAmpOperations(ampPath).ExecutePrompt(context.Background(), repoDir, "fix it", PromptOptions{
+		OnOutput: func(stream, line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, stream+": "+line)
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExecutePrompt() error = %v", err)
+	}
+
+	joined := strings.Join(lines, "\n")
+	for _, want := range []string{"stdout: working on: fix it", "stderr: deprecated flag", "stdout: Task completed"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("streamed lines %q, want %q", lines, want)
+		}
+	}
+	if !strings.Contains(result.Output, "Task completed") || !strings.Contains(result.Output, "deprecated flag") {
+		t.Errorf("Output = %q, want the combined output", result.Output)
+	}
+	if !result.Success || len(result.FilesChanged) != 1 {
+		t.Errorf("result = %+v, want success with one changed file", result)
+	}
+}
+
+func TestAmpThreads(t *testing.T) {
+	binDir := t.TempDir()
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	ampPath := writeFakeAmp(t, binDir, `if [ "$1 $2" = "threads new" ]; then echo "Created thread"; echo "T-5928a90d-d53b-488f-a829-4e36442142ee"; exit 0; fi
+if [ "$1 $2" = "threads continue" ]; then read prompt; echo "$3: $prompt" > thread.txt; echo "Task completed"; exit 0; fi
+echo "error: expected a thread" >&2
+exit 1
+`)
+	amp := NewAmpOperations(ampPath)
+
+	threadID, err := amp.CreateThread(context.Background(), repoDir, nil)
+	if err != nil {
+		t.Fatalf("CreateThread() error = %v", err)
+	}
+	if threadID != "T-5928a90d-d53b-488f-a829-4e36442142ee" {
+		t.Fatalf("threadID = %q, want the ID printed by amp", threadID)
+	}
+
+	if _, err := amp.ExecutePrompt(context.Background(), repoDir, "fix it", PromptOptions{ThreadID: threadID}); err != nil {
+		t.Fatalf("ExecutePrompt() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(repoDir, "thread.txt"))
+	if err != nil {
+		t.Fatalf("amp threads continue was not run: %v", err)
+	}
+	if want := threadID + ": fix it\n"; string(got) != want {
+		t.Errorf("thread.txt = %q, want %q", got, want)
+	}
+}
+
+func TestCreateThread_Unsupported(t *testing.T) {
+	binDir := t.TempDir()
+
+	ampPath := writeFakeAmp(t, binDir, `echo "error: unknown command \"threads\" for \"amp\"" >&2
+exit 1
+`)
+
+	_, err := NewAmpOperations(ampPath).CreateThread(context.Background(), t.TempDir(), nil)
+	if !errors.Is(err, ErrThreadsUnsupported) {
+		t.Errorf("CreateThread() error = %v, want ErrThreadsUnsupported", err)
+	}
+}
+
+// initRepoGitOps is a fakeGitOps whose clones are real, empty git repositories
+type initRepoGitOps struct {
+	fakeGitOps
+}
+
+func (g *initRepoGitOps) CloneRepository(ctx context.Context, repoURL, destDir string) error {
+	return exec.CommandContext(ctx, "git", "init", "-q", destDir).Run()
+}
+
+func TestExecute_ConcurrentTasksStayInTheirWorkspaces(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() error = %v", err)
+	}
+
+	ampPath := writeFakeAmp(t, t.TempDir(), `read prompt
+pwd > "$HOME/cwd"
+echo "$prompt" > "$TMPDIR/prompt"
+echo "$XDG_CACHE_HOME" > "$HOME/cache"
+sleep 0.2
+echo "$prompt" > task.txt
+echo "Task completed"
+`)
+
+	const numTasks = 5
+	processors := make([]*TaskProcessor, numTasks)
+	for i := range processors {
+		processors[i] = &TaskProcessor{
+			task: &models.Task{
+				ID:     fmt.Sprintf("01TASK%d", i),
+				Repo:   "https://github.com/acme/api.git",
+				Prompt: fmt.Sprintf("prompt for task %d", i),
+				Status: models.TaskStatusRunning,
+			},
+			config:  &Config{MaxRetries: 1},
+			taskSvc: &fakeTaskService{},
+			workDir: t.TempDir(),
+			gitOps:  &initRepoGitOps{},
+			ampOps:  NewAmpOperations(ampPath),
+		}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*ExecutionResult, numTasks)
+	for i, processor := range processors {
+		wg.Add(1)
+		go func(i int, processor *TaskProcessor) {
+			defer wg.Done()
+			results[i] = processor.Execute(context.Background())
+		}(i, processor)
+	}
+	wg.Wait()
+
+	for i, processor := range processors {
+		if results[i].Status != models.TaskStatusSuccess {
+			t.Errorf("task %d status = %s, want success (error: %v)", i, results[i].Status, results[i].Error)
+			continue
+		}
+
+		repoDir := filepath.Join(processor.workDir, "repo")
+		checks := map[string]string{
+			filepath.Join(repoDir, "task.txt"):                processor.task.Prompt,
+			filepath.Join(processor.workDir, "home", "cwd"):   repoDir,
+			filepath.Join(processor.workDir, "tmp", "prompt"): processor.task.Prompt,
+			filepath.Join(processor.workDir, "home", "cache"): filepath.Join(processor.workDir, "xdg", "cache"),
+		}
+		for path, want := range checks {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("task %d: %v", i, err)
+				continue
+			}
+			if got := strings.TrimSpace(string(data)); got != want {
+				t.Errorf("task %d: %s = %q, want %q", i, filepath.Base(path), got, want)
+			}
+		}
+	}
+
+	if dir, _ := os.Getwd(); dir != originalDir {
+		t.Errorf("worker working directory changed to %s", dir)
+	}
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Retry backoff policies
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// defaultMaxRetryDelay caps exponential backoff when the config does not set MaxRetryDelay
+const defaultMaxRetryDelay = 30 * time.Minute
+
+// retryDelay returns how long to wait before retrying after the given attempt
+// failed CI. Zero means retry right away without giving up the task.
+func (c *Config) retryDelay(attempt int) time.Duration {
+	maxDelay := c.MaxRetryDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+	return backoffDelay(c.RetryBackoff, c.RetryDelay, maxDelay, c.RetryJitter, attempt, rand.Float64())
+}
+
+// backoffDelay computes the delay after attempt (counting from 1) under the
+// given policy. The delay is spread by up to ±jitter of itself, using r in
+// [0, 1), so workers retrying at the same time drift apart; it never exceeds maxDelay.
+func backoffDelay(policy string, base, maxDelay time.Duration, jitter float64, attempt int, r float64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	delay := base
+	if policy == BackoffExponential {
+		for i := 1; i < attempt && delay < maxDelay; i++ {
+			delay *= 2
+		}
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	if jitter > 0 {
+		delay += time.Duration(float64(delay) * jitter * (2*r - 1))
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
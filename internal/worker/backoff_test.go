@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		base    time.Duration
+		jitter  float64
+		attempt int
+		r       float64
+		want    time.Duration
+	}{
+		{"disabled", BackoffExponential, 0, 0, 3, 0.5, 0},
+		{"fixed", BackoffFixed, time.Minute, 0, 3, 0.5, time.Minute},
+		{"exponential first attempt", BackoffExponential, time.Minute, 0, 1, 0.5, time.Minute},
+		{"exponential doubles", BackoffExponential, time.Minute, 0, 3, 0.5, 4 * time.Minute},
+		{"exponential capped", BackoffExponential, time.Minute, 0, 10, 0.5, 10 * time.Minute},
+		{"jitter low", BackoffFixed, time.Minute, 0.5, 1, 0, 30 * time.Second},
+		{"jitter high", BackoffFixed, time.Minute, 0.5, 1, 0.999999, 90 * time.Second},
+		{"jitter centred", BackoffFixed, time.Minute, 0.5, 1, 0.5, time.Minute},
+		{"jitter stays under cap", BackoffExponential, time.Minute, 0.5, 10, 0.999999, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoffDelay(tt.policy, tt.base, 10*time.Minute, tt.jitter, tt.attempt, tt.r)
+			if got.Round(time.Second) != tt.want {
+				t.Errorf("backoffDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigRetryDelay_DefaultCap(t *testing.T) {
+	config := &Config{RetryDelay: time.Hour, RetryBackoff: BackoffExponential}
+
+	if got := config.retryDelay(5); got != defaultMaxRetryDelay {
+		t.Errorf("retryDelay() = %s, want the default cap %s", got, defaultMaxRetryDelay)
+	}
+}
+
+func TestFormatDelay(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  string
+	}{
+		{45 * time.Second, "45s"},
+		{4*time.Minute + 10*time.Second, "4m"},
+		{time.Hour, "1h"},
+		{90 * time.Minute, "1h30m"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDelay(tt.delay); got != tt.want {
+			t.Errorf("formatDelay(%s) = %q, want %q", tt.delay, got, tt.want)
+		}
+	}
+}
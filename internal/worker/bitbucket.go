@@ -0,0 +1,511 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBitbucketAPIURL is the REST API endpoint of Bitbucket Cloud
+const defaultBitbucketAPIURL = "https://api.bitbucket.org/2.0"
+
+// bitbucketWebURL is the web address of Bitbucket Cloud
+const bitbucketWebURL = "https://bitbucket.org"
+
+// bitbucketOperations implements the GitHubOperations interface for Bitbucket
+// Cloud using the REST 2.0 API: Pipelines stand in for workflow runs and
+// pipeline steps for jobs
+type bitbucketOperations struct {
+	username   string
+	token      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewBitbucketOperations creates a Bitbucket Cloud operations instance. With a
+// username the token is an app password used with basic auth; without one it
+// is an access token sent as a bearer token.
+func NewBitbucketOperations(username, token string) GitHubOperations {
+	return NewBitbucketOperationsWithBaseURL(username, token, "")
+}
+
+// NewBitbucketOperationsWithBaseURL creates a Bitbucket operations instance
+// against the given API base URL
+func NewBitbucketOperationsWithBaseURL(username, token, baseURL string) GitHubOperations {
+	if baseURL == "" {
+		baseURL = defaultBitbucketAPIURL
+	}
+
+	return &bitbucketOperations{
+		username: username,
+		token:    token,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// bitbucketAPIError represents a non-success response from the Bitbucket API
+type bitbucketAPIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *bitbucketAPIError) Error() string {
+	return fmt.Sprintf("bitbucket API %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// CreatePullRequest creates a pull request on Bitbucket, returning the URL of
+// an already open pull request for the source branch if there is one. An
+// empty baseBranch targets the repository's main branch.
+func (bb *bitbucketOperations) CreatePullRequest(ctx context.Context, repoURL, baseBranch, headBranch, title, body string) (string, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	existing, err := bb.FindPullRequest(ctx, repoURL, headBranch)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.HTMLURL, nil
+	}
+
+	if baseBranch == "" {
+		baseBranch, err = bb.GetDefaultBranch(ctx, repoURL)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	payload := map[string]interface{}{
+		"title":       title,
+		"description": body,
+		"source":      map[string]interface{}{"branch": map[string]string{"name": headBranch}},
+		"destination": map[string]interface{}{"branch": map[string]string{"name": baseBranch}},
+	}
+
+	var pr bitbucketPullRequest
+	path := fmt.Sprintf("/repositories/%s/%s/pullrequests", workspace, repo)
+	if err := bb.doJSON(ctx, http.MethodPost, path, payload, &pr); err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+
+	return pr.Links.HTML.Href, nil
+}
+
+// FindPullRequest returns the open pull request for the source branch, or nil if there is none
+func (bb *bitbucketOperations) FindPullRequest(ctx context.Context, repoURL, headBranch string) (*PullRequest, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("q", fmt.Sprintf(`source.branch.name = %q AND state = "OPEN"`, headBranch))
+
+	var resp struct {
+		Values []bitbucketPullRequest `json:"values"`
+	}
+	path := fmt.Sprintf("/repositories/%s/%s/pullrequests?%s", workspace, repo, params.Encode())
+	if err := bb.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	if len(resp.Values) == 0 {
+		return nil, nil
+	}
+
+	pr := resp.Values[0].toPullRequest()
+	return &pr, nil
+}
+
+// GetPullRequest retrieves a pull request by its web URL
+func (bb *bitbucketOperations) GetPullRequest(ctx context.Context, prURL string) (*PullRequest, error) {
+	workspace, repo, id, err := parseBitbucketPullRequestURL(prURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var pr bitbucketPullRequest
+	path := fmt.Sprintf("/repositories/%s/%s/pullrequests/%d", workspace, repo, id)
+	if err := bb.doJSON(ctx, http.MethodGet, path, nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	result := pr.toPullRequest()
+	return &result, nil
+}
+
+// GetPullRequestStatus retrieves the status of a pull request: open, closed or merged
+func (bb *bitbucketOperations) GetPullRequestStatus(ctx context.Context, prURL string) (string, error) {
+	pr, err := bb.GetPullRequest(ctx, prURL)
+	if err != nil {
+		return "", err
+	}
+
+	if pr.Merged {
+		return "merged", nil
+	}
+	return pr.State, nil
+}
+
+// GetDefaultBranch returns the repository's main branch
+func (bb *bitbucketOperations) GetDefaultBranch(ctx context.Context, repoURL string) (string, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	var repository struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	path := fmt.Sprintf("/repositories/%s/%s", workspace, repo)
+	if err := bb.doJSON(ctx, http.MethodGet, path, nil, &repository); err != nil {
+		return "", fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	return repository.MainBranch.Name, nil
+}
+
+// GetWorkflowRuns retrieves the pipelines for a branch
+func (bb *bitbucketOperations) GetWorkflowRuns(ctx context.Context, repoURL, branchName string) ([]WorkflowRun, error) {
+	params := url.Values{}
+	params.Set("target.branch", branchName)
+	return bb.listPipelines(ctx, repoURL, params)
+}
+
+// GetWorkflowRunsForCommit retrieves the pipelines for a commit
+func (bb *bitbucketOperations) GetWorkflowRunsForCommit(ctx context.Context, repoURL, sha string) ([]WorkflowRun, error) {
+	params := url.Values{}
+	params.Set("target.commit.hash", sha)
+	return bb.listPipelines(ctx, repoURL, params)
+}
+
+// bitbucketStep is a step of a pipeline, the unit whose logs are kept
+type bitbucketStep struct {
+	UUID  string         `json:"uuid"`
+	Name  string         `json:"name"`
+	State bitbucketState `json:"state"`
+}
+
+// pipelineSteps retrieves the steps of the pipeline with the given build number
+func (bb *bitbucketOperations) pipelineSteps(ctx context.Context, repoURL string, buildNumber int64) ([]bitbucketStep, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	// Pipelines are addressed by UUID or, equivalently, by build number
+	var resp struct {
+		Values []bitbucketStep `json:"values"`
+	}
+	path := fmt.Sprintf("/repositories/%s/%s/pipelines/%d/steps/?pagelen=100", workspace, repo, buildNumber)
+	if err := bb.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list pipeline steps: %w", err)
+	}
+
+	return resp.Values, nil
+}
+
+// stepLogs downloads the log of a pipeline step
+func (bb *bitbucketOperations) stepLogs(ctx context.Context, repoURL string, buildNumber int64, stepUUID string) (string, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	path := fmt.Sprintf("/repositories/%s/%s/pipelines/%d/steps/%s/log", workspace, repo, buildNumber, url.PathEscape(stepUUID))
+	resp, err := bb.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download step log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJobLogBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read step log: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// GetWorkflowRunLogs retrieves the logs of the failed steps in a pipeline
+func (bb *bitbucketOperations) GetWorkflowRunLogs(ctx context.Context, repoURL string, buildNumber int64) (string, error) {
+	steps, err := bb.pipelineSteps(ctx, repoURL, buildNumber)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, step := range steps {
+		status, conclusion := step.State.status()
+		if status != "completed" || conclusion != "failure" {
+			continue
+		}
+
+		logs, err := bb.stepLogs(ctx, repoURL, buildNumber, step.UUID)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "--- %s (%s) ---\n%s\n", step.Name, conclusion, logs)
+	}
+
+	return sb.String(), nil
+}
+
+// listPipelines lists the most recent pipelines matching the query parameters
+func (bb *bitbucketOperations) listPipelines(ctx context.Context, repoURL string, params url.Values) ([]WorkflowRun, error) {
+	workspace, repo, err := parseBitbucketRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params.Set("sort", "-created_on")
+	params.Set("pagelen", "50")
+
+	var resp struct {
+		Values []struct {
+			BuildNumber int64          `json:"build_number"`
+			State       bitbucketState `json:"state"`
+			Target      struct {
+				RefName string `json:"ref_name"`
+				Commit  struct {
+					Hash string `json:"hash"`
+				} `json:"commit"`
+			} `json:"target"`
+			CreatedOn   time.Time  `json:"created_on"`
+			CompletedOn *time.Time `json:"completed_on"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/repositories/%s/%s/pipelines/?%s", workspace, repo, params.Encode())
+	if err := bb.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list pipelines: %w", err)
+	}
+
+	runs := make([]WorkflowRun, len(resp.Values))
+	for i, pipeline := range resp.Values {
+		status, conclusion := pipeline.State.status()
+		updatedAt := pipeline.CreatedOn
+		if pipeline.CompletedOn != nil {
+			updatedAt = *pipeline.CompletedOn
+		}
+		runs[i] = WorkflowRun{
+			ID:         pipeline.BuildNumber,
+			Name:       fmt.Sprintf("Pipeline #%d", pipeline.BuildNumber),
+			HeadBranch: pipeline.Target.RefName,
+			HeadSHA:    pipeline.Target.Commit.Hash,
+			Status:     status,
+			Conclusion: conclusion,
+			HTMLURL:    fmt.Sprintf("%s/%s/%s/pipelines/results/%d", bitbucketWebURL, workspace, repo, pipeline.BuildNumber),
+			CreatedAt:  pipeline.CreatedOn,
+			UpdatedAt:  updatedAt,
+		}
+	}
+
+	return runs, nil
+}
+
+// bitbucketState is the state of a pipeline or pipeline step
+type bitbucketState struct {
+	Name   string `json:"name"`
+	Result struct {
+		Name string `json:"name"`
+	} `json:"result"`
+	Stage struct {
+		Name string `json:"name"`
+	} `json:"stage"`
+}
+
+// status maps the state to the status and conclusion of a GitHub Actions run
+func (s bitbucketState) status() (string, string) {
+	switch s.Name {
+	case "COMPLETED":
+	case "IN_PROGRESS":
+		// A pipeline paused on a manual step waits on someone who may never come
+		if s.Stage.Name == "PAUSED" || s.Stage.Name == "HALTED" {
+			return "completed", "neutral"
+		}
+		return "in_progress", ""
+	case "PAUSED", "HALTED":
+		return "completed", "neutral"
+	default:
+		return "queued", ""
+	}
+
+	switch s.Result.Name {
+	case "SUCCESSFUL":
+		return "completed", "success"
+	case "STOPPED":
+		return "completed", "cancelled"
+	case "EXPIRED":
+		return "completed", "timed_out"
+	case "NOT_RUN":
+		return "completed", "skipped"
+	default:
+		return "completed", "failure"
+	}
+}
+
+// bitbucketPullRequest is the API representation of a pull request
+type bitbucketPullRequest struct {
+	ID     int    `json:"id"`
+	State  string `json:"state"`
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"destination"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+// toPullRequest converts the API representation to a PullRequest
+func (pr bitbucketPullRequest) toPullRequest() PullRequest {
+	// Declined and superseded pull requests are closed without merging
+	state := "closed"
+	if pr.State == "OPEN" {
+		state = "open"
+	}
+
+	return PullRequest{
+		Number:     pr.ID,
+		HTMLURL:    pr.Links.HTML.Href,
+		State:      state,
+		Merged:     pr.State == "MERGED",
+		HeadBranch: pr.Source.Branch.Name,
+		BaseBranch: pr.Destination.Branch.Name,
+	}
+}
+
+// doJSON performs an API request and decodes the JSON response into target
+func (bb *bitbucketOperations) doJSON(ctx context.Context, method, path string, body, target interface{}) error {
+	resp, err := bb.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if target == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode bitbucket response: %w", err)
+	}
+
+	return nil
+}
+
+// do performs an API request, returning an error for non-2xx responses
+func (bb *bitbucketOperations) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, bb.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "amp-worker")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case bb.username != "":
+		req.SetBasicAuth(bb.username, bb.token)
+	case bb.token != "":
+		req.Header.Set("Authorization", "Bearer "+bb.token)
+	}
+
+	resp, err := bb.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("bitbucket request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return nil, &bitbucketAPIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    message,
+		}
+	}
+
+	return resp, nil
+}
+
+// parseBitbucketRepoURL extracts workspace and repository slug from a
+// Bitbucket Cloud repository URL, including clone URLs naming a user
+func parseBitbucketRepoURL(repoURL string) (workspace, repo string, err error) {
+	ref, err := parseRemoteRepo(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	if ref.Segments() != 2 {
+		return "", "", fmt.Errorf("invalid repository path: %s", ref.Path)
+	}
+
+	return ref.Owner(), ref.Name(), nil
+}
+
+// parseBitbucketPullRequestURL extracts workspace, repository and ID from a
+// pull request web URL, e.g. https://bitbucket.org/acme/api/pull-requests/7
+func parseBitbucketPullRequestURL(prURL string) (workspace, repo string, id int, err error) {
+	parsed, err := url.Parse(prURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid pull request URL: %s", prURL)
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] != "pull-requests" {
+		return "", "", 0, fmt.Errorf("invalid pull request URL: %s", prURL)
+	}
+
+	id, err = strconv.Atoi(parts[3])
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid pull request number in URL: %s", prURL)
+	}
+
+	return parts[0], parts[1], id, nil
+}
@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeBitbucketAPI starts an httptest server serving the given routes, keyed
+// by "METHOD /escaped/path", that expects the app password of amp-bot
+func newFakeBitbucketAPI(t *testing.T, routes map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "amp-bot" || pass != "app-password" {
+			t.Errorf("basic auth = %q/%q, want the app password", user, pass)
+		}
+		handler, ok := routes[r.Method+" "+r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"type":"error","error":{"message":"Repository acme/api not found"}}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestBitbucketCreatePullRequest(t *testing.T) {
+	var created struct {
+		Title       string `json:"title"`
+		Source      struct{ Branch struct{ Name string } }
+		Destination struct{ Branch struct{ Name string } }
+	}
+	server := newFakeBitbucketAPI(t, map[string]http.HandlerFunc{
+		"GET /repositories/acme/api/pullrequests": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("q"); got != `source.branch.name = "amp/01ABC" AND state = "OPEN"` {
+				t.Errorf("q = %q, want the source branch's open pull requests", got)
+			}
+			fmt.Fprint(w, `{"values":[]}`)
+		},
+		"GET /repositories/acme/api": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"mainbranch":{"name":"trunk"}}`)
+		},
+		"POST /repositories/acme/api/pullrequests": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":12,"state":"OPEN","links":{"html":{"href":"https://bitbucket.org/acme/api/pull-requests/12"}}}`)
+		},
+	})
+
+	bb := NewBitbucketOperationsWithBaseURL("amp-bot", "app-password", server.URL)
+	prURL, err := bb.CreatePullRequest(context.Background(), "https://amp-bot@bitbucket.org/acme/api.git", "", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+
+	if prURL != "https://bitbucket.org/acme/api/pull-requests/12" {
+		t.Errorf("prURL = %q, want created PR URL", prURL)
+	}
+	if created.Destination.Branch.Name != "trunk" || created.Source.Branch.Name != "amp/01ABC" || created.Title != "Title" {
+		t.Errorf("created payload = %+v, want trunk <- amp/01ABC", created)
+	}
+}
+
+func TestBitbucketCreatePullRequest_ReusesOpenPullRequest(t *testing.T) {
+	server := newFakeBitbucketAPI(t, map[string]http.HandlerFunc{
+		"GET /repositories/acme/api/pullrequests": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"values":[{"id":3,"state":"OPEN","links":{"html":{"href":"https://bitbucket.org/acme/api/pull-requests/3"}}}]}`)
+		},
+		"POST /repositories/acme/api/pullrequests": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect a new pull request to be created")
+		},
+	})
+
+	bb := NewBitbucketOperationsWithBaseURL("amp-bot", "app-password", server.URL)
+	prURL, err := bb.CreatePullRequest(context.Background(), "git@bitbucket.org:acme/api.git", "main", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+	if prURL != "https://bitbucket.org/acme/api/pull-requests/3" {
+		t.Errorf("prURL = %q, want existing PR URL", prURL)
+	}
+}
+
+func TestBitbucketGetPipelinesForCommit(t *testing.T) {
+	server := newFakeBitbucketAPI(t, map[string]http.HandlerFunc{
+		"GET /repositories/acme/api/pipelines/": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("target.commit.hash"); got != "abc123" {
+				t.Errorf("target.commit.hash = %q, want abc123", got)
+			}
+			fmt.Fprint(w, `{"values":[
+				{"build_number":42,"state":{"name":"COMPLETED","result":{"name":"FAILED"}},"target":{"ref_name":"amp/01ABC","commit":{"hash":"abc123"}},"created_on":"2024-05-01T10:00:00Z","completed_on":"2024-05-01T10:05:00Z"},
+				{"build_number":41,"state":{"name":"IN_PROGRESS","stage":{"name":"RUNNING"}},"target":{"ref_name":"amp/01ABC","commit":{"hash":"abc123"}}}
+			]}`)
+		},
+	})
+
+	bb := NewBitbucketOperationsWithBaseURL("amp-bot", "app-password", server.URL).(*bitbucketOperations)
+	runs, err := bb.GetWorkflowRunsForCommit(context.Background(), "https://bitbucket.org/acme/api", "abc123")
+	if err != nil {
+		t.Fatalf("GetWorkflowRunsForCommit() error = %v", err)
+	}
+
+	if len(runs) != 2 {
+		t.Fatalf("len(runs) = %d, want 2", len(runs))
+	}
+	run := runs[0]
+	if run.ID != 42 || run.HeadSHA != "abc123" || run.Status != "completed" || run.Conclusion != "failure" {
+		t.Errorf("runs[0] = %+v, want a failed pipeline", run)
+	}
+	if run.HTMLURL != "https://bitbucket.org/acme/api/pipelines/results/42" || run.UpdatedAt.Sub(run.CreatedAt).Minutes() != 5 {
+		t.Errorf("runs[0] = %+v, want the pipeline's page and completion time", run)
+	}
+	if runs[1].Status != "in_progress" {
+		t.Errorf("runs[1] = %+v, want a pipeline in progress", runs[1])
+	}
+}
+
+func TestBitbucketGetPipelineLogs(t *testing.T) {
+	server := newFakeBitbucketAPI(t, map[string]http.HandlerFunc{
+		"GET /repositories/acme/api/pipelines/42/steps/": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"values":[
+				{"uuid":"{lint-uuid}","name":"lint","state":{"name":"COMPLETED","result":{"name":"SUCCESSFUL"}}},
+				{"uuid":"{test-uuid}","name":"test","state":{"name":"COMPLETED","result":{"name":"FAILED"}}}
+			]}`)
+		},
+		"GET /repositories/acme/api/pipelines/42/steps/%7Blint-uuid%7D/log": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect the log of a successful step to be fetched")
+		},
+		"GET /repositories/acme/api/pipelines/42/steps/%7Btest-uuid%7D/log": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "--- FAIL: TestLogin (0.01s)\n")
+		},
+	})
+
+	bb := NewBitbucketOperationsWithBaseURL("amp-bot", "app-password", server.URL)
+	logs, err := bb.GetWorkflowRunLogs(context.Background(), "https://bitbucket.org/acme/api", 42)
+	if err != nil {
+		t.Fatalf("GetWorkflowRunLogs() error = %v", err)
+	}
+
+	if !strings.Contains(logs, "--- test (failure) ---") || !strings.Contains(logs, "FAIL: TestLogin") {
+		t.Errorf("logs = %q, want the failed step log", logs)
+	}
+}
+
+func TestBitbucketGetPullRequestStatus(t *testing.T) {
+	server := newFakeBitbucketAPI(t, map[string]http.HandlerFunc{
+		"GET /repositories/acme/api/pullrequests/7": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":7,"state":"MERGED"}`)
+		},
+		"GET /repositories/acme/api/pullrequests/8": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":8,"state":"DECLINED"}`)
+		},
+	})
+
+	bb := NewBitbucketOperationsWithBaseURL("amp-bot", "app-password", server.URL)
+	tests := map[string]string{
+		"https://bitbucket.org/acme/api/pull-requests/7":          "merged",
+		"https://bitbucket.org/acme/api/pull-requests/8/overview": "closed",
+	}
+	for prURL, want := range tests {
+		status, err := bb.GetPullRequestStatus(context.Background(), prURL)
+		if err != nil {
+			t.Fatalf("GetPullRequestStatus(%s) error = %v", prURL, err)
+		}
+		if status != want {
+			t.Errorf("GetPullRequestStatus(%s) = %q, want %q", prURL, status, want)
+		}
+	}
+}
+
+func TestBitbucketAccessToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer access-token" {
+			t.Errorf("Authorization = %q, want bearer token", got)
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"type":"error","error":{"message":"Your credentials lack the pipeline scope"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	bb := NewBitbucketOperationsWithBaseURL("", "access-token", server.URL)
+	_, err := bb.GetWorkflowRuns(context.Background(), "https://bitbucket.org/acme/api", "main")
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "lack the pipeline scope") {
+		t.Errorf("error = %v, want status and API message", err)
+	}
+}
+
+func TestBitbucketStateStatus(t *testing.T) {
+	tests := []struct {
+		state          string
+		result         string
+		stage          string
+		wantStatus     string
+		wantConclusion string
+	}{
+		{"PENDING", "", "", "queued", ""},
+		{"IN_PROGRESS", "", "RUNNING", "in_progress", ""},
+		{"IN_PROGRESS", "", "PAUSED", "completed", "neutral"},
+		{"COMPLETED", "SUCCESSFUL", "", "completed", "success"},
+		{"COMPLETED", "ERROR", "", "completed", "failure"},
+		{"COMPLETED", "STOPPED", "", "completed", "cancelled"},
+		{"COMPLETED", "EXPIRED", "", "completed", "timed_out"},
+	}
+
+	for _, tt := range tests {
+		var state bitbucketState
+		state.Name = tt.state
+		state.Result.Name = tt.result
+		state.Stage.Name = tt.stage
+
+		status, conclusion := state.status()
+		if status != tt.wantStatus || conclusion != tt.wantConclusion {
+			t.Errorf("status(%s/%s/%s) = %s/%s, want %s/%s", tt.state, tt.result, tt.stage, status, conclusion, tt.wantStatus, tt.wantConclusion)
+		}
+	}
+}
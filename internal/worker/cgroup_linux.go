@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupPollInterval is how often a run's cgroup is checked against its CPU limit
+const cgroupPollInterval = 250 * time.Millisecond
+
+// processCgroup is a cgroup v2 created for a single run. Unlike rlimits, its
+// CPU and memory limits cover every process the run starts.
+type processCgroup struct {
+	dir    string
+	limits ResourceLimits
+	fd     *os.File
+}
+
+// newProcessCgroup creates a cgroup for one run under root
+func newProcessCgroup(root string, limits ResourceLimits) (*processCgroup, error) {
+	// Delegate the controllers to the run's cgroup; they may already be enabled
+	os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644)
+
+	dir, err := os.MkdirTemp(root, "task-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	cg := &processCgroup{dir: dir, limits: limits}
+
+	if limits.CPUTime > 0 {
+		if _, err := cg.cpuUsage(); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("cgroup has no CPU accounting: %w", err)
+		}
+	}
+	if limits.Memory > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(limits.Memory, 10)), 0644); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("failed to set memory limit: %w", err)
+		}
+		// Kill the whole run rather than one of its processes when it runs out of memory
+		os.WriteFile(filepath.Join(dir, "memory.oom.group"), []byte("1"), 0644)
+	}
+
+	cg.fd, err = os.Open(dir)
+	if err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+
+	return cg, nil
+}
+
+// attach makes cmd start inside the cgroup
+func (cg *processCgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// watch cancels the run once it has used up its CPU time, until ctx is done
+func (cg *processCgroup) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	if cg.limits.CPUTime <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cgroupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if limitErr := cg.exceeded(); limitErr != nil {
+				cancel(limitErr)
+				return
+			}
+		}
+	}
+}
+
+// exceeded reports the limit the run has hit, if any
+func (cg *processCgroup) exceeded() *LimitExceededError {
+	if cg.limits.Memory > 0 {
+		if kills, err := readCgroupStat(filepath.Join(cg.dir, "memory.events"), "oom_kill"); err == nil && kills > 0 {
+			return &LimitExceededError{Limit: "memory", Max: fmt.Sprintf("%d bytes", cg.limits.Memory)}
+		}
+	}
+	if cg.limits.CPUTime > 0 {
+		if usage, err := cg.cpuUsage(); err == nil && usage > cg.limits.CPUTime {
+			return &LimitExceededError{Limit: "cpu", Max: cg.limits.CPUTime.String()}
+		}
+	}
+	return nil
+}
+
+// cpuUsage returns the CPU time used by the processes in the cgroup
+func (cg *processCgroup) cpuUsage() (time.Duration, error) {
+	usec, err := readCgroupStat(filepath.Join(cg.dir, "cpu.stat"), "usage_usec")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// remove kills anything left in the cgroup, such as daemons that escaped the
+// process group, and deletes it
+func (cg *processCgroup) remove() {
+	if cg.fd != nil {
+		cg.fd.Close()
+	}
+	os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0644)
+
+	// The cgroup can only be removed once the killed processes have exited
+	for i := 0; i < 20; i++ {
+		if err := os.Remove(cg.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// readCgroupStat reads the value of key from a flat-keyed cgroup file such as cpu.stat
+func readCgroupStat(path, key string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == key {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s not found in %s", key, filepath.Base(path))
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// processCgroup is unavailable outside Linux
+type processCgroup struct{}
+
+// newProcessCgroup always fails outside Linux, so rlimits are used instead
+func newProcessCgroup(root string, limits ResourceLimits) (*processCgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+// attach does nothing outside Linux
+func (cg *processCgroup) attach(cmd *exec.Cmd) {}
+
+// watch does nothing outside Linux
+func (cg *processCgroup) watch(ctx context.Context, cancel context.CancelCauseFunc) {}
+
+// exceeded never reports a limit outside Linux
+func (cg *processCgroup) exceeded() *LimitExceededError {
+	return nil
+}
+
+// remove does nothing outside Linux
+func (cg *processCgroup) remove() {}
@@ -0,0 +1,263 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Built-in CI provider names
+const (
+	CIProviderGitHubActions      = "github-actions"
+	CIProviderGitLabCI           = "gitlab-ci"
+	CIProviderBitbucketPipelines = "bitbucket-pipelines"
+	CIProviderLocal              = "local"
+	CIProviderNone               = "none"
+)
+
+// CITarget identifies the pushed commit whose checks a CIProvider runs or watches
+type CITarget struct {
+	// Remote URL of the repository
+	RepoURL string
+	// Local checkout of the commit, in the task's workspace
+	RepoDir string
+	// Branch the commit was pushed to
+	Branch string
+	// The commit itself
+	SHA string
+	// Extra environment variables for commands run in the workspace
+	Env []string
+}
+
+// CIProvider runs or watches the checks of a pushed commit. Runs are
+// reported as WorkflowRuns whichever system produced them.
+type CIProvider interface {
+	// Name identifies the provider in task logs
+	Name() string
+	// FindRuns returns the runs for the target's commit, starting them first
+	// when the provider runs the checks itself. Runs still in progress have
+	// a status other than "completed"; none at all means CI has not started.
+	FindRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error)
+	// WaitForRuns waits until every run for the target's commit has completed.
+	// No runs and no error means the commit has no CI to wait for.
+	WaitForRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error)
+	// FailureLogs returns the logs explaining why a run failed
+	FailureLogs(ctx context.Context, target CITarget, run WorkflowRun) (string, error)
+}
+
+// NewCIProvider creates the CI provider registered under name for the task's
+// code host, github. An empty name selects the host's own CI, e.g. GitHub
+// Actions or GitLab CI, when github is available and no CI otherwise; a nil
+// provider means pushed commits are not verified.
+func NewCIProvider(name string, config *Config, github GitHubOperations) (CIProvider, error) {
+	switch name {
+	case "":
+		if github == nil {
+			return nil, nil
+		}
+		return newHostedCI(hostedCIProvider(github), github, config), nil
+	case CIProviderGitHubActions, CIProviderGitLabCI, CIProviderBitbucketPipelines:
+		if github == nil || hostedCIProvider(github) != name {
+			return nil, fmt.Errorf("the %s CI provider requires %s access", name, hostedCIHosts[name])
+		}
+		return newHostedCI(name, github, config), nil
+	case CIProviderLocal:
+		return NewLocalCI(config.CICommands, config.ciLimits())
+	case CIProviderNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown CI provider %q (available: %s, %s, %s, %s, %s)", name, CIProviderGitHubActions, CIProviderGitLabCI, CIProviderBitbucketPipelines, CIProviderLocal, CIProviderNone)
+	}
+}
+
+// hostedCIHosts names the code host each hosted CI provider belongs to
+var hostedCIHosts = map[string]string{
+	CIProviderGitHubActions:      "GitHub",
+	CIProviderGitLabCI:           "GitLab",
+	CIProviderBitbucketPipelines: "Bitbucket",
+}
+
+// hostedCIProvider returns the name of the CI built into the code host ops talks to
+func hostedCIProvider(ops GitHubOperations) string {
+	switch ops.(type) {
+	case *gitlabOperations:
+		return CIProviderGitLabCI
+	case *bitbucketOperations:
+		return CIProviderBitbucketPipelines
+	default:
+		return CIProviderGitHubActions
+	}
+}
+
+// hostedCI watches the runs a push triggers on the code host: GitHub Actions
+// workflow runs, or GitLab and Bitbucket pipelines through the same operations
+type hostedCI struct {
+	name         string
+	github       GitHubOperations
+	pollInterval time.Duration
+	timeout      time.Duration
+	startTimeout time.Duration
+}
+
+// newHostedCI creates a CI provider that polls the code host's CI
+func newHostedCI(name string, github GitHubOperations, config *Config) CIProvider {
+	return &hostedCI{
+		name:         name,
+		github:       github,
+		pollInterval: config.ciPollInterval(),
+		timeout:      config.ciTimeout(),
+		startTimeout: config.ciStartTimeout(),
+	}
+}
+
+// NewGitHubActionsCI creates a CI provider that polls GitHub Actions
+func NewGitHubActionsCI(github GitHubOperations, config *Config) CIProvider {
+	return newHostedCI(CIProviderGitHubActions, github, config)
+}
+
+// NewGitLabCI creates a CI provider that polls GitLab pipelines
+func NewGitLabCI(gitlab GitHubOperations, config *Config) CIProvider {
+	return newHostedCI(CIProviderGitLabCI, gitlab, config)
+}
+
+// NewBitbucketPipelinesCI creates a CI provider that polls Bitbucket Pipelines
+func NewBitbucketPipelinesCI(bitbucket GitHubOperations, config *Config) CIProvider {
+	return newHostedCI(CIProviderBitbucketPipelines, bitbucket, config)
+}
+
+// Name implements CIProvider
+func (g *hostedCI) Name() string {
+	return g.name
+}
+
+// FindRuns returns the runs the push of the target's commit triggered
+func (g *hostedCI) FindRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error) {
+	runs, err := g.github.GetWorkflowRuns(ctx, target.RepoURL, target.Branch)
+	if err != nil {
+		return nil, err
+	}
+	return runsForCommit(runs, target.SHA), nil
+}
+
+// WaitForRuns polls the workflow runs for the branch until every run for the
+// target's commit has completed, returning those runs. A repository without
+// workflows or pipelines never starts any, so a commit still without runs
+// once the start timeout has passed is taken to have no CI.
+func (g *hostedCI) WaitForRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error) {
+	if target.RepoURL == "" {
+		return nil, fmt.Errorf("no remote URL to find workflow runs for")
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(g.pollInterval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	for {
+		runs, err := g.FindRuns(waitCtx, target)
+		switch {
+		case err != nil:
+			log.Printf("Failed to get workflow runs for %s: %v", target.Branch, err)
+		case len(runs) == 0 && time.Since(started) >= g.startTimeout:
+			return nil, nil
+		case len(runs) > 0 && allCompleted(runs):
+			return runs, nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("timed out after %v waiting for CI on commit %s", g.timeout, shortSHA(target.SHA))
+		case <-ticker.C:
+		}
+	}
+}
+
+// FailureLogs returns the logs of the run's failed jobs
+func (g *hostedCI) FailureLogs(ctx context.Context, target CITarget, run WorkflowRun) (string, error) {
+	return g.github.GetWorkflowRunLogs(ctx, target.RepoURL, run.ID)
+}
+
+// runsForCommit returns the workflow runs triggered by the given commit
+func runsForCommit(runs []WorkflowRun, sha string) []WorkflowRun {
+	var matching []WorkflowRun
+	for _, run := range runs {
+		if run.HeadSHA == sha {
+			matching = append(matching, run)
+		}
+	}
+	return matching
+}
+
+// allCompleted reports whether every run has finished
+func allCompleted(runs []WorkflowRun) bool {
+	for _, run := range runs {
+		if run.Status != "completed" {
+			return false
+		}
+	}
+	return true
+}
+
+// failedRuns returns the completed runs that did not pass
+func failedRuns(runs []WorkflowRun) []WorkflowRun {
+	var failed []WorkflowRun
+	for _, run := range runs {
+		switch run.Conclusion {
+		case "success", "neutral", "skipped":
+		default:
+			failed = append(failed, run)
+		}
+	}
+	return failed
+}
+
+// runDescription returns a human-readable reference to a workflow run
+func runDescription(run WorkflowRun) string {
+	desc := fmt.Sprintf("run %d", run.ID)
+	if run.Name != "" {
+		desc = fmt.Sprintf("%s (%s)", run.Name, desc)
+	}
+	if run.HTMLURL != "" {
+		desc += " " + run.HTMLURL
+	}
+	return desc
+}
+
+// ciPollInterval returns the interval between CI status checks
+func (c *Config) ciPollInterval() time.Duration {
+	if c.CIPollInterval > 0 {
+		return c.CIPollInterval
+	}
+	return defaultCIPollInterval
+}
+
+// ciTimeout returns the maximum time to wait for CI on a pushed commit
+func (c *Config) ciTimeout() time.Duration {
+	if c.CITimeout > 0 {
+		return c.CITimeout
+	}
+	return defaultCITimeout
+}
+
+// ciStartTimeout returns how long a pushed commit may go without CI runs
+// before the hosted CI is taken to have none for the repository
+func (c *Config) ciStartTimeout() time.Duration {
+	if c.CIStartTimeout > 0 {
+		return c.CIStartTimeout
+	}
+	return defaultCIStartTimeout
+}
+
+// ciLimits returns the resource limits applied to each local CI command:
+// the agent's limits, with CITimeout as the wall-clock limit
+func (c *Config) ciLimits() ResourceLimits {
+	limits := c.limits()
+	limits.WallClock = c.ciTimeout()
+	return limits
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// localCI runs configured commands, e.g. "go test ./...", in the task's
+// workspace instead of waiting for a hosted CI system. Each command is one
+// run; the first failing command ends the checks of a commit.
+type localCI struct {
+	commands []string
+	limits   ResourceLimits
+
+	mu      sync.Mutex
+	results map[string][]WorkflowRun
+	logs    map[int64]string
+	nextID  int64
+}
+
+// NewLocalCI creates a CI provider that runs commands through sh -c
+func NewLocalCI(commands []string, limits ResourceLimits) (CIProvider, error) {
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no CI commands configured for the %s CI provider", CIProviderLocal)
+	}
+
+	return &localCI{
+		commands: commands,
+		limits:   limits,
+		results:  make(map[string][]WorkflowRun),
+		logs:     make(map[int64]string),
+	}, nil
+}
+
+// Name implements CIProvider
+func (l *localCI) Name() string {
+	return CIProviderLocal
+}
+
+// FindRuns runs the commands on the target's commit, once per commit
+func (l *localCI) FindRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if runs, ok := l.results[target.SHA]; ok {
+		return runs, nil
+	}
+
+	var runs []WorkflowRun
+	for _, command := range l.commands {
+		run, output, err := l.runCommand(ctx, target, command)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+		l.logs[run.ID] = output
+
+		if run.Conclusion != "success" {
+			break
+		}
+	}
+
+	l.results[target.SHA] = runs
+	return runs, nil
+}
+
+// WaitForRuns runs the commands, which complete before it returns
+func (l *localCI) WaitForRuns(ctx context.Context, target CITarget) ([]WorkflowRun, error) {
+	return l.FindRuns(ctx, target)
+}
+
+// FailureLogs returns the combined output of the run's command
+func (l *localCI) FailureLogs(ctx context.Context, target CITarget, run WorkflowRun) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	output, ok := l.logs[run.ID]
+	if !ok {
+		return "", fmt.Errorf("no output recorded for run %d", run.ID)
+	}
+	return output, nil
+}
+
+// runCommand runs one command in the target's checkout. A command that
+// fails or exceeds its limits yields a failed run; only a cancelled context
+// is an error.
+func (l *localCI) runCommand(ctx context.Context, target CITarget, command string) (WorkflowRun, string, error) {
+	l.nextID++
+	run := WorkflowRun{
+		ID:         l.nextID,
+		Name:       command,
+		HeadBranch: target.Branch,
+		HeadSHA:    target.SHA,
+		Status:     "completed",
+		Conclusion: "success",
+	}
+
+	limited := newLimitedCommand(ctx, l.limits, "sh", "-c", command)
+	cmd := limited.cmd
+	cmd.Dir = target.RepoDir
+	cmd.Env = childEnvironment(target.Env...)
+
+	var combined syncBuffer
+	cmd.Stdout = limited.limitOutput(&combined)
+	cmd.Stderr = limited.limitOutput(&combined)
+
+	err := limited.Run()
+	if ctx.Err() != nil {
+		return run, "", ctx.Err()
+	}
+	output := combined.String()
+
+	var limitErr *LimitExceededError
+	switch {
+	case errors.As(err, &limitErr) && limitErr.Limit == "wall-clock":
+		run.Conclusion = "timed_out"
+		output += fmt.Sprintf("\n%s: %v\n", command, err)
+	case err != nil:
+		run.Conclusion = "failure"
+		output += fmt.Sprintf("\n%s: %v\n", command, err)
+	}
+
+	return run, output, nil
+}
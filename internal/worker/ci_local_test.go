@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestLocalCI(t *testing.T) {
+	repoDir := t.TempDir()
+	ci, err := NewLocalCI([]string{
+		"echo building",
+		"test -f fixed || { echo 'FAIL: TestLogin'; exit 1; }",
+		"echo never reached",
+	}, ResourceLimits{WallClock: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("NewLocalCI() error = %v", err)
+	}
+	ctx := context.Background()
+	target := CITarget{RepoDir: repoDir, Branch: "amp/1", SHA: "sha-1"}
+
+	runs, err := ci.WaitForRuns(ctx, target)
+	if err != nil {
+		t.Fatalf("WaitForRuns() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].Conclusion != "success" || runs[1].Conclusion != "failure" {
+		t.Fatalf("runs = %+v, want the build to pass and the test to fail", runs)
+	}
+	if runs[1].HeadSHA != "sha-1" || runs[1].Status != "completed" {
+		t.Errorf("failed run = %+v, want a completed run of sha-1", runs[1])
+	}
+
+	logs, err := ci.FailureLogs(ctx, target, runs[1])
+	if err != nil || !strings.Contains(logs, "FAIL: TestLogin") {
+		t.Errorf("FailureLogs() = %q, %v, want the command's output", logs, err)
+	}
+
+	// The checks of a commit run once, however often they are asked for
+	if err := os.WriteFile(filepath.Join(repoDir, "fixed"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ci.FindRuns(ctx, target)
+	if len(again) != 2 || again[1].ID != runs[1].ID {
+		t.Errorf("FindRuns() = %+v, want the recorded runs", again)
+	}
+
+	runs, err = ci.WaitForRuns(ctx, CITarget{RepoDir: repoDir, Branch: "amp/1", SHA: "sha-2"})
+	if err != nil {
+		t.Fatalf("WaitForRuns() error = %v", err)
+	}
+	if len(runs) != 3 || len(failedRuns(runs)) != 0 {
+		t.Errorf("runs = %+v, want every command to pass", runs)
+	}
+}
+
+func TestLocalCI_Timeout(t *testing.T) {
+	ci, err := NewLocalCI([]string{"sleep 5"}, ResourceLimits{WallClock: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewLocalCI() error = %v", err)
+	}
+
+	runs, err := ci.WaitForRuns(context.Background(), CITarget{RepoDir: t.TempDir(), SHA: "sha-1"})
+	if err != nil {
+		t.Fatalf("WaitForRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].Conclusion != "timed_out" {
+		t.Errorf("runs = %+v, want a timed out run", runs)
+	}
+}
+
+func TestLocalCI_HidesWorkerCredentials(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_secret")
+	ci, err := NewLocalCI([]string{`test -z "$GITHUB_TOKEN" || { echo "token: $GITHUB_TOKEN"; exit 1; }`}, ResourceLimits{WallClock: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("NewLocalCI() error = %v", err)
+	}
+
+	runs, err := ci.WaitForRuns(context.Background(), CITarget{RepoDir: t.TempDir(), SHA: "sha-1"})
+	if err != nil {
+		t.Fatalf("WaitForRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].Conclusion != "success" {
+		t.Errorf("runs = %+v, want the command to run without the worker's token", runs)
+	}
+}
+
+func TestExecute_LocalCIRetriesWithCommandOutput(t *testing.T) {
+	processor, _, gitOps, ampOps := newTestProcessor(t, nil)
+	ci, err := NewLocalCI([]string{"test -f fixed || { touch fixed; echo 'FAIL: TestLogin'; exit 1; }"}, ResourceLimits{WallClock: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("NewLocalCI() error = %v", err)
+	}
+	processor.ciProvider = ci
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if result.PRURL != "" {
+		t.Errorf("PRURL = %q, want no pull request without GitHub access", result.PRURL)
+	}
+	if processor.task.Attempts != 2 || gitOps.pushes != 2 {
+		t.Errorf("attempts = %d, pushes = %d, want 2 of each", processor.task.Attempts, gitOps.pushes)
+	}
+	if len(ampOps.prompts) != 2 || !strings.Contains(ampOps.prompts[1], "FAIL: TestLogin") {
+		t.Errorf("prompts = %q, want the failing command's output fed back", ampOps.prompts)
+	}
+}
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestNewCIProvider(t *testing.T) {
+	github := &fakeGitHubOps{}
+	gitlab := NewGitLabOperations("token", "")
+	bitbucket := NewBitbucketOperations("", "token")
+	config := &Config{CICommands: []string{"go test ./..."}}
+
+	tests := []struct {
+		name    string
+		github  GitHubOperations
+		want    string
+		wantErr bool
+	}{
+		{name: "", github: github, want: CIProviderGitHubActions},
+		{name: "", github: nil, want: ""},
+		{name: CIProviderGitHubActions, github: github, want: CIProviderGitHubActions},
+		{name: CIProviderGitHubActions, github: nil, wantErr: true},
+		{name: "", github: gitlab, want: CIProviderGitLabCI},
+		{name: CIProviderGitLabCI, github: gitlab, want: CIProviderGitLabCI},
+		{name: CIProviderGitLabCI, github: github, wantErr: true},
+		{name: CIProviderGitHubActions, github: gitlab, wantErr: true},
+		{name: "", github: bitbucket, want: CIProviderBitbucketPipelines},
+		{name: CIProviderBitbucketPipelines, github: bitbucket, want: CIProviderBitbucketPipelines},
+		{name: CIProviderBitbucketPipelines, github: gitlab, wantErr: true},
+		{name: CIProviderLocal, github: nil, want: CIProviderLocal},
+		{name: CIProviderNone, github: github, want: ""},
+		{name: "jenkins", github: github, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		provider, err := NewCIProvider(tt.name, config, tt.github)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewCIProvider(%q) error = nil, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewCIProvider(%q) error = %v", tt.name, err)
+		}
+
+		got := ""
+		if provider != nil {
+			got = provider.Name()
+		}
+		if got != tt.want {
+			t.Errorf("NewCIProvider(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := NewCIProvider(CIProviderLocal, &Config{}, nil); err == nil {
+		t.Error("NewCIProvider(local) without commands error = nil, want an error")
+	}
+}
+
+func TestGitHubActionsCI_WaitForRuns(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}}
+	ci := NewGitHubActionsCI(github, &Config{CIPollInterval: time.Millisecond, CITimeout: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	runs, err := ci.WaitForRuns(ctx, CITarget{RepoURL: "https://github.com/acme/api", Branch: "amp/1", SHA: "sha-2"})
+	if err != nil {
+		t.Fatalf("WaitForRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != 102 || runs[0].Conclusion != "success" {
+		t.Errorf("runs = %+v, want the run of sha-2", runs)
+	}
+
+	// A commit CI never picks up times out
+	_, err = ci.WaitForRuns(ctx, CITarget{RepoURL: "https://github.com/acme/api", Branch: "amp/1", SHA: "sha-9"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("WaitForRuns(unknown commit) error = %v, want a timeout", err)
+	}
+}
+
+func TestHostedCI_NoRuns(t *testing.T) {
+	// A repository without workflows never gets a run for the commit
+	github := &fakeGitHubOps{}
+	ci := NewGitHubActionsCI(github, &Config{CIPollInterval: time.Millisecond, CITimeout: time.Second, CIStartTimeout: 20 * time.Millisecond})
+
+	start := time.Now()
+	runs, err := ci.WaitForRuns(context.Background(), CITarget{RepoURL: "https://github.com/acme/api", Branch: "amp/1", SHA: "sha-1"})
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("WaitForRuns() = %+v, %v, want no runs and no error", runs, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed >= time.Second {
+		t.Errorf("WaitForRuns() returned after %v, want once the start timeout passed", elapsed)
+	}
+
+	// The task passes without CI, saying why
+	processor, taskSvc, _, _ := newTestProcessor(t, &fakeGitHubOps{})
+	processor.ciProvider = ci
+	result := processor.Execute(context.Background())
+	if result.Status != models.TaskStatusSuccess || processor.task.CIRunID != nil {
+		t.Fatalf("result = %s (%v), CIRunID = %v, want success without a CI run", result.Status, result.Error, processor.task.CIRunID)
+	}
+	if logs := strings.Join(taskSvc.logs, "\n"); !strings.Contains(logs, "warn: No CI runs started on sha-1") {
+		t.Errorf("logs = %q, want the missing CI logged", taskSvc.logs)
+	}
+}
+
+func TestFailedRuns(t *testing.T) {
+	runs := []WorkflowRun{
+		{ID: 1, Conclusion: "success"},
+		{ID: 2, Conclusion: "failure"},
+		{ID: 3, Conclusion: "skipped"},
+		{ID: 4, Conclusion: "timed_out"},
+	}
+
+	failed := failedRuns(runs)
+	if len(failed) != 2 || failed[0].ID != 2 || failed[1].ID != 4 {
+		t.Errorf("failedRuns() = %+v, want runs 2 and 4", failed)
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// Environment variables through which the command agent receives its prompt
+const (
+	agentPromptEnv     = "AGENT_PROMPT"
+	agentPromptFileEnv = "AGENT_PROMPT_FILE"
+)
+
+// promptFilePlaceholder is replaced by the prompt file's path in command arguments
+const promptFilePlaceholder = "{prompt_file}"
+
+// commandAgent runs an arbitrary coding agent command in the repository. The
+// prompt is passed in AGENT_PROMPT and written to the file named by
+// AGENT_PROMPT_FILE, whose path also replaces {prompt_file} in the arguments.
+type commandAgent struct {
+	args []string
+}
+
+// NewCommandAgent creates an agent that runs command, split on whitespace
+func NewCommandAgent(command string) (AmpOperations, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no agent command configured")
+	}
+
+	return &commandAgent{args: args}, nil
+}
+
+// CheckInstallation verifies that the command can be found
+func (c *commandAgent) CheckInstallation() error {
+	if _, err := exec.LookPath(c.args[0]); err != nil {
+		return fmt.Errorf("agent command not found: %w", err)
+	}
+	return nil
+}
+
+// CreateThread reports that generic commands have no conversation threads
+func (c *commandAgent) CreateThread(ctx context.Context, repoDir string, env []string) (string, error) {
+	return "", ErrThreadsUnsupported
+}
+
+// ExecutePrompt runs the command in repoDir and reports the files it changed
+func (c *commandAgent) ExecutePrompt(ctx context.Context, repoDir, prompt string, opts PromptOptions) (*AmpResult, error) {
+	result := &AmpResult{}
+
+	// Keep the prompt file out of the repository so it is never committed
+	promptFile, err := os.CreateTemp(envValue(opts.Env, "TMPDIR"), "prompt-*.md")
+	if err != nil {
+		result.Error = fmt.Errorf("failed to create prompt file: %w", err)
+		return result, result.Error
+	}
+	defer os.Remove(promptFile.Name())
+
+	_, err = promptFile.WriteString(prompt)
+	if closeErr := promptFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.Error = fmt.Errorf("failed to write prompt file: %w", err)
+		return result, result.Error
+	}
+
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = strings.ReplaceAll(arg, promptFilePlaceholder, promptFile.Name())
+	}
+
+	limited := newLimitedCommand(ctx, opts.Limits, args[0], args[1:]...)
+	cmd := limited.cmd
+	cmd.Dir = repoDir
+	cmd.Env = childEnvironment(opts.Env...)
+	cmd.Env = append(cmd.Env,
+		agentPromptEnv+"="+prompt,
+		agentPromptFileEnv+"="+promptFile.Name(),
+	)
+
+	var combined syncBuffer
+	stdout := newLineWriter(models.LogStreamStdout, opts.OnOutput, &combined)
+	stderr := newLineWriter(models.LogStreamStderr, opts.OnOutput, &combined)
+	cmd.Stdout = limited.limitOutput(stdout)
+	cmd.Stderr = limited.limitOutput(stderr)
+
+	err = limited.Run()
+	stdout.Flush()
+	stderr.Flush()
+	result.Output = combined.String()
+
+	if err != nil {
+		result.Error = fmt.Errorf("agent command failed: %w", err)
+		result.Message = fmt.Sprintf("Agent execution failed: %s", truncateString(strings.TrimSpace(result.Output), 500))
+		return result, result.Error
+	}
+
+	changedFiles, err := detectChangedFiles(repoDir)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to detect changed files: %w", err)
+		return result, result.Error
+	}
+
+	// A command has no output format to interpret, so success means it changed something
+	result.FilesChanged = changedFiles
+	result.Success = len(changedFiles) > 0
+	if result.Success {
+		result.Message = fmt.Sprintf("Agent completed successfully, %d files changed", len(changedFiles))
+	} else {
+		result.Message = "Agent completed but no files were changed"
+	}
+
+	return result, nil
+}
+
+// envValue returns the last value of key in env, or "" if it is not set
+func envValue(env []string, key string) string {
+	value := ""
+	for _, entry := range env {
+		if name, v, ok := strings.Cut(entry, "="); ok && name == key {
+			value = v
+		}
+	}
+	return value
+}
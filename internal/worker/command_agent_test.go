@@ -0,0 +1,77 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandAgent_ExecutePrompt(t *testing.T) {
+	binDir := t.TempDir()
+	repoDir := t.TempDir()
+	tmpDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	// The agent sees the prompt in the environment, in a file and as an argument
+	script := filepath.Join(binDir, "my-agent")
+	os.WriteFile(script, []byte(`#!/bin/sh
+echo "env: $AGENT_PROMPT" > from-env.txt
+cp "$AGENT_PROMPT_FILE" from-file.txt
+cp "$1" from-arg.txt
+echo "done"
+`), 0755)
+
+	agent, err := NewCommandAgent(script + " {prompt_file}")
+	if err != nil {
+		t.Fatalf("NewCommandAgent() error = %v", err)
+	}
+
+	var lines []string
+	result, err := agent.ExecutePrompt(context.Background(), repoDir, "fix the build", PromptOptions{
+		Env:      []string{"TMPDIR=" + tmpDir},
+		OnOutput: func(stream, line string) { lines = append(lines, stream+": "+line) },
+	})
+	if err != nil {
+		t.Fatalf("ExecutePrompt() error = %v", err)
+	}
+
+	for file, want := range map[string]string{
+		"from-env.txt":  "env: fix the build\n",
+		"from-file.txt": "fix the build",
+		"from-arg.txt":  "fix the build",
+	} {
+		got, _ := os.ReadFile(filepath.Join(repoDir, file))
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+	if !result.Success || len(result.FilesChanged) != 3 {
+		t.Errorf("result = %+v, want success with three changed files", result)
+	}
+	if strings.Join(lines, "\n") != "stdout: done" {
+		t.Errorf("streamed lines = %q, want the command's output", lines)
+	}
+
+	// The prompt file lives in the task's TMPDIR and is removed afterwards
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("TMPDIR still holds %d entries, want the prompt file removed", len(entries))
+	}
+}
+
+func TestCommandAgent_NoChanges(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	agent, _ := NewCommandAgent("true")
+	result, err := agent.ExecutePrompt(context.Background(), repoDir, "do nothing", PromptOptions{})
+	if err != nil {
+		t.Fatalf("ExecutePrompt() error = %v", err)
+	}
+	if result.Success {
+		t.Errorf("result = %+v, want no success without changes", result)
+	}
+}
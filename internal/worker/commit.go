@@ -0,0 +1,320 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultCommitAuthor is the identity of commits when none is configured
+	DefaultCommitAuthor = "Amp Worker <amp-worker@example.com>"
+	// DefaultCommitTemplate renders the commit message when none is configured
+	DefaultCommitTemplate = "Amp task {{.TaskID}} (attempt {{.Attempt}}): {{.Subject}}"
+)
+
+// Commit signing methods
+const (
+	CommitSigningSSH = "ssh"
+	CommitSigningGPG = "gpg"
+)
+
+// CommitSettings controls the commits the worker makes: who they are by, how
+// they are signed and what their messages say. The worker's settings apply to
+// every repository; an entry in the hooks file or a repository's own
+// .ampx.json overrides them field by field, though only the worker's own
+// configuration may sign commits.
+type CommitSettings struct {
+	// Author as "Name <email>" (default: Amp Worker <amp-worker@example.com>)
+	Author string `json:"author,omitempty"`
+	// Committer as "Name <email>" (default: the author)
+	Committer string `json:"committer,omitempty"`
+	// How commits are signed: ssh, gpg, or empty for unsigned commits
+	Signing string `json:"signing,omitempty"`
+	// Path of the SSH private key, or the ID of a key in the worker's GPG
+	// keyring
+	SigningKey string `json:"signing_key,omitempty"`
+	// Go text/template of the commit message, given a commitMessageData;
+	// Task-ID and Co-authored-by trailers are appended to it
+	Template string `json:"template,omitempty"`
+	// Co-authors credited in Co-authored-by trailers, as "Name <email>"
+	CoAuthors []string `json:"co_authors,omitempty"`
+	// Squash the task's commits into one before its pull request is opened
+	Squash *bool `json:"squash,omitempty"`
+}
+
+// commitMessageData is what commit message templates are rendered with
+type commitMessageData struct {
+	TaskID  string
+	Attempt int
+	// First line of the prompt, shortened to 50 characters
+	Subject string
+	Prompt  string
+	// The agent's own account of its run, if it gave one
+	Summary string
+	Repo    string
+	Branch  string
+}
+
+// merge returns s with the fields set in override replacing its own
+func (s CommitSettings) merge(override *CommitSettings) CommitSettings {
+	if override == nil {
+		return s
+	}
+
+	merged := s
+	if override.Author != "" {
+		merged.Author = override.Author
+	}
+	if override.Committer != "" {
+		merged.Committer = override.Committer
+	}
+	if override.Signing != "" {
+		merged.Signing = override.Signing
+		merged.SigningKey = override.SigningKey
+	}
+	if override.Template != "" {
+		merged.Template = override.Template
+	}
+	if override.CoAuthors != nil {
+		merged.CoAuthors = override.CoAuthors
+	}
+	if override.Squash != nil {
+		merged.Squash = override.Squash
+	}
+	return merged
+}
+
+// Validate checks the identities, the signing method and the message template
+func (s CommitSettings) Validate() error {
+	identities := append([]string{s.Author, s.Committer}, s.CoAuthors...)
+	for _, identity := range identities {
+		if identity == "" {
+			continue
+		}
+		if _, _, err := parseIdentity(identity); err != nil {
+			return err
+		}
+	}
+
+	switch s.Signing {
+	case "":
+	case CommitSigningSSH, CommitSigningGPG:
+		if s.SigningKey == "" {
+			return fmt.Errorf("%s commit signing requires a signing key", s.Signing)
+		}
+	default:
+		return fmt.Errorf("unknown commit signing %q (available: %s, %s)", s.Signing, CommitSigningSSH, CommitSigningGPG)
+	}
+
+	if _, err := s.template(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// squash reports whether the task's commits are squashed before its pull request
+func (s CommitSettings) squash() bool {
+	return s.Squash != nil && *s.Squash
+}
+
+// template parses the message template, falling back to the default
+func (s CommitSettings) template() (*template.Template, error) {
+	text := s.Template
+	if text == "" {
+		text = DefaultCommitTemplate
+	}
+
+	tmpl, err := template.New("commit").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// message renders the commit message and appends its trailers
+func (s CommitSettings) message(data commitMessageData) (string, error) {
+	tmpl, err := s.template()
+	if err != nil {
+		return "", err
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %w", err)
+	}
+	message := strings.TrimSpace(rendered.String())
+	if message == "" {
+		return "", fmt.Errorf("commit message template rendered an empty message")
+	}
+
+	trailers := []string{"Task-ID: " + data.TaskID}
+	for _, coAuthor := range s.CoAuthors {
+		trailers = append(trailers, "Co-authored-by: "+coAuthor)
+	}
+	return message + "\n\n" + strings.Join(trailers, "\n"), nil
+}
+
+// identities returns the author and committer, falling back to the defaults
+func (s CommitSettings) identities() (author, committer string) {
+	author = s.Author
+	if author == "" {
+		author = DefaultCommitAuthor
+	}
+	committer = s.Committer
+	if committer == "" {
+		committer = author
+	}
+	return author, committer
+}
+
+// identityEnv returns the environment that makes git commit as the author
+// and committer
+func (s CommitSettings) identityEnv() []string {
+	author, committer := s.identities()
+
+	// Identities are validated before any commit is made
+	authorName, authorEmail, _ := parseIdentity(author)
+	committerName, committerEmail, _ := parseIdentity(committer)
+	return []string{
+		"GIT_AUTHOR_NAME=" + authorName,
+		"GIT_AUTHOR_EMAIL=" + authorEmail,
+		"GIT_COMMITTER_NAME=" + committerName,
+		"GIT_COMMITTER_EMAIL=" + committerEmail,
+	}
+}
+
+// signingConfig returns the git configuration that signs commits as
+// configured; it turns signing off otherwise so that the worker's own git
+// configuration cannot ask for a key it does not have
+func (s CommitSettings) signingConfig() map[string]string {
+	switch s.Signing {
+	case CommitSigningSSH:
+		return map[string]string{"gpg.format": "ssh", "user.signingkey": s.SigningKey, "commit.gpgsign": "true"}
+	case CommitSigningGPG:
+		return map[string]string{"gpg.format": "openpgp", "user.signingkey": s.SigningKey, "commit.gpgsign": "true"}
+	default:
+		return map[string]string{"commit.gpgsign": "false"}
+	}
+}
+
+// parseIdentity splits "Name <email>" into its name and email address
+func parseIdentity(identity string) (name, email string, err error) {
+	address, err := mail.ParseAddress(identity)
+	if err != nil || address.Name == "" {
+		return "", "", fmt.Errorf("invalid commit identity %q: must be 'Name <email>'", identity)
+	}
+	return address.Name, address.Address, nil
+}
+
+// commit records the staged changes with message as settings say
+func (g *gitOperations) commit(ctx context.Context, repoDir, message string, settings CommitSettings) error {
+	config := settings.signingConfig()
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, "-c", key+"="+config[key])
+	}
+	args = append(args, "commit", "-m", message)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoDir
+	cmd.Env = childEnvironment(settings.identityEnv()...)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git commit failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+// SquashBranch squashes the commits on the branch since it left baseRef into
+// one commit with message and force-pushes it, returning how many commits
+// were squashed. A branch with a single commit is left alone. If the squash
+// cannot be committed or pushed the branch is put back as it was, so it still
+// follows the branch on origin.
+func (g *gitOperations) SquashBranch(ctx context.Context, repoDir, branchName, baseRef, message string, settings CommitSettings) (int, error) {
+	base, err := g.gitOutput(ctx, repoDir, "merge-base", "HEAD", baseRef)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find where the branch left %s: %w", baseRef, err)
+	}
+	count, err := g.gitOutput(ctx, repoDir, "rev-list", "--count", base+"..HEAD")
+	if err != nil {
+		return 0, fmt.Errorf("failed to count commits: %w", err)
+	}
+	commits, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count commits: %w", err)
+	}
+	if commits <= 1 {
+		return 0, nil
+	}
+	head, err := g.gitOutput(ctx, repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get commit hash: %w", err)
+	}
+
+	if err := g.reset(ctx, repoDir, "--soft", base); err != nil {
+		return 0, err
+	}
+	if err := g.commit(ctx, repoDir, message, settings); err != nil {
+		return 0, g.restoreHead(repoDir, head, err)
+	}
+
+	// The lease refuses the push if anyone else pushed to the branch since
+	pushCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	cmd, err := g.remoteCommand(pushCtx, "push", "--force-with-lease", "origin", branchName)
+	if err != nil {
+		return 0, g.restoreHead(repoDir, head, err)
+	}
+	cmd.Dir = repoDir
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return 0, g.restoreHead(repoDir, head, fmt.Errorf("git push failed: %w (output: %s)", err, string(output)))
+	}
+	return commits, nil
+}
+
+// reset runs git reset with args
+func (g *gitOperations) reset(ctx context.Context, repoDir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"reset"}, args...)...)
+	cmd.Dir = repoDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+// restoreHead puts the branch back on head after a failed squash and returns
+// the squash's error. It runs even when ctx is done, since a cancelled push
+// must not leave the rewritten history behind.
+func (g *gitOperations) restoreHead(repoDir, head string, cause error) error {
+	if err := g.reset(context.Background(), repoDir, "--hard", head); err != nil {
+		return fmt.Errorf("%w; restoring the branch also failed: %v", cause, err)
+	}
+	return cause
+}
+
+// gitOutput runs a git command that prints a single value and returns it
+func (g *gitOperations) gitOutput(ctx context.Context, repoDir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoDir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommitSettingsMessage(t *testing.T) {
+	data := commitMessageData{
+		TaskID:  "01TESTTASK",
+		Attempt: 2,
+		Subject: "Migrate Mocha tests to Vitest",
+		Summary: "Replaced the Mocha runner and updated 12 test files",
+	}
+
+	tests := []struct {
+		name     string
+		settings CommitSettings
+		want     string
+	}{
+		{
+			name: "default template",
+			want: "Amp task 01TESTTASK (attempt 2): Migrate Mocha tests to Vitest\n\nTask-ID: 01TESTTASK",
+		},
+		{
+			name: "conventional commit with summary and co-authors",
+			settings: CommitSettings{
+				Template:  "chore(tests): {{.Subject}}\n\n{{.Summary}}\n",
+				CoAuthors: []string{"Dana Reviewer <dana@example.com>", "Sam Lead <sam@example.com>"},
+			},
+			want: "chore(tests): Migrate Mocha tests to Vitest\n\nReplaced the Mocha runner and updated 12 test files\n\n" +
+				"Task-ID: 01TESTTASK\nCo-authored-by: Dana Reviewer <dana@example.com>\nCo-authored-by: Sam Lead <sam@example.com>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.settings.message(data)
+			if err != nil {
+				t.Fatalf("message() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (CommitSettings{Template: "{{.Title}}"}).message(data); err == nil {
+		t.Error("message() with an unknown field error = nil, want an error")
+	}
+}
+
+func TestCommitSettingsValidate(t *testing.T) {
+	tests := map[string]struct {
+		settings CommitSettings
+		wantErr  string
+	}{
+		"defaults":            {CommitSettings{}, ""},
+		"ssh signing":         {CommitSettings{Author: "Release Bot <bot@example.com>", Signing: "ssh", SigningKey: "/keys/id_ed25519"}, ""},
+		"author without name": {CommitSettings{Author: "bot@example.com"}, "must be 'Name <email>'"},
+		"bad co-author":       {CommitSettings{CoAuthors: []string{"Dana"}}, "invalid commit identity"},
+		"signing without key": {CommitSettings{Signing: "gpg"}, "requires a signing key"},
+		"unknown signing":     {CommitSettings{Signing: "x509", SigningKey: "key"}, "unknown commit signing"},
+		"malformed template":  {CommitSettings{Template: "{{.Subject"}, "invalid commit message template"},
+	}
+
+	for name, tt := range tests {
+		err := tt.settings.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: Validate() error = %v", name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: Validate() error = %v, want it to mention %q", name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCommitSettingsMerge(t *testing.T) {
+	squash := true
+	worker := CommitSettings{
+		Author:     "Amp Bot <amp@example.com>",
+		Signing:    "ssh",
+		SigningKey: "/keys/id_ed25519",
+		CoAuthors:  []string{"Dana Reviewer <dana@example.com>"},
+	}
+
+	merged := worker.merge(&CommitSettings{Template: "feat: {{.Subject}}", CoAuthors: []string{}, Squash: &squash})
+
+	if merged.Author != worker.Author || merged.SigningKey != worker.SigningKey {
+		t.Errorf("merged = %+v, want the worker's identity and signing kept", merged)
+	}
+	if merged.Template != "feat: {{.Subject}}" || len(merged.CoAuthors) != 0 || !merged.squash() {
+		t.Errorf("merged = %+v, want the repository's template, co-authors and squash", merged)
+	}
+	if got := worker.merge(nil); got.Author != worker.Author {
+		t.Errorf("merge(nil) = %+v, want the worker's settings", got)
+	}
+}
@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// maxDiffPatchBytes caps the unified diff stored for an attempt; the list of
+// changed files is always complete
+const maxDiffPatchBytes = 1 << 20
+
+// CaptureDiff records what the branch changes since it left baseRef: the
+// files it touches with their line counts, and the unified diff. The caller
+// fills in the task and attempt.
+func (g *gitOperations) CaptureDiff(ctx context.Context, repoDir, baseRef string) (*models.TaskDiff, error) {
+	base, err := g.gitOutput(ctx, repoDir, "merge-base", "HEAD", baseRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find where the branch left %s: %w", baseRef, err)
+	}
+	head, err := g.gitOutput(ctx, repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit hash: %w", err)
+	}
+
+	numstat, err := g.gitDiff(ctx, repoDir, "--numstat", "-z", base, head)
+	if err != nil {
+		return nil, err
+	}
+	nameStatus, err := g.gitDiff(ctx, repoDir, "--name-status", "-z", base, head)
+	if err != nil {
+		return nil, err
+	}
+	files, err := parseDiffFiles(numstat, nameStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := g.gitDiff(ctx, repoDir, base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &models.TaskDiff{
+		BaseRef: baseRef,
+		BaseSHA: base,
+		HeadSHA: head,
+		Files:   files,
+	}
+	for _, file := range files {
+		diff.Additions += file.Additions
+		diff.Deletions += file.Deletions
+	}
+	if len(patch) > maxDiffPatchBytes {
+		// Cut at a line boundary so the patch stays readable
+		patch = patch[:bytes.LastIndexByte(patch[:maxDiffPatchBytes], '\n')+1]
+		diff.Truncated = true
+	}
+	diff.Patch = string(patch)
+
+	return diff, nil
+}
+
+// gitDiff runs git diff with rename detection and returns its raw output
+func (g *gitOperations) gitDiff(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"diff", "--find-renames", "--no-color", "--no-ext-diff"}, args...)...)
+	cmd.Dir = repoDir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+	return output, nil
+}
+
+// parseDiffFiles combines the -z output of git diff --numstat and
+// --name-status into the changed files, in git's order
+func parseDiffFiles(numstat, nameStatus []byte) ([]models.DiffFile, error) {
+	statuses, err := parseNameStatus(nameStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := splitNul(numstat)
+	files := make([]models.DiffFile, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		counts := strings.SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			return nil, fmt.Errorf("unexpected git diff --numstat output: %q", fields[i])
+		}
+
+		file := models.DiffFile{Path: counts[2], Status: models.DiffFileModified}
+		// A renamed file has an empty path followed by its old and new paths
+		if file.Path == "" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff --numstat output: rename without paths")
+			}
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i += 2
+		}
+		if status, ok := statuses[file.Path]; ok {
+			file.Status = status
+		}
+
+		// Binary files are counted as "-"
+		if counts[0] == "-" {
+			file.Binary = true
+		} else {
+			if file.Additions, err = strconv.Atoi(counts[0]); err != nil {
+				return nil, fmt.Errorf("unexpected git diff --numstat output: %q", fields[i])
+			}
+			if file.Deletions, err = strconv.Atoi(counts[1]); err != nil {
+				return nil, fmt.Errorf("unexpected git diff --numstat output: %q", fields[i])
+			}
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// parseNameStatus maps each path in the -z output of git diff --name-status
+// to its DiffFile status
+func parseNameStatus(output []byte) (map[string]string, error) {
+	fields := splitNul(output)
+	statuses := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i++ {
+		code := fields[i]
+		if code == "" || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff --name-status output: %q", code)
+		}
+
+		switch code[0] {
+		case 'R', 'C':
+			// Followed by the old and the new path
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff --name-status output: %q without paths", code)
+			}
+			statuses[fields[i+2]] = models.DiffFileRenamed
+			if code[0] == 'C' {
+				// A copy leaves its source in place
+				statuses[fields[i+2]] = models.DiffFileAdded
+			}
+			i += 2
+		case 'A':
+			statuses[fields[i+1]] = models.DiffFileAdded
+			i++
+		case 'D':
+			statuses[fields[i+1]] = models.DiffFileDeleted
+			i++
+		default:
+			statuses[fields[i+1]] = models.DiffFileModified
+			i++
+		}
+	}
+
+	return statuses, nil
+}
+
+// splitNul splits NUL-terminated fields, returning nothing for empty output
+func splitNul(output []byte) []string {
+	text := strings.TrimSuffix(string(output), "\x00")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\x00")
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestCaptureDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	ctx := context.Background()
+
+	origin := t.TempDir()
+	runGit(t, origin, "init", "-q", "--bare")
+	seed := t.TempDir()
+	runGit(t, seed, "init", "-q")
+	os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644)
+	os.WriteFile(filepath.Join(seed, "old notes.md"), []byte("one\ntwo\nthree\nfour\nfive\n"), 0644)
+	os.WriteFile(filepath.Join(seed, "obsolete.txt"), []byte("bye\n"), 0644)
+	runGit(t, seed, "add", ".")
+	runGit(t, seed, "commit", "-q", "-m", "initial")
+	runGit(t, seed, "push", "-q", origin, "HEAD:refs/heads/main")
+	runGit(t, origin, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	gitOps := NewGitOperations()
+	if err := gitOps.CloneRepository(ctx, origin, repoDir); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+	if err := gitOps.CreateBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("CreateBranch() error = %v", err)
+	}
+
+	os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("hello, world\nsecond line\n"), 0644)
+	os.Rename(filepath.Join(repoDir, "old notes.md"), filepath.Join(repoDir, "notes.md"))
+	os.Remove(filepath.Join(repoDir, "obsolete.txt"))
+	os.WriteFile(filepath.Join(repoDir, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0, 0, 1}, 0644)
+	if err := gitOps.CommitChanges(ctx, repoDir, "attempt 1", CommitSettings{}); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+
+	diff, err := gitOps.CaptureDiff(ctx, repoDir, "origin/HEAD")
+	if err != nil {
+		t.Fatalf("CaptureDiff() error = %v", err)
+	}
+
+	want := []models.DiffFile{
+		{Path: "README.md", Status: models.DiffFileModified, Additions: 2, Deletions: 1},
+		{Path: "logo.png", Status: models.DiffFileAdded, Binary: true},
+		{Path: "notes.md", OldPath: "old notes.md", Status: models.DiffFileRenamed},
+		{Path: "obsolete.txt", Status: models.DiffFileDeleted, Deletions: 1},
+	}
+	if !reflect.DeepEqual(diff.Files, want) {
+		t.Errorf("Files = %+v, want %+v", diff.Files, want)
+	}
+	if diff.Additions != 2 || diff.Deletions != 2 {
+		t.Errorf("diffstat = +%d -%d, want +2 -2", diff.Additions, diff.Deletions)
+	}
+	if diff.BaseSHA != runGit(t, repoDir, "rev-parse", "origin/main") || diff.HeadSHA != runGit(t, repoDir, "rev-parse", "HEAD") {
+		t.Errorf("diff is of %s..%s, want origin/main..HEAD", diff.BaseSHA, diff.HeadSHA)
+	}
+	if !strings.Contains(diff.Patch, "+hello, world\n") || !strings.Contains(diff.Patch, "rename from old notes.md") || diff.Truncated {
+		t.Errorf("Patch = %q, want the whole unified diff", diff.Patch)
+	}
+
+	// A patch too large to store is cut short, but every file is still listed
+	huge := strings.Repeat("generated\n", maxDiffPatchBytes/10+1)
+	os.WriteFile(filepath.Join(repoDir, "generated.txt"), []byte(huge), 0644)
+	if err := gitOps.CommitChanges(ctx, repoDir, "attempt 2", CommitSettings{}); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+	diff, err = gitOps.CaptureDiff(ctx, repoDir, "origin/HEAD")
+	if err != nil {
+		t.Fatalf("CaptureDiff() error = %v", err)
+	}
+	if !diff.Truncated || len(diff.Patch) > maxDiffPatchBytes || !strings.HasSuffix(diff.Patch, "\n") {
+		t.Errorf("patch of %d bytes, truncated = %v, want it cut at a line within %d bytes", len(diff.Patch), diff.Truncated, maxDiffPatchBytes)
+	}
+	if len(diff.Files) != 5 {
+		t.Errorf("Files = %d, want all 5 files listed", len(diff.Files))
+	}
+}
+
+func TestParseDiffFiles(t *testing.T) {
+	numstat := "3\t1\tmain.go\x00-\t-\tlogo.png\x000\t0\t\x00a/old.go\x00a/new.go\x00"
+	nameStatus := "M\x00main.go\x00A\x00logo.png\x00R100\x00a/old.go\x00a/new.go\x00"
+
+	files, err := parseDiffFiles([]byte(numstat), []byte(nameStatus))
+	if err != nil {
+		t.Fatalf("parseDiffFiles() error = %v", err)
+	}
+	want := []models.DiffFile{
+		{Path: "main.go", Status: models.DiffFileModified, Additions: 3, Deletions: 1},
+		{Path: "logo.png", Status: models.DiffFileAdded, Binary: true},
+		{Path: "a/new.go", OldPath: "a/old.go", Status: models.DiffFileRenamed},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("parseDiffFiles() = %+v, want %+v", files, want)
+	}
+
+	if files, err := parseDiffFiles(nil, nil); err != nil || len(files) != 0 {
+		t.Errorf("parseDiffFiles(empty) = %+v, %v, want no files", files, err)
+	}
+	if _, err := parseDiffFiles([]byte("garbage\x00"), nil); err == nil {
+		t.Error("parseDiffFiles(garbage) error = nil, want an error")
+	}
+}
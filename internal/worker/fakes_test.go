@@ -0,0 +1,307 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+// localRepoHosts allows the local repositories tests clone from
+func localRepoHosts() repourl.Hosts {
+	hosts := repourl.DefaultHosts()
+	hosts.AllowLocal()
+	return hosts
+}
+
+// fakeTaskService records task updates and logs in memory
+type fakeTaskService struct {
+	mu       sync.Mutex
+	queue    []*models.Task
+	statuses []models.TaskStatus
+	prompts  []string
+	logs     []string
+	renewals int
+	renewErr error
+	released []string
+	updated  []*models.Task
+	aborted  bool
+	entries  []*models.TaskLog
+	diffs    []*models.TaskDiff
+	batches  int
+}
+
+func (f *fakeTaskService) ClaimNextTask(ctx context.Context, workerID string, leaseDuration time.Duration) (*models.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) == 0 {
+		return nil, nil
+	}
+	task := f.queue[0]
+	f.queue = f.queue[1:]
+	task.Status = models.TaskStatusRunning
+	task.ClaimedBy = workerID
+	return task, nil
+}
+
+func (f *fakeTaskService) RenewLease(ctx context.Context, taskID, workerID string, leaseDuration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewals++
+	return f.renewErr
+}
+
+func (f *fakeTaskService) ReleaseTask(ctx context.Context, taskID, workerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, taskID)
+	return nil
+}
+
+func (f *fakeTaskService) ReapExpiredTasks(ctx context.Context, maxAttempts int) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeTaskService) UpdateTaskStatus(ctx context.Context, taskID string, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, models.TaskStatus(status))
+	return nil
+}
+
+func (f *fakeTaskService) ReportTask(ctx context.Context, task *models.Task, workerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.aborted && task.Status != models.TaskStatusAborted {
+		return services.ErrTaskAborted
+	}
+	f.statuses = append(f.statuses, task.Status)
+	f.prompts = append(f.prompts, task.Prompt)
+	f.updated = append(f.updated, task)
+	return nil
+}
+
+func (f *fakeTaskService) AddTaskLogEntries(ctx context.Context, taskID string, entries []*models.TaskLog) error {
+	// Like a request to the orchestrator, nothing is sent once ctx is done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, entries...)
+	f.batches++
+	return nil
+}
+
+func (f *fakeTaskService) SaveTaskDiff(ctx context.Context, diff *models.TaskDiff) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.diffs = append(f.diffs, diff)
+	return nil
+}
+
+func (f *fakeTaskService) GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.aborted {
+		return models.TaskStatusAborted, nil
+	}
+	return models.TaskStatusRunning, nil
+}
+
+func (f *fakeTaskService) AddTaskLog(ctx context.Context, taskID string, level, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs = append(f.logs, level+": "+message)
+	return nil
+}
+
+// fakeGitOps simulates a repository where every commit gets a predictable SHA.
+// Branches in remote exist on origin; pushed branches are added to it.
+type fakeGitOps struct {
+	mu         sync.Mutex
+	commits    []string
+	pushes     int
+	remote     map[string]bool
+	created    []string
+	pushedTo   []string
+	checkedOut []string
+	// Base refs the branch was squashed onto
+	squashedOnto []string
+	// Number of commits made, including squashes; names the HEAD commit
+	head int
+}
+
+func (f *fakeGitOps) CloneRepository(ctx context.Context, repoURL, destDir string) error {
+	return os.MkdirAll(destDir, 0755)
+}
+
+func (f *fakeGitOps) CreateBranch(ctx context.Context, repoDir, branchName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, branchName)
+	return nil
+}
+
+func (f *fakeGitOps) CheckoutRemoteBranch(ctx context.Context, repoDir, branchName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.remote[branchName] {
+		f.checkedOut = append(f.checkedOut, branchName)
+	}
+	return f.remote[branchName], nil
+}
+
+func (f *fakeGitOps) CommitChanges(ctx context.Context, repoDir, message string, settings CommitSettings) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commits = append(f.commits, message)
+	f.head++
+	return nil
+}
+
+func (f *fakeGitOps) SquashBranch(ctx context.Context, repoDir, branchName, baseRef, message string, settings CommitSettings) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.squashedOnto = append(f.squashedOnto, baseRef)
+	squashed := len(f.commits)
+	if squashed <= 1 {
+		return 0, nil
+	}
+	f.commits = []string{message}
+	f.head++
+	return squashed, nil
+}
+
+func (f *fakeGitOps) PushBranch(ctx context.Context, repoDir, branchName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushes++
+	f.pushedTo = append(f.pushedTo, branchName)
+	if f.remote == nil {
+		f.remote = make(map[string]bool)
+	}
+	f.remote[branchName] = true
+	return nil
+}
+
+func (f *fakeGitOps) GetRemoteURL(ctx context.Context, repoDir string) (string, error) {
+	return "https://github.com/acme/api", nil
+}
+
+func (f *fakeGitOps) GetLastCommitHash(ctx context.Context, repoDir string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fmt.Sprintf("sha-%d", f.head), nil
+}
+
+func (f *fakeGitOps) CaptureDiff(ctx context.Context, repoDir, baseRef string) (*models.TaskDiff, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &models.TaskDiff{
+		BaseRef:   baseRef,
+		HeadSHA:   fmt.Sprintf("sha-%d", len(f.commits)),
+		Files:     []models.DiffFile{{Path: "main.go", Status: models.DiffFileModified, Additions: len(f.commits)}},
+		Additions: len(f.commits),
+	}, nil
+}
+
+// fakeAmpOps records the prompts it was given and always reports a change.
+// With block set it runs until its context is cancelled, like a long Amp session.
+// With noThreads set it behaves like an Amp CLI without the threads command.
+type fakeAmpOps struct {
+	mu        sync.Mutex
+	prompts   []string
+	threadIDs []string
+	created   int
+	block     bool
+	noThreads bool
+	limits    []ResourceLimits
+	err       error
+}
+
+func (f *fakeAmpOps) ExecutePrompt(ctx context.Context, repoDir, prompt string, opts PromptOptions) (*AmpResult, error) {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.threadIDs = append(f.threadIDs, opts.ThreadID)
+	f.limits = append(f.limits, opts.Limits)
+	f.mu.Unlock()
+	if opts.OnOutput != nil {
+		opts.OnOutput(models.LogStreamStdout, "Editing main.go")
+		opts.OnOutput(models.LogStreamStderr, "warning: slow test")
+	}
+	if f.block {
+		<-ctx.Done()
+		return &AmpResult{Success: false, Message: "killed"}, ctx.Err()
+	}
+	if f.err != nil {
+		return &AmpResult{Success: false, Message: "stopped"}, f.err
+	}
+	return &AmpResult{Success: true, Message: "changes applied", FilesChanged: []string{"main.go"}}, nil
+}
+
+func (f *fakeAmpOps) CreateThread(ctx context.Context, repoDir string, env []string) (string, error) {
+	if f.noThreads {
+		return "", ErrThreadsUnsupported
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created++
+	return fmt.Sprintf("T-fake-%d", f.created), nil
+}
+
+func (f *fakeAmpOps) CheckInstallation() error {
+	return nil
+}
+
+// fakeGitHubOps reports one workflow run per pushed commit whose conclusion
+// is taken from conclusions in push order
+type fakeGitHubOps struct {
+	mu          sync.Mutex
+	conclusions []string
+	logs        string
+	prs         []string
+	prBases     []string
+	logRequests []int64
+}
+
+func (f *fakeGitHubOps) CreatePullRequest(ctx context.Context, repoURL, baseBranch, headBranch, title, body string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prs = append(f.prs, headBranch)
+	f.prBases = append(f.prBases, baseBranch)
+	return "https://github.com/acme/api/pull/7", nil
+}
+
+func (f *fakeGitHubOps) GetPullRequestStatus(ctx context.Context, prURL string) (string, error) {
+	return "open", nil
+}
+
+func (f *fakeGitHubOps) GetWorkflowRuns(ctx context.Context, repoURL, branchName string) ([]WorkflowRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	runs := make([]WorkflowRun, 0, len(f.conclusions))
+	for i, conclusion := range f.conclusions {
+		runs = append(runs, WorkflowRun{
+			ID:         int64(100 + i + 1),
+			Name:       "CI",
+			HeadBranch: branchName,
+			HeadSHA:    fmt.Sprintf("sha-%d", i+1),
+			Status:     "completed",
+			Conclusion: conclusion,
+		})
+	}
+	return runs, nil
+}
+
+func (f *fakeGitHubOps) GetWorkflowRunLogs(ctx context.Context, repoURL string, runID int64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logRequests = append(f.logRequests, runID)
+	return f.logs, nil
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package worker
+
+import "sync"
+
+// heldLocks records the lock files held by this process
+var heldLocks = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// tryLockFile takes an exclusive lock on path without waiting. Without flock
+// the lock only excludes goroutines in this process.
+func tryLockFile(path string) (func(), error) {
+	heldLocks.Lock()
+	defer heldLocks.Unlock()
+
+	if heldLocks.paths[path] {
+		return nil, nil
+	}
+	heldLocks.paths[path] = true
+
+	return func() {
+		heldLocks.Lock()
+		defer heldLocks.Unlock()
+		delete(heldLocks.paths, path)
+	}, nil
+}
@@ -2,22 +2,93 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
+// askpassScript answers git's username and password prompts from the environment
+const askpassScript = `#!/bin/sh
+case "$1" in
+Username*) printf '%s\n' "$AMP_GIT_USERNAME" ;;
+*) printf '%s\n' "$AMP_GIT_PASSWORD" ;;
+esac
+`
+
+// GitCredentials supplies the username and password for authenticated git operations
+type GitCredentials func(ctx context.Context) (username, password string, err error)
+
 // gitOperations implements the GitOperations interface
-type gitOperations struct{}
+type gitOperations struct {
+	askpassPath string
+	credentials GitCredentials
+	mirrors     *MirrorCache
+}
 
 // NewGitOperations creates a new Git operations instance
 func NewGitOperations() GitOperations {
 	return &gitOperations{}
 }
 
+// NewGitOperationsWithCredentials creates a Git operations instance that
+// authenticates clone and push through the askpass script at askpassPath.
+// Credentials are resolved for every remote operation so short-lived tokens
+// can be refreshed between attempts.
+func NewGitOperationsWithCredentials(askpassPath string, credentials GitCredentials) GitOperations {
+	return &gitOperations{
+		askpassPath: askpassPath,
+		credentials: credentials,
+	}
+}
+
+// WriteAskpassScript writes the GIT_ASKPASS helper into dir and returns its path
+func WriteAskpassScript(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create askpass directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "git-askpass.sh")
+	if err := os.WriteFile(path, []byte(askpassScript), 0700); err != nil {
+		return "", fmt.Errorf("failed to write askpass script: %w", err)
+	}
+
+	return path, nil
+}
+
+// remoteCommand builds a git command that talks to the remote, wiring in
+// credentials when they are configured
+func (g *gitOperations) remoteCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	env := childEnvironment(
+		"GIT_TERMINAL_PROMPT=0", // Disable interactive prompts
+	)
+
+	if g.credentials != nil {
+		username, password, err := g.credentials(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get git credentials: %w", err)
+		}
+
+		// Bypass any configured credential helper so the askpass script is used
+		args = append([]string{"-c", "credential.helper="}, args...)
+		env = append(env,
+			"GIT_ASKPASS="+g.askpassPath,
+			"AMP_GIT_USERNAME="+username,
+			"AMP_GIT_PASSWORD="+password,
+		)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	return cmd, nil
+}
+
 // CloneRepository clones a Git repository to the specified destination
 func (g *gitOperations) CloneRepository(ctx context.Context, repoURL, destDir string) error {
 	// Create parent directory if it doesn't exist
@@ -26,17 +97,28 @@ func (g *gitOperations) CloneRepository(ctx context.Context, repoURL, destDir st
 		return fmt.Errorf("failed to create parent directory: %w", err)
 	}
 	
+	// Clone through the mirror cache when there is one, falling back to the remote
+	if g.mirrors != nil {
+		err := g.cloneFromMirror(ctx, repoURL, destDir)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Mirror cache unavailable for %s, cloning directly: %v", repoURL, err)
+		os.RemoveAll(destDir)
+	}
+	
 	// Add timeout to prevent hanging
 	cloneCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 	
 	// Execute git clone
-	cmd := exec.CommandContext(cloneCtx, "git", "clone", repoURL, destDir)
-	
-	// Set up environment
-	cmd.Env = append(os.Environ(),
-		"GIT_TERMINAL_PROMPT=0", // Disable interactive prompts
-	)
+	cmd, err := g.remoteCommand(cloneCtx, "clone", repoURL, destDir)
+	if err != nil {
+		return err
+	}
 	
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -65,8 +147,40 @@ func (g *gitOperations) CreateBranch(ctx context.Context, repoDir, branchName st
 	return nil
 }
 
-// CommitChanges adds all changes and commits them with the specified message
-func (g *gitOperations) CommitChanges(ctx context.Context, repoDir, message string) error {
+// CheckoutRemoteBranch checks out branchName from origin if it has already
+// been pushed, reporting whether it existed
+func (g *gitOperations) CheckoutRemoteBranch(ctx context.Context, repoDir, branchName string) (bool, error) {
+	if err := g.validateBranchName(branchName); err != nil {
+		return false, err
+	}
+	
+	// The clone fetched every remote branch, so a local lookup is enough
+	remoteRef := "refs/remotes/origin/" + branchName
+	verifyCmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", remoteRef)
+	verifyCmd.Dir = repoDir
+	
+	if err := verifyCmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to look up branch %s: %w", branchName, err)
+	}
+	
+	cmd := exec.CommandContext(ctx, "git", "checkout", "-B", branchName, "--track", "origin/"+branchName)
+	cmd.Dir = repoDir
+	
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to check out branch %s: %w (output: %s)", branchName, err, string(output))
+	}
+	
+	return true, nil
+}
+
+// CommitChanges adds all changes and commits them with the specified message,
+// as the identity and with the signing of settings
+func (g *gitOperations) CommitChanges(ctx context.Context, repoDir, message string, settings CommitSettings) error {
 	// First, add all changes
 	addCmd := exec.CommandContext(ctx, "git", "add", ".")
 	addCmd.Dir = repoDir
@@ -89,22 +203,7 @@ func (g *gitOperations) CommitChanges(ctx context.Context, repoDir, message stri
 	}
 	
 	// Commit the changes
-	commitCmd := exec.CommandContext(ctx, "git", "commit", "-m", message)
-	commitCmd.Dir = repoDir
-	
-	// Configure git user if not already set
-	commitCmd.Env = append(os.Environ(),
-		"GIT_AUTHOR_NAME=Amp Worker",
-		"GIT_AUTHOR_EMAIL=amp-worker@example.com",
-		"GIT_COMMITTER_NAME=Amp Worker",
-		"GIT_COMMITTER_EMAIL=amp-worker@example.com",
-	)
-	
-	if output, err := commitCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git commit failed: %w (output: %s)", err, string(output))
-	}
-	
-	return nil
+	return g.commit(ctx, repoDir, message, settings)
 }
 
 // PushBranch pushes the specified branch to the remote repository
@@ -113,14 +212,12 @@ func (g *gitOperations) PushBranch(ctx context.Context, repoDir, branchName stri
 	pushCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 	
-	cmd := exec.CommandContext(pushCtx, "git", "push", "-u", "origin", branchName)
+	cmd, err := g.remoteCommand(pushCtx, "push", "-u", "origin", branchName)
+	if err != nil {
+		return err
+	}
 	cmd.Dir = repoDir
 	
-	// Set up environment to disable interactive prompts
-	cmd.Env = append(os.Environ(),
-		"GIT_TERMINAL_PROMPT=0",
-	)
-	
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("git push failed: %w (output: %s)", err, string(output))
@@ -186,13 +283,19 @@ func (g *gitOperations) GetLastCommitHash(ctx context.Context, repoDir string) (
 	return strings.TrimSpace(string(output)), nil
 }
 
-// ConfigureRepository sets up basic git configuration for the repository
-func (g *gitOperations) ConfigureRepository(ctx context.Context, repoDir string) error {
-	configs := map[string]string{
-		"user.name":  "Amp Worker",
-		"user.email": "amp-worker@example.com",
+// ConfigureRepository sets up the committer and commit signing of settings
+// as the repository's git configuration
+func (g *gitOperations) ConfigureRepository(ctx context.Context, repoDir string, settings CommitSettings) error {
+	_, committer := settings.identities()
+	name, email, err := parseIdentity(committer)
+	if err != nil {
+		return err
 	}
 	
+	configs := settings.signingConfig()
+	configs["user.name"] = name
+	configs["user.email"] = email
+	
 	for key, value := range configs {
 		cmd := exec.CommandContext(ctx, "git", "config", key, value)
 		cmd.Dir = repoDir
@@ -231,28 +334,15 @@ func (g *gitOperations) validateBranchName(branchName string) error {
 	return nil
 }
 
-// normalizeGitURL converts SSH URLs to HTTPS for web viewing
+// normalizeGitURL converts SSH and clone URLs to HTTPS for web viewing
 func (g *gitOperations) normalizeGitURL(url string) string {
-	// Convert git@github.com:user/repo.git to https://github.com/user/repo
-	if strings.HasPrefix(url, "git@github.com:") {
-		path := strings.TrimPrefix(url, "git@github.com:")
-		path = strings.TrimSuffix(path, ".git")
-		return "https://github.com/" + path
-	}
-	
-	// Convert git@gitlab.com:user/repo.git to https://gitlab.com/user/repo
-	if strings.HasPrefix(url, "git@gitlab.com:") {
-		path := strings.TrimPrefix(url, "git@gitlab.com:")
-		path = strings.TrimSuffix(path, ".git")
-		return "https://gitlab.com/" + path
-	}
-	
-	// Remove .git suffix from HTTPS URLs
-	if strings.HasSuffix(url, ".git") {
+	// Convert e.g. git@gitlab.com:group/repo.git to https://gitlab.com/group/repo
+	ref, err := repourl.Parse(url)
+	if err != nil {
 		return strings.TrimSuffix(url, ".git")
 	}
 	
-	return url
+	return ref.WebURL()
 }
 
 // CleanupRepository performs cleanup operations on the repository
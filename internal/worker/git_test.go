@@ -0,0 +1,241 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs a git command in dir, failing the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v (output: %s)", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestCheckoutRemoteBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	ctx := context.Background()
+
+	// An origin with a task branch one commit ahead of the default branch
+	origin := t.TempDir()
+	runGit(t, origin, "init", "-q")
+	os.WriteFile(filepath.Join(origin, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, origin, "add", ".")
+	runGit(t, origin, "commit", "-q", "-m", "initial")
+	runGit(t, origin, "checkout", "-q", "-b", "amp/01TEST")
+	os.WriteFile(filepath.Join(origin, "fix.go"), []byte("package fix\n"), 0644)
+	runGit(t, origin, "add", ".")
+	runGit(t, origin, "commit", "-q", "-m", "first attempt")
+	branchHead := runGit(t, origin, "rev-parse", "HEAD")
+	runGit(t, origin, "checkout", "-q", "-")
+
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	gitOps := NewGitOperations()
+	if err := gitOps.CloneRepository(ctx, origin, repoDir); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+
+	existing, err := gitOps.CheckoutRemoteBranch(ctx, repoDir, "amp/01TEST")
+	if err != nil {
+		t.Fatalf("CheckoutRemoteBranch() error = %v", err)
+	}
+	if !existing {
+		t.Fatal("CheckoutRemoteBranch() = false, want the pushed branch found")
+	}
+	if head := runGit(t, repoDir, "rev-parse", "HEAD"); head != branchHead {
+		t.Errorf("HEAD = %s, want the branch's previous commit %s", head, branchHead)
+	}
+	if branch := runGit(t, repoDir, "branch", "--show-current"); branch != "amp/01TEST" {
+		t.Errorf("current branch = %s, want amp/01TEST", branch)
+	}
+
+	existing, err = gitOps.CheckoutRemoteBranch(ctx, repoDir, "amp/NEWTASK")
+	if err != nil {
+		t.Fatalf("CheckoutRemoteBranch() error = %v", err)
+	}
+	if existing {
+		t.Error("CheckoutRemoteBranch() = true for a branch that was never pushed")
+	}
+}
+
+func TestCommitChanges_IdentityAndSSHSigning(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skipf("ssh-keygen not available: %v", err)
+	}
+	ctx := context.Background()
+
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed: %v (output: %s)", err, output)
+	}
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-q")
+	os.WriteFile(filepath.Join(repoDir, "fix.go"), []byte("package fix\n"), 0644)
+
+	settings := CommitSettings{
+		Author:     "Release Bot <release-bot@example.com>",
+		Committer:  "CI Signer <ci-signer@example.com>",
+		Signing:    CommitSigningSSH,
+		SigningKey: key,
+	}
+	if err := NewGitOperations().CommitChanges(ctx, repoDir, "fix: add package\n\nTask-ID: 01TEST", settings); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+
+	if got := runGit(t, repoDir, "log", "-1", "--format=%an <%ae>|%cn <%ce>"); got != "Release Bot <release-bot@example.com>|CI Signer <ci-signer@example.com>" {
+		t.Errorf("author|committer = %q, want the configured identities", got)
+	}
+	if commit := runGit(t, repoDir, "cat-file", "commit", "HEAD"); !strings.Contains(commit, "-----BEGIN SSH SIGNATURE-----") {
+		t.Errorf("commit = %q, want an SSH signature", commit)
+	}
+	if trailer := runGit(t, repoDir, "log", "-1", "--format=%(trailers:key=Task-ID,valueonly)"); trailer != "01TEST" {
+		t.Errorf("Task-ID trailer = %q, want 01TEST", trailer)
+	}
+}
+
+func TestSquashBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	ctx := context.Background()
+
+	origin := t.TempDir()
+	runGit(t, origin, "init", "-q", "--bare")
+	seed := t.TempDir()
+	runGit(t, seed, "init", "-q")
+	os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, seed, "add", ".")
+	runGit(t, seed, "commit", "-q", "-m", "initial")
+	runGit(t, seed, "push", "-q", origin, "HEAD:refs/heads/main")
+	runGit(t, origin, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	gitOps := NewGitOperations()
+	if err := gitOps.CloneRepository(ctx, origin, repoDir); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+	if err := gitOps.CreateBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("CreateBranch() error = %v", err)
+	}
+
+	// The first attempt leaves a single commit alone
+	os.WriteFile(filepath.Join(repoDir, "fix.go"), []byte("package fix\n"), 0644)
+	if err := gitOps.CommitChanges(ctx, repoDir, "attempt 1", CommitSettings{}); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+	if err := gitOps.PushBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("PushBranch() error = %v", err)
+	}
+	squashed, err := gitOps.SquashBranch(ctx, repoDir, "amp/01TEST", "origin/HEAD", "squashed", CommitSettings{})
+	if err != nil || squashed != 0 {
+		t.Fatalf("SquashBranch() = %d, %v, want a single commit left alone", squashed, err)
+	}
+
+	os.WriteFile(filepath.Join(repoDir, "fix.go"), []byte("package fix\n\nfunc Fix() {}\n"), 0644)
+	if err := gitOps.CommitChanges(ctx, repoDir, "attempt 2", CommitSettings{}); err != nil {
+		t.Fatalf("CommitChanges() error = %v", err)
+	}
+	if err := gitOps.PushBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("PushBranch() error = %v", err)
+	}
+	tree := runGit(t, repoDir, "rev-parse", "HEAD^{tree}")
+
+	squashed, err = gitOps.SquashBranch(ctx, repoDir, "amp/01TEST", "origin/HEAD", "fix: add Fix\n\nTask-ID: 01TEST", CommitSettings{})
+	if err != nil {
+		t.Fatalf("SquashBranch() error = %v", err)
+	}
+	if squashed != 2 {
+		t.Errorf("squashed = %d, want 2", squashed)
+	}
+	if count := runGit(t, origin, "rev-list", "--count", "main..amp/01TEST"); count != "1" {
+		t.Errorf("pushed branch has %s commits past main, want 1", count)
+	}
+	if got := runGit(t, origin, "rev-parse", "amp/01TEST^{tree}"); got != tree {
+		t.Errorf("pushed tree = %s, want the tree CI passed on %s", got, tree)
+	}
+	if subject := runGit(t, origin, "log", "-1", "--format=%s", "amp/01TEST"); subject != "fix: add Fix" {
+		t.Errorf("pushed subject = %q, want the squashed message", subject)
+	}
+}
+
+func TestSquashBranch_PushRejected(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	ctx := context.Background()
+
+	origin := t.TempDir()
+	runGit(t, origin, "init", "-q", "--bare")
+	seed := t.TempDir()
+	runGit(t, seed, "init", "-q")
+	os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, seed, "add", ".")
+	runGit(t, seed, "commit", "-q", "-m", "initial")
+	runGit(t, seed, "push", "-q", origin, "HEAD:refs/heads/main")
+	runGit(t, origin, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	gitOps := NewGitOperations()
+	if err := gitOps.CloneRepository(ctx, origin, repoDir); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+	if err := gitOps.CreateBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("CreateBranch() error = %v", err)
+	}
+	for i, content := range []string{"package fix\n", "package fix\n\nfunc Fix() {}\n"} {
+		os.WriteFile(filepath.Join(repoDir, "fix.go"), []byte(content), 0644)
+		if err := gitOps.CommitChanges(ctx, repoDir, fmt.Sprintf("attempt %d", i+1), CommitSettings{}); err != nil {
+			t.Fatalf("CommitChanges() error = %v", err)
+		}
+		if i == 0 {
+			if err := gitOps.PushBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+				t.Fatalf("PushBranch() error = %v", err)
+			}
+		}
+	}
+	head := runGit(t, repoDir, "rev-parse", "HEAD")
+
+	// origin refuses the squashed history
+	hook := filepath.Join(origin, "hooks", "pre-receive")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitOps.SquashBranch(ctx, repoDir, "amp/01TEST", "origin/HEAD", "squashed", CommitSettings{}); err == nil {
+		t.Fatal("SquashBranch() error = nil, want the rejected push")
+	}
+	if got := runGit(t, repoDir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD = %s after the failed squash, want it back on %s", got, head)
+	}
+
+	// The plain push that follows still fast-forwards the branch on origin
+	os.Remove(hook)
+	if err := gitOps.PushBranch(ctx, repoDir, "amp/01TEST"); err != nil {
+		t.Fatalf("PushBranch() after the failed squash error = %v", err)
+	}
+	if got := runGit(t, origin, "rev-parse", "amp/01TEST"); got != head {
+		t.Errorf("origin branch = %s, want every attempt's commit up to %s", got, head)
+	}
+}
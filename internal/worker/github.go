@@ -1,76 +1,484 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
-// githubOperations implements the GitHubOperations interface
+// defaultGitHubAPIURL is the REST API endpoint for github.com
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// maxJobLogBytes caps how much of a single job log is downloaded
+const maxJobLogBytes = 1 << 20
+
+// githubOperations implements the GitHubOperations interface using the GitHub REST v3 API
 type githubOperations struct {
-	token string
+	tokens     TokenSource
+	baseURL    string
+	httpClient *http.Client
 }
 
-// NewGitHubOperations creates a new GitHub operations instance
+// NewGitHubOperations creates a new GitHub operations instance for github.com
 func NewGitHubOperations(token string) GitHubOperations {
+	return NewGitHubOperationsWithBaseURL(token, "")
+}
+
+// NewGitHubOperationsWithBaseURL creates a new GitHub operations instance against
+// the given API base URL, e.g. https://github.example.com/api/v3 for GitHub Enterprise
+func NewGitHubOperationsWithBaseURL(token, baseURL string) GitHubOperations {
+	return NewGitHubOperationsWithTokenSource(NewStaticTokenSource(token), baseURL)
+}
+
+// NewGitHubOperationsWithTokenSource creates a new GitHub operations instance
+// that authenticates each request with a token for the target repository
+func NewGitHubOperationsWithTokenSource(tokens TokenSource, baseURL string) GitHubOperations {
+	if baseURL == "" {
+		baseURL = defaultGitHubAPIURL
+	}
+
 	return &githubOperations{
-		token: token,
+		tokens:  tokens,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
 	}
 }
 
-// CreatePullRequest creates a pull request on GitHub
+// githubAPIError represents a non-success response from the GitHub API
+type githubAPIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *githubAPIError) Error() string {
+	return fmt.Sprintf("github API %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// CreatePullRequest creates a pull request on GitHub, returning the URL of an
+// already open pull request for the head branch if there is one. An empty
+// baseBranch targets the repository's default branch.
 func (gh *githubOperations) CreatePullRequest(ctx context.Context, repoURL, baseBranch, headBranch, title, body string) (string, error) {
-	// This is a placeholder implementation
-	// In a real implementation, this would use the GitHub API
-	
-	// Extract owner and repo from URL
 	owner, repo, err := gh.parseRepoURL(repoURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse repository URL: %w", err)
 	}
-	
-	// For now, return a mock PR URL
-	// In a real implementation, this would make an API call to create the PR
-	prURL := fmt.Sprintf("https://github.com/%s/%s/pull/123", owner, repo)
-	
-	return prURL, nil
+
+	existing, err := gh.FindPullRequest(ctx, repoURL, headBranch)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.HTMLURL, nil
+	}
+
+	if baseBranch == "" {
+		baseBranch, err = gh.GetDefaultBranch(ctx, repoURL)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	payload := map[string]string{
+		"title": title,
+		"head":  headBranch,
+		"base":  baseBranch,
+		"body":  body,
+	}
+
+	var pr githubPullRequest
+	path := fmt.Sprintf("/repos/%s/%s/pulls", owner, repo)
+	if err := gh.doJSON(ctx, owner, repo, http.MethodPost, path, payload, &pr); err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+
+	return pr.HTMLURL, nil
+}
+
+// FindPullRequest returns the open pull request for the head branch, or nil if there is none
+func (gh *githubOperations) FindPullRequest(ctx context.Context, repoURL, headBranch string) (*PullRequest, error) {
+	owner, repo, err := gh.parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("head", owner+":"+headBranch)
+	params.Set("state", "open")
+
+	var prs []githubPullRequest
+	path := fmt.Sprintf("/repos/%s/%s/pulls?%s", owner, repo, params.Encode())
+	if err := gh.doJSON(ctx, owner, repo, http.MethodGet, path, nil, &prs); err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	if len(prs) == 0 {
+		return nil, nil
+	}
+
+	pr := prs[0].toPullRequest()
+	return &pr, nil
+}
+
+// GetPullRequest retrieves a pull request by its web URL
+func (gh *githubOperations) GetPullRequest(ctx context.Context, prURL string) (*PullRequest, error) {
+	owner, repo, number, err := gh.parsePullRequestURL(prURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var pr githubPullRequest
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, repo, number)
+	if err := gh.doJSON(ctx, owner, repo, http.MethodGet, path, nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	result := pr.toPullRequest()
+	return &result, nil
 }
 
-// GetPullRequestStatus retrieves the status of a pull request
+// GetPullRequestStatus retrieves the status of a pull request: open, closed or merged
 func (gh *githubOperations) GetPullRequestStatus(ctx context.Context, prURL string) (string, error) {
-	// This is a placeholder implementation
-	// In a real implementation, this would use the GitHub API
-	return "open", nil
+	pr, err := gh.GetPullRequest(ctx, prURL)
+	if err != nil {
+		return "", err
+	}
+
+	if pr.Merged {
+		return "merged", nil
+	}
+	return pr.State, nil
+}
+
+// GetDefaultBranch returns the repository's default branch
+func (gh *githubOperations) GetDefaultBranch(ctx context.Context, repoURL string) (string, error) {
+	owner, repo, err := gh.parseRepoURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	var repository struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s", owner, repo)
+	if err := gh.doJSON(ctx, owner, repo, http.MethodGet, path, nil, &repository); err != nil {
+		return "", fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	return repository.DefaultBranch, nil
 }
 
 // GetWorkflowRuns retrieves workflow runs for a branch
 func (gh *githubOperations) GetWorkflowRuns(ctx context.Context, repoURL, branchName string) ([]WorkflowRun, error) {
-	// This is a placeholder implementation
-	// In a real implementation, this would use the GitHub API
-	return []WorkflowRun{}, nil
+	params := url.Values{}
+	params.Set("branch", branchName)
+	return gh.listWorkflowRuns(ctx, repoURL, params)
+}
+
+// GetWorkflowRunsForCommit retrieves workflow runs triggered by a commit
+func (gh *githubOperations) GetWorkflowRunsForCommit(ctx context.Context, repoURL, sha string) ([]WorkflowRun, error) {
+	params := url.Values{}
+	params.Set("head_sha", sha)
+	return gh.listWorkflowRuns(ctx, repoURL, params)
+}
+
+// GetWorkflowRunJobs retrieves the jobs of a workflow run
+func (gh *githubOperations) GetWorkflowRunJobs(ctx context.Context, repoURL string, runID int64) ([]WorkflowJob, error) {
+	owner, repo, err := gh.parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	var resp struct {
+		Jobs []struct {
+			ID         int64  `json:"id"`
+			RunID      int64  `json:"run_id"`
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+		} `json:"jobs"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/jobs?per_page=100", owner, repo, runID)
+	if err := gh.doJSON(ctx, owner, repo, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list workflow jobs: %w", err)
+	}
+
+	jobs := make([]WorkflowJob, len(resp.Jobs))
+	for i, job := range resp.Jobs {
+		jobs[i] = WorkflowJob{
+			ID:         job.ID,
+			RunID:      job.RunID,
+			Name:       job.Name,
+			Status:     job.Status,
+			Conclusion: job.Conclusion,
+			HTMLURL:    job.HTMLURL,
+		}
+	}
+
+	return jobs, nil
+}
+
+// GetJobLogs downloads the plain-text log of a workflow job
+func (gh *githubOperations) GetJobLogs(ctx context.Context, repoURL string, jobID int64) (string, error) {
+	owner, repo, err := gh.parseRepoURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	// The API answers with a redirect to a short-lived download URL, which
+	// the HTTP client follows without forwarding the Authorization header
+	path := fmt.Sprintf("/repos/%s/%s/actions/jobs/%d/logs", owner, repo, jobID)
+	resp, err := gh.do(ctx, owner, repo, http.MethodGet, path, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download job logs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJobLogBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read job logs: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// GetWorkflowRunLogs retrieves the logs of the failed jobs in a workflow run
+func (gh *githubOperations) GetWorkflowRunLogs(ctx context.Context, repoURL string, runID int64) (string, error) {
+	jobs, err := gh.GetWorkflowRunJobs(ctx, repoURL, runID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, job := range jobs {
+		if job.Status != "completed" || job.Conclusion == "success" || job.Conclusion == "skipped" {
+			continue
+		}
+
+		logs, err := gh.GetJobLogs(ctx, repoURL, job.ID)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "--- %s (%s) ---\n%s\n", job.Name, job.Conclusion, logs)
+	}
+
+	return sb.String(), nil
+}
+
+// listWorkflowRuns lists the workflow runs matching the query parameters
+func (gh *githubOperations) listWorkflowRuns(ctx context.Context, repoURL string, params url.Values) ([]WorkflowRun, error) {
+	owner, repo, err := gh.parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params.Set("per_page", "50")
+
+	var resp struct {
+		WorkflowRuns []struct {
+			ID         int64     `json:"id"`
+			Name       string    `json:"name"`
+			HeadBranch string    `json:"head_branch"`
+			HeadSHA    string    `json:"head_sha"`
+			Status     string    `json:"status"`
+			Conclusion string    `json:"conclusion"`
+			HTMLURL    string    `json:"html_url"`
+			CreatedAt  time.Time `json:"created_at"`
+			UpdatedAt  time.Time `json:"updated_at"`
+		} `json:"workflow_runs"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs?%s", owner, repo, params.Encode())
+	if err := gh.doJSON(ctx, owner, repo, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list workflow runs: %w", err)
+	}
+
+	runs := make([]WorkflowRun, len(resp.WorkflowRuns))
+	for i, run := range resp.WorkflowRuns {
+		runs[i] = WorkflowRun{
+			ID:         run.ID,
+			Name:       run.Name,
+			HeadBranch: run.HeadBranch,
+			HeadSHA:    run.HeadSHA,
+			Status:     run.Status,
+			Conclusion: run.Conclusion,
+			HTMLURL:    run.HTMLURL,
+			CreatedAt:  run.CreatedAt,
+			UpdatedAt:  run.UpdatedAt,
+		}
+	}
+
+	return runs, nil
+}
+
+// githubPullRequest is the API representation of a pull request
+type githubPullRequest struct {
+	Number         int    `json:"number"`
+	HTMLURL        string `json:"html_url"`
+	State          string `json:"state"`
+	Merged         bool   `json:"merged"`
+	Mergeable      *bool  `json:"mergeable"`
+	MergeableState string `json:"mergeable_state"`
+	Head           struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// toPullRequest converts the API representation to a PullRequest
+func (pr githubPullRequest) toPullRequest() PullRequest {
+	return PullRequest{
+		Number:         pr.Number,
+		HTMLURL:        pr.HTMLURL,
+		State:          pr.State,
+		Merged:         pr.Merged,
+		Mergeable:      pr.Mergeable,
+		MergeableState: pr.MergeableState,
+		HeadBranch:     pr.Head.Ref,
+		BaseBranch:     pr.Base.Ref,
+	}
+}
+
+// doJSON performs an API request and decodes the JSON response into target
+func (gh *githubOperations) doJSON(ctx context.Context, owner, repo, method, path string, body, target interface{}) error {
+	resp, err := gh.do(ctx, owner, repo, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if target == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode github response: %w", err)
+	}
+
+	return nil
+}
+
+// do performs an API request authenticated for the owner/repo, returning an error for non-2xx responses
+func (gh *githubOperations) do(ctx context.Context, owner, repo, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, gh.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "amp-worker")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := gh.tokens.Token(ctx, owner, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := gh.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("github request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			message = apiErr.Message
+		}
+		return nil, &githubAPIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    message,
+		}
+	}
+
+	return resp, nil
 }
 
-// parseRepoURL extracts owner and repository name from a GitHub URL
+// parseRepoURL extracts owner and repository name from a repository URL
 func (gh *githubOperations) parseRepoURL(repoURL string) (owner, repo string, err error) {
-	// Handle both HTTPS and SSH URLs
-	var path string
-	
-	if strings.HasPrefix(repoURL, "https://github.com/") {
-		path = strings.TrimPrefix(repoURL, "https://github.com/")
-	} else if strings.HasPrefix(repoURL, "git@github.com:") {
-		path = strings.TrimPrefix(repoURL, "git@github.com:")
-	} else {
-		return "", "", fmt.Errorf("unsupported repository URL format: %s", repoURL)
-	}
-	
-	// Remove .git suffix if present
-	path = strings.TrimSuffix(path, ".git")
-	
-	// Split into owner and repo
-	parts := strings.Split(path, "/")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid repository path: %s", path)
-	}
-	
-	return parts[0], parts[1], nil
+	return parseGitHubRepoURL(repoURL)
+}
+
+// parseGitHubRepoURL extracts owner and repository name from a GitHub or
+// GitHub Enterprise repository URL
+func parseGitHubRepoURL(repoURL string) (owner, repo string, err error) {
+	ref, err := parseRemoteRepo(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	if ref.Segments() != 2 {
+		return "", "", fmt.Errorf("invalid repository path: %s", ref.Path)
+	}
+
+	return ref.Owner(), ref.Name(), nil
+}
+
+// parseRemoteRepo parses a reference to a repository on a code host, which
+// unlike a local repository has pull requests and CI runs
+func parseRemoteRepo(repoURL string) (repourl.Ref, error) {
+	ref, err := repourl.Parse(repoURL)
+	if err != nil {
+		return repourl.Ref{}, err
+	}
+	if ref.IsLocal() {
+		return repourl.Ref{}, fmt.Errorf("unsupported repository URL format: %s", repoURL)
+	}
+
+	return ref, nil
+}
+
+// parsePullRequestURL extracts owner, repository and number from a pull request web URL
+func (gh *githubOperations) parsePullRequestURL(prURL string) (owner, repo string, number int, err error) {
+	parsed, err := url.Parse(prURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid pull request URL: %s", prURL)
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "pull" {
+		return "", "", 0, fmt.Errorf("invalid pull request URL: %s", prURL)
+	}
+
+	number, err = strconv.Atoi(parts[3])
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid pull request number in URL: %s", prURL)
+	}
+
+	return parts[0], parts[1], number, nil
 }
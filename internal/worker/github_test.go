@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeGitHubAPI starts an httptest server serving the given routes, keyed by "METHOD /path"
+func newFakeGitHubAPI(t *testing.T, routes map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want bearer token", got)
+		}
+		handler, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Not Found"}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGitHubCreatePullRequest(t *testing.T) {
+	var created map[string]string
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/pulls": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("head"); got != "acme:amp/01ABC" {
+				t.Errorf("head = %q, want acme:amp/01ABC", got)
+			}
+			fmt.Fprint(w, `[]`)
+		},
+		"GET /repos/acme/api": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"default_branch":"trunk"}`)
+		},
+		"POST /repos/acme/api/pulls": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"number":12,"html_url":"https://github.com/acme/api/pull/12","state":"open"}`)
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL)
+	prURL, err := gh.CreatePullRequest(context.Background(), "https://github.com/acme/api.git", "", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+
+	if prURL != "https://github.com/acme/api/pull/12" {
+		t.Errorf("prURL = %q, want created PR URL", prURL)
+	}
+	if created["base"] != "trunk" || created["head"] != "amp/01ABC" || created["title"] != "Title" {
+		t.Errorf("created payload = %v, want base=trunk head=amp/01ABC", created)
+	}
+}
+
+func TestGitHubCreatePullRequest_ReusesOpenPullRequest(t *testing.T) {
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/pulls": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"number":3,"html_url":"https://github.com/acme/api/pull/3","state":"open"}]`)
+		},
+		"POST /repos/acme/api/pulls": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect a new pull request to be created")
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL)
+	prURL, err := gh.CreatePullRequest(context.Background(), "git@github.com:acme/api.git", "main", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+	if prURL != "https://github.com/acme/api/pull/3" {
+		t.Errorf("prURL = %q, want existing PR URL", prURL)
+	}
+}
+
+func TestGitHubGetWorkflowRuns(t *testing.T) {
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/actions/runs": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("branch"); got != "amp/01ABC" {
+				t.Errorf("branch = %q, want amp/01ABC", got)
+			}
+			fmt.Fprint(w, `{"total_count":1,"workflow_runs":[{"id":42,"name":"CI","head_branch":"amp/01ABC","head_sha":"abc123","status":"completed","conclusion":"failure","html_url":"https://github.com/acme/api/actions/runs/42","created_at":"2024-05-01T10:00:00Z","updated_at":"2024-05-01T10:05:00Z"}]}`)
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL)
+	runs, err := gh.GetWorkflowRuns(context.Background(), "https://github.com/acme/api", "amp/01ABC")
+	if err != nil {
+		t.Fatalf("GetWorkflowRuns() error = %v", err)
+	}
+
+	if len(runs) != 1 {
+		t.Fatalf("len(runs) = %d, want 1", len(runs))
+	}
+	run := runs[0]
+	if run.ID != 42 || run.HeadSHA != "abc123" || run.Status != "completed" || run.Conclusion != "failure" {
+		t.Errorf("run = %+v, want parsed workflow run", run)
+	}
+	if run.CreatedAt.IsZero() {
+		t.Error("expected CreatedAt to be parsed")
+	}
+}
+
+func TestGitHubGetWorkflowRunLogs(t *testing.T) {
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/actions/runs/42/jobs": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"jobs":[
+				{"id":1,"run_id":42,"name":"lint","status":"completed","conclusion":"success"},
+				{"id":2,"run_id":42,"name":"test","status":"completed","conclusion":"failure"}
+			]}`)
+		},
+		"GET /repos/acme/api/actions/jobs/1/logs": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect logs of a successful job to be fetched")
+		},
+		"GET /repos/acme/api/actions/jobs/2/logs": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "--- FAIL: TestLogin (0.01s)\n")
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL)
+	logs, err := gh.GetWorkflowRunLogs(context.Background(), "https://github.com/acme/api", 42)
+	if err != nil {
+		t.Fatalf("GetWorkflowRunLogs() error = %v", err)
+	}
+
+	if !strings.Contains(logs, "--- test (failure) ---") || !strings.Contains(logs, "FAIL: TestLogin") {
+		t.Errorf("logs = %q, want the failed job log", logs)
+	}
+}
+
+func TestGitHubGetPullRequestStatus(t *testing.T) {
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/pulls/7": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"number":7,"state":"closed","merged":true,"mergeable":null}`)
+		},
+		"GET /repos/acme/api/pulls/8": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"number":8,"state":"open","merged":false,"mergeable":false,"mergeable_state":"dirty"}`)
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL).(*githubOperations)
+
+	status, err := gh.GetPullRequestStatus(context.Background(), "https://github.com/acme/api/pull/7")
+	if err != nil {
+		t.Fatalf("GetPullRequestStatus() error = %v", err)
+	}
+	if status != "merged" {
+		t.Errorf("status = %q, want merged", status)
+	}
+
+	pr, err := gh.GetPullRequest(context.Background(), "https://github.com/acme/api/pull/8")
+	if err != nil {
+		t.Fatalf("GetPullRequest() error = %v", err)
+	}
+	if pr.State != "open" || pr.Mergeable == nil || *pr.Mergeable || pr.MergeableState != "dirty" {
+		t.Errorf("pr = %+v, want open and not mergeable", pr)
+	}
+}
+
+func TestGitHubAPIError(t *testing.T) {
+	server := newFakeGitHubAPI(t, map[string]http.HandlerFunc{
+		"GET /repos/acme/api/actions/runs": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"Resource not accessible by integration"}`)
+		},
+	})
+
+	gh := NewGitHubOperationsWithBaseURL("test-token", server.URL)
+	_, err := gh.GetWorkflowRuns(context.Background(), "https://github.com/acme/api", "main")
+	if err == nil {
+		t.Fatal("expected an error for a 403 response")
+	}
+	if !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "Resource not accessible") {
+		t.Errorf("error = %v, want status and API message", err)
+	}
+}
+
+func TestGitHubParseRepoURL(t *testing.T) {
+	gh := &githubOperations{}
+
+	tests := []struct {
+		url       string
+		wantOwner string
+		wantRepo  string
+		wantErr   bool
+	}{
+		{"https://github.com/acme/api.git", "acme", "api", false},
+		{"https://github.com/acme/api", "acme", "api", false},
+		{"git@github.com:acme/api.git", "acme", "api", false},
+		{"https://github.example.com/platform/billing.git", "platform", "billing", false},
+		{"https://github.com/acme", "", "", true},
+		{"ftp://github.com/acme/api", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			owner, repo, err := gh.parseRepoURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRepoURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("parseRepoURL() = %s/%s, want %s/%s", owner, repo, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}
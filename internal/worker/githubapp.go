@@ -0,0 +1,252 @@
+package worker
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// appJWTLifetime is how long an App JWT is valid (GitHub allows at most 10 minutes)
+	appJWTLifetime = 9 * time.Minute
+	// installationTokenRefreshWindow is how long before expiry a cached token is refreshed
+	installationTokenRefreshWindow = 5 * time.Minute
+)
+
+// TokenSource provides GitHub access tokens for a repository
+type TokenSource interface {
+	Token(ctx context.Context, owner, repo string) (string, error)
+}
+
+// staticTokenSource returns the same token for every repository
+type staticTokenSource string
+
+// NewStaticTokenSource creates a token source for a personal access token
+func NewStaticTokenSource(token string) TokenSource {
+	return staticTokenSource(token)
+}
+
+// Token implements TokenSource
+func (s staticTokenSource) Token(ctx context.Context, owner, repo string) (string, error) {
+	return string(s), nil
+}
+
+// installationToken is a cached installation access token
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// AppTokenSource mints short-lived installation tokens for a GitHub App
+type AppTokenSource struct {
+	appID      string
+	key        *rsa.PrivateKey
+	baseURL    string
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu            sync.Mutex
+	installations map[string]int64
+	tokens        map[int64]installationToken
+}
+
+// NewAppTokenSource creates a token source for the GitHub App using the PEM
+// private key at privateKeyPath
+func NewAppTokenSource(appID, privateKeyPath, baseURL string) (*AppTokenSource, error) {
+	pemData, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+
+	return NewAppTokenSourceFromPEM(appID, pemData, baseURL)
+}
+
+// NewAppTokenSourceFromPEM creates a token source for the GitHub App from a PEM encoded private key
+func NewAppTokenSourceFromPEM(appID string, pemData []byte, baseURL string) (*AppTokenSource, error) {
+	if appID == "" {
+		return nil, fmt.Errorf("GitHub App ID cannot be empty")
+	}
+
+	key, err := parseRSAPrivateKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseURL == "" {
+		baseURL = defaultGitHubAPIURL
+	}
+
+	return &AppTokenSource{
+		appID:   appID,
+		key:     key,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		now:           time.Now,
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]installationToken),
+	}, nil
+}
+
+// Token returns an installation token for the repository, minting a new one
+// when there is no cached token or the cached one is about to expire
+func (s *AppTokenSource) Token(ctx context.Context, owner, repo string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installationID, err := s.installationID(ctx, owner, repo)
+	if err != nil {
+		return "", err
+	}
+
+	if cached, ok := s.tokens[installationID]; ok && s.now().Add(installationTokenRefreshWindow).Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installationID)
+	if err := s.appRequest(ctx, http.MethodPost, path, &resp); err != nil {
+		return "", fmt.Errorf("failed to create installation token: %w", err)
+	}
+
+	s.tokens[installationID] = installationToken{
+		token:     resp.Token,
+		expiresAt: resp.ExpiresAt,
+	}
+
+	return resp.Token, nil
+}
+
+// installationID looks up (and caches) the App installation for a repository.
+// The caller must hold s.mu.
+func (s *AppTokenSource) installationID(ctx context.Context, owner, repo string) (int64, error) {
+	key := owner + "/" + repo
+	if id, ok := s.installations[key]; ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int64 `json:"id"`
+	}
+	path := fmt.Sprintf("/repos/%s/%s/installation", owner, repo)
+	if err := s.appRequest(ctx, http.MethodGet, path, &resp); err != nil {
+		return 0, fmt.Errorf("failed to find GitHub App installation for %s: %w", key, err)
+	}
+
+	s.installations[key] = resp.ID
+	return resp.ID, nil
+}
+
+// appRequest performs an API request authenticated as the App itself
+func (s *AppTokenSource) appRequest(ctx context.Context, method, path string, target interface{}) error {
+	jwt, err := s.appJWT()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "amp-worker")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("github request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return &githubAPIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    apiErr.Message,
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode github response: %w", err)
+	}
+
+	return nil
+}
+
+// appJWT builds an RS256 signed JWT identifying the App
+func (s *AppTokenSource) appJWT() (string, error) {
+	now := s.now()
+
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		// Backdate to allow for clock drift between us and GitHub
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.appID,
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey decodes a PKCS#1 or PKCS#8 PEM encoded RSA private key
+func parseRSAPrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+
+	return key, nil
+}
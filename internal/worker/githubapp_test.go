@@ -0,0 +1,198 @@
+package worker
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGitHubApp serves the App endpoints used to mint installation tokens
+type fakeGitHubApp struct {
+	t       *testing.T
+	key     *rsa.PrivateKey
+	now     time.Time
+	lookups int
+	mints   int
+}
+
+func newFakeGitHubApp(t *testing.T) (*fakeGitHubApp, *httptest.Server, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	app := &fakeGitHubApp{t: t, key: key, now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	server := httptest.NewServer(http.HandlerFunc(app.serveHTTP))
+	t.Cleanup(server.Close)
+
+	return app, server, pemData
+}
+
+func (a *fakeGitHubApp) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	a.verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /repos/acme/api/installation":
+		a.lookups++
+		fmt.Fprint(w, `{"id":99}`)
+	case "POST /app/installations/99/access_tokens":
+		a.mints++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"ghs_%d","expires_at":%q}`, a.mints, a.now.Add(time.Hour).Format(time.RFC3339))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	}
+}
+
+// verifyJWT checks the App JWT signature and issuer
+func (a *fakeGitHubApp) verifyJWT(token string) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		a.t.Errorf("Authorization token %q is not a JWT", token)
+		return
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		a.t.Errorf("failed to decode JWT signature: %v", err)
+		return
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&a.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		a.t.Errorf("JWT signature is invalid: %v", err)
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims.Iss != "12345" {
+		a.t.Errorf("iss = %q, want the App ID", claims.Iss)
+	}
+	if claims.Exp-claims.Iat > int64(10*time.Minute/time.Second) {
+		a.t.Errorf("JWT lifetime = %ds, want at most 10 minutes", claims.Exp-claims.Iat)
+	}
+}
+
+func TestAppTokenSource_CachesInstallationToken(t *testing.T) {
+	app, server, pemData := newFakeGitHubApp(t)
+
+	source, err := NewAppTokenSourceFromPEM("12345", pemData, server.URL)
+	if err != nil {
+		t.Fatalf("NewAppTokenSourceFromPEM() error = %v", err)
+	}
+	source.now = func() time.Time { return app.now }
+
+	first, err := source.Token(context.Background(), "acme", "api")
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	second, err := source.Token(context.Background(), "acme", "api")
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if first != "ghs_1" || second != "ghs_1" {
+		t.Errorf("tokens = %q, %q, want the cached ghs_1", first, second)
+	}
+	if app.lookups != 1 || app.mints != 1 {
+		t.Errorf("lookups = %d, mints = %d, want 1 each", app.lookups, app.mints)
+	}
+}
+
+func TestAppTokenSource_RefreshesBeforeExpiry(t *testing.T) {
+	app, server, pemData := newFakeGitHubApp(t)
+
+	source, err := NewAppTokenSourceFromPEM("12345", pemData, server.URL)
+	if err != nil {
+		t.Fatalf("NewAppTokenSourceFromPEM() error = %v", err)
+	}
+	issuedAt := app.now
+	source.now = func() time.Time { return app.now }
+
+	if _, err := source.Token(context.Background(), "acme", "api"); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	// Move into the refresh window of the first token
+	app.now = issuedAt.Add(time.Hour - installationTokenRefreshWindow + time.Second)
+	token, err := source.Token(context.Background(), "acme", "api")
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if token != "ghs_2" {
+		t.Errorf("token = %q, want a refreshed ghs_2", token)
+	}
+	if app.lookups != 1 {
+		t.Errorf("lookups = %d, want the installation to stay cached", app.lookups)
+	}
+}
+
+func TestAppTokenSource_MissingInstallation(t *testing.T) {
+	_, server, pemData := newFakeGitHubApp(t)
+
+	source, err := NewAppTokenSourceFromPEM("12345", pemData, server.URL)
+	if err != nil {
+		t.Fatalf("NewAppTokenSourceFromPEM() error = %v", err)
+	}
+
+	_, err = source.Token(context.Background(), "acme", "unknown")
+	if err == nil || !strings.Contains(err.Error(), "installation for acme/unknown") {
+		t.Errorf("Token() error = %v, want a missing installation error", err)
+	}
+}
+
+func TestParseRSAPrivateKey_Invalid(t *testing.T) {
+	if _, err := parseRSAPrivateKey([]byte("not a key")); err == nil {
+		t.Error("expected an error for non-PEM data")
+	}
+}
+
+func TestAskpassScript(t *testing.T) {
+	askpassPath, err := WriteAskpassScript(t.TempDir())
+	if err != nil {
+		t.Fatalf("WriteAskpassScript() error = %v", err)
+	}
+
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"Username for 'https://github.com': ", "x-access-token"},
+		{"Password for 'https://x-access-token@github.com': ", "ghs_secret"},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command(askpassPath, tt.prompt)
+		cmd.Env = append(os.Environ(), "AMP_GIT_USERNAME=x-access-token", "AMP_GIT_PASSWORD=ghs_secret")
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("askpass %q error = %v", tt.prompt, err)
+		}
+		if got := strings.TrimSpace(string(output)); got != tt.want {
+			t.Errorf("askpass %q = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultGitLabURL is the instance URL of gitlab.com
+const defaultGitLabURL = "https://gitlab.com"
+
+// gitlabOperations implements the GitHubOperations interface for GitLab using
+// the REST v4 API: merge requests stand in for pull requests and pipelines
+// for workflow runs
+type gitlabOperations struct {
+	token      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewGitLabOperations creates a GitLab operations instance for the instance
+// at instanceURL, e.g. https://gitlab.example.com for self-managed GitLab; an
+// empty instanceURL means gitlab.com
+func NewGitLabOperations(token, instanceURL string) GitHubOperations {
+	if instanceURL == "" {
+		instanceURL = defaultGitLabURL
+	}
+
+	return &gitlabOperations{
+		token:   token,
+		baseURL: strings.TrimSuffix(instanceURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// gitlabAPIError represents a non-success response from the GitLab API
+type gitlabAPIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *gitlabAPIError) Error() string {
+	return fmt.Sprintf("gitlab API %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// CreatePullRequest opens a merge request, returning the URL of an already
+// open merge request for the source branch if there is one. An empty
+// baseBranch targets the project's default branch.
+func (gl *gitlabOperations) CreatePullRequest(ctx context.Context, repoURL, baseBranch, headBranch, title, body string) (string, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	existing, err := gl.FindPullRequest(ctx, repoURL, headBranch)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.HTMLURL, nil
+	}
+
+	if baseBranch == "" {
+		baseBranch, err = gl.GetDefaultBranch(ctx, repoURL)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	payload := map[string]string{
+		"source_branch": headBranch,
+		"target_branch": baseBranch,
+		"title":         title,
+		"description":   body,
+	}
+
+	var mr gitlabMergeRequest
+	if err := gl.doJSON(ctx, http.MethodPost, projectPath(project, "/merge_requests"), payload, &mr); err != nil {
+		return "", fmt.Errorf("failed to create merge request: %w", err)
+	}
+
+	return mr.WebURL, nil
+}
+
+// FindPullRequest returns the open merge request for the source branch, or nil if there is none
+func (gl *gitlabOperations) FindPullRequest(ctx context.Context, repoURL, headBranch string) (*PullRequest, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("source_branch", headBranch)
+	params.Set("state", "opened")
+
+	var mrs []gitlabMergeRequest
+	if err := gl.doJSON(ctx, http.MethodGet, projectPath(project, "/merge_requests?"+params.Encode()), nil, &mrs); err != nil {
+		return nil, fmt.Errorf("failed to list merge requests: %w", err)
+	}
+
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+
+	pr := mrs[0].toPullRequest()
+	return &pr, nil
+}
+
+// GetPullRequest retrieves a merge request by its web URL
+func (gl *gitlabOperations) GetPullRequest(ctx context.Context, mrURL string) (*PullRequest, error) {
+	project, iid, err := parseMergeRequestURL(mrURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var mr gitlabMergeRequest
+	if err := gl.doJSON(ctx, http.MethodGet, projectPath(project, fmt.Sprintf("/merge_requests/%d", iid)), nil, &mr); err != nil {
+		return nil, fmt.Errorf("failed to get merge request: %w", err)
+	}
+
+	result := mr.toPullRequest()
+	return &result, nil
+}
+
+// GetPullRequestStatus retrieves the status of a merge request: open, closed or merged
+func (gl *gitlabOperations) GetPullRequestStatus(ctx context.Context, mrURL string) (string, error) {
+	pr, err := gl.GetPullRequest(ctx, mrURL)
+	if err != nil {
+		return "", err
+	}
+
+	if pr.Merged {
+		return "merged", nil
+	}
+	return pr.State, nil
+}
+
+// GetDefaultBranch returns the project's default branch
+func (gl *gitlabOperations) GetDefaultBranch(ctx context.Context, repoURL string) (string, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	var resp struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := gl.doJSON(ctx, http.MethodGet, projectPath(project, ""), nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to get project: %w", err)
+	}
+
+	return resp.DefaultBranch, nil
+}
+
+// GetWorkflowRuns retrieves the pipelines for a branch
+func (gl *gitlabOperations) GetWorkflowRuns(ctx context.Context, repoURL, branchName string) ([]WorkflowRun, error) {
+	params := url.Values{}
+	params.Set("ref", branchName)
+	return gl.listPipelines(ctx, repoURL, params)
+}
+
+// GetWorkflowRunsForCommit retrieves the pipelines for a commit
+func (gl *gitlabOperations) GetWorkflowRunsForCommit(ctx context.Context, repoURL, sha string) ([]WorkflowRun, error) {
+	params := url.Values{}
+	params.Set("sha", sha)
+	return gl.listPipelines(ctx, repoURL, params)
+}
+
+// GetWorkflowRunJobs retrieves the jobs of a pipeline
+func (gl *gitlabOperations) GetWorkflowRunJobs(ctx context.Context, repoURL string, pipelineID int64) ([]WorkflowJob, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	var resp []struct {
+		ID           int64  `json:"id"`
+		Name         string `json:"name"`
+		Status       string `json:"status"`
+		AllowFailure bool   `json:"allow_failure"`
+		WebURL       string `json:"web_url"`
+	}
+	path := projectPath(project, fmt.Sprintf("/pipelines/%d/jobs?per_page=100", pipelineID))
+	if err := gl.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list pipeline jobs: %w", err)
+	}
+
+	jobs := make([]WorkflowJob, len(resp))
+	for i, job := range resp {
+		status, conclusion := gitlabStatus(job.Status)
+		// A job allowed to fail does not fail its pipeline
+		if job.AllowFailure && conclusion == "failure" {
+			conclusion = "neutral"
+		}
+		jobs[i] = WorkflowJob{
+			ID:         job.ID,
+			RunID:      pipelineID,
+			Name:       job.Name,
+			Status:     status,
+			Conclusion: conclusion,
+			HTMLURL:    job.WebURL,
+		}
+	}
+
+	return jobs, nil
+}
+
+// GetJobLogs downloads the trace of a job
+func (gl *gitlabOperations) GetJobLogs(ctx context.Context, repoURL string, jobID int64) (string, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	resp, err := gl.do(ctx, http.MethodGet, projectPath(project, fmt.Sprintf("/jobs/%d/trace", jobID)), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download job trace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJobLogBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read job trace: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// GetWorkflowRunLogs retrieves the traces of the failed jobs in a pipeline
+func (gl *gitlabOperations) GetWorkflowRunLogs(ctx context.Context, repoURL string, pipelineID int64) (string, error) {
+	jobs, err := gl.GetWorkflowRunJobs(ctx, repoURL, pipelineID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, job := range jobs {
+		if job.Status != "completed" || job.Conclusion != "failure" {
+			continue
+		}
+
+		logs, err := gl.GetJobLogs(ctx, repoURL, job.ID)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "--- %s (%s) ---\n%s\n", job.Name, job.Conclusion, logs)
+	}
+
+	return sb.String(), nil
+}
+
+// listPipelines lists the pipelines matching the query parameters
+func (gl *gitlabOperations) listPipelines(ctx context.Context, repoURL string, params url.Values) ([]WorkflowRun, error) {
+	project, err := parseGitLabProject(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+
+	params.Set("per_page", "50")
+
+	var resp []struct {
+		ID        int64     `json:"id"`
+		Name      string    `json:"name"`
+		Ref       string    `json:"ref"`
+		SHA       string    `json:"sha"`
+		Status    string    `json:"status"`
+		WebURL    string    `json:"web_url"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	if err := gl.doJSON(ctx, http.MethodGet, projectPath(project, "/pipelines?"+params.Encode()), nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list pipelines: %w", err)
+	}
+
+	runs := make([]WorkflowRun, len(resp))
+	for i, pipeline := range resp {
+		status, conclusion := gitlabStatus(pipeline.Status)
+		runs[i] = WorkflowRun{
+			ID:         pipeline.ID,
+			Name:       pipeline.Name,
+			HeadBranch: pipeline.Ref,
+			HeadSHA:    pipeline.SHA,
+			Status:     status,
+			Conclusion: conclusion,
+			HTMLURL:    pipeline.WebURL,
+			CreatedAt:  pipeline.CreatedAt,
+			UpdatedAt:  pipeline.UpdatedAt,
+		}
+	}
+
+	return runs, nil
+}
+
+// gitlabStatus maps the status of a GitLab pipeline or job to the status and
+// conclusion of a GitHub Actions run
+func gitlabStatus(status string) (string, string) {
+	switch status {
+	case "success":
+		return "completed", "success"
+	case "failed":
+		return "completed", "failure"
+	case "canceled":
+		return "completed", "cancelled"
+	case "skipped":
+		return "completed", "skipped"
+	case "manual":
+		// Waiting on someone to start a manual job, which may never happen
+		return "completed", "neutral"
+	case "created", "pending", "preparing", "waiting_for_resource", "scheduled":
+		return "queued", ""
+	default:
+		return "in_progress", ""
+	}
+}
+
+// gitlabMergeRequest is the API representation of a merge request
+type gitlabMergeRequest struct {
+	IID          int    `json:"iid"`
+	WebURL       string `json:"web_url"`
+	State        string `json:"state"`
+	MergeStatus  string `json:"detailed_merge_status"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+}
+
+// toPullRequest converts the API representation to a PullRequest
+func (mr gitlabMergeRequest) toPullRequest() PullRequest {
+	// GitLab says "opened" where GitHub says "open"; a locked merge request
+	// is open but briefly frozen while it merges
+	state := mr.State
+	if state == "opened" || state == "locked" {
+		state = "open"
+	}
+
+	var mergeable *bool
+	switch mr.MergeStatus {
+	case "mergeable":
+		ok := true
+		mergeable = &ok
+	case "broken_status", "conflict", "need_rebase":
+		ok := false
+		mergeable = &ok
+	}
+
+	return PullRequest{
+		Number:         mr.IID,
+		HTMLURL:        mr.WebURL,
+		State:          state,
+		Merged:         mr.State == "merged",
+		Mergeable:      mergeable,
+		MergeableState: mr.MergeStatus,
+		HeadBranch:     mr.SourceBranch,
+		BaseBranch:     mr.TargetBranch,
+	}
+}
+
+// doJSON performs an API request and decodes the JSON response into target
+func (gl *gitlabOperations) doJSON(ctx context.Context, method, path string, body, target interface{}) error {
+	resp, err := gl.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if target == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode gitlab response: %w", err)
+	}
+
+	return nil
+}
+
+// do performs an API request, returning an error for non-2xx responses
+func (gl *gitlabOperations) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, gl.baseURL+"/api/v4"+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "amp-worker")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if gl.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", gl.token)
+	}
+
+	resp, err := gl.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gitlab request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil {
+			// The message is a string or, for validation errors, an object of field errors
+			switch {
+			case apiErr.Message != nil:
+				message = fmt.Sprint(apiErr.Message)
+			case apiErr.Error != "":
+				message = apiErr.Error
+			}
+		}
+		return nil, &gitlabAPIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    message,
+		}
+	}
+
+	return resp, nil
+}
+
+// projectPath returns the API path of a project resource. Projects are
+// addressed by their URL-encoded full path, so nested groups need no lookup.
+func projectPath(project, resource string) string {
+	return "/projects/" + url.PathEscape(project) + resource
+}
+
+// parseGitLabProject extracts the full project path, including any nested
+// groups, from a GitLab repository URL
+func parseGitLabProject(repoURL string) (string, error) {
+	ref, err := parseRemoteRepo(repoURL)
+	if err != nil {
+		return "", err
+	}
+	return ref.Path, nil
+}
+
+// parseMergeRequestURL extracts the project path and IID from a merge request
+// web URL, e.g. https://gitlab.com/group/repo/-/merge_requests/12
+func parseMergeRequestURL(mrURL string) (project string, iid int, err error) {
+	parsed, err := url.Parse(mrURL)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid merge request URL: %s", mrURL)
+	}
+
+	project, rest, ok := strings.Cut(strings.Trim(parsed.Path, "/"), "/-/merge_requests/")
+	if !ok || project == "" {
+		return "", 0, fmt.Errorf("invalid merge request URL: %s", mrURL)
+	}
+
+	iid, err = strconv.Atoi(strings.SplitN(rest, "/", 2)[0])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid merge request number in URL: %s", mrURL)
+	}
+
+	return project, iid, nil
+}
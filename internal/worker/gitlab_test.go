@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeGitLabAPI starts an httptest server serving the given routes, keyed by
+// "METHOD /escaped/path" so that URL-encoded project paths can be checked
+func newFakeGitLabAPI(t *testing.T, routes map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "test-token" {
+			t.Errorf("PRIVATE-TOKEN = %q, want the token", got)
+		}
+		handler, ok := routes[r.Method+" "+r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"404 Project Not Found"}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGitLabCreateMergeRequest(t *testing.T) {
+	var created map[string]string
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/acme%2Fplatform%2Fapi/merge_requests": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("source_branch"); got != "amp/01ABC" {
+				t.Errorf("source_branch = %q, want amp/01ABC", got)
+			}
+			fmt.Fprint(w, `[]`)
+		},
+		"GET /api/v4/projects/acme%2Fplatform%2Fapi": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"default_branch":"trunk"}`)
+		},
+		"POST /api/v4/projects/acme%2Fplatform%2Fapi/merge_requests": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"iid":12,"web_url":"https://gitlab.example.com/acme/platform/api/-/merge_requests/12","state":"opened"}`)
+		},
+	})
+
+	gl := NewGitLabOperations("test-token", server.URL)
+	mrURL, err := gl.CreatePullRequest(context.Background(), "git@gitlab.example.com:acme/platform/api.git", "", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+
+	if mrURL != "https://gitlab.example.com/acme/platform/api/-/merge_requests/12" {
+		t.Errorf("mrURL = %q, want created MR URL", mrURL)
+	}
+	if created["target_branch"] != "trunk" || created["source_branch"] != "amp/01ABC" || created["description"] != "Body" {
+		t.Errorf("created payload = %v, want target_branch=trunk source_branch=amp/01ABC", created)
+	}
+}
+
+func TestGitLabCreateMergeRequest_ReusesOpenMergeRequest(t *testing.T) {
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/acme%2Fapi/merge_requests": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"iid":3,"web_url":"https://gitlab.com/acme/api/-/merge_requests/3","state":"opened"}]`)
+		},
+		"POST /api/v4/projects/acme%2Fapi/merge_requests": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect a new merge request to be created")
+		},
+	})
+
+	gl := NewGitLabOperations("test-token", server.URL)
+	mrURL, err := gl.CreatePullRequest(context.Background(), "https://gitlab.com/acme/api", "main", "amp/01ABC", "Title", "Body")
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+	if mrURL != "https://gitlab.com/acme/api/-/merge_requests/3" {
+		t.Errorf("mrURL = %q, want existing MR URL", mrURL)
+	}
+}
+
+func TestGitLabGetPipelines(t *testing.T) {
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/acme%2Fapi/pipelines": func(w http.ResponseWriter, r *http.Request) {
+			if got := r.URL.Query().Get("ref"); got != "amp/01ABC" {
+				t.Errorf("ref = %q, want amp/01ABC", got)
+			}
+			fmt.Fprint(w, `[
+				{"id":42,"ref":"amp/01ABC","sha":"abc123","status":"failed","web_url":"https://gitlab.com/acme/api/-/pipelines/42","created_at":"2024-05-01T10:00:00Z"},
+				{"id":43,"ref":"amp/01ABC","sha":"def456","status":"running"}
+			]`)
+		},
+	})
+
+	gl := NewGitLabOperations("test-token", server.URL)
+	runs, err := gl.GetWorkflowRuns(context.Background(), "https://gitlab.com/acme/api.git", "amp/01ABC")
+	if err != nil {
+		t.Fatalf("GetWorkflowRuns() error = %v", err)
+	}
+
+	if len(runs) != 2 {
+		t.Fatalf("len(runs) = %d, want 2", len(runs))
+	}
+	if run := runs[0]; run.ID != 42 || run.HeadSHA != "abc123" || run.Status != "completed" || run.Conclusion != "failure" || run.CreatedAt.IsZero() {
+		t.Errorf("runs[0] = %+v, want a failed pipeline", run)
+	}
+	if run := runs[1]; run.Status != "in_progress" || run.Conclusion != "" {
+		t.Errorf("runs[1] = %+v, want a pipeline in progress", run)
+	}
+}
+
+func TestGitLabGetPipelineLogs(t *testing.T) {
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/acme%2Fapi/pipelines/42/jobs": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[
+				{"id":1,"name":"lint","status":"success"},
+				{"id":2,"name":"test","status":"failed"},
+				{"id":3,"name":"flaky","status":"failed","allow_failure":true}
+			]`)
+		},
+		"GET /api/v4/projects/acme%2Fapi/jobs/1/trace": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect the trace of a successful job to be fetched")
+		},
+		"GET /api/v4/projects/acme%2Fapi/jobs/2/trace": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "--- FAIL: TestLogin (0.01s)\n")
+		},
+		"GET /api/v4/projects/acme%2Fapi/jobs/3/trace": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("did not expect the trace of a job allowed to fail to be fetched")
+		},
+	})
+
+	gl := NewGitLabOperations("test-token", server.URL)
+	logs, err := gl.GetWorkflowRunLogs(context.Background(), "https://gitlab.com/acme/api", 42)
+	if err != nil {
+		t.Fatalf("GetWorkflowRunLogs() error = %v", err)
+	}
+
+	if !strings.Contains(logs, "--- test (failure) ---") || !strings.Contains(logs, "FAIL: TestLogin") {
+		t.Errorf("logs = %q, want the failed job trace", logs)
+	}
+}
+
+func TestGitLabGetMergeRequestStatus(t *testing.T) {
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/acme%2Fapi/merge_requests/7": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"iid":7,"state":"merged"}`)
+		},
+		"GET /api/v4/projects/acme%2Fapi/merge_requests/8": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"iid":8,"state":"opened","detailed_merge_status":"conflict"}`)
+		},
+	})
+
+	gl := NewGitLabOperations("test-token", server.URL).(*gitlabOperations)
+
+	status, err := gl.GetPullRequestStatus(context.Background(), "https://gitlab.com/acme/api/-/merge_requests/7")
+	if err != nil {
+		t.Fatalf("GetPullRequestStatus() error = %v", err)
+	}
+	if status != "merged" {
+		t.Errorf("status = %q, want merged", status)
+	}
+
+	pr, err := gl.GetPullRequest(context.Background(), "https://gitlab.com/acme/api/-/merge_requests/8/diffs")
+	if err != nil {
+		t.Fatalf("GetPullRequest() error = %v", err)
+	}
+	if pr.State != "open" || pr.Mergeable == nil || *pr.Mergeable || pr.MergeableState != "conflict" {
+		t.Errorf("pr = %+v, want open and not mergeable", pr)
+	}
+}
+
+func TestGitLabAPIError(t *testing.T) {
+	server := newFakeGitLabAPI(t, map[string]http.HandlerFunc{})
+
+	gl := NewGitLabOperations("test-token", server.URL)
+	_, err := gl.GetWorkflowRuns(context.Background(), "https://gitlab.com/acme/api", "main")
+	if err == nil {
+		t.Fatal("expected an error for a 404 response")
+	}
+	if !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "Project Not Found") {
+		t.Errorf("error = %v, want status and API message", err)
+	}
+}
+
+func TestParseGitLabProject(t *testing.T) {
+	tests := []struct {
+		url         string
+		wantProject string
+		wantErr     bool
+	}{
+		{"https://gitlab.com/acme/api.git", "acme/api", false},
+		{"git@gitlab.com:acme/platform/api.git", "acme/platform/api", false},
+		{"ssh://git@gitlab.example.com:2222/acme/api.git", "acme/api", false},
+		{"https://gitlab.com/acme", "", true},
+		{"https://gitlab.com/acme/api/-/merge_requests", "", true},
+		{"ftp://gitlab.com/acme/api", "", true},
+		{"/srv/git/api.git", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			project, err := parseGitLabProject(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGitLabProject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if project != tt.wantProject {
+				t.Errorf("parseGitLabProject() = %s, want %s", project, tt.wantProject)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// RepoHooksFileName is the file in a target repository that configures its
+// own setup and verification commands, overriding the worker's hooks file
+const RepoHooksFileName = ".ampx.json"
+
+// RepoHooks holds the commands run around the agent in a repository's
+// workspace. Setup commands run once before the first agent run, e.g.
+// "npm ci"; verification commands run after every agent run, e.g. a
+// formatter and a smoke test, and a failure goes back to the agent without
+// pushing. It also holds how the repository's commits are made.
+type RepoHooks struct {
+	// Glob matched against the task's repository, with or without its .git
+	// suffix; only used in the worker's hooks file
+	Repo   string   `json:"repo,omitempty"`
+	Setup  []string `json:"setup,omitempty"`
+	Verify []string `json:"verify,omitempty"`
+	// Overrides of the worker's commit settings
+	Commit *CommitSettings `json:"commit,omitempty"`
+}
+
+// repoHooksFile is the layout of the worker's hooks file
+type repoHooksFile struct {
+	Repos []RepoHooks `json:"repos"`
+}
+
+// LoadRepoHooks reads the per-repository hooks from a JSON file of the form
+// {"repos": [{"repo": "https://github.com/acme/*", "setup": [...], "verify": [...]}]}
+func LoadRepoHooks(filename string) ([]RepoHooks, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks file: %w", err)
+	}
+
+	var file repoHooksFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse hooks file %s: %w", filename, err)
+	}
+	for i, hooks := range file.Repos {
+		if hooks.Repo == "" {
+			return nil, fmt.Errorf("hooks file %s: entry %d names no repo", filename, i)
+		}
+		if _, err := path.Match(hooks.Repo, ""); err != nil {
+			return nil, fmt.Errorf("hooks file %s: malformed repo pattern %q", filename, hooks.Repo)
+		}
+		if hooks.Commit != nil {
+			if err := hooks.Commit.Validate(); err != nil {
+				return nil, fmt.Errorf("hooks file %s: %s: %w", filename, hooks.Repo, err)
+			}
+		}
+	}
+
+	return file.Repos, nil
+}
+
+// repoHooks returns the hooks of the first entry matching repo
+func (c *Config) repoHooks(repo string) RepoHooks {
+	trimmed := strings.TrimSuffix(repo, ".git")
+	for _, hooks := range c.RepoHooks {
+		if ok, _ := path.Match(hooks.Repo, repo); ok {
+			return hooks
+		}
+		if ok, _ := path.Match(hooks.Repo, trimmed); ok {
+			return hooks
+		}
+	}
+	return RepoHooks{}
+}
+
+// loadHooks returns the hooks for the task's repository: those of the
+// repository's own hooks file when it has one, otherwise the worker's
+func (tp *TaskProcessor) loadHooks(repoDir string) (RepoHooks, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, RepoHooksFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return tp.config.repoHooks(tp.task.Repo), nil
+	}
+	if err != nil {
+		return RepoHooks{}, fmt.Errorf("failed to read %s: %w", RepoHooksFileName, err)
+	}
+
+	var hooks RepoHooks
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return RepoHooks{}, fmt.Errorf("failed to parse %s: %w", RepoHooksFileName, err)
+	}
+	// Signing keys belong to the worker, so only its own configuration may
+	// choose one
+	if hooks.Commit != nil && hooks.Commit.Signing != "" {
+		return RepoHooks{}, fmt.Errorf("%s: commit signing can only be configured on the worker", RepoHooksFileName)
+	}
+	return hooks, nil
+}
+
+// hookFailure describes a setup or verification command that failed
+type hookFailure struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+// runHooks runs commands one after another in repoDir, storing their output
+// as task logs through recorder. It stops at the first command that fails
+// and returns it; only a cancelled context is returned as an error.
+func (tp *TaskProcessor) runHooks(ctx context.Context, kind string, commands []string, repoDir string, env []string, recorder *outputRecorder) (*hookFailure, error) {
+	for _, command := range commands {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Running %s command: %s", kind, command))
+
+		limited := newLimitedCommand(ctx, tp.config.limits(), "sh", "-c", command)
+		cmd := limited.cmd
+		cmd.Dir = repoDir
+		cmd.Env = childEnvironment(env...)
+
+		var combined syncBuffer
+		stdout := newLineWriter(models.LogStreamStdout, recorder.Record, &combined)
+		stderr := newLineWriter(models.LogStreamStderr, recorder.Record, &combined)
+		cmd.Stdout = limited.limitOutput(stdout)
+		cmd.Stderr = limited.limitOutput(stderr)
+
+		err := limited.Run()
+		stdout.Flush()
+		stderr.Flush()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("%s command failed: %s: %v", capitalize(kind), command, err))
+			return &hookFailure{Command: command, Output: combined.String(), Err: err}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// buildVerifyFailurePrompt builds the continuation prompt sent to the agent
+// after a verification command failed
+func buildVerifyFailurePrompt(failure *hookFailure) string {
+	output := strings.TrimSpace(failure.Output)
+	// The end of the output is where the failure is reported, so keep the tail
+	if len(output) > ciLogExcerptLimit {
+		output = output[len(output)-ciLogExcerptLimit:]
+	}
+	return fmt.Sprintf("Verification command `%s` failed (%v):\n```\n%s\n```\nFix and retry.", failure.Command, failure.Err, output)
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,210 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestLoadRepoHooks(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "hooks.json")
+	err := os.WriteFile(filename, []byte(`{"repos": [
+		{"repo": "https://github.com/acme/web", "setup": ["npm ci"], "verify": ["npm test"]},
+		{"repo": "https://github.com/acme/*", "verify": ["go vet ./..."]}
+	]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := LoadRepoHooks(filename)
+	if err != nil {
+		t.Fatalf("LoadRepoHooks() error = %v", err)
+	}
+	config := &Config{RepoHooks: hooks}
+
+	tests := []struct {
+		repo   string
+		verify string
+	}{
+		{"https://github.com/acme/web.git", "npm test"},
+		{"https://github.com/acme/api", "go vet ./..."},
+		{"https://github.com/other/api", ""},
+	}
+	for _, tt := range tests {
+		got := config.repoHooks(tt.repo)
+		verify := strings.Join(got.Verify, " && ")
+		if verify != tt.verify {
+			t.Errorf("repoHooks(%s).Verify = %q, want %q", tt.repo, verify, tt.verify)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"no repo":     `{"repos": [{"verify": ["make"]}]}`,
+		"bad pattern": `{"repos": [{"repo": "https://github.com/[acme", "verify": ["make"]}]}`,
+		"not json":    `repos: []`,
+		"bad author":  `{"repos": [{"repo": "https://github.com/acme/*", "commit": {"author": "bot"}}]}`,
+	} {
+		filename := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".json")
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRepoHooks(filename); err == nil {
+			t.Errorf("%s: LoadRepoHooks() error = nil, want an error", name)
+		}
+	}
+}
+
+func TestExecute_VerificationFailureRetriesWithoutPushing(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"success"}}
+	processor, taskSvc, gitOps, ampOps := newTestProcessor(t, github)
+	processor.config.RepoHooks = []RepoHooks{{
+		Repo:   "https://github.com/acme/*",
+		Verify: []string{"test -f fixed || { touch fixed; echo 'main.go:3: unused import'; exit 1; }"},
+	}}
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if processor.task.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", processor.task.Attempts)
+	}
+	if gitOps.pushes != 1 || len(gitOps.commits) != 1 {
+		t.Errorf("pushes = %d, commits = %d, want only the verified attempt pushed", gitOps.pushes, len(gitOps.commits))
+	}
+	if len(ampOps.prompts) != 2 || !strings.Contains(ampOps.prompts[1], "main.go:3: unused import") {
+		t.Errorf("prompts = %q, want the verification output fed back", ampOps.prompts)
+	}
+
+	// The command's output is stored with the attempt that produced it
+	found := false
+	for _, entry := range taskSvc.entries {
+		if entry.Message == "main.go:3: unused import" && entry.Attempt == 1 && entry.Stream == models.LogStreamStdout {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("verification output not stored in the task logs")
+	}
+}
+
+func TestExecute_VerificationExhaustsRetries(t *testing.T) {
+	processor, _, gitOps, _ := newTestProcessor(t, &fakeGitHubOps{conclusions: []string{"success"}})
+	processor.config.MaxRetries = 2
+	processor.config.RepoHooks = []RepoHooks{{Repo: "https://github.com/acme/api", Verify: []string{"echo still broken; exit 1"}}}
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusNeedsReview {
+		t.Fatalf("Status = %s, want needs_review (error: %v)", result.Status, result.Error)
+	}
+	if gitOps.pushes != 0 {
+		t.Errorf("pushes = %d, want nothing pushed", gitOps.pushes)
+	}
+	if !strings.Contains(result.Summary, "Verification still failing after 2 attempts") {
+		t.Errorf("Summary = %q, want the verification failure", result.Summary)
+	}
+}
+
+func TestExecute_RepoHooksFile(t *testing.T) {
+	processor, _, _, _ := newTestProcessor(t, &fakeGitHubOps{conclusions: []string{"success"}})
+	// The repository's own file takes precedence over the worker's hooks
+	processor.config.RepoHooks = []RepoHooks{{Repo: "https://github.com/acme/*", Verify: []string{"exit 1"}}}
+
+	repoDir := filepath.Join(processor.workDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(repoDir, RepoHooksFileName), []byte(`{"setup": ["touch .prepared"], "verify": ["test -f .prepared"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := processor.Execute(context.Background())
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if processor.task.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", processor.task.Attempts)
+	}
+
+	// A failing setup command fails the task before the agent runs
+	processor, _, _, ampOps := newTestProcessor(t, nil)
+	processor.config.RepoHooks = []RepoHooks{{Repo: "https://github.com/acme/api.git", Setup: []string{"exit 3"}}}
+
+	result = processor.Execute(context.Background())
+	if result.Status != models.TaskStatusError || result.Error == nil || !strings.Contains(result.Error.Error(), "setup command") {
+		t.Fatalf("result = %s (%v), want a setup error", result.Status, result.Error)
+	}
+	if len(ampOps.prompts) != 0 {
+		t.Errorf("prompts = %q, want the agent never run", ampOps.prompts)
+	}
+}
+
+func TestExecute_SetupOutputSharesFirstAttemptLog(t *testing.T) {
+	processor, taskSvc, _, _ := newTestProcessor(t, &fakeGitHubOps{conclusions: []string{"failure", "success"}})
+	processor.config.RepoHooks = []RepoHooks{{Repo: "https://github.com/acme/api.git", Setup: []string{"echo installing"}}}
+
+	result := processor.Execute(context.Background())
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+
+	// The setup output opens the first attempt's log, and no two lines of an
+	// attempt share a sequence number
+	type position struct{ attempt, sequence int }
+	seen := map[position]string{}
+	for _, entry := range taskSvc.entries {
+		at := position{entry.Attempt, entry.Sequence}
+		if previous, ok := seen[at]; ok {
+			t.Errorf("attempt %d sequence %d holds both %q and %q", at.attempt, at.sequence, previous, entry.Message)
+		}
+		seen[at] = entry.Message
+	}
+	if seen[position{1, 1}] != "installing" || seen[position{1, 2}] != "Editing main.go" {
+		t.Errorf("first attempt starts with %q, %q, want the setup output then the agent's", seen[position{1, 1}], seen[position{1, 2}])
+	}
+	if seen[position{2, 1}] != "Editing main.go" {
+		t.Errorf("second attempt starts with %q, want its own sequence", seen[position{2, 1}])
+	}
+}
+
+func TestExecute_RepoCommitSettings(t *testing.T) {
+	processor, _, gitOps, _ := newTestProcessor(t, &fakeGitHubOps{conclusions: []string{"success"}})
+	processor.config.Commit = CommitSettings{Template: "Amp: {{.Subject}}"}
+
+	repoDir := filepath.Join(processor.workDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(repoDir, RepoHooksFileName), []byte(`{"commit": {"template": "test: {{.Subject}} ({{.Branch}})"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := processor.Execute(context.Background())
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	want := "test: Migrate Mocha tests to Vitest (amp/01TEST)\n\nTask-ID: 01TESTTASK"
+	if len(gitOps.commits) != 1 || gitOps.commits[0] != want {
+		t.Errorf("commits = %q, want the repository's template %q", gitOps.commits, want)
+	}
+
+	// Only the worker may choose a signing key
+	err = os.WriteFile(filepath.Join(repoDir, RepoHooksFileName), []byte(`{"commit": {"signing": "ssh", "signing_key": "/etc/ssh/ssh_host_ed25519_key"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor.task.Attempts = 0
+	result = processor.Execute(context.Background())
+	if result.Status != models.TaskStatusError || result.Error == nil || !strings.Contains(result.Error.Error(), "commit signing") {
+		t.Fatalf("result = %s (%v), want a commit signing error", result.Status, result.Error)
+	}
+}
@@ -0,0 +1,254 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+// httpRequestTimeout bounds each call to the orchestrator
+const httpRequestTimeout = 30 * time.Second
+
+// HTTPTaskService implements TaskService against the orchestrator's worker
+// API, so workers can run on machines without access to its database
+type HTTPTaskService struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewHTTPTaskService creates a TaskService for the orchestrator at baseURL,
+// authenticating with the shared worker token. A bare host:port is treated as http.
+func NewHTTPTaskService(baseURL, token string) *HTTPTaskService {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &HTTPTaskService{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/api/v1/worker",
+		token:      token,
+		httpClient: &http.Client{Timeout: httpRequestTimeout},
+	}
+}
+
+// httpError is an error response from the worker API
+type httpError struct {
+	StatusCode int
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *httpError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("orchestrator returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("orchestrator returned %d", e.StatusCode)
+}
+
+// Unwrap maps the API's conflict codes back to the service errors the worker checks for
+func (e *httpError) Unwrap() error {
+	switch e.Code {
+	case "lease_lost":
+		return services.ErrLeaseLost
+	case "task_aborted":
+		return services.ErrTaskAborted
+	}
+	return nil
+}
+
+// do sends a JSON request to the worker API and decodes a JSON response into
+// out when one is given. It returns the response status code.
+func (s *HTTPTaskService) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("orchestrator request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &httpError{StatusCode: resp.StatusCode}
+		json.Unmarshal(data, apiErr)
+		return resp.StatusCode, apiErr
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// taskPath returns the API path of a task, plus an optional suffix
+func taskPath(taskID, suffix string) string {
+	return "/tasks/" + url.PathEscape(taskID) + suffix
+}
+
+// leaseSeconds converts a lease duration to whole seconds, never less than one
+func leaseSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// ClaimNextTask leases the oldest queued task, returning nil when there is none
+func (s *HTTPTaskService) ClaimNextTask(ctx context.Context, workerID string, leaseDuration time.Duration) (*models.Task, error) {
+	var task models.Task
+	status, err := s.do(ctx, http.MethodPost, "/claim", map[string]interface{}{
+		"worker_id":     workerID,
+		"lease_seconds": leaseSeconds(leaseDuration),
+	}, &task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim next task: %w", err)
+	}
+	if status == http.StatusNoContent {
+		return nil, nil
+	}
+
+	return &task, nil
+}
+
+// RenewLease extends the lease workerID holds on a task. It returns an
+// error wrapping services.ErrLeaseLost if the lease has been lost.
+func (s *HTTPTaskService) RenewLease(ctx context.Context, taskID, workerID string, leaseDuration time.Duration) error {
+	_, err := s.do(ctx, http.MethodPost, taskPath(taskID, "/heartbeat"), map[string]interface{}{
+		"worker_id":     workerID,
+		"lease_seconds": leaseSeconds(leaseDuration),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to renew lease: %w", err)
+	}
+	return nil
+}
+
+// ReleaseTask gives up the lease workerID holds on a task
+func (s *HTTPTaskService) ReleaseTask(ctx context.Context, taskID, workerID string) error {
+	_, err := s.do(ctx, http.MethodPost, taskPath(taskID, "/release"), map[string]interface{}{
+		"worker_id": workerID,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to release task: %w", err)
+	}
+	return nil
+}
+
+// ReapExpiredTasks asks the orchestrator to recover tasks whose lease expired
+func (s *HTTPTaskService) ReapExpiredTasks(ctx context.Context, maxAttempts int) (int, error) {
+	var resp struct {
+		Reaped int `json:"reaped"`
+	}
+	_, err := s.do(ctx, http.MethodPost, "/reap", map[string]interface{}{
+		"max_attempts": maxAttempts,
+	}, &resp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reap expired tasks: %w", err)
+	}
+	return resp.Reaped, nil
+}
+
+// UpdateTaskStatus updates the status of a task
+func (s *HTTPTaskService) UpdateTaskStatus(ctx context.Context, taskID string, status string) error {
+	_, err := s.do(ctx, http.MethodPut, taskPath(taskID, "/status"), map[string]interface{}{
+		"status": status,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update task status: %w", err)
+	}
+	return nil
+}
+
+// ReportTask reports the worker's copy of a task it holds the lease on. It
+// returns an error wrapping services.ErrTaskAborted if the task was aborted
+// in the meantime, or services.ErrLeaseLost if the lease was.
+func (s *HTTPTaskService) ReportTask(ctx context.Context, task *models.Task, workerID string) error {
+	body := map[string]interface{}{
+		"worker_id": workerID,
+		"task":      task,
+	}
+	if _, err := s.do(ctx, http.MethodPut, taskPath(task.ID, ""), body, nil); err != nil {
+		return fmt.Errorf("failed to update task: %w", err)
+	}
+	return nil
+}
+
+// GetTaskStatus returns the current status of a task
+func (s *HTTPTaskService) GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error) {
+	var resp struct {
+		Status models.TaskStatus `json:"status"`
+	}
+	if _, err := s.do(ctx, http.MethodGet, taskPath(taskID, "/status"), nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to get task status: %w", err)
+	}
+	return resp.Status, nil
+}
+
+// AddTaskLog adds a log entry for a task
+func (s *HTTPTaskService) AddTaskLog(ctx context.Context, taskID string, level, message string) error {
+	return s.AddTaskLogEntries(ctx, taskID, []*models.TaskLog{{
+		TaskID:    taskID,
+		Level:     level,
+		Message:   message,
+		Timestamp: time.Now(),
+	}})
+}
+
+// AddTaskLogEntries appends fully populated log entries, such as a batch of
+// agent output, in one request
+func (s *HTTPTaskService) AddTaskLogEntries(ctx context.Context, taskID string, entries []*models.TaskLog) error {
+	for _, entry := range entries {
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now()
+		}
+	}
+
+	_, err := s.do(ctx, http.MethodPost, taskPath(taskID, "/logs"), map[string]interface{}{
+		"logs": entries,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add task log: %w", err)
+	}
+	return nil
+}
+
+// SaveTaskDiff records what an attempt changed
+func (s *HTTPTaskService) SaveTaskDiff(ctx context.Context, diff *models.TaskDiff) error {
+	if _, err := s.do(ctx, http.MethodPost, taskPath(diff.TaskID, "/diffs"), diff, nil); err != nil {
+		return fmt.Errorf("failed to save task diff: %w", err)
+	}
+	return nil
+}
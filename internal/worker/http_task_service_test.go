@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/api"
+	"github.com/brettsmith212/ci-test-2/internal/config"
+	"github.com/brettsmith212/ci-test-2/internal/database"
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+// newTestOrchestrator serves the orchestrator's API over a fresh database
+func newTestOrchestrator(t *testing.T, workerToken string) (*httptest.Server, *services.TaskService) {
+	t.Helper()
+
+	if err := database.Connect(filepath.Join(t.TempDir(), "orchestrator.db")); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	server := api.NewServer(&config.Config{Server: config.ServerConfig{WorkerToken: workerToken}})
+	ts := httptest.NewServer(server.GetRouter())
+	t.Cleanup(ts.Close)
+
+	return ts, services.NewTaskServiceDefault()
+}
+
+func TestHTTPTaskService_TaskLifecycle(t *testing.T) {
+	ctx := context.Background()
+	ts, taskSvc := newTestOrchestrator(t, "s3cret")
+	client := NewHTTPTaskService(ts.URL, "s3cret")
+
+	task, err := client.ClaimNextTask(ctx, "worker-a", time.Minute)
+	if err != nil || task != nil {
+		t.Fatalf("ClaimNextTask() = %v, %v, want nothing to claim", task, err)
+	}
+
+	created, err := taskSvc.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	task, err = client.ClaimNextTask(ctx, "worker-a", time.Minute)
+	if err != nil || task == nil || task.ID != created.ID {
+		t.Fatalf("ClaimNextTask() = %v, %v, want task %s", task, err, created.ID)
+	}
+	if task.Status != models.TaskStatusRunning || task.ClaimedBy != "worker-a" {
+		t.Errorf("claimed task status = %s, claimed by %q", task.Status, task.ClaimedBy)
+	}
+
+	if err := client.RenewLease(ctx, task.ID, "worker-a", time.Minute); err != nil {
+		t.Errorf("RenewLease() error = %v", err)
+	}
+	if err := client.RenewLease(ctx, task.ID, "worker-b", time.Minute); !errors.Is(err, services.ErrLeaseLost) {
+		t.Errorf("RenewLease() by another worker error = %v, want ErrLeaseLost", err)
+	}
+
+	client.AddTaskLog(ctx, task.ID, "info", "Cloning repository...")
+	client.AddTaskLogEntries(ctx, task.ID, []*models.TaskLog{
+		{Level: "info", Message: "ok", Stream: models.LogStreamStdout, Attempt: 1, Sequence: 1},
+		{Level: "info", Message: "done", Stream: models.LogStreamStdout, Attempt: 1, Sequence: 2},
+	})
+	logs, err := taskSvc.GetTaskLogs(task.ID, 0, 0)
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("GetTaskLogs() = %d entries, %v, want 3", len(logs), err)
+	}
+	if logs[0].Message != "Cloning repository..." || logs[1].Stream != models.LogStreamStdout || logs[1].Attempt != 1 || logs[2].Sequence != 2 {
+		t.Errorf("logs = %+v, want the entries in order with their stream and attempt", logs)
+	}
+
+	diff := &models.TaskDiff{TaskID: task.ID, Attempt: 1, Files: []models.DiffFile{{Path: "auth.go", Status: models.DiffFileModified, Additions: 3}}, Additions: 3}
+	if err := client.SaveTaskDiff(ctx, diff); err != nil {
+		t.Fatalf("SaveTaskDiff() error = %v", err)
+	}
+	if stored, err := taskSvc.GetTaskDiff(task.ID, 1); err != nil || len(stored.Files) != 1 || stored.Additions != 3 {
+		t.Errorf("GetTaskDiff() = %+v, %v, want the diff the worker sent", stored, err)
+	}
+
+	task.Status = models.TaskStatusSuccess
+	task.Attempts = 1
+	task.PRURL = "https://github.com/acme/api/pull/7"
+	if err := client.ReportTask(ctx, task, "worker-b"); !errors.Is(err, services.ErrLeaseLost) {
+		t.Errorf("ReportTask() by another worker error = %v, want ErrLeaseLost", err)
+	}
+	if err := client.ReportTask(ctx, task, "worker-a"); err != nil {
+		t.Fatalf("ReportTask() error = %v", err)
+	}
+	if err := client.ReleaseTask(ctx, task.ID, "worker-a"); err != nil {
+		t.Fatalf("ReleaseTask() error = %v", err)
+	}
+
+	stored, _ := taskSvc.GetTask(task.ID)
+	if stored.Status != models.TaskStatusSuccess || stored.PRURL != task.PRURL || stored.ClaimedBy != "" {
+		t.Errorf("stored task = status %s, PR %q, claimed by %q", stored.Status, stored.PRURL, stored.ClaimedBy)
+	}
+	if status, err := client.GetTaskStatus(ctx, task.ID); err != nil || status != models.TaskStatusSuccess {
+		t.Errorf("GetTaskStatus() = %s, %v, want success", status, err)
+	}
+}
+
+func TestHTTPTaskService_AbortAndReap(t *testing.T) {
+	ctx := context.Background()
+	ts, taskSvc := newTestOrchestrator(t, "s3cret")
+	client := NewHTTPTaskService(ts.URL, "s3cret")
+
+	taskSvc.CreateTask("https://github.com/acme/api.git", "Fix the flaky test")
+	task, err := client.ClaimNextTask(ctx, "worker-a", time.Minute)
+	if err != nil || task == nil {
+		t.Fatalf("ClaimNextTask() = %v, %v", task, err)
+	}
+
+	// A report never overwrites an abort made while the worker was busy
+	if err := client.UpdateTaskStatus(ctx, task.ID, string(models.TaskStatusAborted)); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+	task.Status = models.TaskStatusError
+	if err := client.ReportTask(ctx, task, "worker-a"); !errors.Is(err, services.ErrTaskAborted) {
+		t.Errorf("ReportTask() error = %v, want ErrTaskAborted", err)
+	}
+
+	taskSvc.CreateTask("https://github.com/acme/api.git", "Bump dependencies")
+	if _, err := client.ClaimNextTask(ctx, "worker-b", time.Second); err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if reaped, err := client.ReapExpiredTasks(ctx, 3); err != nil || reaped != 1 {
+		t.Errorf("ReapExpiredTasks() = %d, %v, want 1", reaped, err)
+	}
+}
+
+func TestHTTPTaskService_RequiresWorkerToken(t *testing.T) {
+	ts, _ := newTestOrchestrator(t, "s3cret")
+
+	client := NewHTTPTaskService(ts.URL, "wrong")
+	_, err := client.ClaimNextTask(context.Background(), "worker-a", time.Minute)
+
+	var apiErr *httpError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("ClaimNextTask() error = %v, want 401 unauthorized", err)
+	}
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// LimitExceededError reports the resource limit that stopped a process
+type LimitExceededError struct {
+	// Limit is one of "wall-clock", "cpu", "memory" or "output"
+	Limit string
+	// Max describes the configured limit, e.g. "30m0s" or "1048576 bytes"
+	Max string
+}
+
+// Error implements the error interface
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit of %s exceeded", e.Limit, e.Max)
+}
+
+// limitedCommand runs a process under ResourceLimits. The wall-clock and
+// output limits are enforced by the worker; CPU time and memory use a cgroup
+// v2 when ResourceLimits.CgroupRoot is usable, and rlimits otherwise.
+type limitedCommand struct {
+	cmd    *exec.Cmd
+	limits ResourceLimits
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	cgroup *processCgroup
+
+	mu     sync.Mutex
+	output int64
+}
+
+// newLimitedCommand prepares name with args to run under limits. The caller
+// sets up the returned command's Dir, Env and I/O, then calls Run.
+func newLimitedCommand(ctx context.Context, limits ResourceLimits, name string, args ...string) *limitedCommand {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	c := &limitedCommand{
+		limits: limits,
+		ctx:    runCtx,
+		cancel: cancel,
+	}
+
+	if limits.CPUTime > 0 || limits.Memory > 0 {
+		if limits.CgroupRoot != "" {
+			cgroup, err := newProcessCgroup(limits.CgroupRoot, limits)
+			if err != nil {
+				log.Printf("Cgroup unavailable, falling back to rlimits: %v", err)
+			}
+			c.cgroup = cgroup
+		}
+		if c.cgroup == nil {
+			name, args = withRlimits(limits, name, args)
+		}
+	}
+
+	c.cmd = exec.CommandContext(runCtx, name, args...)
+	setProcessGroup(c.cmd)
+	if c.cgroup != nil {
+		c.cgroup.attach(c.cmd)
+	}
+
+	return c
+}
+
+// limitOutput wraps w so that output beyond the output limit is dropped and stops the process
+func (c *limitedCommand) limitOutput(w io.Writer) io.Writer {
+	if c.limits.Output <= 0 {
+		return w
+	}
+	return &limitWriter{command: c, w: w}
+}
+
+// Run runs the process until it exits, returning a *LimitExceededError if
+// one of the limits stopped it
+func (c *limitedCommand) Run() error {
+	defer c.cancel(nil)
+	if c.cgroup != nil {
+		defer c.cgroup.remove()
+	}
+
+	if c.limits.WallClock > 0 {
+		timer := time.AfterFunc(c.limits.WallClock, func() {
+			c.cancel(&LimitExceededError{Limit: "wall-clock", Max: c.limits.WallClock.String()})
+		})
+		defer timer.Stop()
+	}
+
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+	if c.cgroup != nil {
+		go c.cgroup.watch(c.ctx, c.cancel)
+	}
+	err := c.cmd.Wait()
+
+	var limitErr *LimitExceededError
+	if errors.As(context.Cause(c.ctx), &limitErr) {
+		return limitErr
+	}
+	if c.cgroup != nil {
+		if limitErr := c.cgroup.exceeded(); limitErr != nil {
+			return limitErr
+		}
+	}
+	if limitErr := rlimitExceeded(err, c.limits); limitErr != nil {
+		return limitErr
+	}
+	return err
+}
+
+// limitWriter counts the output of a limitedCommand across its streams
+type limitWriter struct {
+	command *limitedCommand
+	w       io.Writer
+}
+
+// Write passes p through until the output limit is reached
+func (l *limitWriter) Write(p []byte) (int, error) {
+	c := l.command
+	c.mu.Lock()
+	remaining := c.limits.Output - c.output
+	c.output += int64(len(p))
+	c.mu.Unlock()
+
+	if remaining < int64(len(p)) {
+		if remaining > 0 {
+			l.w.Write(p[:remaining])
+		}
+		c.cancel(&LimitExceededError{Limit: "output", Max: fmt.Sprintf("%d bytes", c.limits.Output)})
+		// Report success so the process is stopped by the limit rather than a broken pipe
+		return len(p), nil
+	}
+
+	return l.w.Write(p)
+}
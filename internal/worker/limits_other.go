@@ -0,0 +1,13 @@
+//go:build !unix
+
+package worker
+
+// withRlimits leaves the command unchanged on platforms without rlimits
+func withRlimits(limits ResourceLimits, name string, args []string) (string, []string) {
+	return name, args
+}
+
+// rlimitExceeded never reports a limit on platforms without rlimits
+func rlimitExceeded(err error, limits ResourceLimits) *LimitExceededError {
+	return nil
+}
@@ -0,0 +1,145 @@
+//go:build unix
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runLimited runs a shell script under limits, returning its output and error
+func runLimited(t *testing.T, limits ResourceLimits, script string) (string, error) {
+	t.Helper()
+
+	var output syncBuffer
+	limited := newLimitedCommand(context.Background(), limits, "/bin/sh", "-c", script)
+	limited.cmd.Stdout = limited.limitOutput(&output)
+	limited.cmd.Stderr = limited.limitOutput(&output)
+
+	err := limited.Run()
+	return output.String(), err
+}
+
+// assertLimit fails the test unless err reports that limit was exceeded
+func assertLimit(t *testing.T, err error, limit string) {
+	t.Helper()
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Limit != limit {
+		t.Fatalf("Run() error = %v, want the %s limit exceeded", err, limit)
+	}
+}
+
+func TestLimitedCommand_WithinLimits(t *testing.T) {
+	limits := ResourceLimits{WallClock: time.Minute, CPUTime: time.Minute, Memory: 1 << 30, Output: 1 << 20}
+
+	output, err := runLimited(t, limits, "echo hello")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if output != "hello\n" {
+		t.Errorf("output = %q, want hello", output)
+	}
+}
+
+func TestLimitedCommand_WallClock(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "child-survived")
+
+	// The background child is in the process group and is killed with the shell
+	start := time.Now()
+	_, err := runLimited(t, ResourceLimits{WallClock: 200 * time.Millisecond}, "(sleep 1 && touch "+marker+") & sleep 10")
+	assertLimit(t, err, "wall-clock")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %v, want it stopped at the limit", elapsed)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("background child outlived the run")
+	}
+}
+
+func TestLimitedCommand_Output(t *testing.T) {
+	output, err := runLimited(t, ResourceLimits{Output: 1000}, "yes")
+	assertLimit(t, err, "output")
+	if len(output) != 1000 {
+		t.Errorf("kept %d bytes of output, want 1000", len(output))
+	}
+}
+
+func TestLimitedCommand_CPURlimit(t *testing.T) {
+	_, err := runLimited(t, ResourceLimits{WallClock: time.Minute, CPUTime: time.Second}, "while :; do :; done")
+	assertLimit(t, err, "cpu")
+}
+
+func TestLimitedCommand_MemoryRlimit(t *testing.T) {
+	output, err := runLimited(t, ResourceLimits{Memory: 512 << 20}, "ulimit -v")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := strings.TrimSpace(output); got != strconv.Itoa(512<<10) {
+		t.Errorf("ulimit -v = %s, want %d", got, 512<<10)
+	}
+}
+
+func TestLimitedCommand_CgroupCPU(t *testing.T) {
+	root := writableCgroupRoot(t)
+
+	limits := ResourceLimits{WallClock: time.Minute, CPUTime: 500 * time.Millisecond, CgroupRoot: root}
+	_, err := runLimited(t, limits, "while :; do :; done")
+	assertLimit(t, err, "cpu")
+
+	// The run's cgroup is removed afterwards
+	entries, _ := os.ReadDir(root)
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "task-") {
+			t.Errorf("cgroup %s was not removed", entry.Name())
+		}
+	}
+}
+
+// writableCgroupRoot returns a fresh cgroup v2 directory for the test, or skips it
+func writableCgroupRoot(t *testing.T) string {
+	t.Helper()
+
+	for _, mount := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		if _, err := os.Stat(filepath.Join(mount, "cgroup.controllers")); err != nil {
+			continue
+		}
+		root, err := os.MkdirTemp(mount, "worker-test-")
+		if err != nil {
+			continue
+		}
+		t.Cleanup(func() { os.Remove(root) })
+		if _, err := os.Stat(filepath.Join(root, "cpu.stat")); err != nil {
+			continue
+		}
+		return root
+	}
+
+	t.Skip("no writable cgroup v2 hierarchy")
+	return ""
+}
+
+func TestLimitWriter_SharedAcrossStreams(t *testing.T) {
+	limited := newLimitedCommand(context.Background(), ResourceLimits{Output: 10}, "true")
+	var stdout, stderr bytes.Buffer
+
+	limited.limitOutput(&stdout).Write([]byte("123456"))
+	limited.limitOutput(&stderr).Write([]byte("7890abc"))
+
+	if stdout.String() != "123456" || stderr.String() != "7890" {
+		t.Errorf("stdout = %q, stderr = %q, want 10 bytes in total", stdout.String(), stderr.String())
+	}
+	var limitErr *LimitExceededError
+	if !errors.As(context.Cause(limited.ctx), &limitErr) || limitErr.Limit != "output" {
+		t.Errorf("cause = %v, want the output limit exceeded", context.Cause(limited.ctx))
+	}
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// withRlimits wraps name and args in a shell that sets the CPU time and
+// memory rlimits before exec'ing the command. Rlimits apply to each process
+// separately, so a command's children each get the full budget.
+func withRlimits(limits ResourceLimits, name string, args []string) (string, []string) {
+	var ulimits []string
+	if limits.CPUTime > 0 {
+		// Only the soft limit, so the kernel sends SIGXCPU and the cause can be told apart
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -S -t %d", int64(math.Ceil(limits.CPUTime.Seconds()))))
+	}
+	if limits.Memory > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", limits.Memory/1024))
+	}
+	if len(ulimits) == 0 {
+		return name, args
+	}
+
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	return "/bin/sh", append([]string{"-c", script, name}, args...)
+}
+
+// rlimitExceeded reports whether err means the process hit its CPU rlimit.
+// Running out of address space surfaces as an ordinary allocation failure in
+// the process, so memory rlimits cannot be told apart from other errors.
+func rlimitExceeded(err error, limits ResourceLimits) *LimitExceededError {
+	var exitErr *exec.ExitError
+	if limits.CPUTime <= 0 || !errors.As(err, &exitErr) {
+		return nil
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() && status.Signal() == syscall.SIGXCPU {
+		return &LimitExceededError{Limit: "cpu", Max: limits.CPUTime.String()}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mirrorLockPollInterval is how often a busy mirror lock is retried
+const mirrorLockPollInterval = 100 * time.Millisecond
+
+// unsafeMirrorChars matches characters not allowed in mirror directory names
+var unsafeMirrorChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// MirrorCache keeps one bare mirror per repository under dir. Tasks clone
+// from the mirror, which is fetched incrementally, instead of from the remote.
+// Each mirror is guarded by a lock file so concurrent tasks, including those
+// of other workers sharing the directory, update and read it one at a time.
+type MirrorCache struct {
+	dir      string
+	maxBytes int64
+}
+
+// NewMirrorCache creates a mirror cache in dir that evicts the least recently
+// used mirrors once their total size exceeds maxBytes
+func NewMirrorCache(dir string, maxBytes int64) *MirrorCache {
+	return &MirrorCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+}
+
+// path returns the mirror directory for a repository URL
+func (m *MirrorCache) path(repoURL string) string {
+	sum := sha256.Sum256([]byte(repoURL))
+
+	// Keep the repository name readable; the hash keeps it unique
+	name := strings.TrimSuffix(strings.TrimRight(repoURL, "/"), ".git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = unsafeMirrorChars.ReplaceAllString(name, "-")
+
+	return filepath.Join(m.dir, fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:6])))
+}
+
+// lock takes the exclusive lock on a mirror, waiting until it is free or ctx is done
+func (m *MirrorCache) lock(ctx context.Context, mirrorDir string) (func(), error) {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	ticker := time.NewTicker(mirrorLockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		unlock, err := tryLockFile(mirrorDir + ".lock")
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock mirror: %w", err)
+		}
+		if unlock != nil {
+			return unlock, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// evict removes the least recently used mirrors until the cache fits in its
+// size budget. Mirrors in use and the mirror at keep are never removed.
+func (m *MirrorCache) evict(keep string) {
+	if m.maxBytes <= 0 {
+		return
+	}
+
+	type mirror struct {
+		path     string
+		size     int64
+		lastUsed time.Time
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		log.Printf("Failed to read mirror cache: %v", err)
+		return
+	}
+
+	var mirrors []mirror
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(m.dir, entry.Name())
+		size := dirSize(path)
+		mirrors = append(mirrors, mirror{path: path, size: size, lastUsed: info.ModTime()})
+		total += size
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].lastUsed.Before(mirrors[j].lastUsed)
+	})
+
+	for _, candidate := range mirrors {
+		if total <= m.maxBytes {
+			return
+		}
+		if candidate.path == keep {
+			continue
+		}
+
+		unlock, err := tryLockFile(candidate.path + ".lock")
+		if err != nil || unlock == nil {
+			continue
+		}
+		err = os.RemoveAll(candidate.path)
+		unlock()
+		if err != nil {
+			log.Printf("Failed to evict mirror %s: %v", candidate.path, err)
+			continue
+		}
+
+		log.Printf("Evicted mirror %s (%d bytes)", filepath.Base(candidate.path), candidate.size)
+		total -= candidate.size
+	}
+}
+
+// cloneFromMirror brings the repository's mirror up to date and clones it to
+// destDir. The clone hard-links the mirror's objects, and its origin is
+// pointed back at repoURL so branches are pushed to the real remote.
+func (g *gitOperations) cloneFromMirror(ctx context.Context, repoURL, destDir string) error {
+	mirrorDir := g.mirrors.path(repoURL)
+
+	unlock, err := g.mirrors.lock(ctx, mirrorDir)
+	if err != nil {
+		return err
+	}
+
+	err = g.updateMirror(ctx, repoURL, mirrorDir)
+	if err == nil {
+		err = cloneLocal(ctx, mirrorDir, repoURL, destDir)
+	}
+	if err == nil {
+		// The directory's modification time records when the mirror was last used
+		now := time.Now()
+		os.Chtimes(mirrorDir, now, now)
+	}
+	unlock()
+
+	if err != nil {
+		return err
+	}
+
+	g.mirrors.evict(mirrorDir)
+	return nil
+}
+
+// updateMirror fetches the latest branches into the mirror, creating it on first use
+func (g *gitOperations) updateMirror(ctx context.Context, repoURL, mirrorDir string) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	if _, err := os.Stat(filepath.Join(mirrorDir, "HEAD")); err == nil {
+		cmd, err := g.remoteCommand(fetchCtx, "--git-dir", mirrorDir, "fetch", "--prune", "--quiet", "origin")
+		if err != nil {
+			return err
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git fetch into mirror failed: %w (output: %s)", err, string(output))
+		}
+		return nil
+	}
+
+	// Build the mirror next to its final location so a failed clone never leaves a partial mirror
+	tmpDir := mirrorDir + ".tmp"
+	os.RemoveAll(tmpDir)
+
+	cmd, err := g.remoteCommand(fetchCtx, "clone", "--bare", "--quiet", repoURL, tmpDir)
+	if err != nil {
+		return err
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("git clone of mirror failed: %w (output: %s)", err, string(output))
+	}
+
+	// Bare clones have no fetch refspec; mirror every branch onto itself
+	configCmd := exec.CommandContext(ctx, "git", "--git-dir", tmpDir, "config", "remote.origin.fetch", "+refs/heads/*:refs/heads/*")
+	if output, err := configCmd.CombinedOutput(); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("failed to configure mirror: %w (output: %s)", err, string(output))
+	}
+
+	if err := os.Rename(tmpDir, mirrorDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("failed to install mirror: %w", err)
+	}
+
+	return nil
+}
+
+// cloneLocal clones the mirror at mirrorDir into destDir and points origin at repoURL
+func cloneLocal(ctx context.Context, mirrorDir, repoURL, destDir string) error {
+	cloneCmd := exec.CommandContext(ctx, "git", "clone", "--quiet", mirrorDir, destDir)
+	if output, err := cloneCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone from mirror failed: %w (output: %s)", err, string(output))
+	}
+
+	remoteCmd := exec.CommandContext(ctx, "git", "remote", "set-url", "origin", repoURL)
+	remoteCmd.Dir = destDir
+	if output, err := remoteCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set origin: %w (output: %s)", err, string(output))
+	}
+
+	return nil
+}
+
+// dirSize returns the total size of the files under path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
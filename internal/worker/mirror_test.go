@@ -0,0 +1,150 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newOriginRepo creates a repository with one commit to clone from
+func newOriginRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+
+	origin := t.TempDir()
+	runGit(t, origin, "init", "-q")
+	os.WriteFile(filepath.Join(origin, "README.md"), []byte("hello\n"), 0644)
+	runGit(t, origin, "add", ".")
+	runGit(t, origin, "commit", "-q", "-m", "initial")
+	return origin
+}
+
+func TestCloneRepository_ThroughMirror(t *testing.T) {
+	ctx := context.Background()
+	origin := newOriginRepo(t)
+	workDir := t.TempDir()
+	mirrors := NewMirrorCache(filepath.Join(workDir, "mirrors"), 1<<30)
+	gitOps := &gitOperations{mirrors: mirrors}
+
+	first := filepath.Join(workDir, "task-1", "repo")
+	if err := gitOps.CloneRepository(ctx, origin, first); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mirrors.path(origin), "HEAD")); err != nil {
+		t.Fatalf("mirror was not created: %v", err)
+	}
+	if url := runGit(t, first, "remote", "get-url", "origin"); url != origin {
+		t.Errorf("origin = %s, want the real remote %s", url, origin)
+	}
+
+	// A branch pushed after the mirror was created is fetched into it for the next task
+	runGit(t, origin, "checkout", "-q", "-b", "amp/01TEST")
+	os.WriteFile(filepath.Join(origin, "fix.go"), []byte("package fix\n"), 0644)
+	runGit(t, origin, "add", ".")
+	runGit(t, origin, "commit", "-q", "-m", "first attempt")
+	branchHead := runGit(t, origin, "rev-parse", "HEAD")
+	runGit(t, origin, "checkout", "-q", "-")
+
+	second := filepath.Join(workDir, "task-2", "repo")
+	if err := gitOps.CloneRepository(ctx, origin, second); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+	existing, err := gitOps.CheckoutRemoteBranch(ctx, second, "amp/01TEST")
+	if err != nil || !existing {
+		t.Fatalf("CheckoutRemoteBranch() = %v, %v, want the new branch found", existing, err)
+	}
+	if head := runGit(t, second, "rev-parse", "HEAD"); head != branchHead {
+		t.Errorf("HEAD = %s, want %s", head, branchHead)
+	}
+}
+
+func TestCloneRepository_ConcurrentTasksShareMirror(t *testing.T) {
+	ctx := context.Background()
+	origin := newOriginRepo(t)
+	workDir := t.TempDir()
+	gitOps := &gitOperations{mirrors: NewMirrorCache(filepath.Join(workDir, "mirrors"), 1<<30)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- gitOps.CloneRepository(ctx, origin, filepath.Join(workDir, fmt.Sprintf("task-%d", i), "repo"))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("CloneRepository() error = %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(workDir, "mirrors"))
+	mirrorCount := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			mirrorCount++
+		}
+	}
+	if mirrorCount != 1 {
+		t.Errorf("found %d mirror directories, want 1", mirrorCount)
+	}
+}
+
+func TestMirrorCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	older := newOriginRepo(t)
+	newer := newOriginRepo(t)
+	busy := newOriginRepo(t)
+	workDir := t.TempDir()
+	// Large enough for nothing but the latest mirror
+	mirrors := NewMirrorCache(filepath.Join(workDir, "mirrors"), 1)
+	gitOps := &gitOperations{mirrors: mirrors}
+
+	if err := gitOps.CloneRepository(ctx, busy, filepath.Join(workDir, "task-0", "repo")); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+
+	// A mirror that another task has locked survives eviction
+	unlock, err := mirrors.lock(ctx, mirrors.path(busy))
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+	defer unlock()
+
+	if err := gitOps.CloneRepository(ctx, older, filepath.Join(workDir, "task-1", "repo")); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+
+	if err := gitOps.CloneRepository(ctx, newer, filepath.Join(workDir, "task-2", "repo")); err != nil {
+		t.Fatalf("CloneRepository() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		repo     string
+		wantKept bool
+	}{
+		{"least recently used", older, false},
+		{"just used", newer, true},
+		{"locked", busy, true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(mirrors.path(tt.repo))
+		if kept := err == nil; kept != tt.wantKept {
+			t.Errorf("%s mirror kept = %v, want %v", tt.name, kept, tt.wantKept)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String returns the buffered data
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// lineWriter splits a process stream into lines, passing each complete line
+// to onLine and copying the raw bytes to combined
+type lineWriter struct {
+	stream   string
+	onLine   OutputFunc
+	combined *syncBuffer
+	partial  []byte
+}
+
+// newLineWriter creates a lineWriter for the given stream. onLine may be nil.
+func newLineWriter(stream string, onLine OutputFunc, combined *syncBuffer) *lineWriter {
+	return &lineWriter{
+		stream:   stream,
+		onLine:   onLine,
+		combined: combined,
+	}
+}
+
+// Write implements io.Writer
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.combined.Write(p)
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush emits any trailing output that did not end with a newline
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.emit(w.partial)
+		w.partial = nil
+	}
+}
+
+// emit passes a single line to onLine
+func (w *lineWriter) emit(line []byte) {
+	if w.onLine != nil {
+		w.onLine(w.stream, strings.TrimRight(string(line), "\r"))
+	}
+}
+
+const (
+	// logBatchSize is how many output lines the recorder buffers before
+	// sending them to the task service
+	logBatchSize = 200
+	// logFlushInterval bounds how long a buffered line waits to be sent
+	logFlushInterval = time.Second
+	// logCloseTimeout bounds sending the last output once the recorder is
+	// closed, which may be after the task's context is done
+	logCloseTimeout = 10 * time.Second
+)
+
+// outputRecorder stores agent output lines as task logs for one attempt,
+// numbering them and stopping once the attempt's storage cap is reached.
+// Lines are buffered and sent in batches from a background goroutine, so a
+// chatty process is never held up by the task service; Close sends the rest.
+type outputRecorder struct {
+	ctx      context.Context
+	taskSvc  TaskService
+	taskID   string
+	attempt  int
+	maxBytes int
+
+	mu        sync.Mutex
+	sequence  int
+	stored    int
+	truncated bool
+	pending   []*models.TaskLog
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// newOutputRecorder creates a recorder for the given attempt of a task and
+// starts sending its output. The caller must Close it.
+func newOutputRecorder(ctx context.Context, taskSvc TaskService, taskID string, attempt, maxBytes int) *outputRecorder {
+	r := &outputRecorder{
+		ctx:      ctx,
+		taskSvc:  taskSvc,
+		taskID:   taskID,
+		attempt:  attempt,
+		maxBytes: maxBytes,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record is an OutputFunc that stores a line of output
+func (r *outputRecorder) Record(stream, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.truncated {
+		return
+	}
+
+	r.sequence++
+	entry := &models.TaskLog{
+		TaskID:    r.taskID,
+		Level:     "info",
+		Message:   line,
+		Stream:    stream,
+		Attempt:   r.attempt,
+		Sequence:  r.sequence,
+		Timestamp: time.Now(),
+	}
+
+	// Replace the first line over the cap with a marker and drop the rest
+	if r.stored+len(line) > r.maxBytes {
+		r.truncated = true
+		entry.Level = "warn"
+		entry.Message = fmt.Sprintf("Output truncated after %d bytes", r.stored)
+	}
+	r.stored += len(line)
+
+	r.pending = append(r.pending, entry)
+	if len(r.pending) >= logBatchSize {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends the output still buffered and stops the recorder. Lines
+// recorded afterwards are not stored.
+func (r *outputRecorder) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+// run sends buffered output whenever a batch fills up or the flush interval
+// passes, and once more when the recorder is closed. Batches are sent from
+// this goroutine only, so they arrive in order.
+func (r *outputRecorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.full:
+		case <-ticker.C:
+		case <-r.stop:
+			// The last lines often explain why the run was stopped, so they
+			// are sent even when the task was aborted or timed out
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), logCloseTimeout)
+			r.flush(ctx)
+			cancel()
+			return
+		}
+		r.flush(r.ctx)
+	}
+}
+
+// flush sends the buffered output to the task service, at most a batch per
+// request
+func (r *outputRecorder) flush(ctx context.Context) {
+	r.mu.Lock()
+	entries := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	for len(entries) > 0 {
+		batch := entries
+		if len(batch) > logBatchSize {
+			batch = batch[:logBatchSize]
+		}
+		entries = entries[len(batch):]
+
+		if err := r.taskSvc.AddTaskLogEntries(ctx, r.taskID, batch); err != nil {
+			log.Printf("Failed to store output for task %s: %v", r.taskID, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	var combined syncBuffer
+	w := newLineWriter(models.LogStreamStdout, func(stream, line string) {
+		lines = append(lines, stream+": "+line)
+	}, &combined)
+
+	// Lines split across writes, Windows line endings and a trailing partial line
+	w.Write([]byte("first li"))
+	w.Write([]byte("ne\nsecond\r\n\nthi"))
+	w.Write([]byte("rd"))
+	w.Flush()
+
+	want := []string{"stdout: first line", "stdout: second", "stdout: ", "stdout: third"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if combined.String() != "first line\nsecond\r\n\nthird" {
+		t.Errorf("combined = %q, want the raw output", combined.String())
+	}
+}
+
+func TestOutputRecorder(t *testing.T) {
+	taskSvc := &fakeTaskService{}
+	recorder := newOutputRecorder(context.Background(), taskSvc, "01TESTTASK", 2, 20)
+
+	recorder.Record(models.LogStreamStdout, "0123456789")
+	recorder.Record(models.LogStreamStderr, "abcdefghi")
+	recorder.Record(models.LogStreamStdout, "over the cap")
+	recorder.Record(models.LogStreamStdout, "dropped")
+	recorder.Close()
+
+	if len(taskSvc.entries) != 3 {
+		t.Fatalf("stored %d entries, want 3", len(taskSvc.entries))
+	}
+	for i, entry := range taskSvc.entries {
+		if entry.TaskID != "01TESTTASK" || entry.Attempt != 2 || entry.Sequence != i+1 {
+			t.Errorf("entry %d = %+v, want attempt 2 and sequence %d", i, entry, i+1)
+		}
+	}
+	if taskSvc.entries[1].Stream != models.LogStreamStderr {
+		t.Errorf("stream = %q, want stderr", taskSvc.entries[1].Stream)
+	}
+	marker := taskSvc.entries[2]
+	if marker.Level != "warn" || !strings.Contains(marker.Message, "truncated after 19 bytes") {
+		t.Errorf("marker = %+v, want a truncation warning", marker)
+	}
+}
+
+func TestOutputRecorder_SendsBatches(t *testing.T) {
+	taskSvc := &fakeTaskService{}
+	recorder := newOutputRecorder(context.Background(), taskSvc, "01TESTTASK", 1, 1<<20)
+
+	for i := 0; i < logBatchSize+1; i++ {
+		recorder.Record(models.LogStreamStdout, fmt.Sprintf("line %d", i))
+	}
+	recorder.Close()
+	// Output recorded after Close is not sent
+	recorder.Record(models.LogStreamStdout, "late")
+
+	taskSvc.mu.Lock()
+	defer taskSvc.mu.Unlock()
+	if len(taskSvc.entries) != logBatchSize+1 {
+		t.Fatalf("stored %d entries, want %d", len(taskSvc.entries), logBatchSize+1)
+	}
+	if taskSvc.batches < 2 || taskSvc.batches > logBatchSize {
+		t.Errorf("sent %d batches, want the output sent a batch at a time", taskSvc.batches)
+	}
+	for i, entry := range taskSvc.entries {
+		if entry.Sequence != i+1 {
+			t.Fatalf("entry %d has sequence %d, want the batches sent in order", i, entry.Sequence)
+		}
+	}
+}
+
+func TestOutputRecorder_SendsLastOutputAfterCancel(t *testing.T) {
+	taskSvc := &fakeTaskService{}
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder := newOutputRecorder(ctx, taskSvc, "01TESTTASK", 1, 1<<20)
+
+	recorder.Record(models.LogStreamStderr, "fatal: out of memory")
+	// The task is aborted before the recorder is closed
+	cancel()
+	recorder.Close()
+
+	taskSvc.mu.Lock()
+	defer taskSvc.mu.Unlock()
+	if len(taskSvc.entries) != 1 || taskSvc.entries[0].Message != "fatal: out of memory" {
+		t.Errorf("entries = %+v, want the last line stored", taskSvc.entries)
+	}
+}
+
+func TestExecute_RecordsAmpOutput(t *testing.T) {
+	processor, taskSvc, _, _ := newTestProcessor(t, nil)
+
+	processor.Execute(context.Background())
+
+	if len(taskSvc.entries) != 2 {
+		t.Fatalf("stored %d output entries, want 2", len(taskSvc.entries))
+	}
+	if entry := taskSvc.entries[0]; entry.Message != "Editing main.go" || entry.Attempt != 1 || entry.Stream != models.LogStreamStdout {
+		t.Errorf("first entry = %+v, want stdout from attempt 1", entry)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package worker
+
+import "os/exec"
+
+// setProcessGroup kills only the process itself on platforms without process groups
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = processWaitDelay
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processAlive reports whether pid is running (zombies count as dead)
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+func TestExecutePrompt_CancelKillsProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("requires /proc")
+	}
+
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "child.pid")
+	ampPath := writeFakeAmp(t, dir, `sleep 60 &
+echo $! > "`+pidFile+`"
+wait
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewAmpOperations(ampPath).ExecutePrompt(ctx, dir, "do things", PromptOptions{})
+		done <- err
+	}()
+
+	// Wait for the fake Amp to spawn its child
+	var childPID int
+	deadline := time.Now().Add(5 * time.Second)
+	for childPID == 0 && time.Now().Before(deadline) {
+		if data, err := os.ReadFile(pidFile); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			childPID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if childPID == 0 {
+		cancel()
+		t.Fatal("fake amp never started its child process")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error from a cancelled Amp run")
+		}
+	case <-time.After(processWaitDelay + 5*time.Second):
+		t.Fatal("ExecutePrompt did not return after cancellation")
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for processAlive(childPID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if processAlive(childPID) {
+		t.Errorf("child process %d survived cancellation", childPID)
+	}
+}
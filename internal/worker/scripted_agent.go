@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// scriptedAgent is a deterministic stand-in for a coding agent: each run
+// applies the next patch from its script with git apply, whatever the prompt.
+// It lets the whole worker pipeline run without a real agent installed.
+type scriptedAgent struct {
+	mu      sync.Mutex
+	patches []string
+	runs    int
+}
+
+// NewScriptedAgent creates an agent that applies patches in order, one per run
+func NewScriptedAgent(patches []string) (AmpOperations, error) {
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no scripted patches configured")
+	}
+
+	absPatches := make([]string, len(patches))
+	for i, patch := range patches {
+		abs, err := filepath.Abs(patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve patch %s: %w", patch, err)
+		}
+		absPatches[i] = abs
+	}
+
+	return &scriptedAgent{patches: absPatches}, nil
+}
+
+// CheckInstallation verifies that every patch in the script exists
+func (s *scriptedAgent) CheckInstallation() error {
+	for _, patch := range s.patches {
+		if _, err := os.Stat(patch); err != nil {
+			return fmt.Errorf("scripted patch not found: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateThread reports that the scripted agent keeps no conversation
+func (s *scriptedAgent) CreateThread(ctx context.Context, repoDir string, env []string) (string, error) {
+	return "", ErrThreadsUnsupported
+}
+
+// ExecutePrompt applies the next patch in the script to repoDir
+func (s *scriptedAgent) ExecutePrompt(ctx context.Context, repoDir, prompt string, opts PromptOptions) (*AmpResult, error) {
+	result := &AmpResult{}
+
+	s.mu.Lock()
+	run := s.runs
+	s.runs++
+	s.mu.Unlock()
+
+	if run >= len(s.patches) {
+		result.Message = fmt.Sprintf("Scripted agent has no patch for run %d", run+1)
+		return result, nil
+	}
+	patch := s.patches[run]
+
+	var combined syncBuffer
+	stdout := newLineWriter(models.LogStreamStdout, opts.OnOutput, &combined)
+	stderr := newLineWriter(models.LogStreamStderr, opts.OnOutput, &combined)
+	fmt.Fprintf(stdout, "Applying %s\n", filepath.Base(patch))
+
+	cmd := exec.CommandContext(ctx, "git", "apply", "--whitespace=nowarn", patch)
+	cmd.Dir = repoDir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	result.Output = combined.String()
+
+	if err != nil {
+		result.Error = fmt.Errorf("failed to apply %s: %w", filepath.Base(patch), err)
+		result.Message = fmt.Sprintf("Scripted agent failed: %s", strings.TrimSpace(result.Output))
+		return result, result.Error
+	}
+
+	changedFiles, err := detectChangedFiles(repoDir)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to detect changed files: %w", err)
+		return result, result.Error
+	}
+
+	result.FilesChanged = changedFiles
+	result.Success = len(changedFiles) > 0
+	result.Message = fmt.Sprintf("Applied %s, %d files changed", filepath.Base(patch), len(changedFiles))
+
+	return result, nil
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+)
+
+// helloPatch adds hello.txt to a repository
+const helloPatch = `diff --git a/hello.txt b/hello.txt
+new file mode 100644
+--- /dev/null
++++ b/hello.txt
+@@ -0,0 +1 @@
++hello from the scripted agent
+`
+
+func TestScriptedAgent_AppliesPatchesInOrder(t *testing.T) {
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+
+	patch := filepath.Join(t.TempDir(), "hello.patch")
+	os.WriteFile(patch, []byte(helloPatch), 0644)
+
+	agent, err := NewScriptedAgent([]string{patch})
+	if err != nil {
+		t.Fatalf("NewScriptedAgent() error = %v", err)
+	}
+	if err := agent.CheckInstallation(); err != nil {
+		t.Fatalf("CheckInstallation() error = %v", err)
+	}
+
+	result, err := agent.ExecutePrompt(context.Background(), repoDir, "say hello", PromptOptions{})
+	if err != nil {
+		t.Fatalf("ExecutePrompt() error = %v", err)
+	}
+	if !result.Success || len(result.FilesChanged) != 1 || result.FilesChanged[0] != "hello.txt" {
+		t.Errorf("result = %+v, want hello.txt changed", result)
+	}
+
+	// The script has run out of patches
+	result, err = agent.ExecutePrompt(context.Background(), repoDir, "again", PromptOptions{})
+	if err != nil || result.Success {
+		t.Errorf("second run = %+v, %v, want an unsuccessful result", result, err)
+	}
+}
+
+func TestWorker_EndToEndWithScriptedAgent(t *testing.T) {
+	origin := newOriginRepo(t)
+	patch := filepath.Join(t.TempDir(), "hello.patch")
+	os.WriteFile(patch, []byte(helloPatch), 0644)
+
+	taskSvc := &fakeTaskService{}
+	w := New(&Config{
+		MaxConcurrency:  1,
+		WorkDir:         t.TempDir(),
+		WorkerID:        "worker-1",
+		Agent:           AgentScripted,
+		ScriptedPatches: []string{patch},
+		RepoHosts:       localRepoHosts(),
+	}, taskSvc)
+	task := &models.Task{
+		ID:     "01E2ETASK",
+		Repo:   origin,
+		Branch: "amp/01E2E",
+		Prompt: "Say hello in hello.txt",
+		Status: models.TaskStatusRunning,
+	}
+
+	w.semaphore <- struct{}{}
+	w.processTask(task)
+
+	if task.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (summary: %s, logs: %v)", task.Status, task.Summary, taskSvc.logs)
+	}
+	if got := runGit(t, origin, "show", "amp/01E2E:hello.txt"); got != "hello from the scripted agent" {
+		t.Errorf("pushed hello.txt = %q, want the patched content", got)
+	}
+	if message := runGit(t, origin, "log", "-1", "--format=%s", "amp/01E2E"); !strings.Contains(message, "Say hello") {
+		t.Errorf("commit message = %q, want the task prompt", message)
+	}
+}
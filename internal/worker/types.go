@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
 )
 
 // Config holds worker configuration
@@ -17,41 +18,142 @@ type Config struct {
 	WorkDir string
 	// Amp CLI binary path
 	AmpPath string
+	// Agent that runs tasks which do not name one (default: amp)
+	Agent string
+	// Command line run by the "command" agent
+	AgentCommand string
+	// Patch files applied in order by the "scripted" agent, one per run
+	ScriptedPatches []string
+	// Setup and verification commands by repository, for repositories
+	// without their own .ampx.json
+	RepoHooks []RepoHooks
+	// Identity, signing and messages of the worker's commits, for
+	// repositories that do not override them
+	Commit CommitSettings
 	// GitHub token for API access
 	GitHubToken string
+	// GitHub API base URL (empty for github.com)
+	GitHubAPIURL string
+	// GitHub App ID, used instead of GitHubToken when set
+	GitHubAppID string
+	// Path to the GitHub App's PEM private key
+	GitHubPrivateKeyPath string
+	// GitLab token for API and git access to GitLab repositories
+	GitLabToken string
+	// Instance URL of self-managed GitLab, e.g. https://gitlab.example.com;
+	// repositories on gitlab.com are recognised without it
+	GitLabURL string
+	// Bitbucket user whose app password is BitbucketToken; empty when
+	// BitbucketToken is an access token
+	BitbucketUsername string
+	// Bitbucket Cloud app password or access token
+	BitbucketToken string
+	// Self-hosted repository hosts and the provider running each, in addition
+	// to github.com, gitlab.com, bitbucket.org and the GitLab and GitHub
+	// Enterprise instances configured above; its local entry allows
+	// repositories on the local filesystem
+	RepoHosts repourl.Hosts
 	// Database configuration
 	DatabasePath string
+	// Maximum number of Amp attempts before a task needs review, unless the task sets its own
+	MaxRetries int
+	// Delay before retrying a task whose CI failed; zero retries right away
+	RetryDelay time.Duration
+	// How the retry delay grows with each attempt: fixed or exponential
+	RetryBackoff string
+	// Upper bound of the retry delay (default: 30m)
+	MaxRetryDelay time.Duration
+	// Fraction by which each retry delay is randomly spread, e.g. 0.2 for ±20%
+	RetryJitter float64
+	// CI provider that verifies pushed commits: github-actions, gitlab-ci,
+	// local or none (default: the CI of the task's code host when access to
+	// it is configured)
+	CIProvider string
+	// Commands run by the local CI provider in the task's workspace
+	CICommands []string
+	// Interval between CI status checks
+	CIPollInterval time.Duration
+	// Maximum time to wait for CI to finish on a pushed commit
+	CITimeout time.Duration
+	// How long a pushed commit may go without CI runs on the code host before
+	// the repository is taken to have no CI
+	CIStartTimeout time.Duration
+	// Identifies this worker in task leases
+	WorkerID string
+	// How long a claimed task stays leased without a heartbeat
+	LeaseDuration time.Duration
+	// How often running tasks are checked for an abort
+	AbortCheckInterval time.Duration
+	// Maximum bytes of agent output stored in task logs per attempt
+	MaxStoredOutput int
+	// Maximum total size of the repository mirror cache in bytes
+	MirrorCacheSize int64
+	// Maximum wall-clock time of one agent run (default: 30m)
+	AgentTimeout time.Duration
+	// Maximum CPU time of one agent run (0 for no limit)
+	CPULimit time.Duration
+	// Maximum memory of one agent run in bytes (0 for no limit)
+	MemoryLimit int64
+	// Maximum bytes of output of one agent run (0 for no limit)
+	OutputLimit int64
+	// Writable cgroup v2 directory under which each run gets its own cgroup;
+	// empty uses rlimits for the CPU and memory limits
+	CgroupRoot string
+}
+
+// ResourceLimits bounds a process run by the worker. Zero values mean no limit.
+type ResourceLimits struct {
+	WallClock  time.Duration
+	CPUTime    time.Duration
+	Memory     int64
+	Output     int64
+	CgroupRoot string
 }
 
 // Worker represents a task processing worker
 type Worker struct {
-	config   *Config
-	taskSvc  TaskService
-	ctx      context.Context
-	cancel   context.CancelFunc
-	semaphore chan struct{}
+	config      *Config
+	taskSvc     TaskService
+	ctx         context.Context
+	cancel      context.CancelFunc
+	semaphore   chan struct{}
+	tokens      TokenSource
+	askpassPath string
+	mirrors     *MirrorCache
 }
 
 // TaskService interface for task operations
 type TaskService interface {
-	GetNextTask(ctx context.Context) (*models.Task, error)
+	ClaimNextTask(ctx context.Context, workerID string, leaseDuration time.Duration) (*models.Task, error)
+	RenewLease(ctx context.Context, taskID, workerID string, leaseDuration time.Duration) error
+	ReleaseTask(ctx context.Context, taskID, workerID string) error
+	ReapExpiredTasks(ctx context.Context, maxAttempts int) (int, error)
 	UpdateTaskStatus(ctx context.Context, taskID string, status string) error
-	UpdateTaskModel(ctx context.Context, task *models.Task) error
+	ReportTask(ctx context.Context, task *models.Task, workerID string) error
+	GetTaskStatus(ctx context.Context, taskID string) (models.TaskStatus, error)
 	AddTaskLog(ctx context.Context, taskID string, level, message string) error
+	AddTaskLogEntries(ctx context.Context, taskID string, entries []*models.TaskLog) error
+	SaveTaskDiff(ctx context.Context, diff *models.TaskDiff) error
 }
 
 // TaskProcessor handles individual task execution
 type TaskProcessor struct {
-	task    *models.Task
-	config  *Config
-	taskSvc TaskService
-	workDir string
+	task       *models.Task
+	config     *Config
+	taskSvc    TaskService
+	workDir    string
+	gitOps     GitOperations
+	ampOps     AmpOperations
+	githubOps  GitHubOperations
+	ciProvider CIProvider
 }
 
 // ExecutionResult represents the result of task execution
 type ExecutionResult struct {
 	Success   bool
+	Status    models.TaskStatus
 	Message   string
+	Summary   string
 	BranchURL string
 	PRURL     string
 	Logs      []string
@@ -62,14 +164,34 @@ type ExecutionResult struct {
 type GitOperations interface {
 	CloneRepository(ctx context.Context, repoURL, destDir string) error
 	CreateBranch(ctx context.Context, repoDir, branchName string) error
-	CommitChanges(ctx context.Context, repoDir, message string) error
+	CheckoutRemoteBranch(ctx context.Context, repoDir, branchName string) (bool, error)
+	CommitChanges(ctx context.Context, repoDir, message string, settings CommitSettings) error
+	SquashBranch(ctx context.Context, repoDir, branchName, baseRef, message string, settings CommitSettings) (int, error)
 	PushBranch(ctx context.Context, repoDir, branchName string) error
 	GetRemoteURL(ctx context.Context, repoDir string) (string, error)
+	GetLastCommitHash(ctx context.Context, repoDir string) (string, error)
+	CaptureDiff(ctx context.Context, repoDir, baseRef string) (*models.TaskDiff, error)
+}
+
+// OutputFunc receives agent output one line at a time, tagged with its stream
+type OutputFunc func(stream, line string)
+
+// PromptOptions holds per-run settings for ExecutePrompt
+type PromptOptions struct {
+	// Extra environment variables, overriding the worker's own
+	Env []string
+	// Receives output lines as they are produced (optional)
+	OnOutput OutputFunc
+	// Amp thread to continue; empty runs a one-off conversation
+	ThreadID string
+	// Limits on the agent process
+	Limits ResourceLimits
 }
 
 // AmpOperations interface for Amp CLI operations
 type AmpOperations interface {
-	ExecutePrompt(ctx context.Context, repoDir, prompt string) (*AmpResult, error)
+	ExecutePrompt(ctx context.Context, repoDir, prompt string, opts PromptOptions) (*AmpResult, error)
+	CreateThread(ctx context.Context, repoDir string, env []string) (string, error)
 	CheckInstallation() error
 }
 
@@ -82,19 +204,48 @@ type AmpResult struct {
 	Error       error
 }
 
-// GitHubOperations interface for GitHub API operations
+// GitHubOperations interface for code host API operations, implemented for
+// GitHub, for GitLab and for Bitbucket Cloud, where pull requests are merge
+// requests on GitLab and workflow runs are pipelines
 type GitHubOperations interface {
 	CreatePullRequest(ctx context.Context, repoURL, baseBranch, headBranch, title, body string) (string, error)
 	GetPullRequestStatus(ctx context.Context, prURL string) (string, error)
 	GetWorkflowRuns(ctx context.Context, repoURL, branchName string) ([]WorkflowRun, error)
+	GetWorkflowRunLogs(ctx context.Context, repoURL string, runID int64) (string, error)
 }
 
-// WorkflowRun represents a GitHub Actions workflow run
+// WorkflowRun represents a CI run: a GitHub Actions workflow run, a GitLab or
+// Bitbucket pipeline, or one command of the local CI provider
 type WorkflowRun struct {
 	ID         int64
+	Name       string
+	HeadBranch string
+	HeadSHA    string
 	Status     string
 	Conclusion string
 	HTMLURL    string
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
+
+// WorkflowJob represents a job within a GitHub Actions workflow run
+type WorkflowJob struct {
+	ID         int64
+	RunID      int64
+	Name       string
+	Status     string
+	Conclusion string
+	HTMLURL    string
+}
+
+// PullRequest represents a GitHub pull request
+type PullRequest struct {
+	Number         int
+	HTMLURL        string
+	State          string
+	Merged         bool
+	Mergeable      *bool
+	MergeableState string
+	HeadBranch     string
+	BaseBranch     string
+}
@@ -2,22 +2,53 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+const (
+	// defaultMaxRetries is used when the config does not set MaxRetries
+	defaultMaxRetries = 3
+	// defaultCIPollInterval is used when the config does not set CIPollInterval
+	defaultCIPollInterval = 15 * time.Second
+	// defaultCITimeout is used when the config does not set CITimeout
+	defaultCITimeout = 30 * time.Minute
+	// defaultCIStartTimeout is used when the config does not set CIStartTimeout
+	defaultCIStartTimeout = 5 * time.Minute
+	// defaultAbortCheckInterval is used when the config does not set AbortCheckInterval
+	defaultAbortCheckInterval = 5 * time.Second
+	// defaultLeaseDuration is used when the config does not set LeaseDuration
+	defaultLeaseDuration = 2 * time.Minute
+	// defaultMaxStoredOutput is used when the config does not set MaxStoredOutput
+	defaultMaxStoredOutput = 1 << 20
+	// defaultMirrorCacheSize is used when the config does not set MirrorCacheSize
+	defaultMirrorCacheSize = 10 << 30
+	// defaultAgentTimeout is used when the config does not set AgentTimeout
+	defaultAgentTimeout = 30 * time.Minute
+	// ciLogExcerptLimit caps how much of the failing CI logs is fed back to Amp
+	ciLogExcerptLimit = 4000
 )
 
 // New creates a new worker instance
 func New(config *Config, taskSvc TaskService) *Worker {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
 	// Create semaphore for concurrency control
 	semaphore := make(chan struct{}, config.MaxConcurrency)
-	
+
+	if config.WorkerID == "" {
+		config.WorkerID = defaultWorkerID()
+	}
+
 	return &Worker{
 		config:    config,
 		taskSvc:   taskSvc,
@@ -30,16 +61,26 @@ func New(config *Config, taskSvc TaskService) *Worker {
 // Start begins the worker's main loop
 func (w *Worker) Start() error {
 	log.Printf("Worker starting with max concurrency: %d", w.config.MaxConcurrency)
-	
+
 	// Ensure working directory exists
 	if err := os.MkdirAll(w.config.WorkDir, 0755); err != nil {
 		return fmt.Errorf("failed to create work directory: %w", err)
 	}
-	
+
+	if err := w.setupGitHubAuth(); err != nil {
+		return fmt.Errorf("failed to set up GitHub authentication: %w", err)
+	}
+
+	// Tasks clone from per-repository mirrors shared by every task on this work directory
+	w.mirrors = NewMirrorCache(filepath.Join(w.config.WorkDir, "mirrors"), w.config.mirrorCacheSize())
+
+	// Recover tasks left behind by workers that died mid-task
+	go w.reapExpiredTasks()
+
 	// Start the main polling loop
 	ticker := time.NewTicker(w.config.PollInterval)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-w.ctx.Done():
@@ -64,18 +105,18 @@ func (w *Worker) pollForTasks() error {
 	// Try to acquire semaphore for concurrency control
 	select {
 	case w.semaphore <- struct{}{}:
-		// Got semaphore, check for task
-		task, err := w.taskSvc.GetNextTask(w.ctx)
+		// Got semaphore, try to claim a task
+		task, err := w.taskSvc.ClaimNextTask(w.ctx, w.config.WorkerID, w.config.leaseDuration())
 		if err != nil {
 			<-w.semaphore // Release semaphore
-			return fmt.Errorf("failed to get next task: %w", err)
+			return fmt.Errorf("failed to claim next task: %w", err)
 		}
-		
+
 		if task == nil {
 			<-w.semaphore // Release semaphore, no task available
 			return nil
 		}
-		
+
 		// Process task in goroutine
 		go w.processTask(task)
 		return nil
@@ -88,160 +129,896 @@ func (w *Worker) pollForTasks() error {
 // processTask handles execution of a single task
 func (w *Worker) processTask(task *models.Task) {
 	defer func() { <-w.semaphore }() // Release semaphore when done
-	
-	log.Printf("Processing task %d: %s", task.ID, task.Prompt)
-	
-	// Update task status to running
-	if err := w.taskSvc.UpdateTaskStatus(w.ctx, task.ID, "running"); err != nil {
-		log.Printf("Failed to update task status to running: %v", err)
+
+	log.Printf("Processing task %s: %s", task.ID, task.Prompt)
+
+	// Keep the lease alive while the task runs; losing it cancels the task
+	taskCtx, cancelTask := context.WithCancel(w.ctx)
+	defer cancelTask()
+	leaseLost := make(chan struct{})
+	go w.heartbeat(taskCtx, task, cancelTask, leaseLost)
+
+	// Stop work as soon as the user aborts the task
+	aborted := make(chan struct{})
+	go w.watchForAbort(taskCtx, task, cancelTask, aborted)
+
+	// Log task start
+	w.taskSvc.AddTaskLog(w.ctx, task.ID, "info", fmt.Sprintf("Task processing started by worker %s", w.config.WorkerID))
+
+	// Create task processor; a task whose agent cannot be created fails without running
+	var result *ExecutionResult
+	processor, err := w.newTaskProcessor(task)
+	if err != nil {
+		result = &ExecutionResult{Status: models.TaskStatusError, Error: err}
+	} else {
+		// Execute the task
+		result = processor.Execute(taskCtx)
+
+		// Clean up working directory
+		defer func() {
+			if err := os.RemoveAll(processor.workDir); err != nil {
+				log.Printf("Failed to clean up work directory: %v", err)
+			}
+		}()
+	}
+	cancelTask()
+
+	// The task now belongs to the reaper (or another worker), so leave it alone
+	if isClosed(leaseLost) {
+		log.Printf("Lease on task %s was lost; discarding result", task.ID)
 		return
 	}
-	
-	// Log task start
-	w.taskSvc.AddTaskLog(w.ctx, task.ID, "info", "Task processing started")
-	
-	// Create task processor
-	processor := &TaskProcessor{
-		task:    task,
-		config:  w.config,
-		taskSvc: w.taskSvc,
-		workDir: w.generateWorkDir(task),
+
+	// The abort is already recorded; keep the attempt count and give the task up
+	if isClosed(aborted) || result.Status == models.TaskStatusAborted {
+		log.Printf("Task %s aborted by user", task.ID)
+		w.taskSvc.AddTaskLog(w.ctx, task.ID, "warn", "Task aborted by user")
+		task.Status = models.TaskStatusAborted
+		if err := w.taskSvc.ReportTask(w.ctx, task, w.config.WorkerID); err != nil {
+			log.Printf("Failed to update task: %v", err)
+		}
+		if err := w.taskSvc.ReleaseTask(w.ctx, task.ID, w.config.WorkerID); err != nil {
+			log.Printf("Failed to release task %s: %v", task.ID, err)
+		}
+		return
 	}
-	
-	// Execute the task
-	result := processor.Execute(w.ctx)
-	
+
 	// Update task based on result
-	if result.Success {
-		task.Status = "completed"
+	task.Status = result.Status
+	if result.Summary != "" {
+		task.Summary = result.Summary
+	}
+	if result.BranchURL != "" {
 		task.BranchURL = result.BranchURL
+	}
+	if result.PRURL != "" {
 		task.PRURL = result.PRURL
+	}
+	switch result.Status {
+	case models.TaskStatusSuccess:
 		w.taskSvc.AddTaskLog(w.ctx, task.ID, "info", "Task completed successfully")
-	} else {
-		task.Status = "failed"
+	case models.TaskStatusNeedsReview:
+		w.taskSvc.AddTaskLog(w.ctx, task.ID, "warn", result.Summary)
+	case models.TaskStatusRetrying:
+		w.taskSvc.AddTaskLog(w.ctx, task.ID, "info", result.Message)
+	default:
 		errorMsg := "Task failed"
 		if result.Error != nil {
 			errorMsg = result.Error.Error()
 		}
+		task.Summary = errorMsg
 		w.taskSvc.AddTaskLog(w.ctx, task.ID, "error", errorMsg)
 	}
-	
+
 	// Update task in database
-	if err := w.taskSvc.UpdateTaskModel(w.ctx, task); err != nil {
+	if err := w.taskSvc.ReportTask(w.ctx, task, w.config.WorkerID); err != nil {
 		log.Printf("Failed to update task: %v", err)
 	}
-	
-	// Clean up working directory
-	if err := os.RemoveAll(processor.workDir); err != nil {
-		log.Printf("Failed to clean up work directory: %v", err)
+
+	if err := w.taskSvc.ReleaseTask(w.ctx, task.ID, w.config.WorkerID); err != nil {
+		log.Printf("Failed to release task %s: %v", task.ID, err)
+	}
+
+	log.Printf("Task %s completed with status: %s", task.ID, task.Status)
+}
+
+// heartbeat renews the task's lease until ctx is done. If the lease cannot be
+// renewed because another party took the task, it closes leaseLost and cancels the task.
+func (w *Worker) heartbeat(ctx context.Context, task *models.Task, cancelTask context.CancelFunc, leaseLost chan<- struct{}) {
+	leaseDuration := w.config.leaseDuration()
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.taskSvc.RenewLease(ctx, task.ID, w.config.WorkerID, leaseDuration)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, services.ErrLeaseLost) {
+				log.Printf("Lost lease on task %s; stopping", task.ID)
+				close(leaseLost)
+				cancelTask()
+				return
+			}
+			// Transient failures are retried on the next tick, before the lease runs out
+			log.Printf("Failed to renew lease on task %s: %v", task.ID, err)
+		}
 	}
-	
-	log.Printf("Task %d completed with status: %s", task.ID, task.Status)
+}
+
+// watchForAbort polls the task's status until ctx is done. When the task is
+// aborted it closes aborted and cancels the task, killing any running Amp process.
+func (w *Worker) watchForAbort(ctx context.Context, task *models.Task, cancelTask context.CancelFunc, aborted chan<- struct{}) {
+	ticker := time.NewTicker(w.config.abortCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			status, err := w.taskSvc.GetTaskStatus(ctx, task.ID)
+			if err != nil {
+				log.Printf("Failed to check status of task %s: %v", task.ID, err)
+				continue
+			}
+			if status == models.TaskStatusAborted {
+				log.Printf("Task %s was aborted; stopping", task.ID)
+				close(aborted)
+				cancelTask()
+				return
+			}
+		}
+	}
+}
+
+// isClosed reports whether ch has been closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// reapExpiredTasks periodically requeues tasks whose worker stopped heartbeating
+func (w *Worker) reapExpiredTasks() {
+	ticker := time.NewTicker(w.config.leaseDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			reaped, err := w.taskSvc.ReapExpiredTasks(w.ctx, w.config.maxRetries())
+			if err != nil {
+				log.Printf("Error reaping expired tasks: %v", err)
+				continue
+			}
+			if reaped > 0 {
+				log.Printf("Recovered %d task(s) with expired leases", reaped)
+			}
+		}
+	}
+}
+
+// setupGitHubAuth selects the GitHub credentials the worker uses: installation
+// tokens when a GitHub App is configured, otherwise the static token. Git
+// authenticates through the askpass script whenever GitHub, GitLab or
+// Bitbucket credentials are configured.
+func (w *Worker) setupGitHubAuth() error {
+	switch {
+	case w.config.GitHubAppID != "":
+		tokens, err := NewAppTokenSource(w.config.GitHubAppID, w.config.GitHubPrivateKeyPath, w.config.GitHubAPIURL)
+		if err != nil {
+			return err
+		}
+		w.tokens = tokens
+		log.Printf("Using GitHub App %s for authentication", w.config.GitHubAppID)
+	case w.config.GitHubToken != "":
+		w.tokens = NewStaticTokenSource(w.config.GitHubToken)
+	}
+	if w.tokens == nil && w.config.GitLabToken == "" && w.config.BitbucketToken == "" {
+		return nil
+	}
+
+	askpassPath, err := WriteAskpassScript(filepath.Join(w.config.WorkDir, ".bin"))
+	if err != nil {
+		return err
+	}
+	w.askpassPath = askpassPath
+
+	return nil
+}
+
+// newTaskProcessor creates a processor for the task wired to the real Git
+// operations, to GitHub, GitLab or Bitbucket by the repository's host and to
+// the agent the task asks for
+func (w *Worker) newTaskProcessor(task *models.Task) (*TaskProcessor, error) {
+	agent, err := NewAgent(task.Agent, w.config)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := w.config.repoHosts().Parse(task.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	gitOps := &gitOperations{mirrors: w.mirrors}
+	processor := &TaskProcessor{
+		task:    task,
+		config:  w.config,
+		taskSvc: w.taskSvc,
+		workDir: w.generateWorkDir(task),
+		gitOps:  gitOps,
+		ampOps:  agent,
+	}
+
+	// Pull requests and authenticated git require access to the code host
+	// the task's repository lives on; local repositories have neither
+	switch ref.Provider {
+	case repourl.ProviderGitLab:
+		if w.config.GitLabToken != "" {
+			processor.githubOps = NewGitLabOperations(w.config.GitLabToken, w.config.GitLabURL)
+			gitOps.askpassPath = w.askpassPath
+			gitOps.credentials = w.gitLabCredentials()
+		}
+	case repourl.ProviderBitbucket:
+		if w.config.BitbucketToken != "" {
+			processor.githubOps = NewBitbucketOperations(w.config.BitbucketUsername, w.config.BitbucketToken)
+			gitOps.askpassPath = w.askpassPath
+			gitOps.credentials = w.bitbucketCredentials()
+		}
+	case repourl.ProviderGitHub:
+		if w.tokens != nil {
+			processor.githubOps = NewGitHubOperationsWithTokenSource(w.tokens, w.config.GitHubAPIURL)
+			gitOps.askpassPath = w.askpassPath
+			gitOps.credentials = w.gitCredentials(task)
+		}
+	}
+
+	processor.ciProvider, err = NewCIProvider(w.config.CIProvider, w.config, processor.githubOps)
+	if err != nil {
+		return nil, err
+	}
+
+	return processor, nil
+}
+
+// repoHosts returns the hosts task repositories may live on: the well-known
+// hosts, the configured self-hosted hosts and the hosts of the configured
+// GitLab and GitHub Enterprise instances
+func (c *Config) repoHosts() repourl.Hosts {
+	hosts := repourl.DefaultHosts()
+	for host, provider := range c.RepoHosts {
+		hosts[host] = provider
+	}
+	// An invalid instance URL fails the code host's API calls instead
+	_ = hosts.AddInstance(c.GitLabURL, repourl.ProviderGitLab)
+	_ = hosts.AddInstance(c.GitHubAPIURL, repourl.ProviderGitHub)
+	return hosts
+}
+
+// gitCredentials returns credentials for git operations on the task's repository
+func (w *Worker) gitCredentials(task *models.Task) GitCredentials {
+	return func(ctx context.Context) (string, string, error) {
+		owner, repo, err := parseGitHubRepoURL(task.Repo)
+		if err != nil {
+			return "", "", err
+		}
+
+		token, err := w.tokens.Token(ctx, owner, repo)
+		if err != nil {
+			return "", "", err
+		}
+
+		return "x-access-token", token, nil
+	}
+}
+
+// gitLabCredentials returns credentials for git operations on GitLab, which
+// accepts an access token as the password of the oauth2 user
+func (w *Worker) gitLabCredentials() GitCredentials {
+	return func(ctx context.Context) (string, string, error) {
+		return "oauth2", w.config.GitLabToken, nil
+	}
+}
+
+// bitbucketCredentials returns credentials for git operations on Bitbucket:
+// the app password's user, or the fixed user of access tokens
+func (w *Worker) bitbucketCredentials() GitCredentials {
+	return func(ctx context.Context) (string, string, error) {
+		if w.config.BitbucketUsername != "" {
+			return w.config.BitbucketUsername, w.config.BitbucketToken, nil
+		}
+		return "x-token-auth", w.config.BitbucketToken, nil
+	}
+}
+
+// defaultWorkerID identifies the worker by host and process
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
 
 // generateWorkDir creates a unique working directory for the task
 func (w *Worker) generateWorkDir(task *models.Task) string {
 	timestamp := time.Now().Format("20060102-150405")
-	dirName := fmt.Sprintf("task-%d-%s", task.ID, timestamp)
+	dirName := fmt.Sprintf("task-%s-%s", task.ID, timestamp)
 	return filepath.Join(w.config.WorkDir, dirName)
 }
 
-// Execute processes the task through the complete workflow
+// Execute processes the task through the complete workflow: it runs Amp,
+// pushes the result and waits for CI, feeding CI failures back into Amp
+// until CI is green or the retry budget is exhausted.
 func (tp *TaskProcessor) Execute(ctx context.Context) *ExecutionResult {
 	result := &ExecutionResult{
 		Success: false,
+		Status:  models.TaskStatusError,
 		Logs:    []string{},
 	}
-	
+
 	// Step 1: Create working directory
 	if err := os.MkdirAll(tp.workDir, 0755); err != nil {
 		result.Error = fmt.Errorf("failed to create work directory: %w", err)
 		return result
 	}
-	
+
+	// Give Amp its own HOME, TMPDIR and XDG directories inside the workspace
+	env, err := taskEnvironment(tp.workDir)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
 	// Step 2: Clone repository
 	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Cloning repository...")
-	fmt.Printf("DEBUG: About to clone repository %s to %s\n", tp.task.Repo, tp.workDir)
-	gitOps := NewGitOperations()
 	repoDir := filepath.Join(tp.workDir, "repo")
-	
-	if err := gitOps.CloneRepository(ctx, tp.task.Repo, repoDir); err != nil {
-		fmt.Printf("DEBUG: Clone failed: %v\n", err)
+
+	if err := tp.gitOps.CloneRepository(ctx, tp.task.Repo, repoDir); err != nil {
 		result.Error = fmt.Errorf("failed to clone repository: %w", err)
 		return result
 	}
-	fmt.Printf("DEBUG: Clone successful\n")
-	
-	// Step 3: Create feature branch
-	branchName := fmt.Sprintf("amp-task-%d", tp.task.ID)
-	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Creating branch: %s", branchName))
-	
-	if err := gitOps.CreateBranch(ctx, repoDir, branchName); err != nil {
-		result.Error = fmt.Errorf("failed to create branch: %w", err)
-		return result
+
+	// Step 3: Check out the task's branch, building on earlier pushes when
+	// the task is retried or continued
+	if tp.task.Branch == "" {
+		tp.task.Branch = fmt.Sprintf("amp-task-%s", tp.task.ID)
 	}
-	
-	// Step 4: Execute Amp prompt
-	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Executing Amp prompt...")
-	fmt.Printf("DEBUG: About to execute Amp with prompt: %s\n", tp.task.Prompt)
-	ampOps := NewAmpOperations(tp.config.AmpPath)
-	
-	ampResult, err := ampOps.ExecutePrompt(ctx, repoDir, tp.task.Prompt)
+	branchName := tp.task.Branch
+
+	existing, err := tp.gitOps.CheckoutRemoteBranch(ctx, repoDir, branchName)
 	if err != nil {
-		fmt.Printf("DEBUG: Amp execution failed: %v\n", err)
-		result.Error = fmt.Errorf("amp execution failed: %w", err)
+		result.Error = fmt.Errorf("failed to check out branch: %w", err)
 		return result
 	}
-	
-	fmt.Printf("DEBUG: Amp execution completed. Success: %v, Message: %s\n", ampResult.Success, ampResult.Message)
-	if !ampResult.Success {
-		result.Error = fmt.Errorf("amp execution unsuccessful: %s", ampResult.Message)
+	if existing {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Continuing on existing branch: %s", branchName))
+	} else if tp.task.BaseBranch != "" {
+		// A stacked task starts from the branch of the task it depends on
+		found, err := tp.gitOps.CheckoutRemoteBranch(ctx, repoDir, tp.task.BaseBranch)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to check out base branch: %w", err)
+			return result
+		}
+		if !found {
+			result.Error = fmt.Errorf("base branch %s not found on the remote", tp.task.BaseBranch)
+			return result
+		}
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Creating branch: %s (stacked on %s)", branchName, tp.task.BaseBranch))
+
+		if err := tp.gitOps.CreateBranch(ctx, repoDir, branchName); err != nil {
+			result.Error = fmt.Errorf("failed to create branch: %w", err)
+			return result
+		}
+	} else {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Creating branch: %s", branchName))
+
+		if err := tp.gitOps.CreateBranch(ctx, repoDir, branchName); err != nil {
+			result.Error = fmt.Errorf("failed to create branch: %w", err)
+			return result
+		}
+	}
+
+	remoteURL, err := tp.gitOps.GetRemoteURL(ctx, repoDir)
+	if err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to determine remote URL: %v", err))
+	}
+	if remoteURL != "" {
+		result.BranchURL = fmt.Sprintf("%s/tree/%s", remoteURL, branchName)
+	}
+
+	// Keep every attempt in one Amp thread so Amp remembers the earlier ones
+	if !tp.ensureThread(ctx, repoDir, env) {
+		result.Status = models.TaskStatusAborted
 		return result
 	}
-	
-	// Step 5: Commit changes
-	commitMsg := fmt.Sprintf("Amp task %d: %s", tp.task.ID, truncateString(tp.task.Prompt, 50))
-	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Committing changes...")
-	
-	if err := gitOps.CommitChanges(ctx, repoDir, commitMsg); err != nil {
-		result.Error = fmt.Errorf("failed to commit changes: %w", err)
+
+	// Prepare the workspace and find the commands that check each agent run
+	hooks, err := tp.loadHooks(repoDir)
+	if err != nil {
+		result.Error = err
 		return result
 	}
-	
-	// Step 6: Push branch
-	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Pushing branch...")
-	
-	if err := gitOps.PushBranch(ctx, repoDir, branchName); err != nil {
-		result.Error = fmt.Errorf("failed to push branch: %w", err)
+	commit := tp.config.Commit.merge(hooks.Commit)
+	if err := commit.Validate(); err != nil {
+		result.Error = fmt.Errorf("invalid commit settings: %w", err)
 		return result
 	}
-	
-	// Step 7: Create pull request (if GitHub integration is available)
-	remoteURL, err := gitOps.GetRemoteURL(ctx, repoDir)
-	if err == nil && tp.config.GitHubToken != "" {
-		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Creating pull request...")
-		
-		githubOps := NewGitHubOperations(tp.config.GitHubToken)
-		prTitle := fmt.Sprintf("Amp Task: %s", truncateString(tp.task.Prompt, 50))
-		prBody := fmt.Sprintf("Automated changes generated by Amp.\n\nOriginal prompt: %s", tp.task.Prompt)
-		
-		prURL, err := githubOps.CreatePullRequest(ctx, remoteURL, "main", branchName, prTitle, prBody)
+
+	// Each attempt's output is sent by its own recorder, closed once the
+	// attempt is over. The setup commands run as part of the first attempt,
+	// so they share its recorder and its log sequence.
+	recorder := newOutputRecorder(ctx, tp.taskSvc, tp.task.ID, tp.task.Attempts+1, tp.config.maxStoredOutput())
+	defer func() {
+		recorder.Close()
+	}()
+
+	if len(hooks.Setup) > 0 {
+		failure, err := tp.runHooks(ctx, "setup", hooks.Setup, repoDir, env, recorder)
 		if err != nil {
-			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to create PR: %v", err))
-		} else {
-			result.PRURL = prURL
-			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Pull request created: %s", prURL))
+			result.Error = fmt.Errorf("task cancelled: %w", err)
+			return result
+		}
+		if failure != nil {
+			result.Error = fmt.Errorf("setup command %q failed: %v", failure.Command, failure.Err)
+			return result
 		}
 	}
-	
-	// Generate branch URL
-	if remoteURL != "" {
-		result.BranchURL = fmt.Sprintf("%s/tree/%s", remoteURL, branchName)
+
+	maxRetries := tp.maxRetries()
+	originalPrompt := tp.task.Prompt
+	prompt := originalPrompt
+	// A task resuming after its retry backoff carries on from the CI failure
+	if tp.task.NextPrompt != "" {
+		prompt = tp.task.NextPrompt
+	}
+
+	for {
+		// Step 4: Execute Amp prompt
+		tp.task.IncrementAttempts()
+		attempt := tp.task.Attempts
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Executing Amp prompt (attempt %d/%d)...", attempt, maxRetries))
+
+		if recorder.attempt != attempt {
+			recorder.Close()
+			recorder = newOutputRecorder(ctx, tp.taskSvc, tp.task.ID, attempt, tp.config.maxStoredOutput())
+		}
+		ampResult, err := tp.ampOps.ExecutePrompt(ctx, repoDir, prompt, PromptOptions{
+			Env:      env,
+			OnOutput: recorder.Record,
+			ThreadID: tp.task.ThreadID,
+			Limits:   tp.config.limits(),
+		})
+
+		// Never commit or push the work of a cancelled run
+		if ctx.Err() != nil {
+			result.Error = fmt.Errorf("task cancelled: %w", ctx.Err())
+			return result
+		}
+		var limitErr *LimitExceededError
+		if errors.As(err, &limitErr) {
+			result.Error = fmt.Errorf("agent stopped: %w", limitErr)
+			return result
+		}
+		if err != nil {
+			result.Error = fmt.Errorf("amp execution failed: %w", err)
+			return result
+		}
+		if !ampResult.Success {
+			result.Error = fmt.Errorf("amp execution unsuccessful: %s", ampResult.Message)
+			return result
+		}
+		tp.task.NextPrompt = ""
+
+		// Step 5: Verify the changes before spending a CI run on them; a
+		// failure goes straight back to the agent without pushing
+		if len(hooks.Verify) > 0 {
+			failure, err := tp.runHooks(ctx, "verification", hooks.Verify, repoDir, env, recorder)
+			if err != nil {
+				result.Error = fmt.Errorf("task cancelled: %w", err)
+				return result
+			}
+			if failure != nil {
+				if attempt >= maxRetries {
+					result.Status = models.TaskStatusNeedsReview
+					result.Message = "Maximum retries reached"
+					result.Summary = fmt.Sprintf("Verification still failing after %d attempts (max retries hit); nothing pushed; last failing command: %s", attempt, failure.Command)
+					return result
+				}
+
+				prompt = buildVerifyFailurePrompt(failure)
+				if tp.task.ThreadID == "" {
+					prompt = fmt.Sprintf("%s\n\n%s", originalPrompt, prompt)
+				}
+				tp.task.NextPrompt = prompt
+				if !tp.saveProgress(ctx) {
+					result.Status = models.TaskStatusAborted
+					return result
+				}
+				tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Retrying with verification output (attempt %d/%d)", attempt+1, maxRetries))
+				continue
+			}
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Verification passed")
+		}
+
+		// Step 6: Commit changes
+		commitMsg, err := commit.message(tp.commitMessageData(attempt, originalPrompt, branchName, ampResult.Message))
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Committing changes...")
+
+		if err := tp.gitOps.CommitChanges(ctx, repoDir, commitMsg, commit); err != nil {
+			result.Error = fmt.Errorf("failed to commit changes: %w", err)
+			return result
+		}
+		// Squash the attempts before pushing, so CI runs on the commit the
+		// pull request is opened with; a continued task's pull request keeps
+		// the history under review
+		if commit.squash() && tp.task.PRURL == "" {
+			tp.squashBranch(ctx, repoDir, branchName, commitMsg, commit)
+		}
+		tp.recordDiff(ctx, repoDir, attempt)
+
+		// Step 7: Push branch
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Pushing branch...")
+
+		if err := tp.gitOps.PushBranch(ctx, repoDir, branchName); err != nil {
+			result.Error = fmt.Errorf("failed to push branch: %w", err)
+			return result
+		}
+
+		// Without a CI provider there is no CI to wait for
+		if tp.ciProvider == nil {
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", "No CI provider configured, skipping CI verification")
+			result.Success = true
+			result.Status = models.TaskStatusSuccess
+			result.Message = "Task completed successfully"
+			return result
+		}
+
+		sha, err := tp.gitOps.GetLastCommitHash(ctx, repoDir)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to get pushed commit: %w", err)
+			return result
+		}
+
+		// Step 8: Wait for CI on the pushed commit
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Waiting for CI (%s) on %s...", tp.ciProvider.Name(), shortSHA(sha)))
+
+		target := CITarget{
+			RepoURL: remoteURL,
+			RepoDir: repoDir,
+			Branch:  branchName,
+			SHA:     sha,
+			Env:     env,
+		}
+		runs, err := tp.ciProvider.WaitForRuns(ctx, target)
+		if err != nil {
+			result.Error = fmt.Errorf("failed waiting for CI: %w", err)
+			return result
+		}
+		// A repository without workflows or pipelines is treated as having no CI
+		if len(runs) == 0 {
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("No CI runs started on %s, skipping CI verification", shortSHA(sha)))
+			result.Success = true
+			result.Status = models.TaskStatusSuccess
+			result.Message = "Task completed successfully"
+			return result
+		}
+
+		failed := failedRuns(runs)
+		reported := runs[0]
+		if len(failed) > 0 {
+			reported = failed[0]
+		}
+		runID := reported.ID
+		tp.task.CIRunID = &runID
+
+		if len(failed) == 0 {
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("CI passed (run %d)", runID))
+			// A continued task already has a PR, which the push has updated
+			switch {
+			case tp.task.PRURL != "":
+				result.PRURL = tp.task.PRURL
+			case tp.githubOps != nil && remoteURL != "":
+				result.PRURL = tp.createPullRequest(ctx, remoteURL, branchName, originalPrompt)
+			}
+			result.Success = true
+			result.Status = models.TaskStatusSuccess
+			result.Message = "Task completed successfully"
+			result.Summary = fmt.Sprintf("CI passed after %d attempt(s)", attempt)
+			return result
+		}
+
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("CI failed (run %d: %s)", runID, reported.Conclusion))
+
+		if attempt >= maxRetries {
+			result.Status = models.TaskStatusNeedsReview
+			result.Message = "Maximum retries reached"
+			result.Summary = fmt.Sprintf("CI still failing after %d attempts (max retries hit); last failing run: %s", attempt, runDescription(reported))
+			return result
+		}
+
+		// Step 9: Feed the failure back to Amp and retry
+		logs := tp.collectFailureLogs(ctx, target, failed)
+		prompt = buildCIFailurePrompt(logs)
+		if tp.task.ThreadID == "" {
+			// Without a thread Amp starts from scratch, so restate the task
+			prompt = fmt.Sprintf("%s\n\n%s", originalPrompt, prompt)
+		}
+
+		tp.task.NextPrompt = prompt
+		tp.task.Status = models.TaskStatusRetrying
+
+		// Wait out the backoff without holding on to the task; whichever
+		// worker claims it once next_run_at has passed runs the next attempt
+		if delay := tp.config.retryDelay(attempt); delay > 0 {
+			nextRunAt := time.Now().Add(delay)
+			tp.task.NextRunAt = &nextRunAt
+			result.Status = models.TaskStatusRetrying
+			result.Message = fmt.Sprintf("Retrying with CI failure logs; next attempt in %s (attempt %d/%d)", formatDelay(delay), attempt+1, maxRetries)
+			return result
+		}
+
+		if !tp.saveProgress(ctx) {
+			result.Status = models.TaskStatusAborted
+			return result
+		}
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Retrying with CI failure logs (attempt %d/%d)", attempt+1, maxRetries))
+
+		tp.task.Status = models.TaskStatusRunning
+		if !tp.saveProgress(ctx) {
+			result.Status = models.TaskStatusAborted
+			return result
+		}
+	}
+}
+
+// commitMessageData describes the commit of an attempt to message templates
+func (tp *TaskProcessor) commitMessageData(attempt int, prompt, branchName, summary string) commitMessageData {
+	subject, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	return commitMessageData{
+		TaskID:  tp.task.ID,
+		Attempt: attempt,
+		Subject: truncateString(strings.TrimSpace(subject), 50),
+		Prompt:  prompt,
+		Summary: summary,
+		Repo:    tp.task.Repo,
+		Branch:  branchName,
+	}
+}
+
+// baseRef returns the remote branch the task's branch started from: the
+// branch it is stacked on, or the repository's default branch
+func (tp *TaskProcessor) baseRef() string {
+	if tp.task.BaseBranch != "" {
+		return "origin/" + tp.task.BaseBranch
+	}
+	return "origin/HEAD"
+}
+
+// recordDiff stores what the branch changes against its base as of this
+// attempt. The diff is only there for people reviewing the task, so failing
+// to record it never fails the attempt.
+func (tp *TaskProcessor) recordDiff(ctx context.Context, repoDir string, attempt int) {
+	diff, err := tp.gitOps.CaptureDiff(ctx, repoDir, tp.baseRef())
+	if err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to capture diff: %v", err))
+		return
+	}
+	diff.TaskID = tp.task.ID
+	diff.Attempt = attempt
+
+	if err := tp.taskSvc.SaveTaskDiff(ctx, diff); err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to save diff: %v", err))
+		return
+	}
+	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Recorded diff: %d file(s) changed, +%d -%d", len(diff.Files), diff.Additions, diff.Deletions))
+}
+
+// squashBranch squashes the task's commits into one with the message of the
+// latest attempt and force-pushes it. A failed squash puts the branch back
+// with every attempt's commit, which the push that follows sends as is.
+func (tp *TaskProcessor) squashBranch(ctx context.Context, repoDir, branchName, message string, commit CommitSettings) {
+	squashed, err := tp.gitOps.SquashBranch(ctx, repoDir, branchName, tp.baseRef(), message, commit)
+	if err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to squash commits: %v", err))
+		return
+	}
+	if squashed > 0 {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Squashed %d commits into one", squashed))
+	}
+}
+
+// ensureThread makes sure the task has an Amp thread, creating one on the
+// first run. If the Amp CLI cannot create threads the task runs without one.
+// It returns false if the task was aborted while saving the new thread.
+func (tp *TaskProcessor) ensureThread(ctx context.Context, repoDir string, env []string) bool {
+	if isAmpThreadID(tp.task.ThreadID) {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Continuing Amp thread %s", tp.task.ThreadID))
+		return true
+	}
+	tp.task.ThreadID = ""
+
+	threadID, err := tp.ampOps.CreateThread(ctx, repoDir, env)
+	if errors.Is(err, ErrThreadsUnsupported) {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", "Agent does not support threads; each attempt starts a new conversation")
+		return true
+	}
+	if err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to create Amp thread, each attempt starts a new conversation: %v", err))
+		return true
+	}
+
+	tp.task.ThreadID = threadID
+	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Created Amp thread %s", threadID))
+	return tp.saveProgress(ctx)
+}
+
+// isAmpThreadID reports whether id refers to a real Amp thread rather than
+// being empty or a placeholder from before threads were supported
+func isAmpThreadID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, "thread-")
+}
+
+// saveProgress persists the task mid-run. It returns false if the task was
+// aborted or its lease lost in the meantime and the run should stop.
+func (tp *TaskProcessor) saveProgress(ctx context.Context) bool {
+	err := tp.taskSvc.ReportTask(ctx, tp.task, tp.config.WorkerID)
+	if errors.Is(err, services.ErrTaskAborted) || errors.Is(err, services.ErrLeaseLost) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to update task %s: %v", tp.task.ID, err)
+	}
+	return true
+}
+
+// collectFailureLogs fetches and concatenates the logs of the failed runs
+func (tp *TaskProcessor) collectFailureLogs(ctx context.Context, target CITarget, runs []WorkflowRun) string {
+	var sb strings.Builder
+	for _, run := range runs {
+		logs, err := tp.ciProvider.FailureLogs(ctx, target, run)
+		if err != nil {
+			tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to fetch logs for run %d: %v", run.ID, err))
+			continue
+		}
+		fmt.Fprintf(&sb, "== %s ==\n%s\n", runDescription(run), logs)
+	}
+	return sb.String()
+}
+
+// createPullRequest opens a pull request for the branch, returning its URL or
+// an empty string if it could not be created
+func (tp *TaskProcessor) createPullRequest(ctx context.Context, remoteURL, branchName, prompt string) string {
+	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", "Creating pull request...")
+
+	prTitle := fmt.Sprintf("Amp Task: %s", truncateString(prompt, 50))
+	prBody := fmt.Sprintf("Automated changes generated by Amp.\n\nOriginal prompt: %s", prompt)
+
+	// An empty base branch targets the repository's default branch; a
+	// stacked task's pull request targets its dependency's branch
+	prURL, err := tp.githubOps.CreatePullRequest(ctx, remoteURL, tp.task.BaseBranch, branchName, prTitle, prBody)
+	if err != nil {
+		tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "warn", fmt.Sprintf("Failed to create PR: %v", err))
+		return ""
+	}
+
+	tp.taskSvc.AddTaskLog(ctx, tp.task.ID, "info", fmt.Sprintf("Pull request created: %s", prURL))
+	return prURL
+}
+
+// maxRetries returns the task's attempt budget, falling back to the worker's
+func (tp *TaskProcessor) maxRetries() int {
+	if tp.task.MaxRetries > 0 {
+		return tp.task.MaxRetries
+	}
+	return tp.config.maxRetries()
+}
+
+// maxRetries returns the configured retry budget
+func (c *Config) maxRetries() int {
+	if c.MaxRetries > 0 {
+		return c.MaxRetries
+	}
+	return defaultMaxRetries
+}
+
+// mirrorCacheSize returns the size budget of the repository mirror cache
+func (c *Config) mirrorCacheSize() int64 {
+	if c.MirrorCacheSize > 0 {
+		return c.MirrorCacheSize
+	}
+	return defaultMirrorCacheSize
+}
+
+// limits returns the resource limits applied to each agent run
+func (c *Config) limits() ResourceLimits {
+	limits := ResourceLimits{
+		WallClock:  c.AgentTimeout,
+		CPUTime:    c.CPULimit,
+		Memory:     c.MemoryLimit,
+		Output:     c.OutputLimit,
+		CgroupRoot: c.CgroupRoot,
+	}
+	if limits.WallClock <= 0 {
+		limits.WallClock = defaultAgentTimeout
+	}
+	return limits
+}
+
+// abortCheckInterval returns how often a running task's status is checked for an abort
+func (c *Config) abortCheckInterval() time.Duration {
+	if c.AbortCheckInterval > 0 {
+		return c.AbortCheckInterval
+	}
+	return defaultAbortCheckInterval
+}
+
+// maxStoredOutput returns how many bytes of agent output are stored per attempt
+func (c *Config) maxStoredOutput() int {
+	if c.MaxStoredOutput > 0 {
+		return c.MaxStoredOutput
+	}
+	return defaultMaxStoredOutput
+}
+
+// leaseDuration returns how long a claimed task stays leased without a heartbeat
+func (c *Config) leaseDuration() time.Duration {
+	if c.LeaseDuration > 0 {
+		return c.LeaseDuration
+	}
+	return defaultLeaseDuration
+}
+
+// buildCIFailurePrompt builds the continuation prompt sent to Amp after a CI failure
+func buildCIFailurePrompt(logs string) string {
+	logs = strings.TrimSpace(logs)
+	// The end of the logs is where the failure is reported, so keep the tail
+	if len(logs) > ciLogExcerptLimit {
+		logs = logs[len(logs)-ciLogExcerptLimit:]
+	}
+	return fmt.Sprintf("CI failed:\n```\n%s\n```\nFix and retry.", logs)
+}
+
+// shortSHA abbreviates a commit hash for display
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// formatDelay formats a retry delay for the task log, e.g. "45s", "4m" or "1h30m"
+func formatDelay(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
 	}
-	
-	result.Success = true
-	result.Message = "Task completed successfully"
-	return result
 }
 
 // truncateString truncates a string to the specified length
@@ -0,0 +1,637 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettsmith212/ci-test-2/internal/models"
+	"github.com/brettsmith212/ci-test-2/internal/repourl"
+	"github.com/brettsmith212/ci-test-2/internal/services"
+)
+
+func newTestProcessor(t *testing.T, github *fakeGitHubOps) (*TaskProcessor, *fakeTaskService, *fakeGitOps, *fakeAmpOps) {
+	t.Helper()
+
+	taskSvc := &fakeTaskService{}
+	gitOps := &fakeGitOps{}
+	ampOps := &fakeAmpOps{}
+
+	processor := &TaskProcessor{
+		task: &models.Task{
+			ID:     "01TESTTASK",
+			Repo:   "https://github.com/acme/api.git",
+			Branch: "amp/01TEST",
+			Prompt: "Migrate Mocha tests to Vitest",
+			Status: models.TaskStatusRunning,
+		},
+		config: &Config{
+			MaxRetries:     3,
+			CIPollInterval: time.Millisecond,
+			CITimeout:      time.Second,
+		},
+		taskSvc: taskSvc,
+		workDir: t.TempDir(),
+		gitOps:  gitOps,
+		ampOps:  ampOps,
+	}
+	if github != nil {
+		processor.githubOps = github
+		processor.ciProvider = NewGitHubActionsCI(github, processor.config)
+	}
+
+	return processor, taskSvc, gitOps, ampOps
+}
+
+func TestExecute_CIGreenOnFirstAttempt(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"success"}}
+	processor, _, gitOps, _ := newTestProcessor(t, github)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if result.PRURL != "https://github.com/acme/api/pull/7" {
+		t.Errorf("PRURL = %q, want the created pull request", result.PRURL)
+	}
+	if processor.task.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", processor.task.Attempts)
+	}
+	if processor.task.CIRunID == nil || *processor.task.CIRunID != 101 {
+		t.Errorf("CIRunID = %v, want 101", processor.task.CIRunID)
+	}
+	if gitOps.pushes != 1 {
+		t.Errorf("pushes = %d, want 1", gitOps.pushes)
+	}
+	if len(github.logRequests) != 0 {
+		t.Errorf("fetched logs for %v, want none on green CI", github.logRequests)
+	}
+}
+
+func TestExecute_RetriesWithCIFailureLogs(t *testing.T) {
+	github := &fakeGitHubOps{
+		conclusions: []string{"failure", "success"},
+		logs:        "--- FAIL: TestLogin\n    login_test.go:42: expected 200, got 500",
+	}
+	processor, taskSvc, gitOps, ampOps := newTestProcessor(t, github)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if processor.task.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", processor.task.Attempts)
+	}
+	if len(ampOps.prompts) != 2 {
+		t.Fatalf("Amp ran %d times, want 2", len(ampOps.prompts))
+	}
+	if ampOps.prompts[0] != "Migrate Mocha tests to Vitest" {
+		t.Errorf("first prompt = %q, want the task prompt", ampOps.prompts[0])
+	}
+	retryPrompt := ampOps.prompts[1]
+	if !strings.HasPrefix(retryPrompt, "CI failed:") || !strings.Contains(retryPrompt, "login_test.go:42") {
+		t.Errorf("retry prompt = %q, want CI failure logs", retryPrompt)
+	}
+	if len(github.logRequests) != 1 || github.logRequests[0] != 101 {
+		t.Errorf("log requests = %v, want [101]", github.logRequests)
+	}
+	if gitOps.pushes != 2 {
+		t.Errorf("pushes = %d, want 2", gitOps.pushes)
+	}
+	if !strings.Contains(gitOps.commits[1], "Migrate Mocha tests") {
+		t.Errorf("retry commit message = %q, want the original prompt", gitOps.commits[1])
+	}
+
+	sawRetrying := false
+	for _, status := range taskSvc.statuses {
+		if status == models.TaskStatusRetrying {
+			sawRetrying = true
+		}
+	}
+	if !sawRetrying {
+		t.Errorf("statuses = %v, want a retrying update", taskSvc.statuses)
+	}
+}
+
+func TestExecute_SquashesAttemptsBeforePullRequest(t *testing.T) {
+	// sha-1 is the first attempt, sha-2 the second attempt's commit before
+	// it is squashed into sha-3; only sha-1 and sha-3 are ever pushed
+	github := &fakeGitHubOps{conclusions: []string{"failure", "failure", "success"}}
+	processor, _, gitOps, _ := newTestProcessor(t, github)
+	squash := true
+	processor.config.Commit = CommitSettings{
+		Template:  "fix: {{.Subject}}",
+		CoAuthors: []string{"Dana Reviewer <dana@example.com>"},
+		Squash:    &squash,
+	}
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(gitOps.squashedOnto) != 2 || gitOps.squashedOnto[1] != "origin/HEAD" {
+		t.Errorf("squashed onto %v, want the default branch before each push", gitOps.squashedOnto)
+	}
+	if processor.task.CIRunID == nil || *processor.task.CIRunID != 103 {
+		t.Errorf("CIRunID = %v, want CI waited for on the squashed commit", processor.task.CIRunID)
+	}
+	want := "fix: Migrate Mocha tests to Vitest\n\nTask-ID: 01TESTTASK\nCo-authored-by: Dana Reviewer <dana@example.com>"
+	if len(gitOps.commits) != 1 || gitOps.commits[0] != want {
+		t.Errorf("commits = %q, want one commit %q", gitOps.commits, want)
+	}
+	if result.PRURL == "" {
+		t.Error("PRURL is empty, want the pull request opened after squashing")
+	}
+}
+
+func TestExecute_RecordsDiffOfEachAttempt(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}}
+	processor, taskSvc, gitOps, _ := newTestProcessor(t, github)
+	processor.task.BaseBranch = "amp/01PARENT"
+	gitOps.remote = map[string]bool{"amp/01PARENT": true}
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(taskSvc.diffs) != 2 {
+		t.Fatalf("recorded %d diffs, want one per attempt", len(taskSvc.diffs))
+	}
+	for i, diff := range taskSvc.diffs {
+		if diff.TaskID != "01TESTTASK" || diff.Attempt != i+1 || diff.BaseRef != "origin/amp/01PARENT" {
+			t.Errorf("diff %d = task %s attempt %d against %s, want attempt %d against the stacked branch", i, diff.TaskID, diff.Attempt, diff.BaseRef, i+1)
+		}
+	}
+	if diff := taskSvc.diffs[1]; diff.HeadSHA != "sha-2" || diff.Additions != 2 {
+		t.Errorf("second diff = %+v, want the branch as of the second commit", diff)
+	}
+}
+
+func TestExecute_NeedsReviewAfterMaxRetries(t *testing.T) {
+	github := &fakeGitHubOps{
+		conclusions: []string{"failure", "failure", "failure"},
+		logs:        "build failed",
+	}
+	processor, _, _, ampOps := newTestProcessor(t, github)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusNeedsReview {
+		t.Fatalf("Status = %s, want needs_review (error: %v)", result.Status, result.Error)
+	}
+	if processor.task.Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", processor.task.Attempts)
+	}
+	if len(ampOps.prompts) != 3 {
+		t.Errorf("Amp ran %d times, want 3", len(ampOps.prompts))
+	}
+	if !strings.Contains(result.Summary, "max retries") {
+		t.Errorf("Summary = %q, want a max retries summary", result.Summary)
+	}
+	if len(github.prs) != 0 {
+		t.Errorf("created PRs %v, want none while CI is red", github.prs)
+	}
+}
+
+func TestExecute_TaskMaxRetriesOverridesConfig(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "failure", "failure"}, logs: "build failed"}
+	processor, _, _, ampOps := newTestProcessor(t, github)
+	processor.task.MaxRetries = 2
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusNeedsReview {
+		t.Fatalf("Status = %s, want needs_review (error: %v)", result.Status, result.Error)
+	}
+	if len(ampOps.prompts) != 2 {
+		t.Errorf("Amp ran %d times, want the task's 2 attempts", len(ampOps.prompts))
+	}
+}
+
+func TestExecute_SchedulesRetryAfterBackoff(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}, logs: "build failed"}
+	processor, _, gitOps, ampOps := newTestProcessor(t, github)
+	processor.config.RetryDelay = time.Minute
+	processor.config.RetryBackoff = BackoffFixed
+
+	before := time.Now()
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusRetrying {
+		t.Fatalf("Status = %s, want retrying (error: %v)", result.Status, result.Error)
+	}
+	if !strings.Contains(result.Message, "next attempt in 1m (attempt 2/3)") {
+		t.Errorf("Message = %q, want the scheduled attempt", result.Message)
+	}
+	if len(ampOps.prompts) != 1 || gitOps.pushes != 1 {
+		t.Errorf("Amp ran %d times with %d pushes, want one attempt before handing the task back", len(ampOps.prompts), gitOps.pushes)
+	}
+
+	task := processor.task
+	if task.NextRunAt == nil || task.NextRunAt.Before(before.Add(time.Minute)) {
+		t.Errorf("NextRunAt = %v, want a minute from now", task.NextRunAt)
+	}
+	if !strings.HasPrefix(task.NextPrompt, "CI failed:") {
+		t.Errorf("NextPrompt = %q, want the CI failure prompt", task.NextPrompt)
+	}
+	if task.Prompt != "Migrate Mocha tests to Vitest" {
+		t.Errorf("Prompt = %q, want the original prompt kept", task.Prompt)
+	}
+
+	// The worker that claims the task next carries on from the CI failure
+	task.NextRunAt = nil
+	task.Status = models.TaskStatusRunning
+	result = processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(ampOps.prompts) != 2 || !strings.HasPrefix(ampOps.prompts[1], "CI failed:") {
+		t.Errorf("prompts = %q, want the resumed attempt to use the CI failure prompt", ampOps.prompts)
+	}
+	if task.Attempts != 2 || task.NextPrompt != "" {
+		t.Errorf("Attempts = %d, NextPrompt = %q, want 2 attempts and the prompt consumed", task.Attempts, task.NextPrompt)
+	}
+	if !strings.Contains(gitOps.commits[1], "attempt 2") {
+		t.Errorf("retry commit message = %q, want attempt 2", gitOps.commits[1])
+	}
+}
+
+func TestExecute_CreatesAndReusesAmpThread(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}, logs: "build failed"}
+	processor, taskSvc, _, ampOps := newTestProcessor(t, github)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if ampOps.created != 1 {
+		t.Errorf("created %d threads, want 1", ampOps.created)
+	}
+	for i, threadID := range ampOps.threadIDs {
+		if threadID != "T-fake-1" {
+			t.Errorf("attempt %d ran in thread %q, want T-fake-1", i+1, threadID)
+		}
+	}
+	if len(taskSvc.updated) == 0 || taskSvc.updated[0].ThreadID != "T-fake-1" {
+		t.Errorf("saved tasks = %+v, want the thread ID persisted first", taskSvc.updated)
+	}
+}
+
+func TestExecute_ContinuesExistingThread(t *testing.T) {
+	processor, _, _, ampOps := newTestProcessor(t, nil)
+	processor.task.ThreadID = "T-existing"
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if ampOps.created != 0 {
+		t.Errorf("created %d threads, want the existing one reused", ampOps.created)
+	}
+	if len(ampOps.threadIDs) != 1 || ampOps.threadIDs[0] != "T-existing" {
+		t.Errorf("thread IDs = %v, want [T-existing]", ampOps.threadIDs)
+	}
+}
+
+func TestExecute_WithoutThreadSupport(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}, logs: "build failed"}
+	processor, taskSvc, _, ampOps := newTestProcessor(t, github)
+	ampOps.noThreads = true
+	// Placeholder IDs from before threads were supported are not real threads
+	processor.task.ThreadID = "thread-01TESTTA"
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	for i, threadID := range ampOps.threadIDs {
+		if threadID != "" {
+			t.Errorf("attempt %d ran in thread %q, want none", i+1, threadID)
+		}
+	}
+	if processor.task.ThreadID != "" {
+		t.Errorf("ThreadID = %q, want the placeholder cleared", processor.task.ThreadID)
+	}
+	// Without a thread the retry has to restate the task
+	if retryPrompt := ampOps.prompts[1]; !strings.HasPrefix(retryPrompt, "Migrate Mocha tests to Vitest") || !strings.Contains(retryPrompt, "CI failed:") {
+		t.Errorf("retry prompt = %q, want the task prompt and the CI failure", retryPrompt)
+	}
+
+	warned := false
+	for _, entry := range taskSvc.logs {
+		if strings.Contains(entry, "does not support threads") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("logs = %v, want a warning about missing thread support", taskSvc.logs)
+	}
+}
+
+func TestExecute_UsesTaskBranch(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"success"}}
+	processor, _, gitOps, _ := newTestProcessor(t, github)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(gitOps.created) != 1 || gitOps.created[0] != "amp/01TEST" {
+		t.Errorf("created branches %v, want [amp/01TEST]", gitOps.created)
+	}
+	if len(gitOps.pushedTo) != 1 || gitOps.pushedTo[0] != "amp/01TEST" {
+		t.Errorf("pushed to %v, want [amp/01TEST]", gitOps.pushedTo)
+	}
+	if len(github.prs) != 1 || github.prs[0] != "amp/01TEST" {
+		t.Errorf("PR head branches %v, want [amp/01TEST]", github.prs)
+	}
+	if result.BranchURL != "https://github.com/acme/api/tree/amp/01TEST" {
+		t.Errorf("BranchURL = %q, want the task branch", result.BranchURL)
+	}
+}
+
+func TestExecute_ContinuesOnExistingBranch(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"success"}}
+	processor, _, gitOps, _ := newTestProcessor(t, github)
+	gitOps.remote = map[string]bool{"amp/01TEST": true}
+	processor.task.Attempts = 1
+	processor.task.PRURL = "https://github.com/acme/api/pull/3"
+	processor.task.Prompt = "restore skipped test"
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(gitOps.created) != 0 {
+		t.Errorf("created branches %v, want the pushed branch checked out", gitOps.created)
+	}
+	if len(gitOps.pushedTo) != 1 || gitOps.pushedTo[0] != "amp/01TEST" {
+		t.Errorf("pushed to %v, want [amp/01TEST]", gitOps.pushedTo)
+	}
+	if len(github.prs) != 0 {
+		t.Errorf("created PRs %v, want the existing PR reused", github.prs)
+	}
+	if result.PRURL != "https://github.com/acme/api/pull/3" {
+		t.Errorf("PRURL = %q, want the existing PR", result.PRURL)
+	}
+}
+
+func TestExecute_StacksOnBaseBranch(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"success"}}
+	processor, _, gitOps, _ := newTestProcessor(t, github)
+	gitOps.remote = map[string]bool{"amp/01PARENT": true}
+	processor.task.BaseBranch = "amp/01PARENT"
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if len(gitOps.checkedOut) != 1 || gitOps.checkedOut[0] != "amp/01PARENT" {
+		t.Errorf("checked out %v, want the base branch", gitOps.checkedOut)
+	}
+	if len(gitOps.created) != 1 || gitOps.created[0] != "amp/01TEST" {
+		t.Errorf("created branches %v, want [amp/01TEST]", gitOps.created)
+	}
+	if len(github.prBases) != 1 || github.prBases[0] != "amp/01PARENT" {
+		t.Errorf("PR base branches %v, want the pull request stacked on amp/01PARENT", github.prBases)
+	}
+
+	// Without its base branch a stacked task cannot start
+	processor, _, _, _ = newTestProcessor(t, github)
+	processor.task.BaseBranch = "amp/01GONE"
+	if result := processor.Execute(context.Background()); result.Error == nil {
+		t.Error("Execute() succeeded without the base branch")
+	}
+}
+
+func TestExecute_CITimeout(t *testing.T) {
+	// No conclusions means no workflow run ever appears for the pushed commit
+	github := &fakeGitHubOps{}
+	processor, _, _, _ := newTestProcessor(t, github)
+	processor.config.CITimeout = 20 * time.Millisecond
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusError {
+		t.Fatalf("Status = %s, want error", result.Status)
+	}
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "timed out") {
+		t.Errorf("Error = %v, want a CI timeout", result.Error)
+	}
+}
+
+func TestExecute_WithoutGitHub(t *testing.T) {
+	processor, _, gitOps, _ := newTestProcessor(t, nil)
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusSuccess {
+		t.Fatalf("Status = %s, want success (error: %v)", result.Status, result.Error)
+	}
+	if gitOps.pushes != 1 {
+		t.Errorf("pushes = %d, want 1", gitOps.pushes)
+	}
+}
+
+func TestBuildCIFailurePrompt(t *testing.T) {
+	logs := strings.Repeat("x", ciLogExcerptLimit) + "FAIL: the end"
+
+	prompt := buildCIFailurePrompt(logs)
+
+	if !strings.Contains(prompt, "FAIL: the end") {
+		t.Error("expected the tail of the logs to be kept")
+	}
+	if len(prompt) > ciLogExcerptLimit+100 {
+		t.Errorf("prompt length = %d, want the logs capped at %d", len(prompt), ciLogExcerptLimit)
+	}
+}
+
+func TestHeartbeat_RenewsLease(t *testing.T) {
+	taskSvc := &fakeTaskService{}
+	w := New(&Config{MaxConcurrency: 1, WorkerID: "worker-1", LeaseDuration: 30 * time.Millisecond}, taskSvc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	leaseLost := make(chan struct{})
+	w.heartbeat(ctx, &models.Task{ID: "01TESTTASK"}, cancel, leaseLost)
+
+	if taskSvc.renewals < 2 {
+		t.Errorf("renewals = %d, want the lease renewed repeatedly", taskSvc.renewals)
+	}
+	select {
+	case <-leaseLost:
+		t.Error("lease reported lost while renewals succeeded")
+	default:
+	}
+}
+
+func TestHeartbeat_LeaseLostCancelsTask(t *testing.T) {
+	taskSvc := &fakeTaskService{renewErr: services.ErrLeaseLost}
+	w := New(&Config{MaxConcurrency: 1, WorkerID: "worker-1", LeaseDuration: 30 * time.Millisecond}, taskSvc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	leaseLost := make(chan struct{})
+	w.heartbeat(ctx, &models.Task{ID: "01TESTTASK"}, cancel, leaseLost)
+
+	select {
+	case <-leaseLost:
+	default:
+		t.Fatal("expected the lease to be reported lost")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("task context error = %v, want canceled", ctx.Err())
+	}
+}
+
+func TestExecute_CancelledRunSkipsCommitAndPush(t *testing.T) {
+	processor, _, gitOps, ampOps := newTestProcessor(t, nil)
+	ampOps.block = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result := processor.Execute(ctx)
+
+	if result.Status != models.TaskStatusError {
+		t.Errorf("Status = %s, want error", result.Status)
+	}
+	if len(gitOps.commits) != 0 || gitOps.pushes != 0 {
+		t.Errorf("commits = %v, pushes = %d, want nothing committed or pushed", gitOps.commits, gitOps.pushes)
+	}
+}
+
+func TestExecute_ResourceLimitExceeded(t *testing.T) {
+	processor, _, gitOps, ampOps := newTestProcessor(t, nil)
+	processor.config.OutputLimit = 1 << 20
+	ampOps.err = fmt.Errorf("amp command failed: %w", &LimitExceededError{Limit: "wall-clock", Max: "30m0s"})
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusError {
+		t.Errorf("Status = %s, want error", result.Status)
+	}
+	if result.Error == nil || result.Error.Error() != "agent stopped: wall-clock limit of 30m0s exceeded" {
+		t.Errorf("Error = %v, want the exceeded limit", result.Error)
+	}
+	if len(gitOps.commits) != 0 || gitOps.pushes != 0 {
+		t.Errorf("commits = %v, pushes = %d, want nothing committed or pushed", gitOps.commits, gitOps.pushes)
+	}
+
+	// The agent runs with the configured limits and the default wall-clock limit
+	want := ResourceLimits{WallClock: defaultAgentTimeout, Output: 1 << 20}
+	if len(ampOps.limits) != 1 || ampOps.limits[0] != want {
+		t.Errorf("limits = %+v, want %+v", ampOps.limits, want)
+	}
+}
+
+func TestExecute_AbortedBetweenAttempts(t *testing.T) {
+	github := &fakeGitHubOps{conclusions: []string{"failure", "success"}, logs: "build failed"}
+	processor, taskSvc, gitOps, _ := newTestProcessor(t, github)
+	processor.task.ThreadID = "T-existing"
+	taskSvc.aborted = true
+
+	result := processor.Execute(context.Background())
+
+	if result.Status != models.TaskStatusAborted {
+		t.Fatalf("Status = %s, want aborted", result.Status)
+	}
+	if gitOps.pushes != 1 {
+		t.Errorf("pushes = %d, want no retry after the abort", gitOps.pushes)
+	}
+}
+
+func TestWatchForAbort(t *testing.T) {
+	taskSvc := &fakeTaskService{aborted: true}
+	w := New(&Config{MaxConcurrency: 1, AbortCheckInterval: 10 * time.Millisecond}, taskSvc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	aborted := make(chan struct{})
+	w.watchForAbort(ctx, &models.Task{ID: "01TESTTASK"}, cancel, aborted)
+
+	if !isClosed(aborted) {
+		t.Fatal("expected the abort to be detected")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("task context error = %v, want canceled", ctx.Err())
+	}
+}
+
+func TestNewTaskProcessor_ChoosesCodeHost(t *testing.T) {
+	config := &Config{
+		WorkDir:           t.TempDir(),
+		GitHubToken:       "gh-token",
+		GitLabToken:       "gl-token",
+		GitLabURL:         "https://gitlab.example.com",
+		BitbucketUsername: "amp-bot",
+		BitbucketToken:    "app-password",
+		RepoHosts:         repourl.Hosts{"git.example.com": repourl.ProviderGitLab},
+	}
+	w := New(config, nil)
+	if err := w.setupGitHubAuth(); err != nil {
+		t.Fatalf("setupGitHubAuth() error = %v", err)
+	}
+
+	tests := []struct {
+		repo string
+		ci   string
+	}{
+		{"https://github.com/acme/api", CIProviderGitHubActions},
+		{"https://gitlab.com/acme/api", CIProviderGitLabCI},
+		{"git@gitlab.example.com:acme/platform/api.git", CIProviderGitLabCI},
+		{"https://amp-bot@bitbucket.org/acme/api.git", CIProviderBitbucketPipelines},
+		{"ssh://git@git.example.com/acme/platform/api.git", CIProviderGitLabCI},
+	}
+
+	for _, tt := range tests {
+		processor, err := w.newTaskProcessor(&models.Task{ID: "01TESTTASK", Repo: tt.repo})
+		if err != nil {
+			t.Fatalf("newTaskProcessor(%s) error = %v", tt.repo, err)
+		}
+		if got := hostedCIProvider(processor.githubOps); got != tt.ci {
+			t.Errorf("%s: code host CI = %s, want %s", tt.repo, got, tt.ci)
+		}
+		if processor.ciProvider == nil || processor.ciProvider.Name() != tt.ci {
+			t.Errorf("%s: CI provider = %v, want %s", tt.repo, processor.ciProvider, tt.ci)
+		}
+	}
+}
+
+func TestNewTaskProcessor_RepositoryHosts(t *testing.T) {
+	w := New(&Config{WorkDir: t.TempDir(), GitHubToken: "gh-token"}, nil)
+	if err := w.setupGitHubAuth(); err != nil {
+		t.Fatalf("setupGitHubAuth() error = %v", err)
+	}
+
+	// Local repositories are refused unless the hosts allow them
+	if _, err := w.newTaskProcessor(&models.Task{ID: "01TESTTASK", Repo: "/srv/git/api.git"}); err == nil {
+		t.Error("newTaskProcessor(local) error = nil, want local repositories refused")
+	}
+	w.config.RepoHosts = localRepoHosts()
+
+	processor, err := w.newTaskProcessor(&models.Task{ID: "01TESTTASK", Repo: "/srv/git/api.git"})
+	if err != nil {
+		t.Fatalf("newTaskProcessor(local) error = %v", err)
+	}
+	if processor.githubOps != nil || processor.ciProvider != nil {
+		t.Errorf("local repository got code host %v and CI %v, want neither", processor.githubOps, processor.ciProvider)
+	}
+
+	_, err = w.newTaskProcessor(&models.Task{ID: "01TESTTASK", Repo: "git@git.example.com:acme/api.git"})
+	if err == nil || err.Error() != "unsupported repository host: git.example.com" {
+		t.Errorf("newTaskProcessor(unlisted host) error = %v, want unsupported host", err)
+	}
+}
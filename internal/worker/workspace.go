@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workerSecrets are the worker's own credentials. They are kept out of every
+// process that runs repository code, since git authenticates through the
+// askpass helper and agents bring their own keys.
+var workerSecrets = []string{
+	"WORKER_TOKEN",
+	"GITHUB_TOKEN",
+	"GH_TOKEN",
+	"GITHUB_APP_ID",
+	"GITHUB_PRIVATE_KEY_PATH",
+	"GITLAB_TOKEN",
+	"BITBUCKET_TOKEN",
+	"BITBUCKET_USERNAME",
+	"COMMIT_SIGNING_KEY",
+	"AMP_GIT_USERNAME",
+	"AMP_GIT_PASSWORD",
+}
+
+// taskEnvironment creates private HOME, TMPDIR and XDG directories under the
+// task's work directory and returns the environment overrides pointing at them,
+// so concurrent tasks never share caches, config or temp files
+func taskEnvironment(workDir string) ([]string, error) {
+	dirs := []struct {
+		key  string
+		path string
+	}{
+		{"HOME", filepath.Join(workDir, "home")},
+		{"TMPDIR", filepath.Join(workDir, "tmp")},
+		{"XDG_CONFIG_HOME", filepath.Join(workDir, "xdg", "config")},
+		{"XDG_CACHE_HOME", filepath.Join(workDir, "xdg", "cache")},
+		{"XDG_DATA_HOME", filepath.Join(workDir, "xdg", "data")},
+		{"XDG_STATE_HOME", filepath.Join(workDir, "xdg", "state")},
+	}
+
+	env := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir.path, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create %s directory: %w", dir.key, err)
+		}
+		env = append(env, dir.key+"="+dir.path)
+	}
+
+	return env, nil
+}
+
+// childEnvironment returns the worker's environment without its credentials,
+// followed by extra; later entries win, so extra can override anything
+func childEnvironment(extra ...string) []string {
+	env := make([]string, 0, len(os.Environ())+len(extra))
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if !isWorkerSecret(key) {
+			env = append(env, entry)
+		}
+	}
+	return append(env, extra...)
+}
+
+// isWorkerSecret reports whether key names one of the worker's credentials
+func isWorkerSecret(key string) bool {
+	for _, secret := range workerSecrets {
+		if key == secret {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChildEnvironment(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_secret")
+	t.Setenv("WORKER_TOKEN", "worker-secret")
+	t.Setenv("GITHUB_PRIVATE_KEY_PATH", "/etc/worker/app.pem")
+	t.Setenv("AMP_API_KEY", "amp-key")
+
+	env := childEnvironment("HOME=/work/home", "AMP_API_KEY=task-key")
+
+	values := map[string]string{}
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		values[key] = value
+	}
+	for _, secret := range []string{"GITHUB_TOKEN", "WORKER_TOKEN", "GITHUB_PRIVATE_KEY_PATH"} {
+		if _, ok := values[secret]; ok {
+			t.Errorf("childEnvironment() passes %s to the child", secret)
+		}
+	}
+	if values["HOME"] != "/work/home" {
+		t.Errorf("HOME = %q, want the extra entry", values["HOME"])
+	}
+	// Agents keep their own keys, and later entries still win
+	if env[len(env)-1] != "AMP_API_KEY=task-key" {
+		t.Errorf("childEnvironment() ends with %q, want the extra entries last", env[len(env)-1])
+	}
+}